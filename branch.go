@@ -0,0 +1,288 @@
+package git
+
+import (
+	"container/heap"
+	"errors"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/core"
+)
+
+var (
+	// ErrNoUpstream is returned when a branch has no upstream configured, or
+	// its upstream is not fetched by the refspecs of its remote.
+	ErrNoUpstream = errors.New("branch has no upstream")
+	// ErrNonFastForwardUpdate is returned by Pull when the current branch has
+	// commits not in its upstream, so it can't be fast-forwarded.
+	ErrNonFastForwardUpdate = errors.New("non-fast-forward update")
+)
+
+const (
+	branchPrefix = "refs/heads/"
+	// localRemote is the remote of the branches tracking a local branch.
+	localRemote = "."
+)
+
+// BranchStatus is the state of a branch compared with its upstream.
+type BranchStatus struct {
+	// Branch is the local branch, eg. refs/heads/master
+	Branch core.ReferenceName
+	// Upstream is the reference tracking the upstream, eg.
+	// refs/remotes/origin/master
+	Upstream core.ReferenceName
+	// Ahead is the number of commits of Branch not in Upstream
+	Ahead int
+	// Behind is the number of commits of Upstream not in Branch
+	Behind int
+}
+
+// SetUpstream sets the upstream of a local branch, the merge reference of the
+// given remote, as branch.<name>.remote and branch.<name>.merge.
+func (r *Repository) SetUpstream(branch, remote string, merge core.ReferenceName) error {
+	cfg, err := r.s.ConfigStorage().Config()
+	if err != nil {
+		return err
+	}
+
+	b, ok := cfg.Branches[branch]
+	if !ok {
+		b = &config.BranchConfig{Name: branch}
+		cfg.Branches[branch] = b
+	}
+
+	b.Remote = remote
+	b.Merge = merge
+	return r.s.ConfigStorage().SetConfig(cfg)
+}
+
+// Upstream returns the reference tracking the upstream of the given local
+// branch: the merge reference mapped by the fetch refspecs of the remote, or
+// the merge reference itself for the branches tracking a local branch.
+func (r *Repository) Upstream(branch string) (core.ReferenceName, error) {
+	cfg, err := r.s.ConfigStorage().Config()
+	if err != nil {
+		return "", err
+	}
+
+	b, ok := cfg.Branches[branch]
+	if !ok || b.Remote == "" || b.Merge == "" {
+		return "", ErrNoUpstream
+	}
+
+	if b.Remote == localRemote {
+		return b.Merge, nil
+	}
+
+	remote, ok := cfg.Remotes[b.Remote]
+	if !ok {
+		return "", config.ErrRemoteConfigNotFound
+	}
+
+	for _, rs := range remote.Fetch {
+		if rs.Match(b.Merge) {
+			return rs.Dst(b.Merge), nil
+		}
+	}
+
+	return "", ErrNoUpstream
+}
+
+// BranchStatus returns the number of commits the given local branch is ahead
+// and behind of its upstream, as git status does.
+func (r *Repository) BranchStatus(branch string) (*BranchStatus, error) {
+	upstream, err := r.Upstream(branch)
+	if err != nil {
+		return nil, err
+	}
+
+	local, err := r.Ref(core.ReferenceName(branchPrefix+branch), true)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := r.Ref(upstream, true)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &BranchStatus{Branch: local.Name(), Upstream: upstream}
+	s.Ahead, s.Behind, err = r.AheadBehind(local.Hash(), remote.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// AheadBehind returns the number of commits reachable from a and not from b,
+// and reachable from b and not from a, as git rev-list --count --left-right
+// a...b. As in git, the history is walked from the newest commits to the
+// oldest, until the rest of it is reachable from both.
+func (r *Repository) AheadBehind(a, b core.Hash) (ahead, behind int, err error) {
+	w := &paintWalker{
+		r:       r,
+		flags:   make(map[core.Hash]int, 0),
+		commits: make(map[core.Hash]*Commit, 0),
+	}
+
+	if err := w.paint(a, paintAhead); err != nil {
+		return 0, 0, err
+	}
+
+	if err := w.paint(b, paintBehind); err != nil {
+		return 0, 0, err
+	}
+
+	for w.queue.Len() > 0 && !w.done() {
+		c := heap.Pop(&w.queue).(*Commit)
+		for _, p := range c.parents {
+			if err := w.paint(p, w.flags[c.Hash]); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+
+	for _, f := range w.flags {
+		switch f {
+		case paintAhead:
+			ahead++
+		case paintBehind:
+			behind++
+		}
+	}
+
+	return ahead, behind, nil
+}
+
+// setPullUpstream sets the remote and the reference of the pull options to
+// the upstream of the current branch, if it has one. The local branch to
+// update is returned, empty if the upstream is not used.
+func (r *Repository) setPullUpstream(o *PullOptions) (core.ReferenceName, error) {
+	head, err := r.Ref(core.HEAD, false)
+	if err == core.ErrReferenceNotFound {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if head.Type() != core.SymbolicReference ||
+		!strings.HasPrefix(head.Target().String(), branchPrefix) {
+		return "", nil
+	}
+
+	cfg, err := r.s.ConfigStorage().Config()
+	if err != nil {
+		return "", err
+	}
+
+	branch := strings.TrimPrefix(head.Target().String(), branchPrefix)
+	b, ok := cfg.Branches[branch]
+	if !ok || b.Remote == "" || b.Remote == localRemote || b.Merge == "" {
+		return "", nil
+	}
+
+	o.RemoteName = b.Remote
+	o.ReferenceName = b.Merge
+	return head.Target(), nil
+}
+
+// fastForward updates a local branch to the given commit, if the branch is
+// behind it. NoErrAlreadyUpToDate is returned if the commit is already in the
+// branch and ErrNonFastForwardUpdate if the branch has commits not in it.
+func (r *Repository) fastForward(branch core.ReferenceName, h core.Hash, reflogMsg string) error {
+	ref := core.NewHashReference(branch, h)
+	current, err := r.Ref(branch, false)
+	if err == core.ErrReferenceNotFound {
+		return r.createReferences(ref, reflogMsg)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	ahead, behind, err := r.AheadBehind(current.Hash(), h)
+	if err != nil {
+		return err
+	}
+
+	if ahead > 0 {
+		return ErrNonFastForwardUpdate
+	}
+
+	if behind == 0 {
+		return NoErrAlreadyUpToDate
+	}
+
+	return r.createReferences(ref, reflogMsg)
+}
+
+const (
+	paintAhead = 1 << iota
+	paintBehind
+	paintBoth = paintAhead | paintBehind
+)
+
+// paintWalker walks the history of two commits, painting every commit with
+// the sides it's reachable from.
+type paintWalker struct {
+	r       *Repository
+	flags   map[core.Hash]int
+	commits map[core.Hash]*Commit
+	queue   commitQueue
+}
+
+// paint adds the given flags to a commit, queuing it to paint its parents if
+// the flags changed.
+func (w *paintWalker) paint(h core.Hash, flags int) error {
+	if w.flags[h]&flags == flags {
+		return nil
+	}
+
+	w.flags[h] |= flags
+	c, ok := w.commits[h]
+	if !ok {
+		var err error
+		if c, err = w.r.Commit(h); err != nil {
+			return err
+		}
+
+		w.commits[h] = c
+	}
+
+	heap.Push(&w.queue, c)
+	return nil
+}
+
+// done returns true if all the queued commits are reachable from both sides.
+func (w *paintWalker) done() bool {
+	for _, c := range w.queue {
+		if w.flags[c.Hash] != paintBoth {
+			return false
+		}
+	}
+
+	return true
+}
+
+// commitQueue is a heap of commits, the newest first.
+type commitQueue []*Commit
+
+func (q commitQueue) Len() int { return len(q) }
+
+func (q commitQueue) Less(i, j int) bool {
+	return q[i].Committer.When.After(q[j].Committer.When)
+}
+
+func (q commitQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *commitQueue) Push(x interface{}) { *q = append(*q, x.(*Commit)) }
+
+func (q *commitQueue) Pop() interface{} {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
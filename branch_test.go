@@ -0,0 +1,198 @@
+package git
+
+import (
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type BranchSuite struct {
+	BaseSuite
+}
+
+var _ = Suite(&BranchSuite{})
+
+func (s *BranchSuite) TestCloneSetsUpstream(c *C) {
+	r := NewMemoryRepository()
+	err := r.Clone(&CloneOptions{URL: RepositoryFixture})
+	c.Assert(err, IsNil)
+
+	cfg, err := r.s.ConfigStorage().Config()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Branches, HasLen, 1)
+	c.Assert(cfg.Branches["master"].Remote, Equals, DefaultRemoteName)
+	c.Assert(cfg.Branches["master"].Merge, Equals, core.ReferenceName("refs/heads/master"))
+
+	upstream, err := r.Upstream("master")
+	c.Assert(err, IsNil)
+	c.Assert(upstream, Equals, core.ReferenceName("refs/remotes/origin/master"))
+
+	status, err := r.BranchStatus("master")
+	c.Assert(err, IsNil)
+	c.Assert(status, DeepEquals, &BranchStatus{
+		Branch:   "refs/heads/master",
+		Upstream: "refs/remotes/origin/master",
+	})
+}
+
+func (s *BranchSuite) TestCloneSingleBranchSetsUpstream(c *C) {
+	r := NewMemoryRepository()
+	err := r.Clone(&CloneOptions{
+		URL:           RepositoryFixture,
+		RemoteName:    "foo",
+		ReferenceName: "refs/heads/branch",
+		SingleBranch:  true,
+	})
+	c.Assert(err, IsNil)
+
+	upstream, err := r.Upstream("branch")
+	c.Assert(err, IsNil)
+	c.Assert(upstream, Equals, core.ReferenceName("refs/remotes/foo/branch"))
+
+	_, err = r.Upstream("master")
+	c.Assert(err, Equals, ErrNoUpstream)
+}
+
+func (s *BranchSuite) TestUpstream(c *C) {
+	r := NewMemoryRepository()
+	_, err := r.Upstream("master")
+	c.Assert(err, Equals, ErrNoUpstream)
+
+	err = r.SetUpstream("master", ".", "refs/heads/develop")
+	c.Assert(err, IsNil)
+
+	upstream, err := r.Upstream("master")
+	c.Assert(err, IsNil)
+	c.Assert(upstream, Equals, core.ReferenceName("refs/heads/develop"))
+
+	err = r.SetUpstream("master", "origin", "refs/heads/master")
+	c.Assert(err, IsNil)
+
+	_, err = r.Upstream("master")
+	c.Assert(err, Equals, config.ErrRemoteConfigNotFound)
+
+	_, err = r.CreateRemote(&config.RemoteConfig{
+		Name:  "origin",
+		URL:   RepositoryFixture,
+		Fetch: []config.RefSpec{"+refs/heads/develop:refs/remotes/origin/develop"},
+	})
+	c.Assert(err, IsNil)
+
+	_, err = r.Upstream("master")
+	c.Assert(err, Equals, ErrNoUpstream)
+}
+
+func (s *BranchSuite) TestSetUpstreamKeepsRebase(c *C) {
+	r := NewMemoryRepository()
+	cfg := config.NewConfig()
+	cfg.Branches["master"] = &config.BranchConfig{Name: "master", Rebase: "true"}
+	c.Assert(r.s.ConfigStorage().SetConfig(cfg), IsNil)
+
+	err := r.SetUpstream("master", "origin", "refs/heads/master")
+	c.Assert(err, IsNil)
+
+	cfg, err = r.s.ConfigStorage().Config()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Branches["master"].Remote, Equals, "origin")
+	c.Assert(cfg.Branches["master"].Rebase, Equals, "true")
+}
+
+func (s *BranchSuite) TestBranchStatus(c *C) {
+	r := NewMemoryRepository()
+	err := r.Clone(&CloneOptions{URL: RepositoryFixture})
+	c.Assert(err, IsNil)
+
+	err = r.s.ReferenceStorage().Set(core.NewReferenceFromStrings(
+		"refs/heads/master", "e8d3ffab552895c19b9fcf7aa264d277cde33881",
+	))
+	c.Assert(err, IsNil)
+
+	status, err := r.BranchStatus("master")
+	c.Assert(err, IsNil)
+	c.Assert(status.Ahead, Equals, 1)
+	c.Assert(status.Behind, Equals, 1)
+}
+
+func (s *BranchSuite) TestAheadBehind(c *C) {
+	for _, t := range []struct {
+		a, b          string
+		ahead, behind int
+	}{
+		{"6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", 0, 0},
+		{"6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "e8d3ffab552895c19b9fcf7aa264d277cde33881", 1, 1},
+		{"6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "b029517f6300c2da0f4b651b8642506cd6aaf45d", 7, 0},
+		{"b029517f6300c2da0f4b651b8642506cd6aaf45d", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", 0, 7},
+		{"a5b8b09e2f8fcb0bb99d3ccb0958157b40890d69", "35e85108805c84807bc66a02d91535e1e24b38b9", 2, 1},
+	} {
+		ahead, behind, err := s.Repository.AheadBehind(core.NewHash(t.a), core.NewHash(t.b))
+		c.Assert(err, IsNil)
+		c.Assert(ahead, Equals, t.ahead, Commentf("%s...%s", t.a, t.b))
+		c.Assert(behind, Equals, t.behind, Commentf("%s...%s", t.a, t.b))
+	}
+}
+
+func (s *BranchSuite) TestPullUpstream(c *C) {
+	r := NewMemoryRepository()
+	err := r.Clone(&CloneOptions{URL: RepositoryFixture})
+	c.Assert(err, IsNil)
+
+	err = r.s.ReferenceStorage().Set(core.NewReferenceFromStrings(
+		"refs/heads/feature", "918c48b83bd081e863dbe1b80f8998f058cd8294",
+	))
+	c.Assert(err, IsNil)
+
+	err = r.s.ReferenceStorage().Set(core.NewSymbolicReference(core.HEAD, "refs/heads/feature"))
+	c.Assert(err, IsNil)
+
+	err = r.SetUpstream("feature", "origin", "refs/heads/master")
+	c.Assert(err, IsNil)
+
+	err = r.Pull(&PullOptions{})
+	c.Assert(err, IsNil)
+
+	head, err := r.Ref(core.HEAD, false)
+	c.Assert(err, IsNil)
+	c.Assert(head.Target(), Equals, core.ReferenceName("refs/heads/feature"))
+
+	feature, err := r.Ref("refs/heads/feature", false)
+	c.Assert(err, IsNil)
+	c.Assert(feature.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+	err = r.Pull(&PullOptions{})
+	c.Assert(err, Equals, NoErrAlreadyUpToDate)
+}
+
+func (s *BranchSuite) TestPullUpstreamNonFastForward(c *C) {
+	r := NewMemoryRepository()
+	err := r.Clone(&CloneOptions{URL: RepositoryFixture})
+	c.Assert(err, IsNil)
+
+	_, err = r.CreateRemote(&config.RemoteConfig{
+		Name: "foo",
+		URL:  "https://github.com/git-fixtures/tags.git",
+	})
+	c.Assert(err, IsNil)
+
+	err = r.s.ReferenceStorage().Set(core.NewReferenceFromStrings(
+		"refs/heads/feature", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+	))
+	c.Assert(err, IsNil)
+
+	err = r.s.ReferenceStorage().Set(core.NewSymbolicReference(core.HEAD, "refs/heads/feature"))
+	c.Assert(err, IsNil)
+
+	err = r.SetUpstream("feature", "foo", "refs/heads/master")
+	c.Assert(err, IsNil)
+
+	err = r.Pull(&PullOptions{})
+	c.Assert(err, Equals, ErrNonFastForwardUpdate)
+
+	feature, err := r.Ref("refs/heads/feature", false)
+	c.Assert(err, IsNil)
+	c.Assert(feature.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+	remote, err := r.Ref("refs/remotes/foo/master", false)
+	c.Assert(err, IsNil)
+	c.Assert(remote.Hash().String(), Equals, "f7b877701fbf855b44c0a9e86f3fdce2c298b07f")
+}
@@ -6,6 +6,7 @@ import (
 
 	"gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/core"
+	"gopkg.in/src-d/go-git.v4/formats/index"
 )
 
 // Storage storage of objects and references
@@ -15,6 +16,12 @@ type Storage interface {
 	ReferenceStorage() core.ReferenceStorage
 }
 
+// IndexStorage is an optional interface for Storage, it gives access to the
+// index of the repository
+type IndexStorage interface {
+	Index() (*index.Index, error)
+}
+
 // countLines returns the number of lines in a string à la git, this is
 // The newline character is assumed to be '\n'.  The empty string
 // contains 0 lines.  If the last line of the string doesn't end with a
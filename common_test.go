@@ -214,3 +214,34 @@ func (s *BaseSuite) NewRepository(f *fixtures.Fixture) *Repository {
 
 	return r
 }
+
+// newClonedRepository returns a filesystem repository cloned from
+// RepositoryFixture, and the path of its git directory.
+func (s *BaseSuite) newClonedRepository(c *C) (*Repository, string) {
+	dir := c.MkDir()
+	r, err := NewFilesystemRepository(dir)
+	c.Assert(err, IsNil)
+
+	err = r.Clone(&CloneOptions{URL: RepositoryFixture})
+	c.Assert(err, IsNil)
+
+	return r, dir
+}
+
+// setObject stores in r an object of the given type and content.
+func (s *BaseSuite) setObject(c *C, r *Repository, t core.ObjectType, content string) core.Hash {
+	o := r.s.ObjectStorage().NewObject()
+	o.SetType(t)
+	o.SetSize(int64(len(content)))
+
+	w, err := o.Writer()
+	c.Assert(err, IsNil)
+	_, err = w.Write([]byte(content))
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	h, err := r.s.ObjectStorage().Set(o)
+	c.Assert(err, IsNil)
+
+	return h
+}
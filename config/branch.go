@@ -0,0 +1,59 @@
+package config
+
+import (
+	"errors"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/core"
+	format "gopkg.in/src-d/go-git.v4/formats/config"
+)
+
+var (
+	// ErrBranchConfigEmptyName is returned by BranchConfig.Validate when the
+	// branch has no name.
+	ErrBranchConfigEmptyName = errors.New("branch config: empty name")
+	// ErrBranchConfigInvalidMerge is returned by BranchConfig.Validate when
+	// Merge is not a full reference name.
+	ErrBranchConfigInvalidMerge = errors.New("branch config: invalid merge")
+)
+
+// BranchConfig is the configuration of a branch, its upstream is the Merge
+// reference of the Remote.
+type BranchConfig struct {
+	// Name of the branch, without the refs/heads/ prefix.
+	Name string
+	// Remote is the name of the remote to fetch from, "." for the local
+	// repository.
+	Remote string
+	// Merge is the reference of the remote merged into the branch.
+	Merge core.ReferenceName
+	// Rebase is the value of branch.<name>.rebase: true, false, merges,
+	// preserve or interactive, empty if not set.
+	Rebase string
+}
+
+// Validate validates the fields of the branch config.
+func (b *BranchConfig) Validate() error {
+	if b.Name == "" {
+		return ErrBranchConfigEmptyName
+	}
+
+	if b.Merge != "" && !strings.HasPrefix(b.Merge.String(), "refs/") {
+		return ErrBranchConfigInvalidMerge
+	}
+
+	return nil
+}
+
+func (b *BranchConfig) unmarshal(s *format.Subsection) {
+	b.Name = s.Name
+	b.Remote = s.Option(remoteKey)
+	b.Merge = core.ReferenceName(s.Option(mergeKey))
+	b.Rebase = s.Option(rebaseKey)
+}
+
+func (b *BranchConfig) marshal(s *format.Subsection) {
+	setSubsectionOption(s, remoteKey, b.Remote)
+	setSubsectionOption(s, mergeKey, b.Merge.String())
+	setSubsectionOption(s, rebaseKey, b.Rebase)
+}
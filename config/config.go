@@ -2,8 +2,14 @@
 package config
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	format "gopkg.in/src-d/go-git.v4/formats/config"
 )
 
 const (
@@ -14,19 +20,315 @@ var (
 	ErrRemoteConfigNotFound  = errors.New("remote config not found")
 	ErrRemoteConfigEmptyURL  = errors.New("remote config: empty URL")
 	ErrRemoteConfigEmptyName = errors.New("remote config: empty name")
+	// ErrRemoteConfigInvalidTagOpt is returned by RemoteConfig.Validate when
+	// TagOpt is not one of the supported values.
+	ErrRemoteConfigInvalidTagOpt = errors.New("remote config: invalid tagopt")
+	// ErrInvalid is returned by Config.Validate when the name of a remote,
+	// branch or url doesn't match its key in the config.
+	ErrInvalid = errors.New("config invalid key in remote, branch or url")
+)
+
+const (
+	coreSection   = "core"
+	userSection   = "user"
+	remoteSection = "remote"
+	branchSection = "branch"
+	urlSection    = "url"
+
+	bareKey          = "bare"
+	worktreeKey      = "worktree"
+	autoCRLFKey      = "autocrlf"
+	nameKey          = "name"
+	emailKey         = "email"
+	urlKey           = "url"
+	pushURLKey       = "pushurl"
+	fetchKey         = "fetch"
+	pushKey          = "push"
+	mirrorKey        = "mirror"
+	tagOptKey        = "tagopt"
+	remoteKey        = "remote"
+	mergeKey         = "merge"
+	rebaseKey        = "rebase"
+	insteadOfKey     = "insteadOf"
+	pushInsteadOfKey = "pushInsteadOf"
 )
 
 type ConfigStorage interface {
+	// Config returns the whole configuration of the repository.
+	Config() (*Config, error)
+	// SetConfig validates and stores the whole configuration of the
+	// repository, replacing the previous one.
+	SetConfig(*Config) error
 	Remote(name string) (*RemoteConfig, error)
 	Remotes() ([]*RemoteConfig, error)
 	SetRemote(*RemoteConfig) error
 	DeleteRemote(name string) error
 }
 
-type RemoteConfig struct {
+// Config is the configuration of a repository, as stored in its config file.
+// The sections and keys not supported by the model are kept in Raw, so they
+// survive a round trip through Unmarshal and Marshal.
+type Config struct {
+	Core CoreConfig
+	User UserConfig
+	// Remotes are the remotes of the repository, by name.
+	Remotes map[string]*RemoteConfig
+	// Branches are the settings of the branches, by name.
+	Branches map[string]*BranchConfig
+	// URLs are the URL rewriting rules, by base URL.
+	URLs map[string]*URLConfig
+	// Raw is the parsed config file, the fields of Config are written to it
+	// by Marshal.
+	Raw *format.Config
+}
+
+// CoreConfig is the core section of the config.
+type CoreConfig struct {
+	// IsBare is true for the repositories without working directory.
+	IsBare bool
+	// Worktree is the path of the working directory, if it's not the parent
+	// of the git directory.
+	Worktree string
+	// AutoCRLF is the line ending conversion mode: true, false or input.
+	AutoCRLF string
+}
+
+// UserConfig is the identity used for the commits and tags.
+type UserConfig struct {
 	Name  string
-	URL   string
+	Email string
+}
+
+// NewConfig returns a new empty Config.
+func NewConfig() *Config {
+	return &Config{
+		Remotes:  make(map[string]*RemoteConfig, 0),
+		Branches: make(map[string]*BranchConfig, 0),
+		URLs:     make(map[string]*URLConfig, 0),
+		Raw:      format.New(),
+	}
+}
+
+// Validate validates the remotes, branches and urls, setting their default
+// values.
+func (c *Config) Validate() error {
+	for name, r := range c.Remotes {
+		if r.Name != name {
+			return ErrInvalid
+		}
+
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for name, b := range c.Branches {
+		if b.Name != name {
+			return ErrInvalid
+		}
+
+		if err := b.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for name, u := range c.URLs {
+		if u.Name != name {
+			return ErrInvalid
+		}
+
+		if err := u.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Unmarshal parses the content of a config file.
+func (c *Config) Unmarshal(b []byte) error {
+	raw := format.New()
+	if err := format.NewDecoder(bytes.NewReader(b)).Decode(raw); err != nil {
+		return err
+	}
+
+	c.unmarshal(raw)
+	return nil
+}
+
+// unmarshal sets raw as the Raw config and reads the fields from it.
+func (c *Config) unmarshal(raw *format.Config) {
+	c.Raw = raw
+	c.unmarshalCore()
+	c.unmarshalUser()
+	c.unmarshalRemotes()
+	c.unmarshalBranches()
+	c.unmarshalURLs()
+}
+
+func (c *Config) unmarshalCore() {
+	s := c.Raw.Section(coreSection)
+	c.Core.IsBare = parseBoolOption(s.Options.GetOption(bareKey))
+	c.Core.Worktree = s.Option(worktreeKey)
+	c.Core.AutoCRLF = s.Option(autoCRLFKey)
+}
+
+func (c *Config) unmarshalUser() {
+	s := c.Raw.Section(userSection)
+	c.User.Name = s.Option(nameKey)
+	c.User.Email = s.Option(emailKey)
+}
+
+func (c *Config) unmarshalRemotes() {
+	c.Remotes = make(map[string]*RemoteConfig, 0)
+	for _, ss := range c.Raw.Section(remoteSection).Subsections {
+		r := &RemoteConfig{}
+		r.unmarshal(ss)
+		c.Remotes[r.Name] = r
+	}
+}
+
+func (c *Config) unmarshalBranches() {
+	c.Branches = make(map[string]*BranchConfig, 0)
+	for _, ss := range c.Raw.Section(branchSection).Subsections {
+		b := &BranchConfig{}
+		b.unmarshal(ss)
+		c.Branches[b.Name] = b
+	}
+}
+
+func (c *Config) unmarshalURLs() {
+	c.URLs = make(map[string]*URLConfig, 0)
+	for _, ss := range c.Raw.Section(urlSection).Subsections {
+		u := &URLConfig{}
+		u.unmarshal(ss)
+		c.URLs[u.Name] = u
+	}
+}
+
+// Marshal writes the fields of the config to Raw and returns its content in
+// the config file format.
+func (c *Config) Marshal() ([]byte, error) {
+	if c.Raw == nil {
+		c.Raw = format.New()
+	}
+
+	c.marshalCore()
+	c.marshalUser()
+	c.marshalRemotes()
+	c.marshalBranches()
+	c.marshalURLs()
+
+	buf := bytes.NewBuffer(nil)
+	if err := format.NewEncoder(buf).Encode(c.Raw); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (c *Config) marshalCore() {
+	s := c.Raw.Section(coreSection)
+	if parseBoolOption(s.Options.GetOption(bareKey)) != c.Core.IsBare {
+		s.SetOption(bareKey, strconv.FormatBool(c.Core.IsBare))
+	}
+
+	setSectionOption(s, worktreeKey, c.Core.Worktree)
+	setSectionOption(s, autoCRLFKey, c.Core.AutoCRLF)
+}
+
+func (c *Config) marshalUser() {
+	s := c.Raw.Section(userSection)
+	setSectionOption(s, nameKey, c.User.Name)
+	setSectionOption(s, emailKey, c.User.Email)
+}
+
+func (c *Config) marshalRemotes() {
+	s := c.Raw.Section(remoteSection)
+	s.Subsections = keepSubsections(s.Subsections, func(name string) bool {
+		_, ok := c.Remotes[name]
+		return ok
+	})
+
+	names := make([]string, 0, len(c.Remotes))
+	for name := range c.Remotes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		c.Remotes[name].marshal(s.Subsection(name))
+	}
+}
+
+func (c *Config) marshalBranches() {
+	s := c.Raw.Section(branchSection)
+	s.Subsections = keepSubsections(s.Subsections, func(name string) bool {
+		_, ok := c.Branches[name]
+		return ok
+	})
+
+	names := make([]string, 0, len(c.Branches))
+	for name := range c.Branches {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		c.Branches[name].marshal(s.Subsection(name))
+	}
+}
+
+func (c *Config) marshalURLs() {
+	s := c.Raw.Section(urlSection)
+	s.Subsections = keepSubsections(s.Subsections, func(name string) bool {
+		_, ok := c.URLs[name]
+		return ok
+	})
+
+	names := make([]string, 0, len(c.URLs))
+	for name := range c.URLs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		c.URLs[name].marshal(s.Subsection(name))
+	}
+}
+
+// TagOpt is the value of remote.<name>.tagopt, it sets which tags are fetched
+// from a remote.
+type TagOpt string
+
+const (
+	// TagOptDefault fetches the tags pointing to the fetched objects.
+	TagOptDefault TagOpt = ""
+	// NoTags doesn't fetch any tag, as --no-tags.
+	NoTags TagOpt = "--no-tags"
+	// AllTags fetches all the tags, as --tags.
+	AllTags TagOpt = "--tags"
+)
+
+type RemoteConfig struct {
+	Name string
+	// URL is the URL to fetch from and push to.
+	URL string
+	// URLs are the additional URLs of the remote, after URL. As in git, they
+	// are only used to push, when there are no PushURLs.
+	URLs  []string
 	Fetch []RefSpec
+	// PushURLs are the URLs used to push, instead of URL and URLs.
+	PushURLs []string
+	// Push are the refspecs pushed by default, they aren't validated since
+	// the push refspecs can omit the destination.
+	Push []RefSpec
+	// TagOpt sets which tags are fetched from the remote.
+	TagOpt TagOpt
+	// Mirror is true for the remotes where the local references are mirrored
+	// when pushing, as remote.<name>.mirror in git it's a push setting only and
+	// doesn't change the fetch refspecs.
+	Mirror bool
 }
 
 // Validate validate the fields and set the default values
@@ -39,9 +341,171 @@ func (c *RemoteConfig) Validate() error {
 		return ErrRemoteConfigEmptyURL
 	}
 
+	switch c.TagOpt {
+	case TagOptDefault, NoTags, AllTags:
+	default:
+		return ErrRemoteConfigInvalidTagOpt
+	}
+
 	if len(c.Fetch) == 0 {
 		c.Fetch = []RefSpec{RefSpec(fmt.Sprintf(DefaultRefSpec, c.Name))}
 	}
 
 	return nil
 }
+
+func (c *RemoteConfig) unmarshal(s *format.Subsection) {
+	fetch := []RefSpec{}
+	for _, f := range s.Options.GetAll(fetchKey) {
+		rs := RefSpec(f)
+		if rs.IsValid() {
+			fetch = append(fetch, rs)
+		}
+	}
+
+	var push []RefSpec
+	for _, p := range s.Options.GetAll(pushKey) {
+		push = append(push, RefSpec(p))
+	}
+
+	urls := s.Options.GetAll(urlKey)
+	if len(urls) > 0 {
+		c.URL = urls[0]
+	}
+
+	if len(urls) > 1 {
+		c.URLs = urls[1:]
+	}
+
+	c.Name = s.Name
+	c.Fetch = fetch
+	c.PushURLs = s.Options.GetAll(pushURLKey)
+	c.Push = push
+	c.TagOpt = TagOpt(s.Option(tagOptKey))
+	c.Mirror = parseBoolOption(s.Options.GetOption(mirrorKey))
+}
+
+func (c *RemoteConfig) marshal(s *format.Subsection) {
+	fetch := make([]string, len(c.Fetch))
+	for i, rs := range c.Fetch {
+		fetch[i] = rs.String()
+	}
+
+	push := make([]string, len(c.Push))
+	for i, rs := range c.Push {
+		push[i] = rs.String()
+	}
+
+	var urls []string
+	if c.URL != "" {
+		urls = append(urls, c.URL)
+	}
+
+	setSubsectionOptions(s, urlKey, append(urls, c.URLs...))
+	setSubsectionOptions(s, fetchKey, fetch)
+	setSubsectionOptions(s, pushURLKey, c.PushURLs)
+	setSubsectionOptions(s, pushKey, push)
+	setSubsectionOption(s, tagOptKey, string(c.TagOpt))
+	if parseBoolOption(s.Options.GetOption(mirrorKey)) != c.Mirror {
+		s.SetOption(mirrorKey, strconv.FormatBool(c.Mirror))
+	}
+}
+
+// parseBool parses a boolean value as git does.
+func parseBool(v string) bool {
+	switch strings.ToLower(v) {
+	case "true", "yes", "on", "1":
+		return true
+	default:
+		return false
+	}
+}
+
+// parseBoolOption parses a boolean option, a key without value is true and an
+// unset key is false.
+func parseBoolOption(o *format.Option) bool {
+	if o == nil {
+		return false
+	}
+
+	return o.NoValue || parseBool(o.Value)
+}
+
+// setSectionOption sets the value of a key, an empty value removes the key.
+func setSectionOption(s *format.Section, key, value string) {
+	if value == "" {
+		s.RemoveOption(key)
+		return
+	}
+
+	s.SetOption(key, value)
+}
+
+// setSubsectionOption sets the value of a key, an empty value removes the key.
+func setSubsectionOption(s *format.Subsection, key, value string) {
+	if value == "" {
+		s.RemoveOption(key)
+		return
+	}
+
+	s.SetOption(key, value)
+}
+
+// setSubsectionOptions replaces all the values of a multivalued key, the new
+// values are placed where the first of the current ones was.
+func setSubsectionOptions(s *format.Subsection, key string, values []string) {
+	current := s.Options.GetAll(key)
+	if len(current) == len(values) {
+		equal := true
+		for i := range values {
+			if current[i] != values[i] {
+				equal = false
+				break
+			}
+		}
+
+		if equal {
+			return
+		}
+	}
+
+	opts := make(format.Options, 0, len(s.Options)+len(values))
+	added := false
+	for _, o := range s.Options {
+		if !o.IsKey(key) {
+			opts = append(opts, o)
+			continue
+		}
+
+		if !added {
+			opts = appendOptions(opts, key, values)
+			added = true
+		}
+	}
+
+	if !added {
+		opts = appendOptions(opts, key, values)
+	}
+
+	s.Options = opts
+}
+
+func appendOptions(opts format.Options, key string, values []string) format.Options {
+	for _, v := range values {
+		opts = append(opts, &format.Option{Key: key, Value: v})
+	}
+
+	return opts
+}
+
+// keepSubsections returns the subsections whose name is accepted by keep.
+func keepSubsections(ss format.Subsections, keep func(name string) bool) format.Subsections {
+	result := format.Subsections{}
+	for _, s := range ss {
+		if keep(s.Name) {
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
@@ -24,3 +24,216 @@ func (s *ConfigSuite) TestRemoteConfigValidateDefault(c *C) {
 	c.Assert(fetch, HasLen, 1)
 	c.Assert(fetch[0].String(), Equals, "+refs/heads/*:refs/remotes/foo/*")
 }
+
+func (s *ConfigSuite) TestRemoteConfigValidateMirror(c *C) {
+	config := &RemoteConfig{Name: "foo", URL: "http://foo/bar", Mirror: true}
+	c.Assert(config.Validate(), IsNil)
+	c.Assert(config.Fetch, DeepEquals, []RefSpec{"+refs/heads/*:refs/remotes/foo/*"})
+}
+
+func (s *ConfigSuite) TestRemoteConfigValidateInvalidTagOpt(c *C) {
+	config := &RemoteConfig{Name: "foo", URL: "http://foo/bar", TagOpt: "foo"}
+	c.Assert(config.Validate(), Equals, ErrRemoteConfigInvalidTagOpt)
+}
+
+func (s *ConfigSuite) TestUnmarshal(c *C) {
+	input := []byte(`[core]
+	bare = true
+	worktree = foo
+	autocrlf = input
+[user]
+	name = John Doe
+	email = john@example.com
+[remote "origin"]
+	url = git@github.com:src-d/go-git.git
+	url = https://example.com/go-git.git
+	pushurl = git@github.com:mcuadros/go-git.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	fetch = +refs/pull/*:refs/remotes/origin/pull/*
+	push = refs/heads/master
+	tagopt = --no-tags
+	mirror = true
+[branch "master"]
+	remote = origin
+	merge = refs/heads/master
+	rebase = true
+[url "git@github.com:"]
+	insteadOf = https://github.com/
+	pushInsteadOf = gh:
+`)
+
+	cfg := NewConfig()
+	err := cfg.Unmarshal(input)
+	c.Assert(err, IsNil)
+
+	c.Assert(cfg.Core.IsBare, Equals, true)
+	c.Assert(cfg.Core.Worktree, Equals, "foo")
+	c.Assert(cfg.Core.AutoCRLF, Equals, "input")
+	c.Assert(cfg.User.Name, Equals, "John Doe")
+	c.Assert(cfg.User.Email, Equals, "john@example.com")
+
+	c.Assert(cfg.Remotes, HasLen, 1)
+	r := cfg.Remotes["origin"]
+	c.Assert(r.Name, Equals, "origin")
+	c.Assert(r.URL, Equals, "git@github.com:src-d/go-git.git")
+	c.Assert(r.PushURLs, DeepEquals, []string{"git@github.com:mcuadros/go-git.git"})
+	c.Assert(r.Fetch, DeepEquals, []RefSpec{
+		"+refs/heads/*:refs/remotes/origin/*",
+		"+refs/pull/*:refs/remotes/origin/pull/*",
+	})
+	c.Assert(r.URLs, DeepEquals, []string{"https://example.com/go-git.git"})
+	c.Assert(r.Push, DeepEquals, []RefSpec{"refs/heads/master"})
+	c.Assert(r.TagOpt, Equals, NoTags)
+	c.Assert(r.Mirror, Equals, true)
+
+	c.Assert(cfg.Branches, HasLen, 1)
+	b := cfg.Branches["master"]
+	c.Assert(b.Name, Equals, "master")
+	c.Assert(b.Remote, Equals, "origin")
+	c.Assert(b.Merge.String(), Equals, "refs/heads/master")
+	c.Assert(b.Rebase, Equals, "true")
+
+	c.Assert(cfg.URLs, HasLen, 1)
+	u := cfg.URLs["git@github.com:"]
+	c.Assert(u.InsteadOf, DeepEquals, []string{"https://github.com/"})
+	c.Assert(u.PushInsteadOf, DeepEquals, []string{"gh:"})
+}
+
+func (s *ConfigSuite) TestMarshal(c *C) {
+	cfg := NewConfig()
+	cfg.Core.IsBare = true
+	cfg.User.Name = "John Doe"
+	cfg.Remotes["origin"] = &RemoteConfig{
+		Name:  "origin",
+		URL:   "git@github.com:src-d/go-git.git",
+		Fetch: []RefSpec{"+refs/heads/*:refs/remotes/origin/*"},
+	}
+	cfg.Branches["master"] = &BranchConfig{
+		Name:   "master",
+		Remote: "origin",
+		Merge:  "refs/heads/master",
+	}
+
+	b, err := cfg.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(b), Equals, `[core]
+	bare = true
+[user]
+	name = John Doe
+[remote "origin"]
+	url = git@github.com:src-d/go-git.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+[branch "master"]
+	remote = origin
+	merge = refs/heads/master
+`)
+}
+
+func (s *ConfigSuite) TestMarshalRemote(c *C) {
+	input := []byte(`[remote "origin"]
+	url = git@github.com:src-d/go-git.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	mirror = false
+`)
+
+	cfg := NewConfig()
+	c.Assert(cfg.Unmarshal(input), IsNil)
+
+	r := cfg.Remotes["origin"]
+	r.URL = "https://github.com/src-d/go-git.git"
+	r.URLs = []string{"https://example.com/go-git.git"}
+	r.Push = []RefSpec{"refs/heads/master:refs/heads/master"}
+	r.TagOpt = AllTags
+
+	b, err := cfg.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(b), Equals, `[remote "origin"]
+	url = https://github.com/src-d/go-git.git
+	url = https://example.com/go-git.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	mirror = false
+	push = refs/heads/master:refs/heads/master
+	tagopt = --tags
+`)
+}
+
+func (s *ConfigSuite) TestUnmarshalNoValue(c *C) {
+	input := []byte(`[core]
+	bare
+[remote "origin"]
+	url = https://github.com/src-d/go-git
+	mirror
+`)
+
+	cfg := NewConfig()
+	c.Assert(cfg.Unmarshal(input), IsNil)
+	c.Assert(cfg.Core.IsBare, Equals, true)
+	c.Assert(cfg.Remotes["origin"].Mirror, Equals, true)
+
+	b, err := cfg.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(b), Equals, string(input))
+
+	cfg.Core.IsBare = false
+	b, err = cfg.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(b), Equals, `[core]
+	bare = false
+[remote "origin"]
+	url = https://github.com/src-d/go-git
+	mirror
+`)
+}
+
+func (s *ConfigSuite) TestUnmarshalMarshalKeepsUnknown(c *C) {
+	input := []byte(`[core]
+	bare = false
+	filemode = true
+[remote "origin"]
+	url = https://github.com/src-d/go-git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	prune = true
+[remote "upstream"]
+	url = https://github.com/git-fixtures/basic
+	fetch = +refs/heads/*:refs/remotes/upstream/*
+[alias]
+	co = checkout
+`)
+
+	cfg := NewConfig()
+	c.Assert(cfg.Unmarshal(input), IsNil)
+
+	delete(cfg.Remotes, "upstream")
+	cfg.User.Email = "john@example.com"
+
+	b, err := cfg.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(b), Equals, `[core]
+	bare = false
+	filemode = true
+[remote "origin"]
+	url = https://github.com/src-d/go-git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	prune = true
+[alias]
+	co = checkout
+[user]
+	email = john@example.com
+`)
+}
+
+func (s *ConfigSuite) TestValidateInvalidName(c *C) {
+	cfg := NewConfig()
+	cfg.Remotes["foo"] = &RemoteConfig{Name: "bar", URL: "http://foo/bar"}
+	c.Assert(cfg.Validate(), Equals, ErrInvalid)
+
+	cfg = NewConfig()
+	cfg.Branches["foo"] = &BranchConfig{Name: "bar"}
+	c.Assert(cfg.Validate(), Equals, ErrInvalid)
+}
+
+func (s *ConfigSuite) TestValidateInvalidBranch(c *C) {
+	cfg := NewConfig()
+	cfg.Branches["foo"] = &BranchConfig{Name: "foo", Merge: "master"}
+	c.Assert(cfg.Validate(), Equals, ErrBranchConfigInvalidMerge)
+}
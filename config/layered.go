@@ -0,0 +1,422 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	format "gopkg.in/src-d/go-git.v4/formats/config"
+)
+
+const (
+	includeSection   = "include"
+	includeIfSection = "includeIf"
+	pathKey          = "path"
+
+	gitDirCondition     = "gitdir:"
+	gitDirFoldCondition = "gitdir/i:"
+
+	// maxIncludeDepth is the maximum number of nested includes, as in git.
+	maxIncludeDepth = 10
+
+	systemConfigPath = "/etc/gitconfig"
+)
+
+// ErrIncludeDepthExceeded is returned when the includes of a config file are
+// nested more than 10 levels, usually because of an include cycle.
+var ErrIncludeDepthExceeded = errors.New("config: exceeded maximum include depth")
+
+// Scope is the level a config file applies to, the values of a scope override
+// the values of the lower ones.
+type Scope int
+
+const (
+	// SystemScope is the config of all the users, /etc/gitconfig.
+	SystemScope Scope = iota
+	// GlobalScope is the config of the user, ~/.gitconfig and
+	// $XDG_CONFIG_HOME/git/config.
+	GlobalScope
+	// LocalScope is the config of the repository, the config file of its git
+	// directory.
+	LocalScope
+)
+
+func (s Scope) String() string {
+	switch s {
+	case SystemScope:
+		return "system"
+	case GlobalScope:
+		return "global"
+	case LocalScope:
+		return "local"
+	default:
+		return "unknown"
+	}
+}
+
+// Value is a value of a layered config, with the file defining it.
+type Value struct {
+	Section    string
+	Subsection string
+	Key        string
+	Value      string
+	// NoValue is true for the keys without value, see format.Option.
+	NoValue bool
+	// Scope is the scope of the file read, for the included files it's the
+	// scope of the file including them.
+	Scope Scope
+	// Path is the file defining the value, the included file for the values
+	// read through an include. It's empty for the values not read from a file.
+	Path string
+}
+
+// File is a config file read by a LayeredConfig.
+type File struct {
+	Scope Scope
+	Path  string
+	// Raw is the content of the file, the included files are in its Includes.
+	Raw *format.Config
+}
+
+// LayeredConfig is the config of a repository as git sees it, the merge of the
+// system, global and repository config files, with the include and includeIf
+// sections resolved.
+type LayeredConfig struct {
+	// Config is the merged config. It must not be stored in a ConfigStorage,
+	// since it contains the values of all the files.
+	Config *Config
+	// Files are the config files read, in the order they were added.
+	Files []*File
+	// Values are all the values read, in the order git reads them, the later
+	// values override the former ones.
+	Values []*Value
+
+	gitDir string
+}
+
+// NewLayeredConfig returns an empty LayeredConfig for the repository with the
+// given git directory, used to match the includeIf gitdir conditions. gitDir
+// can be empty for the repositories not stored in the filesystem.
+func NewLayeredConfig(gitDir string) *LayeredConfig {
+	return &LayeredConfig{Config: NewConfig(), gitDir: gitDir}
+}
+
+// LoadGlobalConfig reads the system and global config files, as returned by
+// SystemConfigPath and GlobalConfigPaths.
+func LoadGlobalConfig(gitDir string) (*LayeredConfig, error) {
+	l := NewLayeredConfig(gitDir)
+	if path := SystemConfigPath(); path != "" {
+		if err := l.AddFile(SystemScope, path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, path := range GlobalConfigPaths() {
+		if err := l.AddFile(GlobalScope, path); err != nil {
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+// LoadConfig reads the system and global config files and the config file of
+// the given git directory.
+func LoadConfig(gitDir string) (*LayeredConfig, error) {
+	l, err := LoadGlobalConfig(gitDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.AddFile(LocalScope, filepath.Join(gitDir, "config")); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// SystemConfigPath returns the path of the system config file, or the value
+// of $GIT_CONFIG_SYSTEM if set. It's empty if $GIT_CONFIG_NOSYSTEM is true.
+func SystemConfigPath() string {
+	if parseBool(os.Getenv("GIT_CONFIG_NOSYSTEM")) {
+		return ""
+	}
+
+	if path := os.Getenv("GIT_CONFIG_SYSTEM"); path != "" {
+		return path
+	}
+
+	return systemConfigPath
+}
+
+// GlobalConfigPaths returns the paths of the global config files, in the
+// order they are read: $XDG_CONFIG_HOME/git/config and ~/.gitconfig, or only
+// the value of $GIT_CONFIG_GLOBAL if set.
+func GlobalConfigPaths() []string {
+	if path := os.Getenv("GIT_CONFIG_GLOBAL"); path != "" {
+		return []string{path}
+	}
+
+	var paths []string
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	home := homeDir()
+	if xdg == "" && home != "" {
+		xdg = filepath.Join(home, ".config")
+	}
+
+	if xdg != "" {
+		paths = append(paths, filepath.Join(xdg, "git", "config"))
+	}
+
+	if home != "" {
+		paths = append(paths, filepath.Join(home, ".gitconfig"))
+	}
+
+	return paths
+}
+
+// AddFile reads the given config file, its values override the values read
+// before. The missing files are ignored, as git does.
+func (l *LayeredConfig) AddFile(scope Scope, path string) error {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return l.AddConfig(scope, path, b)
+}
+
+// AddConfig reads the content of a config file, path is used to resolve the
+// relative includes, that are ignored if it's empty.
+func (l *LayeredConfig) AddConfig(scope Scope, path string, b []byte) error {
+	f := &File{Scope: scope, Path: path, Raw: format.New()}
+	if err := l.read(f.Raw, scope, path, b, 0); err != nil {
+		return err
+	}
+
+	l.Files = append(l.Files, f)
+	l.merge()
+	return nil
+}
+
+// Origin returns the value of the given key, the last one read, with the file
+// defining it, or nil if the key is not set.
+func (l *LayeredConfig) Origin(section, subsection, key string) *Value {
+	for i := len(l.Values) - 1; i >= 0; i-- {
+		v := l.Values[i]
+		if strings.EqualFold(v.Section, section) && v.Subsection == subsection &&
+			strings.EqualFold(v.Key, key) {
+			return v
+		}
+	}
+
+	return nil
+}
+
+func (l *LayeredConfig) read(raw *format.Config, scope Scope, path string, b []byte, depth int) error {
+	if depth > maxIncludeDepth {
+		return ErrIncludeDepthExceeded
+	}
+
+	d := format.NewDecoder(bytes.NewReader(b))
+	return d.DecodeFunc(func(s, ss string, o *format.Option) error {
+		addOption(raw, s, ss, o)
+		l.Values = append(l.Values, &Value{
+			Section: s, Subsection: ss, Key: o.Key, Value: o.Value, NoValue: o.NoValue,
+			Scope: scope, Path: path,
+		})
+
+		if include := l.includePath(path, s, ss, o.Key, o.Value); include != "" {
+			return l.include(raw, scope, include, depth)
+		}
+
+		return nil
+	})
+}
+
+// include reads an included file, as if its content was at the place of the
+// include, the missing files are ignored.
+func (l *LayeredConfig) include(raw *format.Config, scope Scope, path string, depth int) error {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	inc := &format.Include{Path: path, Config: format.New()}
+	raw.Includes = append(raw.Includes, inc)
+	return l.read(inc.Config, scope, path, b, depth+1)
+}
+
+// includePath returns the path of the file included by the given value, if
+// it's an include.path or an includeIf.<condition>.path with a matching
+// condition.
+func (l *LayeredConfig) includePath(file, s, ss, k, v string) string {
+	if !strings.EqualFold(k, pathKey) || v == "" {
+		return ""
+	}
+
+	switch {
+	case strings.EqualFold(s, includeSection) && ss == "":
+	case strings.EqualFold(s, includeIfSection) && l.matchCondition(file, ss):
+	default:
+		return ""
+	}
+
+	if strings.HasPrefix(v, "~/") {
+		return filepath.Join(homeDir(), v[2:])
+	}
+
+	if filepath.IsAbs(v) {
+		return v
+	}
+
+	if file == "" {
+		return ""
+	}
+
+	return filepath.Join(filepath.Dir(file), v)
+}
+
+// matchCondition returns true if the condition of an includeIf section is met,
+// only the gitdir conditions are supported.
+func (l *LayeredConfig) matchCondition(file, cond string) bool {
+	switch {
+	case strings.HasPrefix(cond, gitDirCondition):
+		return l.matchGitDir(file, strings.TrimPrefix(cond, gitDirCondition), false)
+	case strings.HasPrefix(cond, gitDirFoldCondition):
+		return l.matchGitDir(file, strings.TrimPrefix(cond, gitDirFoldCondition), true)
+	default:
+		return false
+	}
+}
+
+// matchGitDir matches the git directory against the pattern of a gitdir
+// condition, following the rules of git: ~/ is the home directory, ./ is the
+// directory of the file, the relative patterns match anywhere and a trailing
+// slash matches everything inside the directory.
+func (l *LayeredConfig) matchGitDir(file, pattern string, fold bool) bool {
+	if l.gitDir == "" || pattern == "" {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(pattern, "~/"):
+		pattern = filepath.ToSlash(homeDir()) + pattern[1:]
+	case strings.HasPrefix(pattern, "./"):
+		if file == "" {
+			return false
+		}
+
+		pattern = filepath.ToSlash(filepath.Dir(file)) + pattern[1:]
+	case !filepath.IsAbs(pattern) && !strings.HasPrefix(pattern, "/"):
+		pattern = "**/" + pattern
+	}
+
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+
+	re, err := globRegexp(pattern, fold)
+	if err != nil {
+		return false
+	}
+
+	dirs := []string{l.gitDir}
+	if dir, err := filepath.EvalSymlinks(l.gitDir); err == nil && dir != l.gitDir {
+		dirs = append(dirs, dir)
+	}
+
+	for _, dir := range dirs {
+		if re.MatchString(filepath.ToSlash(filepath.Clean(dir))) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// merge builds the merged config from all the values read.
+func (l *LayeredConfig) merge() {
+	raw := format.New()
+	for _, v := range l.Values {
+		addOption(raw, v.Section, v.Subsection, &format.Option{
+			Key: v.Key, Value: v.Value, NoValue: v.NoValue,
+		})
+	}
+
+	l.Config = NewConfig()
+	l.Config.unmarshal(raw)
+}
+
+// addOption adds an option to a section or subsection of raw, keeping whether
+// it has a value.
+func addOption(raw *format.Config, section, subsection string, o *format.Option) {
+	if subsection == format.NoSubsection {
+		s := raw.Section(section)
+		s.Options = append(s.Options, o)
+		return
+	}
+
+	ss := raw.Section(section).Subsection(subsection)
+	ss.Options = append(ss.Options, o)
+}
+
+// globRegexp compiles a wildmatch pattern, where * and ? don't match slashes
+// and ** matches any number of directories.
+func globRegexp(pattern string, fold bool) (*regexp.Regexp, error) {
+	buf := bytes.NewBuffer(nil)
+	if fold {
+		buf.WriteString("(?i)")
+	}
+
+	buf.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			buf.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			buf.WriteString(".*")
+			i++
+		case c == '*':
+			buf.WriteString("[^/]*")
+		case c == '?':
+			buf.WriteString("[^/]")
+		case c == '[' && strings.IndexByte(pattern[i+1:], ']') > 0:
+			end := i + 1 + strings.IndexByte(pattern[i+1:], ']')
+			class := pattern[i+1 : end]
+			if class[0] == '!' {
+				class = "^" + class[1:]
+			}
+
+			buf.WriteString("[" + class + "]")
+			i = end
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	buf.WriteString("$")
+	return regexp.Compile(buf.String())
+}
+
+// homeDir returns the home directory of the user.
+func homeDir() string {
+	if home := os.Getenv("HOME"); home != "" {
+		return home
+	}
+
+	return os.Getenv("USERPROFILE")
+}
@@ -0,0 +1,232 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+type LayeredSuite struct {
+	dir string
+	env map[string]string
+}
+
+var _ = Suite(&LayeredSuite{})
+
+var layeredEnv = []string{
+	"HOME", "XDG_CONFIG_HOME",
+	"GIT_CONFIG_NOSYSTEM", "GIT_CONFIG_SYSTEM", "GIT_CONFIG_GLOBAL",
+}
+
+func (s *LayeredSuite) SetUpTest(c *C) {
+	dir, err := ioutil.TempDir("", "go-git-layered-config")
+	c.Assert(err, IsNil)
+	s.dir = dir
+
+	s.env = make(map[string]string, 0)
+	for _, name := range layeredEnv {
+		s.env[name] = os.Getenv(name)
+		os.Unsetenv(name)
+	}
+
+	os.Setenv("HOME", filepath.Join(dir, "home"))
+	os.Setenv("GIT_CONFIG_NOSYSTEM", "true")
+}
+
+func (s *LayeredSuite) TearDownTest(c *C) {
+	for name, value := range s.env {
+		if value == "" {
+			os.Unsetenv(name)
+		} else {
+			os.Setenv(name, value)
+		}
+	}
+
+	os.RemoveAll(s.dir)
+}
+
+func (s *LayeredSuite) writeFile(c *C, path, content string) string {
+	path = filepath.Join(s.dir, path)
+	c.Assert(os.MkdirAll(filepath.Dir(path), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(path, []byte(content), 0644), IsNil)
+	return path
+}
+
+func (s *LayeredSuite) TestAddFileScopes(c *C) {
+	system := s.writeFile(c, "system", "[user]\n\tname = system\n\temail = system@example.com\n")
+	global := s.writeFile(c, "global", "[user]\n\tname = global\n")
+	local := s.writeFile(c, "local", "[core]\n\tbare = true\n")
+
+	l := NewLayeredConfig("")
+	c.Assert(l.AddFile(SystemScope, system), IsNil)
+	c.Assert(l.AddFile(GlobalScope, global), IsNil)
+	c.Assert(l.AddFile(LocalScope, local), IsNil)
+	c.Assert(l.AddFile(LocalScope, filepath.Join(s.dir, "missing")), IsNil)
+
+	c.Assert(l.Files, HasLen, 3)
+	c.Assert(l.Values, HasLen, 4)
+	c.Assert(l.Config.User.Name, Equals, "global")
+	c.Assert(l.Config.User.Email, Equals, "system@example.com")
+	c.Assert(l.Config.Core.IsBare, Equals, true)
+
+	v := l.Origin("user", "", "name")
+	c.Assert(v.Value, Equals, "global")
+	c.Assert(v.Scope, Equals, GlobalScope)
+	c.Assert(v.Path, Equals, global)
+
+	v = l.Origin("USER", "", "Email")
+	c.Assert(v.Scope, Equals, SystemScope)
+	c.Assert(v.Path, Equals, system)
+
+	c.Assert(l.Origin("user", "", "signingkey"), IsNil)
+}
+
+func (s *LayeredSuite) TestInclude(c *C) {
+	included := s.writeFile(c, "dir/included", "[user]\n\tname = included\n\temail = included@example.com\n")
+	path := s.writeFile(c, "dir/config", `[user]
+	name = before
+[include]
+	path = included
+[user]
+	email = after@example.com
+`)
+
+	l := NewLayeredConfig("")
+	c.Assert(l.AddFile(GlobalScope, path), IsNil)
+	c.Assert(l.Config.User.Name, Equals, "included")
+	c.Assert(l.Config.User.Email, Equals, "after@example.com")
+
+	v := l.Origin("user", "", "name")
+	c.Assert(v.Path, Equals, included)
+	c.Assert(v.Scope, Equals, GlobalScope)
+
+	raw := l.Files[0].Raw
+	c.Assert(raw.Includes, HasLen, 1)
+	c.Assert(raw.Includes[0].Path, Equals, included)
+	c.Assert(raw.Includes[0].Config.Section("user").Option("name"), Equals, "included")
+}
+
+func (s *LayeredSuite) TestIncludeHome(c *C) {
+	s.writeFile(c, "home/work.inc", "[user]\n\tname = work\n")
+
+	l := NewLayeredConfig("")
+	err := l.AddConfig(LocalScope, "", []byte("[include]\n\tpath = ~/work.inc\n"))
+	c.Assert(err, IsNil)
+	c.Assert(l.Config.User.Name, Equals, "work")
+}
+
+func (s *LayeredSuite) TestIncludeRelativeWithoutPath(c *C) {
+	l := NewLayeredConfig("")
+	err := l.AddConfig(LocalScope, "", []byte("[include]\n\tpath = included\n"))
+	c.Assert(err, IsNil)
+	c.Assert(l.Values, HasLen, 1)
+}
+
+func (s *LayeredSuite) TestIncludeCycle(c *C) {
+	path := s.writeFile(c, "config", "[include]\n\tpath = config\n")
+
+	l := NewLayeredConfig("")
+	c.Assert(l.AddFile(GlobalScope, path), Equals, ErrIncludeDepthExceeded)
+}
+
+func (s *LayeredSuite) TestIncludeIfGitDir(c *C) {
+	s.writeFile(c, "work.inc", "[user]\n\temail = work@example.com\n")
+	path := s.writeFile(c, "config", `[user]
+	email = home@example.com
+[includeIf "gitdir:/srv/work/"]
+	path = work.inc
+`)
+
+	l := NewLayeredConfig("/srv/work/foo/.git")
+	c.Assert(l.AddFile(GlobalScope, path), IsNil)
+	c.Assert(l.Config.User.Email, Equals, "work@example.com")
+
+	l = NewLayeredConfig("/srv/personal/foo/.git")
+	c.Assert(l.AddFile(GlobalScope, path), IsNil)
+	c.Assert(l.Config.User.Email, Equals, "home@example.com")
+
+	l = NewLayeredConfig("")
+	c.Assert(l.AddFile(GlobalScope, path), IsNil)
+	c.Assert(l.Config.User.Email, Equals, "home@example.com")
+}
+
+func (s *LayeredSuite) TestMatchCondition(c *C) {
+	l := NewLayeredConfig("/srv/Work/foo/.git")
+	file := "/srv/Work/config"
+
+	for cond, match := range map[string]bool{
+		"gitdir:/srv/Work/":         true,
+		"gitdir:/srv/work/":         false,
+		"gitdir/i:/srv/work/":       true,
+		"gitdir:foo/.git":           true,
+		"gitdir:foo/":               true,
+		"gitdir:bar/":               false,
+		"gitdir:/srv/*/foo/.git":    true,
+		"gitdir:/srv/*/.git":        false,
+		"gitdir:/srv/**/.git":       true,
+		"gitdir:/srv/W?rk/foo/.git": true,
+		"gitdir:/srv/[VW]ork/":      true,
+		"gitdir:/srv/[!W]ork/":      false,
+		"gitdir:./foo/.git":         true,
+		"gitdir:~/foo/":             false,
+		"onbranch:master":           false,
+		"gitdir:":                   false,
+	} {
+		c.Assert(l.matchCondition(file, cond), Equals, match, Commentf("%s", cond))
+	}
+}
+
+func (s *LayeredSuite) TestSystemConfigPath(c *C) {
+	c.Assert(SystemConfigPath(), Equals, "")
+
+	os.Unsetenv("GIT_CONFIG_NOSYSTEM")
+	c.Assert(SystemConfigPath(), Equals, "/etc/gitconfig")
+
+	os.Setenv("GIT_CONFIG_SYSTEM", "/foo/gitconfig")
+	c.Assert(SystemConfigPath(), Equals, "/foo/gitconfig")
+}
+
+func (s *LayeredSuite) TestGlobalConfigPaths(c *C) {
+	home := filepath.Join(s.dir, "home")
+	c.Assert(GlobalConfigPaths(), DeepEquals, []string{
+		filepath.Join(home, ".config", "git", "config"),
+		filepath.Join(home, ".gitconfig"),
+	})
+
+	os.Setenv("XDG_CONFIG_HOME", "/xdg")
+	c.Assert(GlobalConfigPaths(), DeepEquals, []string{
+		filepath.Join("/xdg", "git", "config"),
+		filepath.Join(home, ".gitconfig"),
+	})
+
+	os.Setenv("GIT_CONFIG_GLOBAL", "/foo/gitconfig")
+	c.Assert(GlobalConfigPaths(), DeepEquals, []string{"/foo/gitconfig"})
+}
+
+func (s *LayeredSuite) TestLoadConfig(c *C) {
+	s.writeFile(c, "home/.config/git/config", "[user]\n\tname = xdg\n\temail = xdg@example.com\n")
+	global := s.writeFile(c, "home/.gitconfig", `[user]
+	name = global
+[url "git@github.com:"]
+	insteadOf = https://github.com/
+`)
+	local := s.writeFile(c, "repo/.git/config", `[core]
+	bare = false
+[remote "origin"]
+	url = https://github.com/src-d/go-git
+`)
+
+	l, err := LoadConfig(filepath.Join(s.dir, "repo", ".git"))
+	c.Assert(err, IsNil)
+	c.Assert(l.Files, HasLen, 3)
+	c.Assert(l.Config.User.Name, Equals, "global")
+	c.Assert(l.Config.User.Email, Equals, "xdg@example.com")
+	c.Assert(l.Config.URLs["git@github.com:"].InsteadOf, DeepEquals, []string{"https://github.com/"})
+	c.Assert(l.Config.Remotes["origin"].URL, Equals, "https://github.com/src-d/go-git")
+
+	c.Assert(l.Origin("url", "git@github.com:", "insteadof").Path, Equals, global)
+	c.Assert(l.Origin("remote", "origin", "url").Path, Equals, local)
+	c.Assert(l.Origin("remote", "origin", "url").Scope, Equals, LocalScope)
+}
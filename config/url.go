@@ -0,0 +1,137 @@
+package config
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	format "gopkg.in/src-d/go-git.v4/formats/config"
+)
+
+// ErrURLConfigEmptyName is returned by URLConfig.Validate when the base URL
+// is empty.
+var ErrURLConfigEmptyName = errors.New("url config: empty name")
+
+// URLConfig is a URL rewriting rule, the URLs starting with any of InsteadOf
+// are rewritten to start with Name instead.
+type URLConfig struct {
+	// Name is the base URL the matching prefixes are replaced with.
+	Name string
+	// InsteadOf are the prefixes replaced by Name.
+	InsteadOf []string
+	// PushInsteadOf are the prefixes replaced by Name only to push.
+	PushInsteadOf []string
+}
+
+// Validate validates the fields of the url config.
+func (u *URLConfig) Validate() error {
+	if u.Name == "" {
+		return ErrURLConfigEmptyName
+	}
+
+	return nil
+}
+
+func (u *URLConfig) unmarshal(s *format.Subsection) {
+	u.Name = s.Name
+	u.InsteadOf = s.Options.GetAll(insteadOfKey)
+	u.PushInsteadOf = s.Options.GetAll(pushInsteadOfKey)
+}
+
+func (u *URLConfig) marshal(s *format.Subsection) {
+	setSubsectionOptions(s, insteadOfKey, u.InsteadOf)
+	setSubsectionOptions(s, pushInsteadOfKey, u.PushInsteadOf)
+}
+
+// ApplyInsteadOf rewrites url with the longest of the InsteadOf prefixes
+// matching it, url is returned as it is if none matches.
+func (u *URLConfig) ApplyInsteadOf(url string) string {
+	prefix := longestPrefix(url, u.InsteadOf)
+	if prefix == "" {
+		return url
+	}
+
+	return u.Name + url[len(prefix):]
+}
+
+// RewriteURL rewrites url with the insteadOf rules, as git does for the URLs
+// to fetch from: the rule with the longest prefix matching url is applied.
+func (c *Config) RewriteURL(url string) string {
+	return c.rewrite(url, func(u *URLConfig) []string { return u.InsteadOf })
+}
+
+// RewritePushURL rewrites url with the pushInsteadOf rules, or with the
+// insteadOf rules if none of them matches, as git does for the URLs of the
+// remotes to push to when they have no pushurl.
+func (c *Config) RewritePushURL(url string) string {
+	rewritten := c.rewrite(url, func(u *URLConfig) []string { return u.PushInsteadOf })
+	if rewritten != url {
+		return rewritten
+	}
+
+	return c.RewriteURL(url)
+}
+
+// FetchURL returns the URL to fetch from the given remote, rewritten with the
+// insteadOf rules.
+func (c *Config) FetchURL(r *RemoteConfig) string {
+	return c.RewriteURL(r.URL)
+}
+
+// PushURLs returns the URLs to push to the given remote: its PushURLs
+// rewritten with the insteadOf rules, or its URL and URLs rewritten with the
+// pushInsteadOf rules if it has no PushURLs.
+func (c *Config) PushURLs(r *RemoteConfig) []string {
+	if len(r.PushURLs) == 0 {
+		urls := []string{c.RewritePushURL(r.URL)}
+		for _, url := range r.URLs {
+			urls = append(urls, c.RewritePushURL(url))
+		}
+
+		return urls
+	}
+
+	urls := make([]string, len(r.PushURLs))
+	for i, url := range r.PushURLs {
+		urls[i] = c.RewriteURL(url)
+	}
+
+	return urls
+}
+
+// rewrite replaces the longest prefix of url found in the given prefixes of
+// all the URLConfigs, the first one wins between prefixes of the same length.
+func (c *Config) rewrite(url string, prefixes func(*URLConfig) []string) string {
+	names := make([]string, 0, len(c.URLs))
+	for name := range c.URLs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var best, base string
+	for _, name := range names {
+		prefix := longestPrefix(url, prefixes(c.URLs[name]))
+		if len(prefix) > len(best) {
+			best, base = prefix, name
+		}
+	}
+
+	if best == "" {
+		return url
+	}
+
+	return base + url[len(best):]
+}
+
+// longestPrefix returns the longest of the prefixes url starts with.
+func longestPrefix(url string, prefixes []string) string {
+	var longest string
+	for _, prefix := range prefixes {
+		if len(prefix) > len(longest) && strings.HasPrefix(url, prefix) {
+			longest = prefix
+		}
+	}
+
+	return longest
+}
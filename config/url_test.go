@@ -0,0 +1,83 @@
+package config
+
+import . "gopkg.in/check.v1"
+
+type URLSuite struct{}
+
+var _ = Suite(&URLSuite{})
+
+func (s *URLSuite) TestValidateEmptyName(c *C) {
+	u := &URLConfig{InsteadOf: []string{"foo:"}}
+	c.Assert(u.Validate(), Equals, ErrURLConfigEmptyName)
+}
+
+func (s *URLSuite) TestApplyInsteadOf(c *C) {
+	u := &URLConfig{
+		Name:      "git@github.com:",
+		InsteadOf: []string{"https://github.com/", "https://github.com/src-d/", "gh:"},
+	}
+
+	c.Assert(u.ApplyInsteadOf("https://github.com/src-d/go-git"), Equals, "git@github.com:go-git")
+	c.Assert(u.ApplyInsteadOf("gh:src-d/go-git"), Equals, "git@github.com:src-d/go-git")
+	c.Assert(u.ApplyInsteadOf("https://gitlab.com/foo"), Equals, "https://gitlab.com/foo")
+}
+
+func (s *URLSuite) TestRewriteURLLongestPrefix(c *C) {
+	cfg := NewConfig()
+	cfg.URLs["https://mirror.example.com/"] = &URLConfig{
+		Name:      "https://mirror.example.com/",
+		InsteadOf: []string{"https://github.com/"},
+	}
+	cfg.URLs["https://src-d.example.com/"] = &URLConfig{
+		Name:      "https://src-d.example.com/",
+		InsteadOf: []string{"https://github.com/src-d/"},
+	}
+
+	c.Assert(cfg.RewriteURL("https://github.com/src-d/go-git"), Equals, "https://src-d.example.com/go-git")
+	c.Assert(cfg.RewriteURL("https://github.com/git/git"), Equals, "https://mirror.example.com/git/git")
+	c.Assert(cfg.RewriteURL("https://gitlab.com/foo"), Equals, "https://gitlab.com/foo")
+}
+
+func (s *URLSuite) TestRewritePushURL(c *C) {
+	cfg := NewConfig()
+	cfg.URLs["https://mirror.example.com/"] = &URLConfig{
+		Name:      "https://mirror.example.com/",
+		InsteadOf: []string{"https://github.com/"},
+	}
+	cfg.URLs["git@github.com:"] = &URLConfig{
+		Name:          "git@github.com:",
+		PushInsteadOf: []string{"https://github.com/src-d/"},
+	}
+
+	c.Assert(cfg.RewriteURL("https://github.com/src-d/go-git"), Equals, "https://mirror.example.com/src-d/go-git")
+	c.Assert(cfg.RewritePushURL("https://github.com/src-d/go-git"), Equals, "git@github.com:go-git")
+	c.Assert(cfg.RewritePushURL("https://github.com/git/git"), Equals, "https://mirror.example.com/git/git")
+}
+
+func (s *URLSuite) TestRemoteURLs(c *C) {
+	cfg := NewConfig()
+	cfg.URLs["https://mirror.example.com/"] = &URLConfig{
+		Name:      "https://mirror.example.com/",
+		InsteadOf: []string{"https://github.com/"},
+	}
+	cfg.URLs["git@github.com:"] = &URLConfig{
+		Name:          "git@github.com:",
+		PushInsteadOf: []string{"https://github.com/"},
+	}
+
+	r := &RemoteConfig{Name: "origin", URL: "https://github.com/src-d/go-git"}
+	c.Assert(cfg.FetchURL(r), Equals, "https://mirror.example.com/src-d/go-git")
+	c.Assert(cfg.PushURLs(r), DeepEquals, []string{"git@github.com:src-d/go-git"})
+
+	r.URLs = []string{"https://github.com/mcuadros/go-git"}
+	c.Assert(cfg.PushURLs(r), DeepEquals, []string{
+		"git@github.com:src-d/go-git",
+		"git@github.com:mcuadros/go-git",
+	})
+
+	r.PushURLs = []string{"https://github.com/mcuadros/go-git", "ssh://example.com/go-git"}
+	c.Assert(cfg.PushURLs(r), DeepEquals, []string{
+		"https://mirror.example.com/mcuadros/go-git",
+		"ssh://example.com/go-git",
+	})
+}
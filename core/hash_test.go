@@ -1,6 +1,7 @@
 package core
 
 import (
+	"sort"
 	"testing"
 
 	. "gopkg.in/check.v1"
@@ -40,3 +41,16 @@ func (s *HashSuite) TestNewHasher(c *C) {
 	hasher.Write([]byte(content))
 	c.Assert(hasher.Sum().String(), Equals, "dc42c3cc80028d0ec61f0a6b24cadd1c195c4dfc")
 }
+
+func (s *HashSuite) TestHashSlice(c *C) {
+	slice := HashSlice{
+		NewHash("2ea74d7f9dd9d25e1dc9f0d1be8fcb46cfd82d04"),
+		NewHash("0000000000000000000000000000000000000001"),
+		NewHash("1669dce138d9b841a518c64b10914d88f5e488ea"),
+	}
+
+	sort.Sort(slice)
+	c.Assert(slice[0].String(), Equals, "0000000000000000000000000000000000000001")
+	c.Assert(slice[1].String(), Equals, "1669dce138d9b841a518c64b10914d88f5e488ea")
+	c.Assert(slice[2].String(), Equals, "2ea74d7f9dd9d25e1dc9f0d1be8fcb46cfd82d04")
+}
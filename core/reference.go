@@ -21,6 +21,9 @@ const (
 var (
 	ErrMaxResolveRecursion = errors.New("max. recursion level reached")
 	ErrReferenceNotFound   = errors.New("reference not found")
+	// ErrReferenceHasChanged is returned when a reference was updated
+	// concurrently, and its value is not the expected one anymore.
+	ErrReferenceHasChanged = errors.New("reference has changed concurrently")
 )
 
 // ReferenceType reference type's
@@ -144,11 +147,31 @@ func (r *Reference) Strings() [2]string {
 	return o
 }
 
+// IsAbsent returns true if the reference is a hash reference to ZeroHash. As
+// in git, it is used as the expected value of a reference that must not exist.
+func (r *Reference) IsAbsent() bool {
+	return r.Type() == HashReference && r.Hash() == ZeroHash
+}
+
+// Equals returns true if both references have the same name, type and target.
+func (r *Reference) Equals(o *Reference) bool {
+	return r.Strings() == o.Strings()
+}
+
 func (r *Reference) String() string {
 	s := r.Strings()
 	return fmt.Sprintf("%s %s", s[1], s[0])
 }
 
+// ReflogEntry is a change of a reference recorded in its reflog. Committer is
+// the identity of who made the change encoded as in the commit headers,
+// "name <email> timestamp timezone".
+type ReflogEntry struct {
+	Old, New  Hash
+	Committer []byte
+	Message   string
+}
+
 // ReferenceSliceIter implements ReferenceIter. It iterates over a series of
 // references stored in a slice and yields each one in turn when Next() is
 // called.
@@ -44,6 +44,13 @@ func (s *ReferenceSuite) TestNewHashReference(c *C) {
 	c.Assert(r.Hash(), Equals, NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
 }
 
+func (s *ReferenceSuite) TestEquals(c *C) {
+	r := NewHashReference(ExampleReferenceName, NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(r.Equals(NewReferenceFromStrings("refs/heads/v4", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")), Equals, true)
+	c.Assert(r.Equals(NewHashReference(ExampleReferenceName, ZeroHash)), Equals, false)
+	c.Assert(r.Equals(NewSymbolicReference(ExampleReferenceName, HEAD)), Equals, false)
+}
+
 func (s *ReferenceSuite) TestIsBranch(c *C) {
 	r := NewHashReference(ExampleReferenceName, ZeroHash)
 	c.Assert(r.IsBranch(), Equals, true)
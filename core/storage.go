@@ -3,6 +3,7 @@ package core
 import (
 	"errors"
 	"io"
+	"time"
 )
 
 var (
@@ -69,6 +70,109 @@ type ReferenceStorage interface {
 	Set(*Reference) error
 	Get(ReferenceName) (*Reference, error)
 	Iter() (ReferenceIter, error)
+	// CheckAndSetReference stores the new reference only if the stored value
+	// of the reference is equal to old, otherwise ErrReferenceHasChanged is
+	// returned. If old is nil the reference is stored without any check, if
+	// old is absent (see Reference.IsAbsent) the reference must not exist.
+	CheckAndSetReference(new, old *Reference) error
+	// Remove deletes the reference with the given name, removing a reference
+	// that doesn't exist is not an error.
+	Remove(ReferenceName) error
+}
+
+// ReferenceStorageTx is an optional interface for ReferenceStorage, it enables
+// updating several references atomically.
+type ReferenceStorageTx interface {
+	// Begin starts a reference transaction.
+	Begin() TxReferenceStorage
+}
+
+// TxReferenceStorage is an in-progress reference storage transaction. The
+// changes are not visible until Commit is called, then all of them are applied
+// or none, if any of the checks fails Commit returns ErrReferenceHasChanged.
+// A transaction must end with a call to Commit or Rollback.
+type TxReferenceStorage interface {
+	// CheckAndSetReference queues the update of a reference, with the same
+	// semantics as ReferenceStorage.CheckAndSetReference.
+	CheckAndSetReference(new, old *Reference) error
+	// CheckAndRemoveReference queues the removal of the reference with the
+	// given name, if old is not nil the reference is only removed if its
+	// stored value is equal to old, or if it doesn't exist when old is absent.
+	CheckAndRemoveReference(n ReferenceName, old *Reference) error
+	Commit() error
+	Rollback() error
+}
+
+// ReflogTxReferenceStorage is an optional interface for TxReferenceStorage,
+// for the storages recording the changes in the reflog, it sets the message
+// of the reflog entries of the transaction.
+type ReflogTxReferenceStorage interface {
+	SetReflogMessage(msg string)
+}
+
+// AlternatesObjectStorage is an optional interface for ObjectStorage, it
+// reads objects from the object directories of other repositories, as the
+// git alternates do.
+type AlternatesObjectStorage interface {
+	// AddAlternate adds the object directory at the given path as an
+	// alternate, its objects become available from the storage.
+	AddAlternate(path string) error
+	// AlternateReferences returns the references of the repositories of the
+	// alternates, its objects don't need to be fetched.
+	AlternateReferences() ([]*Reference, error)
+}
+
+// PackedObjectStorage is an optional interface for ObjectStorage, for the
+// storages keeping the objects in packfiles, it allows to replace the
+// packfiles when the objects are repacked.
+type PackedObjectStorage interface {
+	// ObjectPacks returns the hashes of the packfiles of the storage.
+	ObjectPacks() ([]Hash, error)
+	// ObjectPackHashes returns the hashes of the objects of a packfile.
+	ObjectPackHashes(pack Hash) ([]Hash, error)
+	// ObjectPackTime returns the last modification time of a packfile.
+	ObjectPackTime(pack Hash) (time.Time, error)
+	// DeleteObjectPack deletes a packfile, its objects are no longer
+	// available unless they are stored somewhere else.
+	DeleteObjectPack(pack Hash) error
+}
+
+// VerifiablePackedObjectStorage is an optional interface for
+// PackedObjectStorage, it checks the integrity of the packfiles on disk.
+type VerifiablePackedObjectStorage interface {
+	// VerifyObjectPack checks the checksum of a packfile and the CRC32 of
+	// every entry listed in its index.
+	VerifyObjectPack(pack Hash) error
+}
+
+// LooseObjectStorage is an optional interface for ObjectStorage, for the
+// storages keeping objects one by one, as the git loose objects, it allows to
+// delete them once they are packed or unreachable.
+type LooseObjectStorage interface {
+	// LooseObjects returns the hashes of the loose objects of the storage.
+	LooseObjects() ([]Hash, error)
+	// LooseObjectTime returns the last modification time of a loose object.
+	LooseObjectTime(Hash) (time.Time, error)
+	// SetLooseObjectTime changes the last modification time of a loose
+	// object, fs.ErrNotSupported is returned if the storage can't change it.
+	SetLooseObjectTime(Hash, time.Time) error
+	// DeleteLooseObject deletes a loose object, the object is no longer
+	// available unless it is stored somewhere else.
+	DeleteLooseObject(Hash) error
+}
+
+// ReflogStorage is an optional interface for ReferenceStorage, it gives access
+// to the reflog, the log of the changes of every reference. The storages
+// implementing it record the changes of the references on their own.
+type ReflogStorage interface {
+	// Reflog returns the entries of the reflog of the given reference, from
+	// the oldest to the newest. A reference without reflog has no entries.
+	Reflog(ReferenceName) ([]*ReflogEntry, error)
+	// AppendReflog adds an entry at the end of the reflog of a reference.
+	AppendReflog(ReferenceName, *ReflogEntry) error
+	// SetReflog replaces all the entries of the reflog of a reference, it's
+	// used to expire old entries.
+	SetReflog(ReferenceName, []*ReflogEntry) error
 }
 
 // ReferenceIter is a generic closable interface for iterating over references
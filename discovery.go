@@ -0,0 +1,400 @@
+package git
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+	"gopkg.in/src-d/go-git.v4/utils/fs"
+	osfs "gopkg.in/src-d/go-git.v4/utils/fs/os"
+)
+
+const (
+	dotGitPath    = ".git"
+	commonDirPath = "commondir"
+	gitDirPrefix  = "gitdir:"
+	lockSuffix    = ".lock"
+)
+
+var (
+	// ErrRepositoryNotExists is returned by OpenFilesystemRepository when no
+	// repository is found at the given path.
+	ErrRepositoryNotExists = errors.New("repository not exists")
+	// ErrInvalidGitFile is returned by OpenFilesystemRepository when a .git
+	// file doesn't point to a git directory.
+	ErrInvalidGitFile = errors.New("invalid .git file")
+
+	errCrossWorktree = errors.New("rename between working tree and common directory")
+)
+
+// OpenFilesystemRepository opens the repository owning the given path, that
+// can be a working directory, a git directory or any file or directory inside
+// them, depending on the options. The .git files pointing to other git
+// directories, as the ones of the submodules and the linked working trees, are
+// followed.
+func OpenFilesystemRepository(path string, o *OpenOptions) (*Repository, error) {
+	gitDir, workTree, err := discoverRepository(path, o)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := newDiscoveredStorage(gitDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.WorkTree == "" {
+		if workTree, err = configuredWorkTree(s, gitDir, workTree); err != nil {
+			return nil, err
+		}
+	}
+
+	r, err := NewRepository(s)
+	if err != nil {
+		return nil, err
+	}
+
+	r.wt = workTree
+	r.gitDir = gitDir
+	return r, nil
+}
+
+// discoverRepository returns the absolute paths of the git directory and the
+// working directory of the repository owning path, the working directory is
+// empty for the bare repositories.
+func discoverRepository(path string, o *OpenOptions) (gitDir, workTree string, err error) {
+	if path, err = startDir(path); err != nil {
+		return "", "", err
+	}
+
+	if o.GitDir != "" {
+		gitDir, workTree = absPath(path, o.GitDir), path
+		if fi, err := os.Stat(gitDir); err == nil && !fi.IsDir() {
+			if gitDir, err = readGitFile(gitDir); err != nil {
+				return "", "", err
+			}
+		}
+
+		if !isGitDir(gitDir) {
+			return "", "", ErrRepositoryNotExists
+		}
+	} else {
+		for dir := path; ; {
+			gitDir, workTree, err = gitDirAt(dir)
+			if err != ErrRepositoryNotExists || !o.DetectDotGit {
+				break
+			}
+
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+
+			dir = parent
+		}
+
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	if o.WorkTree != "" {
+		workTree = absPath(path, o.WorkTree)
+	}
+
+	return gitDir, workTree, nil
+}
+
+// configuredWorkTree returns the working directory set by core.worktree, or
+// none if core.bare is set, otherwise the given one. As git does, they only
+// apply to the main working tree, not to the linked ones.
+func configuredWorkTree(s *filesystem.Storage, gitDir, workTree string) (string, error) {
+	common, err := commonDir(gitDir)
+	if err != nil {
+		return "", err
+	}
+
+	if common != gitDir {
+		return workTree, nil
+	}
+
+	cfg, err := s.ConfigStorage().Config()
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case cfg.Core.Worktree != "":
+		return absPath(gitDir, cfg.Core.Worktree), nil
+	case cfg.Core.IsBare:
+		return "", nil
+	default:
+		return workTree, nil
+	}
+}
+
+// startDir returns the absolute path of the directory where the lookup
+// starts, the directory of path if it's a file.
+func startDir(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	if !fi.IsDir() {
+		path = filepath.Dir(path)
+	}
+
+	return path, nil
+}
+
+// gitDirAt returns the git directory and the working directory of the
+// repository at dir, dir may contain a .git directory or file, or be a bare
+// repository.
+func gitDirAt(dir string) (gitDir, workTree string, err error) {
+	dotGit := filepath.Join(dir, dotGitPath)
+	fi, err := os.Stat(dotGit)
+	switch {
+	case err == nil && fi.IsDir():
+		if isGitDir(dotGit) {
+			return dotGit, dir, nil
+		}
+	case err == nil:
+		gitDir, err := readGitFile(dotGit)
+		if err != nil {
+			return "", "", err
+		}
+
+		if !isGitDir(gitDir) {
+			return "", "", ErrInvalidGitFile
+		}
+
+		return gitDir, dir, nil
+	case !os.IsNotExist(err):
+		return "", "", err
+	}
+
+	if isGitDir(dir) {
+		return dir, "", nil
+	}
+
+	return "", "", ErrRepositoryNotExists
+}
+
+// readGitFile returns the absolute path of the git directory a .git file
+// points to, the relative paths are relative to the directory of the file.
+func readGitFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	line := strings.TrimSpace(string(content))
+	if !strings.HasPrefix(line, gitDirPrefix) {
+		return "", ErrInvalidGitFile
+	}
+
+	gitDir := strings.TrimSpace(strings.TrimPrefix(line, gitDirPrefix))
+	if gitDir == "" {
+		return "", ErrInvalidGitFile
+	}
+
+	return absPath(filepath.Dir(path), gitDir), nil
+}
+
+// isGitDir returns true if dir looks like a git directory, as git does it
+// requires a HEAD file and the objects and refs directories, that for a
+// linked working tree are in the common directory.
+func isGitDir(dir string) bool {
+	fi, err := os.Stat(filepath.Join(dir, "HEAD"))
+	if err != nil || fi.IsDir() {
+		return false
+	}
+
+	common, err := commonDir(dir)
+	if err != nil {
+		return false
+	}
+
+	for _, path := range []string{"objects", "refs"} {
+		fi, err := os.Stat(filepath.Join(common, path))
+		if err != nil || !fi.IsDir() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// commonDir returns the git directory shared by the linked working trees, as
+// written in the commondir file, or the given git directory if it has no
+// commondir file.
+func commonDir(gitDir string) (string, error) {
+	content, err := ioutil.ReadFile(filepath.Join(gitDir, commonDirPath))
+	if os.IsNotExist(err) {
+		return gitDir, nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return absPath(gitDir, strings.TrimSpace(string(content))), nil
+}
+
+// absPath returns path as an absolute path, the relative paths are relative
+// to base.
+func absPath(base, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+
+	return filepath.Join(base, path)
+}
+
+// newDiscoveredStorage returns a storage over the given git directory, that
+// can belong to a linked working tree.
+func newDiscoveredStorage(gitDir string) (*filesystem.Storage, error) {
+	common, err := commonDir(gitDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var dir fs.Filesystem = osfs.NewOS(gitDir)
+	if common != gitDir {
+		dir = &worktreeFilesystem{Filesystem: osfs.NewOS(common), worktree: dir, dir: "."}
+	}
+
+	return newOSStorage(dir)
+}
+
+// worktreeFilesystem is the git directory of a linked working tree, created by
+// git worktree add. The files of the working tree, as HEAD, the index, the
+// pseudo references and the refs/bisect and refs/worktree references, are in
+// its own git directory, and the rest of the files are in the common git
+// directory.
+type worktreeFilesystem struct {
+	fs.Filesystem
+	worktree fs.Filesystem
+	// dir is the path of the filesystem in the git directory, as given to Dir
+	dir string
+}
+
+func (w *worktreeFilesystem) Create(filename string) (fs.File, error) {
+	return w.route(filename).Create(filename)
+}
+
+func (w *worktreeFilesystem) Open(filename string) (fs.File, error) {
+	return w.route(filename).Open(filename)
+}
+
+func (w *worktreeFilesystem) OpenFile(filename string, flag int, perm os.FileMode) (fs.File, error) {
+	return w.route(filename).OpenFile(filename, flag, perm)
+}
+
+func (w *worktreeFilesystem) Stat(filename string) (fs.FileInfo, error) {
+	return w.route(filename).Stat(filename)
+}
+
+// ReadDir reads a directory of the filesystem holding it, the refs directory
+// is read from both, with the working tree references from its own.
+func (w *worktreeFilesystem) ReadDir(path string) ([]fs.FileInfo, error) {
+	infos, err := w.route(path).ReadDir(path)
+	if err != nil || w.name(path) != "refs" {
+		return infos, err
+	}
+
+	own, err := w.worktree.ReadDir(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var merged []fs.FileInfo
+	for _, fi := range infos {
+		if !isWorktreeRefsDir(fi.Name()) {
+			merged = append(merged, fi)
+		}
+	}
+
+	for _, fi := range own {
+		if isWorktreeRefsDir(fi.Name()) {
+			merged = append(merged, fi)
+		}
+	}
+
+	return merged, nil
+}
+
+func (w *worktreeFilesystem) TempFile(dir, prefix string) (fs.File, error) {
+	return w.route(w.Join(dir, prefix)).TempFile(dir, prefix)
+}
+
+func (w *worktreeFilesystem) MkdirAll(filename string, perm os.FileMode) error {
+	return w.route(filename).MkdirAll(filename, perm)
+}
+
+func (w *worktreeFilesystem) Dir(path string) fs.Filesystem {
+	return &worktreeFilesystem{
+		Filesystem: w.Filesystem.Dir(path),
+		worktree:   w.worktree.Dir(path),
+		dir:        w.name(path),
+	}
+}
+
+func (w *worktreeFilesystem) Rename(from, to string) error {
+	target := w.route(to)
+	if target != w.route(from) {
+		return &os.LinkError{Op: "rename", Old: from, New: to, Err: errCrossWorktree}
+	}
+
+	return target.Rename(from, to)
+}
+
+func (w *worktreeFilesystem) Remove(filename string) error {
+	return w.route(filename).Remove(filename)
+}
+
+func (w *worktreeFilesystem) Chtimes(filename string, atime, mtime time.Time) error {
+	target, ok := w.route(filename).(fs.ChtimesFilesystem)
+	if !ok {
+		return fs.ErrNotSupported
+	}
+
+	return target.Chtimes(filename, atime, mtime)
+}
+
+// route returns the filesystem holding the given file.
+func (w *worktreeFilesystem) route(filename string) fs.Filesystem {
+	name := strings.TrimSuffix(w.name(filename), lockSuffix)
+
+	switch {
+	case name == "HEAD" || name == "index" || name == "logs/HEAD",
+		!strings.Contains(name, "/") && strings.HasSuffix(name, "_HEAD"),
+		strings.HasPrefix(name, "refs/") && isWorktreeRefsDir(strings.Split(name, "/")[1]):
+		return w.worktree
+	default:
+		return w.Filesystem
+	}
+}
+
+// name returns the path of the given file in the git directory, with forward
+// slashes.
+func (w *worktreeFilesystem) name(filename string) string {
+	name := filepath.ToSlash(filepath.Join(w.dir, filename))
+	return strings.TrimPrefix(name, "/")
+}
+
+// isWorktreeRefsDir returns true for the directories of refs holding the
+// references of each working tree.
+func isWorktreeRefsDir(name string) bool {
+	return name == "bisect" || name == "worktree"
+}
@@ -0,0 +1,247 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/src-d/go-git.v4/core"
+	osfs "gopkg.in/src-d/go-git.v4/utils/fs/os"
+
+	. "gopkg.in/check.v1"
+)
+
+type DiscoverySuite struct {
+	BaseSuite
+}
+
+var _ = Suite(&DiscoverySuite{})
+
+func (s *DiscoverySuite) TestOpen(c *C) {
+	dir := s.initRepository(c, false)
+
+	r, err := OpenFilesystemRepository(dir, &OpenOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(r.WorkTree(), Equals, dir)
+
+	s.assertHead(c, r, "refs/heads/master")
+}
+
+func (s *DiscoverySuite) TestOpenNotExists(c *C) {
+	_, err := OpenFilesystemRepository(c.MkDir(), &OpenOptions{})
+	c.Assert(err, Equals, ErrRepositoryNotExists)
+
+	_, err = OpenFilesystemRepository(c.MkDir(), &OpenOptions{DetectDotGit: true})
+	c.Assert(err, Equals, ErrRepositoryNotExists)
+}
+
+func (s *DiscoverySuite) TestOpenDetectDotGit(c *C) {
+	dir := s.initRepository(c, false)
+	sub := filepath.Join(dir, "foo", "bar")
+	c.Assert(os.MkdirAll(sub, 0755), IsNil)
+	file := filepath.Join(sub, "qux")
+	c.Assert(ioutil.WriteFile(file, []byte("qux"), 0644), IsNil)
+
+	_, err := OpenFilesystemRepository(sub, &OpenOptions{})
+	c.Assert(err, Equals, ErrRepositoryNotExists)
+
+	for _, path := range []string{sub, file} {
+		r, err := OpenFilesystemRepository(path, &OpenOptions{DetectDotGit: true})
+		c.Assert(err, IsNil)
+		c.Assert(r.WorkTree(), Equals, dir)
+	}
+}
+
+func (s *DiscoverySuite) TestOpenBare(c *C) {
+	dir := s.initRepository(c, true)
+
+	r, err := OpenFilesystemRepository(filepath.Join(dir, "refs", "heads"), &OpenOptions{
+		DetectDotGit: true,
+	})
+
+	c.Assert(err, IsNil)
+	c.Assert(r.WorkTree(), Equals, "")
+	s.assertHead(c, r, "refs/heads/master")
+}
+
+func (s *DiscoverySuite) TestOpenGitFile(c *C) {
+	// the git directory of a non-bare repository, as git init --separate-git-dir
+	gitDir := filepath.Join(s.initRepository(c, false), ".git")
+	dir := c.MkDir()
+
+	rel, err := filepath.Rel(dir, gitDir)
+	c.Assert(err, IsNil)
+	err = ioutil.WriteFile(filepath.Join(dir, ".git"), []byte("gitdir: "+rel+"\n"), 0644)
+	c.Assert(err, IsNil)
+
+	r, err := OpenFilesystemRepository(dir, &OpenOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(r.WorkTree(), Equals, dir)
+	s.assertHead(c, r, "refs/heads/master")
+}
+
+func (s *DiscoverySuite) TestOpenInvalidGitFile(c *C) {
+	dir := c.MkDir()
+	for _, content := range []string{"foo", "gitdir: ", "gitdir: not-exists"} {
+		err := ioutil.WriteFile(filepath.Join(dir, ".git"), []byte(content), 0644)
+		c.Assert(err, IsNil)
+
+		_, err = OpenFilesystemRepository(dir, &OpenOptions{})
+		c.Assert(err, Equals, ErrInvalidGitFile)
+	}
+}
+
+func (s *DiscoverySuite) TestOpenGitDirAndWorkTree(c *C) {
+	// the git directory of a non-bare repository, as git init --separate-git-dir
+	gitDir := filepath.Join(s.initRepository(c, false), ".git")
+	dir := c.MkDir()
+
+	r, err := OpenFilesystemRepository(dir, &OpenOptions{GitDir: gitDir})
+	c.Assert(err, IsNil)
+	c.Assert(r.WorkTree(), Equals, dir)
+	s.assertHead(c, r, "refs/heads/master")
+
+	r, err = OpenFilesystemRepository(dir, &OpenOptions{GitDir: gitDir, WorkTree: "foo"})
+	c.Assert(err, IsNil)
+	c.Assert(r.WorkTree(), Equals, filepath.Join(dir, "foo"))
+
+	_, err = OpenFilesystemRepository(dir, &OpenOptions{GitDir: "not-exists"})
+	c.Assert(err, Equals, ErrRepositoryNotExists)
+}
+
+func (s *DiscoverySuite) TestOpenLinkedWorkTree(c *C) {
+	dir := c.MkDir()
+	main, err := NewFilesystemRepository(filepath.Join(dir, ".git"))
+	c.Assert(err, IsNil)
+	c.Assert(main.Clone(&CloneOptions{URL: RepositoryFixture}), IsNil)
+
+	// the layout written by git worktree add
+	wt := c.MkDir()
+	wtGitDir := filepath.Join(dir, ".git", "worktrees", "wt")
+	c.Assert(os.MkdirAll(wtGitDir, 0755), IsNil)
+	s.writeFile(c, filepath.Join(wtGitDir, "HEAD"), "918c48b83bd081e863dbe1b80f8998f058cd8294\n")
+	s.writeFile(c, filepath.Join(wtGitDir, "commondir"), "../..\n")
+	s.writeFile(c, filepath.Join(wtGitDir, "gitdir"), filepath.Join(wt, ".git")+"\n")
+	s.writeFile(c, filepath.Join(wt, ".git"), "gitdir: "+wtGitDir+"\n")
+
+	r, err := OpenFilesystemRepository(wt, &OpenOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(r.WorkTree(), Equals, wt)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Hash().String(), Equals, "918c48b83bd081e863dbe1b80f8998f058cd8294")
+
+	branch, err := r.Ref("refs/heads/master", true)
+	c.Assert(err, IsNil)
+	c.Assert(branch.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+	_, err = r.Commit(head.Hash())
+	c.Assert(err, IsNil)
+
+	// HEAD is updated in the git directory of the working tree
+	err = r.s.ReferenceStorage().Set(core.NewSymbolicReference(core.HEAD, "refs/heads/branch"))
+	c.Assert(err, IsNil)
+
+	content, err := ioutil.ReadFile(filepath.Join(wtGitDir, "HEAD"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "ref: refs/heads/branch\n")
+
+	head, err = main.Ref(core.HEAD, false)
+	c.Assert(err, IsNil)
+	c.Assert(head.Target(), Equals, core.ReferenceName("refs/heads/master"))
+}
+
+func (s *DiscoverySuite) TestOpenLinkedWorkTreeReferences(c *C) {
+	dir := c.MkDir()
+	main, err := NewFilesystemRepository(filepath.Join(dir, ".git"))
+	c.Assert(err, IsNil)
+	c.Assert(main.Clone(&CloneOptions{URL: RepositoryFixture}), IsNil)
+
+	wt := c.MkDir()
+	wtGitDir := filepath.Join(dir, ".git", "worktrees", "wt")
+	c.Assert(os.MkdirAll(filepath.Join(wtGitDir, "refs", "bisect"), 0755), IsNil)
+	s.writeFile(c, filepath.Join(wtGitDir, "HEAD"), "ref: refs/heads/master\n")
+	s.writeFile(c, filepath.Join(wtGitDir, "commondir"), "../..\n")
+	s.writeFile(c, filepath.Join(wtGitDir, "refs", "bisect", "bad"), "918c48b83bd081e863dbe1b80f8998f058cd8294\n")
+	s.writeFile(c, filepath.Join(wt, ".git"), "gitdir: "+wtGitDir+"\n")
+
+	r, err := OpenFilesystemRepository(wt, &OpenOptions{})
+	c.Assert(err, IsNil)
+
+	ref := core.NewReferenceFromStrings("refs/worktree/foo", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	c.Assert(r.s.ReferenceStorage().Set(ref), IsNil)
+
+	_, err = os.Stat(filepath.Join(wtGitDir, "refs", "worktree", "foo"))
+	c.Assert(err, IsNil)
+	_, err = os.Stat(filepath.Join(dir, ".git", "refs", "worktree"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	iter, err := r.Refs()
+	c.Assert(err, IsNil)
+
+	found := make(map[core.ReferenceName]bool, 0)
+	c.Assert(iter.ForEach(func(ref *core.Reference) error {
+		found[ref.Name()] = true
+		return nil
+	}), IsNil)
+
+	c.Assert(found["refs/heads/master"], Equals, true)
+	c.Assert(found["refs/bisect/bad"], Equals, true)
+	c.Assert(found["refs/worktree/foo"], Equals, true)
+
+	_, err = main.Ref("refs/worktree/foo", false)
+	c.Assert(err, NotNil)
+}
+
+func (s *DiscoverySuite) TestOpenCoreWorkTree(c *C) {
+	dir := c.MkDir()
+	r, err := Init(osfs.NewOS(dir), false)
+	c.Assert(err, IsNil)
+
+	cfg, err := r.s.ConfigStorage().Config()
+	c.Assert(err, IsNil)
+	cfg.Core.Worktree = "../work"
+	c.Assert(r.s.ConfigStorage().SetConfig(cfg), IsNil)
+
+	r, err = OpenFilesystemRepository(dir, &OpenOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(r.WorkTree(), Equals, filepath.Join(dir, "work"))
+
+	r, err = OpenFilesystemRepository(dir, &OpenOptions{WorkTree: "foo"})
+	c.Assert(err, IsNil)
+	c.Assert(r.WorkTree(), Equals, filepath.Join(dir, "foo"))
+}
+
+func (s *DiscoverySuite) TestOpenCoreBare(c *C) {
+	dir := c.MkDir()
+	r, err := Init(osfs.NewOS(dir), false)
+	c.Assert(err, IsNil)
+
+	cfg, err := r.s.ConfigStorage().Config()
+	c.Assert(err, IsNil)
+	cfg.Core.IsBare = true
+	c.Assert(r.s.ConfigStorage().SetConfig(cfg), IsNil)
+
+	r, err = OpenFilesystemRepository(dir, &OpenOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(r.WorkTree(), Equals, "")
+}
+
+func (s *DiscoverySuite) initRepository(c *C, bare bool) string {
+	dir := c.MkDir()
+	_, err := Init(osfs.NewOS(dir), bare)
+	c.Assert(err, IsNil)
+
+	return dir
+}
+
+func (s *DiscoverySuite) assertHead(c *C, r *Repository, target core.ReferenceName) {
+	head, err := r.Ref(core.HEAD, false)
+	c.Assert(err, IsNil)
+	c.Assert(head.Target(), Equals, target)
+}
+
+func (s *DiscoverySuite) writeFile(c *C, path, content string) {
+	c.Assert(ioutil.WriteFile(path, []byte(content), 0644), IsNil)
+}
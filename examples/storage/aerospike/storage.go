@@ -253,6 +253,36 @@ func (s *ReferenceStorage) Get(n core.ReferenceName) (*core.Reference, error) {
 	), nil
 }
 
+// CheckAndSetReference stores a reference if the stored one is equal to old,
+// or doesn't exist if old is absent. The check and the update are not atomic.
+func (s *ReferenceStorage) CheckAndSetReference(new, old *core.Reference) error {
+	if old != nil {
+		current, err := s.Get(new.Name())
+		switch {
+		case old.IsAbsent() && err == core.ErrReferenceNotFound:
+		case old.IsAbsent() && err == nil:
+			return core.ErrReferenceHasChanged
+		case err != nil:
+			return err
+		case !current.Equals(old):
+			return core.ErrReferenceHasChanged
+		}
+	}
+
+	return s.Set(new)
+}
+
+// Remove deletes the reference with the given name
+func (s *ReferenceStorage) Remove(n core.ReferenceName) error {
+	key, err := s.buildKey(n)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.Delete(nil, key)
+	return err
+}
+
 func (s *ReferenceStorage) buildKey(n core.ReferenceName) (*driver.Key, error) {
 	return driver.NewKey(s.ns, referencesSet, fmt.Sprintf("%s|%s", s.url, n))
 }
@@ -21,7 +21,8 @@ func NewFile(name string, m os.FileMode, b *Blob) *File {
 	return &File{Name: name, Mode: m, Blob: *b}
 }
 
-// Contents returns the contents of a file as a string.
+// Contents returns the contents of a file as a string, the whole content is
+// loaded in memory.
 func (f *File) Contents() (content string, err error) {
 	reader, err := f.Reader()
 	if err != nil {
@@ -2,6 +2,7 @@ package git
 
 import (
 	"io"
+	"io/ioutil"
 
 	"gopkg.in/src-d/go-git.v4/core"
 	"gopkg.in/src-d/go-git.v4/fixtures"
@@ -111,6 +112,25 @@ func (s *FileSuite) TestContents(c *C) {
 	}
 }
 
+func (s *FileSuite) TestReader(c *C) {
+	for i, t := range contentsTests {
+		commit, err := s.Repositories[t.repo].Commit(core.NewHash(t.commit))
+		c.Assert(err, IsNil, Commentf("subtest %d: %v (%s)", i, err, t.commit))
+
+		file, err := commit.File(t.path)
+		c.Assert(err, IsNil)
+
+		r, err := file.Reader()
+		c.Assert(err, IsNil)
+
+		content, err := ioutil.ReadAll(r)
+		c.Assert(err, IsNil)
+		c.Assert(r.Close(), IsNil)
+		c.Assert(string(content), Equals, t.contents, Commentf(
+			"subtest %d: commit=%s, path=%s", i, t.commit, t.path))
+	}
+}
+
 var linesTests = []struct {
 	repo   string   // the repo name as in localRepos
 	commit string   // the commit to search for the file
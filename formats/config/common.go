@@ -9,6 +9,10 @@ type Config struct {
 	Comment  *Comment
 	Sections Sections
 	Includes Includes
+
+	// doc is the layout of the decoded file, nil for the configs not read by
+	// a Decoder.
+	doc *document
 }
 
 type Includes []*Include
@@ -52,6 +56,17 @@ func (s *Config) AddOption(section string, subsection string, key string, value
 	return s
 }
 
+// addOption adds the given option to a section or subsection.
+func (c *Config) addOption(section string, subsection string, o *Option) {
+	if subsection == NoSubsection {
+		s := c.Section(section)
+		s.Options = append(s.Options, o)
+	} else {
+		ss := c.Section(section).Subsection(subsection)
+		ss.Options = append(ss.Options, o)
+	}
+}
+
 // SetOption is a convenience method to set an option to a given
 // section and subsection.
 //
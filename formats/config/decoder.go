@@ -1,9 +1,10 @@
 package config
 
 import (
+	"bytes"
+	"fmt"
 	"io"
-
-	"github.com/src-d/gcfg"
+	"io/ioutil"
 )
 
 // A Decoder reads and decodes config files from an input stream.
@@ -17,21 +18,325 @@ func NewDecoder(r io.Reader) *Decoder {
 }
 
 // Decode reads the whole config from its input and stores it in the
-// value pointed to by config.
+// value pointed to by config. The original text of the file, including the
+// comments and the layout, is kept in config, so encoding it writes the same
+// file back, with only the changes made to config.
 func (d *Decoder) Decode(config *Config) error {
-	cb := func(s string, ss string, k string, v string, bv bool) error {
-		if ss == "" && k == "" {
-			config.Section(s)
-			return nil
+	if config.doc == nil {
+		config.doc = &document{}
+	}
+
+	return d.decode(func(e *entry) error {
+		switch e.kind {
+		case headerEntry:
+			s := config.Section(e.section)
+			if e.subsection != NoSubsection {
+				s.Subsection(e.subsection)
+			}
+		case optionEntry:
+			config.addOption(e.section, e.subsection, e.option())
 		}
 
-		if ss != "" && k == "" {
-			config.Section(s).Subsection(ss)
+		config.doc.entries = append(config.doc.entries, e)
+		return nil
+	})
+}
+
+// DecodeFunc reads the whole config from its input and calls fn for every
+// option, in the order they are found.
+func (d *Decoder) DecodeFunc(fn func(section, subsection string, o *Option) error) error {
+	return d.decode(func(e *entry) error {
+		if e.kind != optionEntry {
 			return nil
 		}
 
-		config.AddOption(s, ss, k, v)
+		return fn(e.section, e.subsection, e.option())
+	})
+}
+
+func (d *Decoder) decode(fn func(*entry) error) error {
+	src, err := ioutil.ReadAll(d)
+	if err != nil {
+		return err
+	}
+
+	p := &parser{src: src, line: 1}
+	for p.pos < len(p.src) {
+		e, err := p.next()
+		if err != nil {
+			return err
+		}
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parser splits a config file in entries, keeping the original text.
+type parser struct {
+	src  []byte
+	pos  int
+	line int
+
+	section    string
+	subsection string
+	inSection  bool
+}
+
+// next parses the next line, or lines for the values with continuations.
+func (p *parser) next() (*entry, error) {
+	start := p.pos
+	p.skipSpaces()
+
+	var e *entry
+	var err error
+	switch c := p.peek(); {
+	case c == eof || c == '\n' || c == '\r' || c == '#' || c == ';':
+		p.skipLine()
+		e = &entry{kind: triviaEntry}
+	case c == '[':
+		e, err = p.header()
+	default:
+		e, err = p.option()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	e.text = string(p.src[start:p.pos])
+	return e, nil
+}
+
+func (p *parser) header() (*entry, error) {
+	p.pos++
+	name := p.name(isSectionChar)
+	if name == "" {
+		return nil, p.errorf("invalid section name")
+	}
+
+	subsection := NoSubsection
+	p.skipSpaces()
+	if p.peek() == '"' {
+		p.pos++
+		var buf bytes.Buffer
+		for {
+			c := p.peek()
+			if c == eof || c == '\n' || c == '\r' {
+				return nil, p.errorf("unterminated subsection name")
+			}
+
+			p.pos++
+			if c == '"' {
+				break
+			}
+
+			if c == '\\' {
+				c = p.peek()
+				if c == eof || c == '\n' || c == '\r' {
+					return nil, p.errorf("unterminated subsection name")
+				}
+
+				p.pos++
+			}
+
+			buf.WriteByte(byte(c))
+		}
+
+		subsection = buf.String()
+		if subsection == NoSubsection {
+			return nil, p.errorf("empty subsection name")
+		}
+	}
+
+	if p.peek() != ']' {
+		return nil, p.errorf("invalid section header")
+	}
+
+	p.pos++
+	if err := p.endOfLine(); err != nil {
+		return nil, err
+	}
+
+	p.section, p.subsection, p.inSection = name, subsection, true
+	return &entry{kind: headerEntry, section: name, subsection: subsection}, nil
+}
+
+func (p *parser) option() (*entry, error) {
+	if !p.inSection {
+		return nil, p.errorf("option outside of a section")
+	}
+
+	key := p.name(isKeyChar)
+	if key == "" || !isLetter(key[0]) {
+		return nil, p.errorf("invalid option name")
+	}
+
+	e := &entry{kind: optionEntry, section: p.section, subsection: p.subsection, key: key}
+	p.skipSpaces()
+	if p.peek() != '=' {
+		e.noValue = true
+		return e, p.endOfLine()
+	}
+
+	p.pos++
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+
+	e.value = value
+	return e, nil
+}
+
+// value parses a value as git does: the whitespaces around it and the
+// comments are discarded, the quotes are removed and the escape sequences and
+// the line continuations are resolved.
+func (p *parser) value() (string, error) {
+	var buf, spaces bytes.Buffer
+	quote := false
+	for {
+		c := p.peek()
+		switch {
+		case c == eof:
+			if quote {
+				return "", p.errorf("unterminated quote")
+			}
+
+			return buf.String(), nil
+		case c == '\n' || (c == '\r' && p.peekAt(1) == '\n'):
+			if quote {
+				return "", p.errorf("unterminated quote")
+			}
+
+			p.skipLine()
+			return buf.String(), nil
+		case !quote && (c == '#' || c == ';'):
+			p.skipLine()
+			return buf.String(), nil
+		case !quote && (c == ' ' || c == '\t'):
+			p.pos++
+			if buf.Len() > 0 {
+				spaces.WriteByte(byte(c))
+			}
+
+			continue
+		}
+
+		p.pos++
+		if c == '"' {
+			quote = !quote
+			continue
+		}
+
+		if c == '\\' {
+			if p.continuation() {
+				continue
+			}
+
+			var ok bool
+			if c, ok = escapes[p.peek()]; !ok {
+				return "", p.errorf("invalid escape sequence")
+			}
+
+			p.pos++
+		}
+
+		buf.Write(spaces.Bytes())
+		spaces.Reset()
+		buf.WriteByte(byte(c))
+	}
+}
+
+// continuation skips the line break after a backslash, if any.
+func (p *parser) continuation() bool {
+	switch {
+	case p.peek() == '\n':
+		p.pos++
+	case p.peek() == '\r' && p.peekAt(1) == '\n':
+		p.pos += 2
+	default:
+		return false
+	}
+
+	p.line++
+	return true
+}
+
+// endOfLine skips the rest of the line, that can only contain a comment.
+func (p *parser) endOfLine() error {
+	p.skipSpaces()
+	switch c := p.peek(); {
+	case c == eof, c == '\n', c == '\r', c == '#', c == ';':
+		p.skipLine()
 		return nil
+	default:
+		return p.errorf("unexpected character %q", c)
+	}
+}
+
+func (p *parser) name(valid func(byte) bool) string {
+	start := p.pos
+	for p.pos < len(p.src) && valid(p.src[p.pos]) {
+		p.pos++
 	}
-	return gcfg.ReadWithCallback(d, cb)
+
+	return string(p.src[start:p.pos])
+}
+
+func (p *parser) skipSpaces() {
+	for p.peek() == ' ' || p.peek() == '\t' {
+		p.pos++
+	}
+}
+
+func (p *parser) skipLine() {
+	for p.pos < len(p.src) {
+		p.pos++
+		if p.src[p.pos-1] == '\n' {
+			p.line++
+			return
+		}
+	}
+}
+
+const eof = -1
+
+func (p *parser) peek() int {
+	return p.peekAt(0)
+}
+
+func (p *parser) peekAt(offset int) int {
+	if p.pos+offset >= len(p.src) {
+		return eof
+	}
+
+	return int(p.src[p.pos+offset])
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("config: line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+var escapes = map[int]int{
+	'n':  '\n',
+	't':  '\t',
+	'b':  '\b',
+	'"':  '"',
+	'\\': '\\',
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isKeyChar(c byte) bool {
+	return isLetter(c) || c >= '0' && c <= '9' || c == '-'
+}
+
+func isSectionChar(c byte) bool {
+	return isKeyChar(c) || c == '.'
 }
@@ -17,10 +17,68 @@ func (s *DecoderSuite) TestDecode(c *C) {
 		cfg := &Config{}
 		err := d.Decode(cfg)
 		c.Assert(err, IsNil, Commentf("decoder error for fixture: %d", idx))
-		c.Assert(cfg, DeepEquals, fixture.Config, Commentf("bad result for fixture: %d", idx))
+		c.Assert(cfg.Sections, DeepEquals, fixture.Config.Sections, Commentf("bad result for fixture: %d", idx))
 	}
 }
 
+func (s *DecoderSuite) TestDecodeValues(c *C) {
+	cfg := &Config{}
+	err := NewDecoder(bytes.NewReader([]byte(`[section]
+	quoted = "  foo ; bar # qux  "
+	escaped = foo\tbar\\qux\"\n
+	spaces = foo   bar  ; comment
+	continued = foo \
+bar\
+qux
+	empty =
+	bool
+	crlf = foo
+`))).Decode(cfg)
+	c.Assert(err, IsNil)
+
+	sect := cfg.Section("section")
+	c.Assert(sect.Option("quoted"), Equals, "  foo ; bar # qux  ")
+	c.Assert(sect.Option("escaped"), Equals, "foo\tbar\\qux\"\n")
+	c.Assert(sect.Option("spaces"), Equals, "foo   bar")
+	c.Assert(sect.Option("continued"), Equals, "foo barqux")
+	c.Assert(sect.Option("empty"), Equals, "")
+	c.Assert(sect.Options.GetAll("bool"), DeepEquals, []string{""})
+	c.Assert(sect.Options.GetOption("bool").NoValue, Equals, true)
+	c.Assert(sect.Options.GetOption("empty").NoValue, Equals, false)
+	c.Assert(sect.Option("crlf"), Equals, "foo")
+}
+
+func (s *DecoderSuite) TestDecodeSubsectionEscapes(c *C) {
+	cfg := &Config{}
+	err := NewDecoder(bytes.NewReader([]byte(`[remote "foo \"bar\" \\ qux"]
+	url = foo
+`))).Decode(cfg)
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Section("remote").HasSubsection(`foo "bar" \ qux`), Equals, true)
+}
+
+func (s *DecoderSuite) TestDecodeFunc(c *C) {
+	var values []string
+	err := NewDecoder(bytes.NewReader([]byte(`[a]
+	x = 1
+[b "c"]
+	y = 2
+[a]
+	x = 3
+`))).DecodeFunc(func(section, subsection string, o *Option) error {
+		values = append(values, section+"."+subsection+"."+o.Key+"="+o.Value)
+		return nil
+	})
+
+	c.Assert(err, IsNil)
+	c.Assert(values, DeepEquals, []string{"a..x=1", "b.c.y=2", "a..x=3"})
+}
+
+func (s *DecoderSuite) TestDecodeFailsWithInvalidEscape(c *C) {
+	decodeFails(c, "[section]\nkey = foo\\qux")
+	decodeFails(c, "[section]\nkey = \"foo\nbar\"")
+}
+
 func (s *DecoderSuite) TestDecodeFailsWithIdentBeforeSection(c *C) {
 	t := `
 	key=value
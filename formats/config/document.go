@@ -0,0 +1,223 @@
+package config
+
+import "strings"
+
+type entryKind int
+
+const (
+	// triviaEntry is a blank or comment line.
+	triviaEntry entryKind = iota
+	// headerEntry is a section or subsection header.
+	headerEntry
+	// optionEntry is an option, that can span several lines.
+	optionEntry
+)
+
+// entry is a part of a decoded config file, with its original text.
+type entry struct {
+	kind entryKind
+	// text is the original text, including the line breaks.
+	text       string
+	section    string
+	subsection string
+	key        string
+	value      string
+	noValue    bool
+}
+
+// option returns the option of an option entry.
+func (e *entry) option() *Option {
+	return &Option{Key: e.key, Value: e.value, NoValue: e.noValue}
+}
+
+// document is the layout of a decoded config file, used to encode it back
+// without losing the comments, the formatting and the order of the sections.
+type document struct {
+	entries []*entry
+}
+
+// scopeKey identifies a section or subsection, the section names are case
+// insensitive.
+type scopeKey struct {
+	section    string
+	subsection string
+}
+
+func newScopeKey(section, subsection string) scopeKey {
+	return scopeKey{strings.ToLower(section), subsection}
+}
+
+// scope is a section or subsection, as found in the document and in the
+// config being encoded.
+type scope struct {
+	section    string
+	subsection string
+	// options are the options of the config.
+	options Options
+	// inConfig is true if the section or subsection exists in the config.
+	inConfig bool
+	// headers are the headers of the blocks of the scope in the document.
+	headers []*entry
+	// entries are the options of the scope in the document.
+	entries []*entry
+}
+
+// layout is the plan to encode a config over its decoded document.
+type layout struct {
+	scopes map[scopeKey]*scope
+	// order is the order of the scopes in the config.
+	order []*scope
+	// header of each entry of the document, nil before the first header.
+	header map[*entry]*entry
+	// last is the last header or option of the block of each header.
+	last map[*entry]*entry
+	// kept are the option entries of the document still in the config.
+	kept map[*entry]bool
+	// inserted are the options of the config not in the document, to be
+	// written after the given entry.
+	inserted map[*entry]Options
+}
+
+func newLayout(cfg *Config) *layout {
+	l := &layout{
+		scopes:   make(map[scopeKey]*scope, 0),
+		header:   make(map[*entry]*entry, 0),
+		last:     make(map[*entry]*entry, 0),
+		kept:     make(map[*entry]bool, 0),
+		inserted: make(map[*entry]Options, 0),
+	}
+
+	for _, s := range cfg.Sections {
+		l.addConfigScope(s.Name, NoSubsection, s.Options)
+		for _, ss := range s.Subsections {
+			l.addConfigScope(s.Name, ss.Name, ss.Options)
+		}
+	}
+
+	var header *entry
+	for _, e := range cfg.doc.entries {
+		switch e.kind {
+		case headerEntry:
+			header = e
+			l.last[e] = e
+			s := l.scope(e.section, e.subsection)
+			s.headers = append(s.headers, e)
+		case optionEntry:
+			l.last[header] = e
+			s := l.scope(e.section, e.subsection)
+			s.entries = append(s.entries, e)
+		}
+
+		l.header[e] = header
+	}
+
+	for _, s := range l.scopes {
+		if s.inConfig && len(s.headers) > 0 {
+			l.merge(s)
+		}
+	}
+
+	return l
+}
+
+func (l *layout) scope(section, subsection string) *scope {
+	k := newScopeKey(section, subsection)
+	s, ok := l.scopes[k]
+	if !ok {
+		s = &scope{section: section, subsection: subsection}
+		l.scopes[k] = s
+	}
+
+	return s
+}
+
+func (l *layout) addConfigScope(section, subsection string, opts Options) {
+	s := l.scope(section, subsection)
+	if !s.inConfig {
+		s.inConfig = true
+		l.order = append(l.order, s)
+	}
+
+	s.options = append(s.options, opts...)
+}
+
+// merge matches the options of the scope in the config with the ones in the
+// document, using the longest common subsequence: the matching entries are
+// kept, and the rest of the options are inserted after the previous matching
+// entry.
+func (l *layout) merge(s *scope) {
+	n, m := len(s.entries), len(s.options)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			switch {
+			case matchEntry(s.entries[i], s.options[j]):
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var anchor *entry
+	var pending Options
+	for i, j := 0, 0; j < m; {
+		switch {
+		case i < n && matchEntry(s.entries[i], s.options[j]):
+			if anchor == nil && len(pending) > 0 {
+				header := l.header[s.entries[i]]
+				l.inserted[header] = append(l.inserted[header], pending...)
+				pending = nil
+			}
+
+			anchor = s.entries[i]
+			l.kept[anchor] = true
+			i++
+			j++
+		case i < n && lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			if anchor == nil {
+				pending = append(pending, s.options[j])
+			} else {
+				l.inserted[anchor] = append(l.inserted[anchor], s.options[j])
+			}
+
+			j++
+		}
+	}
+
+	if len(pending) > 0 {
+		last := l.last[s.headers[len(s.headers)-1]]
+		l.inserted[last] = append(l.inserted[last], pending...)
+	}
+}
+
+// removed returns true if the block of the given header must not be written,
+// because its section or subsection is not in the config.
+func (l *layout) removed(header *entry) bool {
+	if header == nil {
+		return false
+	}
+
+	return !l.scopes[newScopeKey(header.section, header.subsection)].inConfig
+}
+
+func matchEntry(e *entry, o *Option) bool {
+	return o.IsKey(e.key) && o.Value == e.value && o.NoValue == e.noValue
+}
+
+// indentation returns the leading whitespaces of the text of an entry.
+func indentation(e *entry) string {
+	if e.kind != optionEntry {
+		return "\t"
+	}
+
+	return e.text[:len(e.text)-len(strings.TrimLeft(e.text, " \t"))]
+}
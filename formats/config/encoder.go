@@ -3,20 +3,29 @@ package config
 import (
 	"fmt"
 	"io"
+	"strings"
 )
 
 // An Encoder writes config files to an output stream.
 type Encoder struct {
 	w io.Writer
+	// last is the last byte written.
+	last byte
 }
 
 // NewEncoder returns a new encoder that writes to w.
 func NewEncoder(w io.Writer) *Encoder {
-	return &Encoder{w}
+	return &Encoder{w: w}
 }
 
 // Encode writes the config in git config format to the stream of the encoder.
+// The configs read by a Decoder are written keeping the original text of the
+// sections and options not changed, with their comments and formatting.
 func (e *Encoder) Encode(cfg *Config) error {
+	if cfg.doc != nil {
+		return e.encodeDocument(cfg)
+	}
+
 	for _, s := range cfg.Sections {
 		if err := e.encodeSection(s); err != nil {
 			return err
@@ -32,7 +41,7 @@ func (e *Encoder) encodeSection(s *Section) error {
 			return err
 		}
 
-		if err := e.encodeOptions(s.Options); err != nil {
+		if err := e.encodeOptions("\t", s.Options); err != nil {
 			return err
 		}
 	}
@@ -47,21 +56,68 @@ func (e *Encoder) encodeSection(s *Section) error {
 }
 
 func (e *Encoder) encodeSubsection(sectionName string, s *Subsection) error {
-	//TODO: escape
-	if err := e.printf("[%s \"%s\"]\n", sectionName, s.Name); err != nil {
+	if err := e.printf("[%s \"%s\"]\n", sectionName, subsectionEscaper.Replace(s.Name)); err != nil {
 		return err
 	}
 
-	if err := e.encodeOptions(s.Options); err != nil {
-		return err
+	return e.encodeOptions("\t", s.Options)
+}
+
+func (e *Encoder) encodeOptions(indent string, opts Options) error {
+	for _, o := range opts {
+		var err error
+		if o.NoValue {
+			err = e.printf("%s%s\n", indent, o.Key)
+		} else {
+			err = e.printf("%s%s = %s\n", indent, o.Key, encodeValue(o.Value))
+		}
+
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (e *Encoder) encodeOptions(opts Options) error {
-	for _, o := range opts {
-		if err := e.printf("\t%s = %s\n", o.Key, o.Value); err != nil {
+// encodeDocument writes the decoded document of the config, skipping the
+// options and sections removed from the config and adding the new ones after
+// the options of the same section.
+func (e *Encoder) encodeDocument(cfg *Config) error {
+	l := newLayout(cfg)
+	for _, entry := range cfg.doc.entries {
+		header := l.header[entry]
+		if l.removed(header) {
+			continue
+		}
+
+		if entry.kind != optionEntry || l.kept[entry] {
+			if err := e.write(entry.text); err != nil {
+				return err
+			}
+		}
+
+		if opts, ok := l.inserted[entry]; ok {
+			if err := e.encodeOptions(indentation(entry), opts); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, s := range l.order {
+		if len(s.headers) > 0 {
+			continue
+		}
+
+		var err error
+		switch {
+		case s.subsection != NoSubsection:
+			err = e.encodeSubsection(s.section, &Subsection{Name: s.subsection, Options: s.options})
+		default:
+			err = e.encodeSection(&Section{Name: s.section, Options: s.options})
+		}
+
+		if err != nil {
 			return err
 		}
 	}
@@ -69,7 +125,56 @@ func (e *Encoder) encodeOptions(opts Options) error {
 	return nil
 }
 
+// printf writes a line to the output, starting a new line first if the
+// output doesn't end with a line break, as the last line of a decoded file may.
 func (e *Encoder) printf(msg string, args ...interface{}) error {
-	_, err := fmt.Fprintf(e.w, msg, args...)
-	return err
+	if e.last != 0 && e.last != '\n' {
+		if err := e.write("\n"); err != nil {
+			return err
+		}
+	}
+
+	return e.write(fmt.Sprintf(msg, args...))
+}
+
+func (e *Encoder) write(s string) error {
+	if s == "" {
+		return nil
+	}
+
+	if _, err := io.WriteString(e.w, s); err != nil {
+		return err
+	}
+
+	e.last = s[len(s)-1]
+	return nil
+}
+
+var (
+	valueEscaper = strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		"\n", `\n`,
+		"\t", `\t`,
+		"\b", `\b`,
+	)
+
+	subsectionEscaper = strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+	)
+)
+
+// encodeValue escapes a value, quoting it if it has leading or trailing
+// whitespaces or comment characters.
+func encodeValue(v string) string {
+	quote := strings.ContainsAny(v, "#;") ||
+		strings.TrimSpace(v) != v
+
+	v = valueEscaper.Replace(v)
+	if quote {
+		return `"` + v + `"`
+	}
+
+	return v
 }
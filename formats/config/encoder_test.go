@@ -19,3 +19,127 @@ func (s *EncoderSuite) TestEncode(c *C) {
 		c.Assert(buf.String(), Equals, fixture.Text, Commentf("bad result for fixture: %d", idx))
 	}
 }
+
+func (s *EncoderSuite) TestEncodeDecoded(c *C) {
+	for idx, fixture := range fixtures {
+		cfg := &Config{}
+		err := NewDecoder(bytes.NewReader([]byte(fixture.Raw))).Decode(cfg)
+		c.Assert(err, IsNil, Commentf("decoder error for fixture: %d", idx))
+
+		buf := &bytes.Buffer{}
+		err = NewEncoder(buf).Encode(cfg)
+		c.Assert(err, IsNil, Commentf("encoder error for fixture: %d", idx))
+		c.Assert(buf.String(), Equals, fixture.Raw, Commentf("bad result for fixture: %d", idx))
+	}
+}
+
+const handEdited = `# my config
+[core]
+	Bare = false   ; not bare
+	autocrlf = input
+
+[remote "origin"]
+	url = https://github.com/src-d/go-git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+
+# the fork
+[remote "fork"]
+	url = "https://github.com/mcuadros/go-git"
+[core]
+	filemode = true`
+
+func (s *EncoderSuite) TestEncodeDecodedUnchanged(c *C) {
+	c.Assert(s.roundTrip(c, handEdited, func(*Config) {}), Equals, handEdited)
+}
+
+func (s *EncoderSuite) TestEncodeDecodedChanges(c *C) {
+	output := s.roundTrip(c, handEdited, func(cfg *Config) {
+		cfg.SetOption("core", NoSubsection, "autocrlf", "false")
+		cfg.SetOption("core", NoSubsection, "logallrefupdates", "true")
+		cfg.Section("remote").Subsection("origin").AddOption("pushurl", "git@github.com:src-d/go-git")
+		cfg.RemoveSubsection("remote", "fork")
+		cfg.SetOption("user", NoSubsection, "name", " John Doe; Jr ")
+	})
+
+	c.Assert(output, Equals, `# my config
+[core]
+	Bare = false   ; not bare
+	autocrlf = false
+
+[remote "origin"]
+	url = https://github.com/src-d/go-git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	pushurl = git@github.com:src-d/go-git
+
+# the fork
+[core]
+	filemode = true
+	logallrefupdates = true
+[user]
+	name = " John Doe; Jr "
+`)
+}
+
+func (s *EncoderSuite) TestEncodeDecodedRemoveAndSet(c *C) {
+	output := s.roundTrip(c, "[remote \"origin\"]\n  url = foo\n  fetch = a\n  fetch = b\n", func(cfg *Config) {
+		ss := cfg.Section("remote").Subsection("origin")
+		ss.RemoveOption("fetch")
+		ss.AddOption("fetch", "c")
+		ss.AddOption("fetch", "b")
+		ss.AddOption("prune", "true")
+	})
+
+	c.Assert(output, Equals, "[remote \"origin\"]\n  url = foo\n  fetch = c\n  fetch = b\n  prune = true\n")
+}
+
+func (s *EncoderSuite) TestEncodeEscapes(c *C) {
+	cfg := New().
+		AddOption("section", NoSubsection, "quote", `foo "bar"`).
+		AddOption("section", NoSubsection, "backslash", `C:\foo`).
+		AddOption("section", NoSubsection, "comment", "foo # bar").
+		AddOption("section", NoSubsection, "spaces", " foo ").
+		AddOption("section", NoSubsection, "lines", "foo\nbar\tqux").
+		AddOption("section", `sub "section" \`, "key", "value")
+
+	buf := &bytes.Buffer{}
+	c.Assert(NewEncoder(buf).Encode(cfg), IsNil)
+	c.Assert(buf.String(), Equals, `[section]
+	quote = foo \"bar\"
+	backslash = C:\\foo
+	comment = "foo # bar"
+	spaces = " foo "
+	lines = foo\nbar\tqux
+[section "sub \"section\" \\"]
+	key = value
+`)
+
+	decoded := &Config{}
+	c.Assert(NewDecoder(buf).Decode(decoded), IsNil)
+	c.Assert(decoded.Sections, DeepEquals, cfg.Sections)
+}
+
+func (s *EncoderSuite) TestEncodeNoValue(c *C) {
+	cfg := New()
+	sect := cfg.Section("core")
+	sect.Options = append(sect.Options, &Option{Key: "bare", NoValue: true})
+	sect.AddOption("worktree", "")
+
+	buf := &bytes.Buffer{}
+	c.Assert(NewEncoder(buf).Encode(cfg), IsNil)
+	c.Assert(buf.String(), Equals, "[core]\n\tbare\n\tworktree = \n")
+
+	decoded := &Config{}
+	c.Assert(NewDecoder(buf).Decode(decoded), IsNil)
+	c.Assert(decoded.Sections, DeepEquals, cfg.Sections)
+}
+
+func (s *EncoderSuite) roundTrip(c *C, input string, change func(*Config)) string {
+	cfg := &Config{}
+	c.Assert(NewDecoder(bytes.NewReader([]byte(input))).Decode(cfg), IsNil)
+
+	change(cfg)
+
+	buf := &bytes.Buffer{}
+	c.Assert(NewEncoder(buf).Encode(cfg), IsNil)
+	return buf.String()
+}
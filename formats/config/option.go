@@ -10,6 +10,9 @@ type Option struct {
 	Key string
 	// Original value as string, could be not notmalized.
 	Value string
+	// NoValue is true for the keys written without value, as bare in
+	// "[core]\n\tbare", that git reads as true for the boolean options.
+	NoValue bool
 }
 
 type Options []*Option
@@ -23,7 +26,8 @@ func (o *Option) IsKey(key string) bool {
 // Get gets the value for the given key if set,
 // otherwise it returns the empty string.
 //
-// Note that there is no difference
+// Note that there is no difference between an unset key and a key with an
+// empty value or without value, use GetOption to tell them apart.
 //
 // This matches git behaviour since git v1.8.1-rc1,
 // if there are multiple definitions of a key, the
@@ -43,6 +47,18 @@ func (opts Options) Get(key string) string {
 	return ""
 }
 
+// GetOption returns the last option with the given key, or nil if the key
+// is not set.
+func (opts Options) GetOption(key string) *Option {
+	for i := len(opts) - 1; i >= 0; i-- {
+		if opts[i].IsKey(key) {
+			return opts[i]
+		}
+	}
+
+	return nil
+}
+
 // GetAll returns all possible values for the same key.
 func (opts Options) GetAll(key string) []string {
 	result := []string{}
@@ -65,7 +81,7 @@ func (opts Options) withoutOption(key string) Options {
 }
 
 func (opts Options) withAddedOption(key string, value string) Options {
-	return append(opts, &Option{key, value})
+	return append(opts, &Option{Key: key, Value: value})
 }
 
 func (opts Options) withSettedOption(key string, value string) Options {
@@ -74,7 +90,7 @@ func (opts Options) withSettedOption(key string, value string) Options {
 		if o.IsKey(key) {
 			result := make(Options, len(opts))
 			copy(result, opts)
-			result[i] = &Option{key, value}
+			result[i] = &Option{Key: key, Value: value}
 			return result
 		}
 	}
@@ -10,9 +10,9 @@ var _ = Suite(&OptionSuite{})
 
 func (s *OptionSuite) TestOptions_GetAll(c *C) {
 	o := Options{
-		&Option{"k", "v"},
-		&Option{"ok", "v1"},
-		&Option{"K", "v2"},
+		&Option{Key: "k", Value: "v"},
+		&Option{Key: "ok", Value: "v1"},
+		&Option{Key: "K", Value: "v2"},
 	}
 	c.Assert(o.GetAll("k"), DeepEquals, []string{"v", "v2"})
 	c.Assert(o.GetAll("K"), DeepEquals, []string{"v", "v2"})
@@ -23,6 +23,17 @@ func (s *OptionSuite) TestOptions_GetAll(c *C) {
 	c.Assert(o.GetAll("k"), DeepEquals, []string{})
 }
 
+func (s *OptionSuite) TestOptions_GetOption(c *C) {
+	o := Options{
+		&Option{Key: "k", Value: "v"},
+		&Option{Key: "ok", Value: "v1"},
+		&Option{Key: "K", NoValue: true},
+	}
+	c.Assert(o.GetOption("k"), Equals, o[2])
+	c.Assert(o.GetOption("ok"), Equals, o[1])
+	c.Assert(o.GetOption("unexistant"), IsNil)
+}
+
 func (s *OptionSuite) TestOption_IsKey(c *C) {
 	c.Assert((&Option{Key: "key"}).IsKey("key"), Equals, true)
 	c.Assert((&Option{Key: "key"}).IsKey("KEY"), Equals, true)
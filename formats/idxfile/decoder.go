@@ -122,6 +122,7 @@ func readCRC32(idx *Idxfile, r io.Reader) error {
 }
 
 func readOffsets(idx *Idxfile, r io.Reader) error {
+	var large []int
 	c := int(idx.ObjectCount)
 	for i := 0; i < c; i++ {
 		o, err := binary.ReadUint32(r)
@@ -129,9 +130,39 @@ func readOffsets(idx *Idxfile, r io.Reader) error {
 			return err
 		}
 
+		if o&largeOffsetBit != 0 {
+			large = append(large, i)
+		}
+
 		idx.Entries[i].Offset = uint64(o)
 	}
 
+	return readLargeOffsets(idx, r, large)
+}
+
+// readLargeOffsets reads the 64-bit offsets table, used by the entries with
+// offsets that don't fit in 31 bits
+func readLargeOffsets(idx *Idxfile, r io.Reader, entries []int) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	offsets := make([]uint64, len(entries))
+	for k := range offsets {
+		if err := binary.Read(r, &offsets[k]); err != nil {
+			return err
+		}
+	}
+
+	for _, i := range entries {
+		k := int(idx.Entries[i].Offset &^ largeOffsetBit)
+		if k >= len(offsets) {
+			return ErrMalformedIdxFile
+		}
+
+		idx.Entries[i].Offset = offsets[k]
+	}
+
 	return nil
 }
 
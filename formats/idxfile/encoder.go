@@ -98,13 +98,27 @@ func (e *Encoder) encodeCRC32(idx *Idxfile) (int, error) {
 
 func (e *Encoder) encodeOffsets(idx *Idxfile) (int, error) {
 	sz := 0
+	var large []uint64
 	for _, ent := range idx.Entries {
-		if err := binary.WriteUint32(e, uint32(ent.Offset)); err != nil {
+		o := uint32(ent.Offset)
+		if ent.Offset >= largeOffsetBit {
+			o = uint32(len(large)) | largeOffsetBit
+			large = append(large, ent.Offset)
+		}
+
+		if err := binary.WriteUint32(e, o); err != nil {
 			return sz, err
 		}
 
 		sz += 4
+	}
+
+	for _, o := range large {
+		if err := binary.Write(e, o); err != nil {
+			return sz, err
+		}
 
+		sz += 8
 	}
 
 	return sz, nil
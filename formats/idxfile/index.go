@@ -0,0 +1,295 @@
+package idxfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+
+	"gopkg.in/src-d/go-git.v4/core"
+)
+
+const (
+	fanoutOffset   = 8
+	fanoutSize     = 256 * 4
+	hashesOffset   = fanoutOffset + fanoutSize
+	hashSize       = 20
+	crcSize        = 4
+	offsetSize     = 4
+	largeOffsetBit = 1 << 31
+)
+
+// ErrReverseIndexDisabled is returned by FindHash when the reverse index of
+// the Index is not enabled.
+var ErrReverseIndexDisabled = errors.New("idx reverse index disabled")
+
+// Index looks up the objects of an idx file without loading it in memory,
+// the hash of an object is found with the fanout table and a binary search
+// over the sorted list of hashes, so only the fanout table is kept in memory.
+//
+// Finding an object by its offset in the packfile needs a reverse index, that
+// is kept in memory, so it's only built if enabled with EnableReverseIndex.
+type Index struct {
+	r      io.ReaderAt
+	fanout [256]uint32
+
+	reverse bool
+	revOnce sync.Once
+	revErr  error
+	// revOffsets are the offsets of the objects sorted, revPositions the
+	// position of every offset in the idx file
+	revOffsets   []uint64
+	revPositions []uint32
+}
+
+// NewIndex returns a new Index of the idx file read from r, only the header
+// and the fanout table are read.
+func NewIndex(r io.ReaderAt) (*Index, error) {
+	header := make([]byte, fanoutOffset+fanoutSize)
+	if n, err := r.ReadAt(header, 0); n != len(header) {
+		if err == io.EOF {
+			return nil, ErrMalformedIdxFile
+		}
+
+		return nil, err
+	}
+
+	if !bytes.Equal(header[:4], idxHeader) {
+		return nil, ErrMalformedIdxFile
+	}
+
+	if binary.BigEndian.Uint32(header[4:8]) != VersionSupported {
+		return nil, ErrUnsupportedVersion
+	}
+
+	i := &Index{r: r}
+	for k := range i.fanout {
+		pos := fanoutOffset + k*4
+		i.fanout[k] = binary.BigEndian.Uint32(header[pos : pos+4])
+		if k > 0 && i.fanout[k] < i.fanout[k-1] {
+			return nil, ErrMalformedIdxFile
+		}
+	}
+
+	return i, nil
+}
+
+// EnableReverseIndex allows to use FindHash. The reverse index holds the
+// offsets of all the objects sorted, 12 bytes per object, it's built the first
+// time FindHash is called and kept in memory.
+func (i *Index) EnableReverseIndex() {
+	i.reverse = true
+}
+
+// Count returns the number of objects in the idx file.
+func (i *Index) Count() uint32 {
+	return i.fanout[255]
+}
+
+// Contains returns true if the object with the given hash is in the idx file.
+func (i *Index) Contains(h core.Hash) (bool, error) {
+	_, ok, err := i.find(h)
+	return ok, err
+}
+
+// FindOffset returns the offset in the packfile of the object with the given
+// hash, core.ErrObjectNotFound is returned if it's not in the idx file.
+func (i *Index) FindOffset(h core.Hash) (int64, error) {
+	pos, ok, err := i.find(h)
+	if err != nil {
+		return -1, err
+	}
+
+	if !ok {
+		return -1, core.ErrObjectNotFound
+	}
+
+	o, err := i.offsetAt(pos)
+	return int64(o), err
+}
+
+// FindCRC32 returns the CRC32 of the packfile entry of the object with the
+// given hash, core.ErrObjectNotFound is returned if it's not in the idx file.
+func (i *Index) FindCRC32(h core.Hash) (uint32, error) {
+	pos, ok, err := i.find(h)
+	if err != nil {
+		return 0, err
+	}
+
+	if !ok {
+		return 0, core.ErrObjectNotFound
+	}
+
+	var b [crcSize]byte
+	if err := i.readAt(b[:], i.crcsOffset()+int64(pos)*crcSize); err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint32(b[:]), nil
+}
+
+// FindHash returns the hash of the object at the given offset of the
+// packfile, core.ErrObjectNotFound is returned if no object starts at the
+// offset. ErrReverseIndexDisabled is returned if the reverse index is not
+// enabled, see EnableReverseIndex.
+func (i *Index) FindHash(o int64) (core.Hash, error) {
+	if !i.reverse {
+		return core.ZeroHash, ErrReverseIndexDisabled
+	}
+
+	if err := i.buildReverseIndex(); err != nil {
+		return core.ZeroHash, err
+	}
+
+	k := sort.Search(len(i.revOffsets), func(k int) bool {
+		return i.revOffsets[k] >= uint64(o)
+	})
+
+	if k == len(i.revOffsets) || i.revOffsets[k] != uint64(o) {
+		return core.ZeroHash, core.ErrObjectNotFound
+	}
+
+	return i.hashAt(i.revPositions[k])
+}
+
+// Hashes returns the hashes of all the objects in the idx file, sorted.
+func (i *Index) Hashes() ([]core.Hash, error) {
+	table := make([]byte, int(i.Count())*hashSize)
+	if err := i.readAt(table, hashesOffset); err != nil {
+		return nil, err
+	}
+
+	hashes := make([]core.Hash, i.Count())
+	for k := range hashes {
+		copy(hashes[k][:], table[k*hashSize:])
+	}
+
+	return hashes, nil
+}
+
+func (i *Index) find(h core.Hash) (uint32, bool, error) {
+	var lo uint32
+	if h[0] > 0 {
+		lo = i.fanout[h[0]-1]
+	}
+
+	hi := i.fanout[h[0]]
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		current, err := i.hashAt(mid)
+		if err != nil {
+			return 0, false, err
+		}
+
+		switch bytes.Compare(h[:], current[:]) {
+		case 0:
+			return mid, true, nil
+		case -1:
+			hi = mid
+		default:
+			lo = mid + 1
+		}
+	}
+
+	return 0, false, nil
+}
+
+func (i *Index) hashAt(pos uint32) (core.Hash, error) {
+	var h core.Hash
+	err := i.readAt(h[:], hashesOffset+int64(pos)*hashSize)
+	return h, err
+}
+
+func (i *Index) offsetAt(pos uint32) (uint64, error) {
+	var b [offsetSize]byte
+	if err := i.readAt(b[:], i.offsetsOffset()+int64(pos)*offsetSize); err != nil {
+		return 0, err
+	}
+
+	return i.resolveOffset(binary.BigEndian.Uint32(b[:]))
+}
+
+// resolveOffset returns the offset of an entry of the offsets table, looking
+// it up in the large offsets table if the most significant bit is set.
+func (i *Index) resolveOffset(o uint32) (uint64, error) {
+	if o&largeOffsetBit == 0 {
+		return uint64(o), nil
+	}
+
+	var b [8]byte
+	k := int64(o &^ largeOffsetBit)
+	if err := i.readAt(b[:], i.largeOffsetsOffset()+k*8); err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint64(b[:]), nil
+}
+
+func (i *Index) buildReverseIndex() error {
+	i.revOnce.Do(func() {
+		count := i.Count()
+		table := make([]byte, int(count)*offsetSize)
+		if err := i.readAt(table, i.offsetsOffset()); err != nil {
+			i.revErr = err
+			return
+		}
+
+		offsets := make([]uint64, count)
+		positions := make([]uint32, count)
+		for pos := uint32(0); pos < count; pos++ {
+			o := binary.BigEndian.Uint32(table[pos*offsetSize:])
+			offset, err := i.resolveOffset(o)
+			if err != nil {
+				i.revErr = err
+				return
+			}
+
+			offsets[pos] = offset
+			positions[pos] = pos
+		}
+
+		sort.Sort(&reverseIndex{offsets, positions})
+		i.revOffsets, i.revPositions = offsets, positions
+	})
+
+	return i.revErr
+}
+
+func (i *Index) crcsOffset() int64 {
+	return hashesOffset + int64(i.Count())*hashSize
+}
+
+func (i *Index) offsetsOffset() int64 {
+	return i.crcsOffset() + int64(i.Count())*crcSize
+}
+
+func (i *Index) largeOffsetsOffset() int64 {
+	return i.offsetsOffset() + int64(i.Count())*offsetSize
+}
+
+func (i *Index) readAt(p []byte, off int64) error {
+	n, err := i.r.ReadAt(p, off)
+	if n == len(p) {
+		return nil
+	}
+
+	if err == io.EOF {
+		return ErrMalformedIdxFile
+	}
+
+	return err
+}
+
+type reverseIndex struct {
+	offsets   []uint64
+	positions []uint32
+}
+
+func (r *reverseIndex) Len() int           { return len(r.offsets) }
+func (r *reverseIndex) Less(i, j int) bool { return r.offsets[i] < r.offsets[j] }
+func (r *reverseIndex) Swap(i, j int) {
+	r.offsets[i], r.offsets[j] = r.offsets[j], r.offsets[i]
+	r.positions[i], r.positions[j] = r.positions[j], r.positions[i]
+}
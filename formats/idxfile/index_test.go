@@ -0,0 +1,149 @@
+package idxfile
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	"gopkg.in/src-d/go-git.v4/core"
+	"gopkg.in/src-d/go-git.v4/fixtures"
+
+	. "gopkg.in/check.v1"
+)
+
+type IndexSuite struct {
+	fixtures.Suite
+}
+
+var _ = Suite(&IndexSuite{})
+
+func (s *IndexSuite) TestFindOffset(c *C) {
+	idx := s.newIndex(c)
+	c.Assert(idx.Count(), Equals, uint32(31))
+
+	o, err := idx.FindOffset(core.NewHash("1669dce138d9b841a518c64b10914d88f5e488ea"))
+	c.Assert(err, IsNil)
+	c.Assert(o, Equals, int64(615))
+
+	o, err = idx.FindOffset(core.NewHash("0000000000000000000000000000000000000000"))
+	c.Assert(err, Equals, core.ErrObjectNotFound)
+	c.Assert(o, Equals, int64(-1))
+
+	o, err = idx.FindOffset(core.NewHash("ffffffffffffffffffffffffffffffffffffffff"))
+	c.Assert(err, Equals, core.ErrObjectNotFound)
+}
+
+func (s *IndexSuite) TestFindOffsetAllEntries(c *C) {
+	fixtures.ByTag("packfile").Test(c, func(f *fixtures.Fixture) {
+		expected := &Idxfile{}
+		c.Assert(NewDecoder(f.Idx()).Decode(expected), IsNil)
+
+		content, err := ioutil.ReadAll(f.Idx())
+		c.Assert(err, IsNil)
+
+		idx, err := NewIndex(bytes.NewReader(content))
+		c.Assert(err, IsNil)
+		c.Assert(idx.Count(), Equals, expected.ObjectCount)
+		idx.EnableReverseIndex()
+
+		for _, e := range expected.Entries {
+			o, err := idx.FindOffset(e.Hash)
+			c.Assert(err, IsNil)
+			c.Assert(o, Equals, int64(e.Offset))
+
+			h, err := idx.FindHash(o)
+			c.Assert(err, IsNil)
+			c.Assert(h, Equals, e.Hash)
+
+			crc, err := idx.FindCRC32(e.Hash)
+			c.Assert(err, IsNil)
+			c.Assert(crc, Equals, e.CRC32)
+		}
+	})
+}
+
+func (s *IndexSuite) TestFindHash(c *C) {
+	idx := s.newIndex(c)
+
+	_, err := idx.FindHash(615)
+	c.Assert(err, Equals, ErrReverseIndexDisabled)
+
+	idx.EnableReverseIndex()
+	h, err := idx.FindHash(615)
+	c.Assert(err, IsNil)
+	c.Assert(h.String(), Equals, "1669dce138d9b841a518c64b10914d88f5e488ea")
+
+	_, err = idx.FindHash(616)
+	c.Assert(err, Equals, core.ErrObjectNotFound)
+}
+
+func (s *IndexSuite) TestHashes(c *C) {
+	idx := s.newIndex(c)
+
+	hashes, err := idx.Hashes()
+	c.Assert(err, IsNil)
+	c.Assert(hashes, HasLen, 31)
+	c.Assert(hashes[0].String(), Equals, "1669dce138d9b841a518c64b10914d88f5e488ea")
+
+	for k := 1; k < len(hashes); k++ {
+		c.Assert(bytes.Compare(hashes[k-1][:], hashes[k][:]), Equals, -1)
+	}
+}
+
+func (s *IndexSuite) TestContains(c *C) {
+	idx := s.newIndex(c)
+
+	ok, err := idx.Contains(core.NewHash("1669dce138d9b841a518c64b10914d88f5e488ea"))
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+
+	ok, err = idx.Contains(core.NewHash("1669dce138d9b841a518c64b10914d88f5e488eb"))
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+}
+
+func (s *IndexSuite) TestLargeOffsets(c *C) {
+	large := uint64(1<<32 + 42)
+
+	expected := &Idxfile{Version: VersionSupported}
+	expected.Add(core.NewHash("4bfc730165c370df4a012afbb45ba3f9c332c0d4"), large, 82)
+	expected.Add(core.NewHash("8fa2238efdae08d83c12ee176fae65ff7c99af46"), 42, 42)
+
+	buf := bytes.NewBuffer(nil)
+	_, err := NewEncoder(buf).Encode(expected)
+	c.Assert(err, IsNil)
+
+	idx, err := NewIndex(bytes.NewReader(buf.Bytes()))
+	c.Assert(err, IsNil)
+
+	o, err := idx.FindOffset(core.NewHash("4bfc730165c370df4a012afbb45ba3f9c332c0d4"))
+	c.Assert(err, IsNil)
+	c.Assert(o, Equals, int64(large))
+
+	idx.EnableReverseIndex()
+	h, err := idx.FindHash(int64(large))
+	c.Assert(err, IsNil)
+	c.Assert(h.String(), Equals, "4bfc730165c370df4a012afbb45ba3f9c332c0d4")
+
+	decoded := &Idxfile{}
+	c.Assert(NewDecoder(buf).Decode(decoded), IsNil)
+	c.Assert(decoded.Entries, DeepEquals, expected.Entries)
+}
+
+func (s *IndexSuite) TestNewIndexMalformed(c *C) {
+	_, err := NewIndex(bytes.NewReader([]byte("foo")))
+	c.Assert(err, Equals, ErrMalformedIdxFile)
+
+	content := make([]byte, 1032)
+	_, err = NewIndex(bytes.NewReader(content))
+	c.Assert(err, Equals, ErrMalformedIdxFile)
+}
+
+func (s *IndexSuite) newIndex(c *C) *Index {
+	f := fixtures.Basic().One()
+	content, err := ioutil.ReadAll(f.Idx())
+	c.Assert(err, IsNil)
+
+	idx, err := NewIndex(bytes.NewReader(content))
+	c.Assert(err, IsNil)
+	return idx
+}
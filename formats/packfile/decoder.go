@@ -4,6 +4,7 @@ import (
 	"bytes"
 
 	"gopkg.in/src-d/go-git.v4/core"
+	"gopkg.in/src-d/go-git.v4/utils/cache"
 )
 
 // Format specifies if the packfile uses ref-deltas or ofs-deltas.
@@ -39,12 +40,25 @@ var (
 	ErrNonSeekable = NewError("non-seekable scanner")
 )
 
+// Index is an index of the objects of a packfile, as an idx file, used to
+// find the objects without decoding the whole packfile.
+type Index interface {
+	// FindOffset returns the offset of the object with the given hash.
+	FindOffset(h core.Hash) (int64, error)
+	// FindHash returns the hash of the object at the given offset, if it
+	// fails the object at the offset is not looked up in the cache.
+	FindHash(o int64) (core.Hash, error)
+}
+
 // Decoder reads and decodes packfiles from an input stream.
 type Decoder struct {
 	s  *Scanner
 	o  core.ObjectStorage
 	tx core.TxObjectStorage
 
+	cache cache.Object
+	index Index
+
 	offsetToHash map[int64]core.Hash
 	hashToOffset map[core.Hash]int64
 	crcs         map[core.Hash]uint32
@@ -163,12 +177,35 @@ func (d *Decoder) newObject() core.Object {
 	return d.o.NewObject()
 }
 
-// ReadObjectAt reads an object at the given location
+// ReadObjectAt reads an object at the given location, if a cache is set and
+// the hash of the object at the offset is known the object is looked up in
+// the cache before reading it, the objects read are added to the cache.
 func (d *Decoder) ReadObjectAt(offset int64) (core.Object, error) {
 	if !d.s.IsSeekable {
 		return nil, ErrNonSeekable
 	}
 
+	if d.cache != nil {
+		if h, ok := d.hashByOffset(offset); ok {
+			if obj, ok := d.cache.Get(h); ok {
+				return obj, nil
+			}
+		}
+	}
+
+	obj, err := d.readObjectAt(offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.cache != nil {
+		d.cache.Add(obj)
+	}
+
+	return obj, nil
+}
+
+func (d *Decoder) readObjectAt(offset int64) (obj core.Object, err error) {
 	beforeJump, err := d.s.Seek(offset)
 	if err != nil {
 		return nil, err
@@ -227,6 +264,14 @@ func (d *Decoder) fillOFSDeltaObjectContent(obj core.Object, offset int64) (uint
 }
 
 func (d *Decoder) setOffset(h core.Hash, offset int64) {
+	// the offsets given with SetOffsets can be shared with other decoders,
+	// they are only written if unknown
+	if _, ok := d.hashToOffset[h]; ok {
+		if _, ok := d.offsetToHash[offset]; ok {
+			return
+		}
+	}
+
 	d.offsetToHash[offset] = h
 	d.hashToOffset[h] = offset
 }
@@ -248,8 +293,14 @@ func (d *Decoder) recallByOffset(o int64) (core.Object, error) {
 }
 
 func (d *Decoder) recallByHash(h core.Hash) (core.Object, error) {
+	if d.cache != nil {
+		if obj, ok := d.cache.Get(h); ok {
+			return obj, nil
+		}
+	}
+
 	if d.s.IsSeekable {
-		if o, ok := d.hashToOffset[h]; ok {
+		if o, ok := d.offsetByHash(h); ok {
 			return d.ReadObjectAt(o)
 		}
 	}
@@ -262,12 +313,59 @@ func (d *Decoder) recallByHash(h core.Hash) (core.Object, error) {
 	return nil, core.ErrObjectNotFound
 }
 
+func (d *Decoder) hashByOffset(o int64) (core.Hash, bool) {
+	if h, ok := d.offsetToHash[o]; ok {
+		return h, true
+	}
+
+	if d.index == nil {
+		return core.ZeroHash, false
+	}
+
+	h, err := d.index.FindHash(o)
+	return h, err == nil
+}
+
+func (d *Decoder) offsetByHash(h core.Hash) (int64, bool) {
+	if o, ok := d.hashToOffset[h]; ok {
+		return o, true
+	}
+
+	if d.index == nil {
+		return 0, false
+	}
+
+	o, err := d.index.FindOffset(h)
+	return o, err == nil
+}
+
+// SetIndex sets the index used to find the objects by hash and by offset,
+// the alternative to SetOffsets and SetHashes for big packfiles.
+func (d *Decoder) SetIndex(idx Index) {
+	d.index = idx
+}
+
 // SetOffsets sets the offsets, required when using the method ReadObjectAt,
 // without decoding the full packfile
 func (d *Decoder) SetOffsets(offsets map[core.Hash]int64) {
 	d.hashToOffset = offsets
 }
 
+// SetHashes sets the hashes of the objects by its offset, the reverse of
+// the offsets given to SetOffsets. They are used to look up in the cache the
+// delta bases referenced by offset.
+func (d *Decoder) SetHashes(hashes map[int64]core.Hash) {
+	d.offsetToHash = hashes
+}
+
+// SetCache sets the cache used to keep the objects read with ReadObjectAt,
+// usually the bases of the deltas, so they aren't decoded again by the
+// following reads. The cache can be shared between decoders of the same
+// packfile or of different packfiles.
+func (d *Decoder) SetCache(c cache.Object) {
+	d.cache = c
+}
+
 // Offsets returns the objects read offset
 func (d *Decoder) Offsets() map[core.Hash]int64 {
 	return d.hashToOffset
@@ -8,6 +8,7 @@ import (
 	"gopkg.in/src-d/go-git.v4/fixtures"
 	"gopkg.in/src-d/go-git.v4/formats/idxfile"
 	"gopkg.in/src-d/go-git.v4/storage/memory"
+	"gopkg.in/src-d/go-git.v4/utils/cache"
 
 	. "gopkg.in/check.v1"
 )
@@ -129,6 +130,35 @@ func (s *ReaderSuite) TestReadObjectAt(c *C) {
 	c.Assert(obj.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
 }
 
+func (s *ReaderSuite) TestReadObjectAtWithCache(c *C) {
+	f := fixtures.Basic().ByTag("ofs-delta").One()
+	scanner := NewScanner(f.Packfile())
+	d, err := NewDecoder(scanner, nil)
+	c.Assert(err, IsNil)
+
+	offsets := getOffsetsFromIdx(f.Idx())
+	hashes := make(map[int64]core.Hash, len(offsets))
+	for h, o := range offsets {
+		hashes[o] = h
+	}
+
+	lru := cache.NewObjectLRUDefault()
+	d.SetOffsets(offsets)
+	d.SetHashes(hashes)
+	d.SetCache(lru)
+
+	obj, err := d.ReadObjectAt(186)
+	c.Assert(err, IsNil)
+
+	cached, ok := lru.Get(obj.Hash())
+	c.Assert(ok, Equals, true)
+	c.Assert(cached, Equals, obj)
+
+	again, err := d.ReadObjectAt(186)
+	c.Assert(err, IsNil)
+	c.Assert(again, Equals, obj)
+}
+
 func (s *ReaderSuite) TestOffsets(c *C) {
 	f := fixtures.Basic().One()
 	scanner := NewScanner(f.Packfile())
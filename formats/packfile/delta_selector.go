@@ -0,0 +1,373 @@
+package packfile
+
+import (
+	"bytes"
+	"io/ioutil"
+	"sort"
+
+	"gopkg.in/src-d/go-git.v4/core"
+)
+
+const (
+	// defaultWindow is the number of previous objects tried as delta base of
+	// every object.
+	defaultWindow = 10
+	// defaultMaxDepth is the max length of the delta chains.
+	defaultMaxDepth = 50
+	// bigFileThreshold is the size from which the objects are never written
+	// as deltas nor used as delta bases.
+	bigFileThreshold = 512 * 1024 * 1024
+	// defaultDeltaCacheSize is the total size of the deltas kept in memory
+	// until they are written, the rest are computed again when written.
+	defaultDeltaCacheSize = 64 * 1024 * 1024
+)
+
+// ErrObjectToPackReadOnly is returned when the Writer of an object selected
+// to be packed is requested.
+var ErrObjectToPackReadOnly = NewError("object to pack is read-only")
+
+// deltaSelector chooses the objects written as deltas and their bases, as
+// git does the objects are sorted by type, path hash and size, so similar
+// objects are close, and every object is compared against the previous ones
+// inside a window. Only the hash, type and size of the objects are kept, their
+// content is read from the storage when needed.
+type deltaSelector struct {
+	storage   core.ObjectStorage
+	window    int
+	maxDepth  int
+	cacheSize int64
+	// cached is the total size of the deltas kept in memory
+	cached int64
+}
+
+func newDeltaSelector(s core.ObjectStorage) *deltaSelector {
+	return &deltaSelector{
+		storage:   s,
+		window:    defaultWindow,
+		maxDepth:  defaultMaxDepth,
+		cacheSize: defaultDeltaCacheSize,
+	}
+}
+
+// ObjectsToPack returns the objects with the given hashes in the order to be
+// written, the objects whose delta is small enough are written as deltas.
+func (s *deltaSelector) ObjectsToPack(hashes []core.Hash) ([]*ObjectToPack, error) {
+	objects, err := s.objectsToPack(hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.window <= 0 {
+		return objects, nil
+	}
+
+	nameHashes, err := s.nameHashes(objects)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Stable(&byTypeNameAndSize{objects, nameHashes})
+
+	if err := s.walk(objects); err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+func (s *deltaSelector) objectsToPack(hashes []core.Hash) ([]*ObjectToPack, error) {
+	objects := make([]*ObjectToPack, len(hashes))
+	for i, h := range hashes {
+		o, err := s.storage.Get(core.AnyObject, h)
+		if err != nil {
+			return nil, err
+		}
+
+		objects[i] = NewObjectToPack(&storedObject{
+			storage: s.storage, h: h, t: o.Type(), size: o.Size(),
+		})
+	}
+
+	return objects, nil
+}
+
+// nameHashes returns the hash of the name of every object found in the trees
+// being packed, so the versions of the same file are sorted together.
+func (s *deltaSelector) nameHashes(objects []*ObjectToPack) (map[core.Hash]uint32, error) {
+	hashes := make(map[core.Hash]uint32, len(objects))
+	for _, o := range objects {
+		if o.Original.Type() != core.TreeObject {
+			continue
+		}
+
+		content, err := readObjectContent(o.Original)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range parseTreeEntries(content) {
+			if _, ok := hashes[e.hash]; !ok {
+				hashes[e.hash] = nameHash(e.name)
+			}
+		}
+	}
+
+	return hashes, nil
+}
+
+// walk tries every object against the previous ones inside the window and
+// keeps the smallest delta found.
+func (s *deltaSelector) walk(objects []*ObjectToPack) error {
+	contents := make(map[core.Hash][]byte, s.window+1)
+	for i, target := range objects {
+		if i > s.window {
+			delete(contents, objects[i-s.window-1].Hash())
+		}
+
+		if !canDelta(target.Original) {
+			continue
+		}
+
+		for j := i - 1; j >= 0 && j >= i-s.window; j-- {
+			base := objects[j]
+			if base.Original.Type() != target.Original.Type() {
+				break
+			}
+
+			if !canDelta(base.Original) || base.Depth >= s.maxDepth {
+				continue
+			}
+
+			if err := s.tryDelta(contents, base, target); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// tryDelta writes target as a delta of base if the delta is smaller than the
+// current representation of target, the max size is reduced as the delta
+// chain grows, as git does, to favour short chains.
+func (s *deltaSelector) tryDelta(contents map[core.Hash][]byte, base, target *ObjectToPack) error {
+	targetSize := target.Original.Size()
+	if targetSize < base.Original.Size()/32 {
+		return nil
+	}
+
+	maxSize := targetSize/2 - 20
+	if target.IsDelta() {
+		maxSize = target.Object.Size()
+	}
+
+	maxSize = maxSize * int64(s.maxDepth-base.Depth) / int64(s.maxDepth+1)
+	if maxSize <= 0 {
+		return nil
+	}
+
+	src, err := s.content(contents, base)
+	if err != nil {
+		return err
+	}
+
+	tgt, err := s.content(contents, target)
+	if err != nil {
+		return err
+	}
+
+	delta := DiffDelta(src, tgt)
+	if int64(len(delta)) >= maxSize {
+		return nil
+	}
+
+	s.setDelta(base, target, delta)
+	return nil
+}
+
+// setDelta writes target as the given delta of base, the delta is kept in
+// memory if it fits in the delta cache.
+func (s *deltaSelector) setDelta(base, target *ObjectToPack, delta []byte) {
+	if d, ok := target.Object.(*selectedDelta); ok {
+		s.cached -= int64(len(d.delta))
+	}
+
+	d := &selectedDelta{
+		base:   base.Original,
+		target: target.Original,
+		size:   int64(len(delta)),
+	}
+
+	if s.cached+d.size <= s.cacheSize {
+		d.delta = delta
+		s.cached += d.size
+	}
+
+	target.Object = d
+	target.Base = base
+	target.Depth = base.Depth + 1
+}
+
+func (s *deltaSelector) content(contents map[core.Hash][]byte, o *ObjectToPack) ([]byte, error) {
+	h := o.Hash()
+	if c, ok := contents[h]; ok {
+		return c, nil
+	}
+
+	c, err := readObjectContent(o.Original)
+	if err != nil {
+		return nil, err
+	}
+
+	contents[h] = c
+	return c, nil
+}
+
+// storedObject is a core.Object whose content is read from the storage each
+// time Reader is called, so the objects to pack are not kept in memory.
+type storedObject struct {
+	storage core.ObjectStorage
+	h       core.Hash
+	t       core.ObjectType
+	size    int64
+}
+
+func (o *storedObject) Hash() core.Hash           { return o.h }
+func (o *storedObject) Type() core.ObjectType     { return o.t }
+func (o *storedObject) SetType(t core.ObjectType) { o.t = t }
+func (o *storedObject) Size() int64               { return o.size }
+func (o *storedObject) SetSize(s int64)           { o.size = s }
+
+func (o *storedObject) Reader() (core.ObjectReader, error) {
+	obj, err := o.storage.Get(o.t, o.h)
+	if err != nil {
+		return nil, err
+	}
+
+	return obj.Reader()
+}
+
+// Writer always fails, since the content is read from the storage.
+func (o *storedObject) Writer() (core.ObjectWriter, error) {
+	return nil, ErrObjectToPackReadOnly
+}
+
+// selectedDelta is a core.Object whose content are the delta instructions to
+// build target from base, when they are not kept in memory they are computed
+// again each time Reader is called.
+type selectedDelta struct {
+	base, target core.Object
+	size         int64
+	delta        []byte
+}
+
+func (o *selectedDelta) Hash() core.Hash           { return core.ZeroHash }
+func (o *selectedDelta) Type() core.ObjectType     { return core.OFSDeltaObject }
+func (o *selectedDelta) SetType(t core.ObjectType) {}
+func (o *selectedDelta) Size() int64               { return o.size }
+func (o *selectedDelta) SetSize(s int64)           {}
+
+func (o *selectedDelta) Reader() (core.ObjectReader, error) {
+	delta := o.delta
+	if delta == nil {
+		src, err := readObjectContent(o.base)
+		if err != nil {
+			return nil, err
+		}
+
+		tgt, err := readObjectContent(o.target)
+		if err != nil {
+			return nil, err
+		}
+
+		delta = DiffDelta(src, tgt)
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(delta)), nil
+}
+
+// Writer always fails, since the content is computed from base and target.
+func (o *selectedDelta) Writer() (core.ObjectWriter, error) {
+	return nil, ErrObjectToPackReadOnly
+}
+
+func canDelta(o core.Object) bool {
+	switch o.Type() {
+	case core.CommitObject, core.TreeObject, core.BlobObject, core.TagObject:
+		return o.Size() < bigFileThreshold
+	default:
+		return false
+	}
+}
+
+// byTypeNameAndSize sorts the objects by type, name hash and size, the
+// biggest first, so the smaller objects are written as deltas of the bigger
+// ones.
+type byTypeNameAndSize struct {
+	objects    []*ObjectToPack
+	nameHashes map[core.Hash]uint32
+}
+
+func (s *byTypeNameAndSize) Len() int { return len(s.objects) }
+
+func (s *byTypeNameAndSize) Less(i, j int) bool {
+	a, b := s.objects[i], s.objects[j]
+	if a.Original.Type() != b.Original.Type() {
+		return a.Original.Type() > b.Original.Type()
+	}
+
+	ha, hb := s.nameHashes[a.Hash()], s.nameHashes[b.Hash()]
+	if ha != hb {
+		return ha > hb
+	}
+
+	return a.Original.Size() > b.Original.Size()
+}
+
+func (s *byTypeNameAndSize) Swap(i, j int) {
+	s.objects[i], s.objects[j] = s.objects[j], s.objects[i]
+}
+
+// nameHash returns the hash of a name, most of the bits are given by the
+// last characters, so the files with the same extension are sorted together,
+// see pack_name_hash in git.
+func nameHash(name string) uint32 {
+	var h uint32
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v' {
+			continue
+		}
+
+		h = (h >> 2) + (uint32(c) << 24)
+	}
+
+	return h
+}
+
+type treeEntry struct {
+	name string
+	hash core.Hash
+}
+
+// parseTreeEntries returns the entries of the content of a tree object, a
+// malformed entry ends the parsing.
+func parseTreeEntries(content []byte) []treeEntry {
+	var entries []treeEntry
+	for len(content) > 0 {
+		sp := bytes.IndexByte(content, ' ')
+		nul := bytes.IndexByte(content, 0)
+		if sp < 0 || nul < sp || len(content) < nul+1+20 {
+			break
+		}
+
+		var e treeEntry
+		e.name = string(content[sp+1 : nul])
+		copy(e.hash[:], content[nul+1:nul+21])
+		entries = append(entries, e)
+
+		content = content[nul+21:]
+	}
+
+	return entries
+}
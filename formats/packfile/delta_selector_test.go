@@ -0,0 +1,129 @@
+package packfile
+
+import (
+	"gopkg.in/src-d/go-git.v4/core"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	. "gopkg.in/check.v1"
+)
+
+type DeltaSelectorSuite struct {
+	storage *memory.Storage
+}
+
+var _ = Suite(&DeltaSelectorSuite{})
+
+func (s *DeltaSelectorSuite) SetUpTest(c *C) {
+	s.storage = memory.NewStorage()
+}
+
+func (s *DeltaSelectorSuite) TestObjectsToPack(c *C) {
+	base := randomBytes(1, 4096)
+	big := setBlob(c, s.storage, string(base))
+	similar := setBlob(c, s.storage, string(join(base[:2048], []byte("foo"), base[2048:])))
+	different := setBlob(c, s.storage, string(randomBytes(2, 1024)))
+	commit := s.setObject(c, core.CommitObject, "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n")
+
+	sel := newDeltaSelector(s.storage.ObjectStorage())
+	objects, err := sel.ObjectsToPack([]core.Hash{commit, different, similar, big})
+	c.Assert(err, IsNil)
+	c.Assert(objects, HasLen, 4)
+
+	// blobs before commits, and the biggest blobs first
+	c.Assert(objects[0].Hash(), Equals, similar)
+	c.Assert(objects[1].Hash(), Equals, big)
+	c.Assert(objects[2].Hash(), Equals, different)
+	c.Assert(objects[3].Hash(), Equals, commit)
+
+	c.Assert(objects[0].IsDelta(), Equals, false)
+	c.Assert(objects[1].IsDelta(), Equals, true)
+	c.Assert(objects[1].Base, Equals, objects[0])
+	c.Assert(objects[1].Depth, Equals, 1)
+	c.Assert(objects[2].IsDelta(), Equals, false)
+	c.Assert(objects[3].IsDelta(), Equals, false)
+}
+
+func (s *DeltaSelectorSuite) TestObjectsToPackDeltaCache(c *C) {
+	content := randomBytes(1, 4096)
+	base := setBlob(c, s.storage, string(content))
+	target := setBlob(c, s.storage, string(join(content, []byte("foo"))))
+
+	for _, size := range []int64{0, defaultDeltaCacheSize} {
+		sel := newDeltaSelector(s.storage.ObjectStorage())
+		sel.cacheSize = size
+
+		objects, err := sel.ObjectsToPack([]core.Hash{base, target})
+		c.Assert(err, IsNil)
+		c.Assert(objects[1].IsDelta(), Equals, true)
+		c.Assert(objects[1].Object.(*selectedDelta).delta == nil, Equals, size == 0)
+
+		// the content is read from the storage, only the delta may be kept
+		c.Assert(objects[0].Original, FitsTypeOf, &storedObject{})
+		c.Assert(objects[1].Original, FitsTypeOf, &storedObject{})
+
+		delta, err := readObjectContent(objects[1].Object)
+		c.Assert(err, IsNil)
+		c.Assert(int64(len(delta)), Equals, objects[1].Object.Size())
+
+		src, err := readObjectContent(objects[1].Base.Original)
+		c.Assert(err, IsNil)
+		expected, err := readObjectContent(objects[1].Original)
+		c.Assert(err, IsNil)
+		c.Assert(PatchDelta(src, delta), DeepEquals, expected)
+	}
+}
+
+func (s *DeltaSelectorSuite) TestObjectsToPackMaxDepth(c *C) {
+	content := randomBytes(1, 4096)
+
+	var hashes []core.Hash
+	for i := 0; i < 5; i++ {
+		content = join(content, randomBytes(int64(i+2), 16))
+		hashes = append(hashes, setBlob(c, s.storage, string(content)))
+	}
+
+	sel := newDeltaSelector(s.storage.ObjectStorage())
+	sel.maxDepth = 2
+
+	objects, err := sel.ObjectsToPack(hashes)
+	c.Assert(err, IsNil)
+
+	for _, o := range objects {
+		c.Assert(o.Depth <= 2, Equals, true)
+		if o.IsDelta() {
+			c.Assert(o.Depth, Equals, o.Base.Depth+1)
+		}
+	}
+}
+
+func (s *DeltaSelectorSuite) TestObjectsToPackNameHash(c *C) {
+	a := s.setObject(c, core.BlobObject, "foo content")
+	b := s.setObject(c, core.BlobObject, "bar content, bigger")
+
+	tree := s.setObject(c, core.TreeObject, string(join(
+		[]byte("100644 a.go\x00"), a[:],
+		[]byte("100644 b.txt\x00"), b[:],
+	)))
+
+	sel := newDeltaSelector(s.storage.ObjectStorage())
+	objects, err := sel.ObjectsToPack([]core.Hash{tree, b, a})
+	c.Assert(err, IsNil)
+
+	// sorted by name hash before size
+	c.Assert(objects[0].Hash(), Equals, b)
+	c.Assert(objects[1].Hash(), Equals, a)
+	c.Assert(objects[2].Hash(), Equals, tree)
+}
+
+func (s *DeltaSelectorSuite) TestNameHash(c *C) {
+	c.Assert(nameHash(""), Equals, uint32(0))
+	c.Assert(nameHash("a b"), Equals, nameHash("ab"))
+	c.Assert(nameHash("foo.go") == nameHash("foo.txt"), Equals, false)
+}
+
+func (s *DeltaSelectorSuite) setObject(c *C, t core.ObjectType, content string) core.Hash {
+	h, err := s.storage.ObjectStorage().Set(newObject(s.storage, t, []byte(content)))
+	c.Assert(err, IsNil)
+
+	return h
+}
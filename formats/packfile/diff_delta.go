@@ -0,0 +1,181 @@
+package packfile
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	"gopkg.in/src-d/go-git.v4/core"
+)
+
+// See https://github.com/git/git/blob/master/diff-delta.c for the original
+// implementation, the base is indexed in blocks and the target is scanned
+// looking for those blocks, every match is extended as much as possible and
+// written as a copy instruction, everything else is written as inserts.
+
+const (
+	// blockSize is the size of the blocks of the base indexed to find the
+	// copies, shorter matches are written as inserts.
+	blockSize = 16
+	// maxCopySize is the max size of a single copy instruction.
+	maxCopySize = 0x10000
+	// maxInsertSize is the max size of a single insert instruction.
+	maxInsertSize = 0x7f
+)
+
+// GetDelta returns an object whose content are the delta instructions to
+// build target from base.
+func GetDelta(base, target core.Object) (core.Object, error) {
+	src, err := readObjectContent(base)
+	if err != nil {
+		return nil, err
+	}
+
+	tgt, err := readObjectContent(target)
+	if err != nil {
+		return nil, err
+	}
+
+	return newDeltaObject(DiffDelta(src, tgt)), nil
+}
+
+func newDeltaObject(delta []byte) core.Object {
+	o := &core.MemoryObject{}
+	o.SetType(core.OFSDeltaObject)
+	o.SetSize(int64(len(delta)))
+	o.Write(delta)
+
+	return o
+}
+
+// DiffDelta returns the delta instructions to build tgt from src, in the
+// format read by PatchDelta.
+func DiffDelta(src, tgt []byte) []byte {
+	buf := bytes.NewBuffer(nil)
+	buf.Write(encodeLEB128(uint(len(src))))
+	buf.Write(encodeLEB128(uint(len(tgt))))
+
+	index := indexBlocks(src)
+
+	var pending int
+	for i := 0; i+blockSize <= len(tgt); {
+		offset, ok := index[string(tgt[i:i+blockSize])]
+		if !ok {
+			i++
+			continue
+		}
+
+		// the match is extended backwards over the pending inserts and
+		// forwards as much as possible
+		length := matchLength(src[offset:], tgt[i:])
+		for offset > 0 && i > pending && src[offset-1] == tgt[i-1] {
+			offset--
+			i--
+			length++
+		}
+
+		encodeInsert(buf, tgt[pending:i])
+		encodeCopy(buf, offset, length)
+
+		i += length
+		pending = i
+	}
+
+	encodeInsert(buf, tgt[pending:])
+	return buf.Bytes()
+}
+
+// indexBlocks returns the offset of every block of src, when a block is
+// repeated the first offset is kept.
+func indexBlocks(src []byte) map[string]int {
+	index := make(map[string]int, len(src)/blockSize)
+	for i := 0; i+blockSize <= len(src); i += blockSize {
+		block := string(src[i : i+blockSize])
+		if _, ok := index[block]; !ok {
+			index[block] = i
+		}
+	}
+
+	return index
+}
+
+func matchLength(src, tgt []byte) int {
+	var l int
+	for l < len(src) && l < len(tgt) && src[l] == tgt[l] {
+		l++
+	}
+
+	return l
+}
+
+func encodeInsert(buf *bytes.Buffer, data []byte) {
+	for len(data) > 0 {
+		sz := len(data)
+		if sz > maxInsertSize {
+			sz = maxInsertSize
+		}
+
+		buf.WriteByte(byte(sz))
+		buf.Write(data[:sz])
+		data = data[sz:]
+	}
+}
+
+// encodeCopy writes the copy instructions of length bytes from offset, only
+// the non-zero bytes of the offset and the size are written, the flags of the
+// first byte say which ones are present, the reverse of decodeOffset and
+// decodeSize.
+func encodeCopy(buf *bytes.Buffer, offset, length int) {
+	for length > 0 {
+		sz := length
+		if sz > maxCopySize {
+			sz = maxCopySize
+		}
+
+		code := byte(0x80)
+		args := make([]byte, 0, 7)
+		for k := uint(0); k < 4; k++ {
+			if b := byte(offset >> (8 * k)); b != 0 {
+				code |= 0x01 << k
+				args = append(args, b)
+			}
+		}
+
+		for k := uint(0); k < 3; k++ {
+			if b := byte(sz >> (8 * k)); b != 0 {
+				code |= 0x10 << k
+				args = append(args, b)
+			}
+		}
+
+		buf.WriteByte(code)
+		buf.Write(args)
+
+		offset += sz
+		length -= sz
+	}
+}
+
+// encodeLEB128 returns the unsigned LEB128 encoding of n, the reverse of
+// decodeLEB128.
+func encodeLEB128(n uint) []byte {
+	var buf []byte
+	for {
+		b := byte(n & payload)
+		n >>= 7
+		if n == 0 {
+			return append(buf, b)
+		}
+
+		buf = append(buf, b|continuation)
+	}
+}
+
+func readObjectContent(o core.Object) ([]byte, error) {
+	r, err := o.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,92 @@
+package packfile
+
+import (
+	"bytes"
+	"math/rand"
+
+	"gopkg.in/src-d/go-git.v4/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type DiffDeltaSuite struct{}
+
+var _ = Suite(&DiffDeltaSuite{})
+
+func randomBytes(seed int64, n int) []byte {
+	r := rand.New(rand.NewSource(seed))
+	b := make([]byte, n)
+	r.Read(b)
+
+	return b
+}
+
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+var diffDeltaTests = []struct {
+	name     string
+	src, tgt []byte
+}{
+	{"empty", []byte{}, []byte{}},
+	{"empty source", []byte{}, []byte("hello world\n")},
+	{"empty target", []byte("hello world\n"), []byte{}},
+	{"equal", randomBytes(1, 1024), randomBytes(1, 1024)},
+	{"append", randomBytes(1, 1024), join(randomBytes(1, 1024), []byte("foo"))},
+	{"prepend", randomBytes(1, 1024), join([]byte("foo"), randomBytes(1, 1024))},
+	{"different", randomBytes(1, 1024), randomBytes(2, 1024)},
+	{"long insert", randomBytes(1, 64), join(randomBytes(1, 64), randomBytes(2, 300))},
+	{"long copy", randomBytes(1, 200000), join(randomBytes(1, 200000), []byte("foo"))},
+	{
+		"reorder",
+		join(randomBytes(1, 500), randomBytes(2, 500), randomBytes(3, 500)),
+		join(randomBytes(3, 500), []byte("bar"), randomBytes(1, 500)),
+	},
+}
+
+func (s *DiffDeltaSuite) TestDiffDelta(c *C) {
+	for _, t := range diffDeltaTests {
+		delta := DiffDelta(t.src, t.tgt)
+		result := PatchDelta(t.src, delta)
+		c.Assert(len(result), Equals, len(t.tgt), Commentf("subtest %q", t.name))
+		c.Assert(bytes.Equal(result, t.tgt), Equals, true, Commentf("subtest %q", t.name))
+	}
+}
+
+func (s *DiffDeltaSuite) TestDiffDeltaSize(c *C) {
+	src := randomBytes(1, 100000)
+	tgt := join(src[:50000], []byte("foo"), src[50000:])
+
+	delta := DiffDelta(src, tgt)
+	c.Assert(len(delta) < 32, Equals, true, Commentf("delta size %d", len(delta)))
+}
+
+func (s *DiffDeltaSuite) TestGetDelta(c *C) {
+	base := &core.MemoryObject{}
+	base.SetType(core.BlobObject)
+	base.SetSize(12)
+	base.Write([]byte("hello world\n"))
+
+	target := &core.MemoryObject{}
+	target.SetType(core.BlobObject)
+	target.SetSize(16)
+	target.Write([]byte("hello world\nbye\n"))
+
+	delta, err := GetDelta(base, target)
+	c.Assert(err, IsNil)
+	c.Assert(delta.Type(), Equals, core.OFSDeltaObject)
+
+	result := &core.MemoryObject{}
+	err = ApplyDelta(result, base, []byte(readObject(c, delta)))
+	c.Assert(err, IsNil)
+	c.Assert(readObject(c, result), Equals, "hello world\nbye\n")
+}
+
+func (s *DiffDeltaSuite) TestEncodeLEB128(c *C) {
+	for _, n := range []uint{0, 1, 127, 128, 16383, 16384, 1 << 30} {
+		v, rest := decodeLEB128(encodeLEB128(n))
+		c.Assert(v, Equals, n)
+		c.Assert(rest, HasLen, 0)
+	}
+}
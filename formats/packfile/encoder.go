@@ -0,0 +1,264 @@
+package packfile
+
+import (
+	"compress/zlib"
+	"crypto/sha1"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"gopkg.in/src-d/go-git.v4/core"
+	"gopkg.in/src-d/go-git.v4/utils/binary"
+)
+
+// ErrBaseNotWritten is returned by EncodeObjects when an ofs-delta is written
+// before its base object.
+var ErrBaseNotWritten = NewError("delta base not written")
+
+// ObjectToPack is an object to be written in a packfile, it can be written
+// as a full object or as a delta of another ObjectToPack.
+type ObjectToPack struct {
+	// Object is the object written in the packfile, when the object is a
+	// delta its content is the delta instructions against Base.
+	Object core.Object
+	// Original is the object represented by this entry, for non-delta
+	// objects it is the same as Object.
+	Original core.Object
+	// Base is the object used as base of the delta, nil if this is not
+	// a delta.
+	Base *ObjectToPack
+	// Depth is the length of the delta chain of this object.
+	Depth int
+}
+
+// NewObjectToPack returns an ObjectToPack of a full object.
+func NewObjectToPack(o core.Object) *ObjectToPack {
+	return &ObjectToPack{Object: o, Original: o}
+}
+
+// NewDeltaObjectToPack returns an ObjectToPack of the given original object
+// written as the delta against base, the content of delta are the delta
+// instructions.
+func NewDeltaObjectToPack(base *ObjectToPack, original, delta core.Object) *ObjectToPack {
+	return &ObjectToPack{
+		Object:   delta,
+		Original: original,
+		Base:     base,
+		Depth:    base.Depth + 1,
+	}
+}
+
+// Hash returns the hash of the object represented by this entry.
+func (o *ObjectToPack) Hash() core.Hash {
+	return o.Original.Hash()
+}
+
+// IsDelta returns true if the object is written as a delta.
+func (o *ObjectToPack) IsDelta() bool {
+	return o.Base != nil
+}
+
+// Encoder writes packfiles to an output stream, the objects are read from a
+// core.ObjectStorage.
+type Encoder struct {
+	w        *offsetWriter
+	zw       *zlib.Writer
+	selector *deltaSelector
+
+	useRefDeltas bool
+	offsets      map[core.Hash]int64
+	crcs         map[core.Hash]uint32
+}
+
+// NewEncoder returns a new Encoder that writes to w the objects of s, the
+// deltas are written as ref-deltas if useRefDeltas is true, otherwise as
+// ofs-deltas.
+func NewEncoder(w io.Writer, s core.ObjectStorage, useRefDeltas bool) *Encoder {
+	ow := newOffsetWriter(w)
+	return &Encoder{
+		w:            ow,
+		zw:           zlib.NewWriter(ow),
+		selector:     newDeltaSelector(s),
+		useRefDeltas: useRefDeltas,
+	}
+}
+
+// Encode writes a packfile containing the objects with the given hashes,
+// returns the checksum of the packfile. The objects are written as deltas of
+// other objects being packed when it's worth it.
+func (e *Encoder) Encode(hashes []core.Hash) (core.Hash, error) {
+	objects, err := e.selector.ObjectsToPack(hashes)
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	return e.EncodeObjects(objects)
+}
+
+// EncodeObjects writes a packfile containing the given objects in the same
+// order, returns the checksum of the packfile. When ofs-deltas are used the
+// base of every delta should be written before the delta.
+func (e *Encoder) EncodeObjects(objects []*ObjectToPack) (core.Hash, error) {
+	e.w.reset()
+	e.offsets = make(map[core.Hash]int64, len(objects))
+	e.crcs = make(map[core.Hash]uint32, len(objects))
+
+	if err := e.head(len(objects)); err != nil {
+		return core.ZeroHash, err
+	}
+
+	for _, o := range objects {
+		if err := e.entry(o); err != nil {
+			return core.ZeroHash, err
+		}
+	}
+
+	return e.footer()
+}
+
+// Offsets returns the offsets of the objects written by the last call to
+// Encode or EncodeObjects, together with CRCs they are the entries needed to
+// build the idxfile.Idxfile of the packfile.
+func (e *Encoder) Offsets() map[core.Hash]int64 {
+	return e.offsets
+}
+
+// CRCs returns the CRC32 of the objects written by the last call to Encode or
+// EncodeObjects.
+func (e *Encoder) CRCs() map[core.Hash]uint32 {
+	return e.crcs
+}
+
+func (e *Encoder) head(count int) error {
+	return binary.Write(
+		e.w,
+		[]byte{'P', 'A', 'C', 'K'},
+		VersionSupported,
+		uint32(count),
+	)
+}
+
+func (e *Encoder) entry(o *ObjectToPack) error {
+	offset := e.w.Offset()
+	e.w.crc.Reset()
+
+	if err := e.entryHead(o, offset); err != nil {
+		return err
+	}
+
+	if err := e.entryContent(o.Object); err != nil {
+		return err
+	}
+
+	h := o.Hash()
+	e.offsets[h] = offset
+	e.crcs[h] = e.w.crc.Sum32()
+
+	return nil
+}
+
+func (e *Encoder) entryHead(o *ObjectToPack, offset int64) error {
+	if !o.IsDelta() {
+		return e.writeTypeAndLength(o.Object.Type(), o.Object.Size())
+	}
+
+	if e.useRefDeltas {
+		if err := e.writeTypeAndLength(core.REFDeltaObject, o.Object.Size()); err != nil {
+			return err
+		}
+
+		base := o.Base.Hash()
+		_, err := e.w.Write(base[:])
+		return err
+	}
+
+	base, ok := e.offsets[o.Base.Hash()]
+	if !ok {
+		return ErrBaseNotWritten.AddDetails("%s", o.Base.Hash())
+	}
+
+	if err := e.writeTypeAndLength(core.OFSDeltaObject, o.Object.Size()); err != nil {
+		return err
+	}
+
+	return binary.WriteVariableWidthInt(e.w, offset-base)
+}
+
+// writeTypeAndLength writes the type in the 3 bits after the MSB of the first
+// byte and the length in the last 4 bits of the first byte and in the last 7
+// bits of the subsequent bytes, the reverse of Scanner.readObjectTypeAndLength.
+func (e *Encoder) writeTypeAndLength(t core.ObjectType, length int64) error {
+	c := byte(t)<<firstLengthBits | byte(length)&maskFirstLength
+	length >>= firstLengthBits
+
+	buf := make([]byte, 0, 10)
+	for length != 0 {
+		buf = append(buf, c|maskContinue)
+		c = byte(length) & maskLength
+		length >>= lengthBits
+	}
+
+	_, err := e.w.Write(append(buf, c))
+	return err
+}
+
+func (e *Encoder) entryContent(o core.Object) error {
+	r, err := o.Reader()
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	e.zw.Reset(e.w)
+	if _, err := io.Copy(e.zw, r); err != nil {
+		return err
+	}
+
+	return e.zw.Close()
+}
+
+func (e *Encoder) footer() (core.Hash, error) {
+	var h core.Hash
+	copy(h[:], e.w.hash.Sum(nil))
+
+	_, err := e.w.w.Write(h[:])
+	return h, err
+}
+
+// offsetWriter keeps track of the number of bytes written, the checksum of
+// the whole packfile and the CRC32 of the current entry.
+type offsetWriter struct {
+	w      io.Writer
+	hash   hash.Hash
+	crc    hash.Hash32
+	offset int64
+}
+
+func newOffsetWriter(w io.Writer) *offsetWriter {
+	return &offsetWriter{
+		w:    w,
+		hash: sha1.New(),
+		crc:  crc32.NewIEEE(),
+	}
+}
+
+func (w *offsetWriter) Write(p []byte) (n int, err error) {
+	n, err = w.w.Write(p)
+	w.hash.Write(p[:n])
+	w.crc.Write(p[:n])
+	w.offset += int64(n)
+
+	return n, err
+}
+
+// reset starts the offset and the checksum of a new packfile.
+func (w *offsetWriter) reset() {
+	w.hash.Reset()
+	w.offset = 0
+}
+
+// Offset returns the number of bytes written.
+func (w *offsetWriter) Offset() int64 {
+	return w.offset
+}
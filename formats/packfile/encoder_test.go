@@ -0,0 +1,237 @@
+package packfile
+
+import (
+	"bytes"
+
+	"gopkg.in/src-d/go-git.v4/core"
+	"gopkg.in/src-d/go-git.v4/fixtures"
+	"gopkg.in/src-d/go-git.v4/formats/idxfile"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	. "gopkg.in/check.v1"
+)
+
+type EncoderSuite struct {
+	fixtures.Suite
+}
+
+var _ = Suite(&EncoderSuite{})
+
+func (s *EncoderSuite) TestEncodeEmpty(c *C) {
+	buf := bytes.NewBuffer(nil)
+	e := NewEncoder(buf, memory.NewStorage().ObjectStorage(), false)
+
+	h, err := e.Encode(nil)
+	c.Assert(err, IsNil)
+	c.Assert(e.Offsets(), HasLen, 0)
+
+	expected := []byte{'P', 'A', 'C', 'K', 0, 0, 0, 2, 0, 0, 0, 0}
+	c.Assert(buf.Bytes()[:12], DeepEquals, expected)
+	c.Assert(buf.Bytes()[12:], DeepEquals, h[:])
+
+	d, err := NewDecoder(NewScanner(buf), memory.NewStorage().ObjectStorage())
+	c.Assert(err, IsNil)
+
+	checksum, err := d.Decode()
+	c.Assert(err, IsNil)
+	c.Assert(checksum, Equals, h)
+}
+
+func (s *EncoderSuite) TestEncodeDecode(c *C) {
+	fixtures.Basic().ByTag("packfile").Test(c, func(f *fixtures.Fixture) {
+		storage := memory.NewStorage()
+		d, err := NewDecoder(NewScanner(f.Packfile()), storage.ObjectStorage())
+		c.Assert(err, IsNil)
+		_, err = d.Decode()
+		c.Assert(err, IsNil)
+
+		var hashes []core.Hash
+		for h := range storage.ObjectStorage().(*memory.ObjectStorage).Objects {
+			hashes = append(hashes, h)
+		}
+
+		buf := bytes.NewBuffer(nil)
+		e := NewEncoder(buf, storage.ObjectStorage(), false)
+		checksum, err := e.Encode(hashes)
+		c.Assert(err, IsNil)
+
+		result := memory.NewStorage()
+		d, err = NewDecoder(NewScanner(buf), result.ObjectStorage())
+		c.Assert(err, IsNil)
+
+		decoded, err := d.Decode()
+		c.Assert(err, IsNil)
+		c.Assert(decoded, Equals, checksum)
+
+		assertObjects(c, result, expectedHashes)
+
+		c.Assert(e.Offsets(), DeepEquals, d.Offsets())
+		c.Assert(e.CRCs(), DeepEquals, d.CRCs())
+	})
+}
+
+func (s *EncoderSuite) TestEncodeWithDeltas(c *C) {
+	storage := memory.NewStorage()
+	content := randomBytes(1, 4096)
+	base := setBlob(c, storage, string(content))
+	target := setBlob(c, storage, string(join(content, []byte("foo"))))
+
+	for _, useRefDeltas := range []bool{false, true} {
+		buf := bytes.NewBuffer(nil)
+		e := NewEncoder(buf, storage.ObjectStorage(), useRefDeltas)
+		_, err := e.Encode([]core.Hash{base, target})
+		c.Assert(err, IsNil)
+
+		// the second blob is written as a small delta
+		c.Assert(buf.Len() < 2*4096, Equals, true)
+
+		result := memory.NewStorage()
+		d, err := NewDecoder(NewScanner(buf), result.ObjectStorage())
+		c.Assert(err, IsNil)
+		_, err = d.Decode()
+		c.Assert(err, IsNil)
+
+		for _, h := range []core.Hash{base, target} {
+			expected, err := storage.ObjectStorage().Get(core.BlobObject, h)
+			c.Assert(err, IsNil)
+			obtained, err := result.ObjectStorage().Get(core.BlobObject, h)
+			c.Assert(err, IsNil)
+			c.Assert(readObject(c, obtained), Equals, readObject(c, expected))
+		}
+	}
+}
+
+func (s *EncoderSuite) TestEncodeIdxfile(c *C) {
+	storage := memory.NewStorage()
+	h := setBlob(c, storage, "foo")
+
+	buf := bytes.NewBuffer(nil)
+	e := NewEncoder(buf, storage.ObjectStorage(), false)
+	checksum, err := e.Encode([]core.Hash{h})
+	c.Assert(err, IsNil)
+
+	idx := &idxfile.Idxfile{
+		Version:          idxfile.VersionSupported,
+		PackfileChecksum: checksum,
+	}
+
+	offsets := e.Offsets()
+	for h, crc := range e.CRCs() {
+		idx.Add(h, uint64(offsets[h]), crc)
+	}
+
+	idxBuf := bytes.NewBuffer(nil)
+	_, err = idxfile.NewEncoder(idxBuf).Encode(idx)
+	c.Assert(err, IsNil)
+
+	index, err := idxfile.NewIndex(bytes.NewReader(idxBuf.Bytes()))
+	c.Assert(err, IsNil)
+
+	offset, err := index.FindOffset(h)
+	c.Assert(err, IsNil)
+	c.Assert(offset, Equals, int64(12))
+}
+
+func (s *EncoderSuite) TestEncodeOFSDelta(c *C) {
+	s.testEncodeDelta(c, false)
+}
+
+func (s *EncoderSuite) TestEncodeREFDelta(c *C) {
+	s.testEncodeDelta(c, true)
+}
+
+func (s *EncoderSuite) testEncodeDelta(c *C, useRefDeltas bool) {
+	storage := memory.NewStorage()
+	base, target := "hello world\n", "hello world\nbye\n"
+	baseHash := setBlob(c, storage, base)
+	targetHash := setBlob(c, storage, target)
+
+	baseObject, err := storage.ObjectStorage().Get(core.BlobObject, baseHash)
+	c.Assert(err, IsNil)
+	targetObject, err := storage.ObjectStorage().Get(core.BlobObject, targetHash)
+	c.Assert(err, IsNil)
+
+	// copy the 12 bytes of the base and insert "bye\n"
+	delta := newObject(storage, core.OFSDeltaObject, []byte{
+		12, 16, 0x90, 12, 4, 'b', 'y', 'e', '\n',
+	})
+
+	baseToPack := NewObjectToPack(baseObject)
+	targetToPack := NewDeltaObjectToPack(baseToPack, targetObject, delta)
+	c.Assert(targetToPack.IsDelta(), Equals, true)
+	c.Assert(targetToPack.Depth, Equals, 1)
+	c.Assert(targetToPack.Hash(), Equals, targetHash)
+
+	buf := bytes.NewBuffer(nil)
+	e := NewEncoder(buf, storage.ObjectStorage(), useRefDeltas)
+	_, err = e.EncodeObjects([]*ObjectToPack{baseToPack, targetToPack})
+	c.Assert(err, IsNil)
+
+	result := memory.NewStorage()
+	d, err := NewDecoder(NewScanner(buf), result.ObjectStorage())
+	c.Assert(err, IsNil)
+	_, err = d.Decode()
+	c.Assert(err, IsNil)
+
+	o, err := result.ObjectStorage().Get(core.BlobObject, targetHash)
+	c.Assert(err, IsNil)
+	c.Assert(readObject(c, o), Equals, target)
+}
+
+func (s *EncoderSuite) TestEncodeOFSDeltaBaseNotWritten(c *C) {
+	storage := memory.NewStorage()
+	baseHash := setBlob(c, storage, "hello world\n")
+	targetHash := setBlob(c, storage, "hello world\nbye\n")
+
+	baseObject, err := storage.ObjectStorage().Get(core.BlobObject, baseHash)
+	c.Assert(err, IsNil)
+	targetObject, err := storage.ObjectStorage().Get(core.BlobObject, targetHash)
+	c.Assert(err, IsNil)
+
+	delta := newObject(storage, core.OFSDeltaObject, []byte{
+		12, 16, 0x90, 12, 4, 'b', 'y', 'e', '\n',
+	})
+
+	targetToPack := NewDeltaObjectToPack(NewObjectToPack(baseObject), targetObject, delta)
+
+	e := NewEncoder(bytes.NewBuffer(nil), storage.ObjectStorage(), false)
+	_, err = e.EncodeObjects([]*ObjectToPack{targetToPack})
+	c.Assert(err, ErrorMatches, ErrBaseNotWritten.reason+".*")
+}
+
+func (s *EncoderSuite) TestEncodeObjectNotFound(c *C) {
+	e := NewEncoder(bytes.NewBuffer(nil), memory.NewStorage().ObjectStorage(), false)
+	_, err := e.Encode([]core.Hash{core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")})
+	c.Assert(err, Equals, core.ErrObjectNotFound)
+}
+
+func newObject(s *memory.Storage, t core.ObjectType, content []byte) core.Object {
+	o := s.ObjectStorage().NewObject()
+	o.SetType(t)
+	o.SetSize(int64(len(content)))
+
+	w, _ := o.Writer()
+	w.Write(content)
+	w.Close()
+
+	return o
+}
+
+func setBlob(c *C, s *memory.Storage, content string) core.Hash {
+	h, err := s.ObjectStorage().Set(newObject(s, core.BlobObject, []byte(content)))
+	c.Assert(err, IsNil)
+
+	return h
+}
+
+func readObject(c *C, o core.Object) string {
+	r, err := o.Reader()
+	c.Assert(err, IsNil)
+	defer r.Close()
+
+	buf := bytes.NewBuffer(nil)
+	_, err = buf.ReadFrom(r)
+	c.Assert(err, IsNil)
+
+	return buf.String()
+}
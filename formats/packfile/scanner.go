@@ -286,6 +286,20 @@ func (s *Scanner) NextObject(w io.Writer) (written int64, crc32 uint32, err erro
 	return
 }
 
+// NextObjectReader returns a reader of the content of the next object, the
+// content is inflated as it is read, so the object is never fully loaded in
+// memory. The reader should be closed before calling any other method of the
+// Scanner.
+func (s *Scanner) NextObjectReader() (io.ReadCloser, error) {
+	s.pendingObject = nil
+	zr, err := zlib.NewReader(s.r)
+	if err != nil {
+		return nil, ErrZLib.AddDetails(err.Error())
+	}
+
+	return zr, nil
+}
+
 // ReadRegularObject reads and write a non-deltified object
 // from it zlib stream in an object entry in the packfile.
 func (s *Scanner) copyObject(w io.Writer) (int64, error) {
@@ -3,6 +3,7 @@ package packfile
 import (
 	"bytes"
 	"io"
+	"io/ioutil"
 
 	. "gopkg.in/check.v1"
 	"gopkg.in/src-d/go-git.v4/core"
@@ -70,6 +71,26 @@ func (s *ScannerSuite) testNextObjectHeader(c *C, tag string, expected []ObjectH
 	c.Assert(n, HasLen, 20)
 }
 
+func (s *ScannerSuite) TestNextObjectReader(c *C) {
+	r := fixtures.Basic().ByTag("ofs-delta").One().Packfile()
+	p := NewScanner(r)
+
+	h, err := p.NextObjectHeader()
+	c.Assert(err, IsNil)
+
+	or, err := p.NextObjectReader()
+	c.Assert(err, IsNil)
+
+	content, err := ioutil.ReadAll(or)
+	c.Assert(err, IsNil)
+	c.Assert(int64(len(content)), Equals, h.Length)
+	c.Assert(or.Close(), IsNil)
+
+	h, err = p.NextObjectHeader()
+	c.Assert(err, IsNil)
+	c.Assert(*h, DeepEquals, expectedHeadersOFS[1])
+}
+
 func (s *ScannerSuite) TestNextObjectHeaderWithOutReadObject(c *C) {
 	f := fixtures.Basic().ByTag("ref-delta").One()
 	r := f.Packfile()
@@ -0,0 +1,378 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"gopkg.in/src-d/go-git.v4/core"
+)
+
+var (
+	// ErrObjectHashMismatch is reported by Fsck when the content of an object
+	// doesn't match its hash.
+	ErrObjectHashMismatch = errors.New("object hash mismatch")
+	// ErrObjectSizeMismatch is reported by Fsck when the content of an object
+	// is shorter or longer than its size.
+	ErrObjectSizeMismatch = errors.New("object size mismatch")
+	// ErrMalformedObject is reported by Fsck when a commit has no tree or a
+	// tag has no target.
+	ErrMalformedObject = errors.New("malformed object")
+)
+
+// FsckReport is the result of Repository.Fsck.
+type FsckReport struct {
+	// Missing are the objects reachable from the references, the reflogs
+	// or the index that are not found in the storage.
+	Missing []core.Hash
+	// Corrupt are the objects that can't be read, whose content doesn't
+	// match their hash or that can't be decoded.
+	Corrupt []*FsckError
+	// Dangling are the objects not referenced by any other object, nor by
+	// the references, the reflogs or the index.
+	Dangling []core.Hash
+	// BrokenReferences are the references whose history reaches a missing or
+	// corrupt object.
+	BrokenReferences []core.ReferenceName
+	// CorruptPacks are the packfiles whose checksum or CRC32s don't match
+	// their content.
+	CorruptPacks []*FsckError
+}
+
+// IsValid returns true if no missing or corrupt objects nor corrupt packfiles
+// were found, the dangling objects don't make a repository invalid.
+func (r *FsckReport) IsValid() bool {
+	return len(r.Missing) == 0 && len(r.Corrupt) == 0 &&
+		len(r.BrokenReferences) == 0 && len(r.CorruptPacks) == 0
+}
+
+// FsckError is an object or a packfile that failed the checks of Fsck.
+type FsckError struct {
+	Hash core.Hash
+	Err  error
+}
+
+func (e *FsckError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Hash, e.Err)
+}
+
+// Fsck checks the integrity of the repository, as git fsck does. Every object
+// of the storage is read, its content is hashed and compared against its name
+// and the commits, trees and tags are decoded. The history of every reference
+// must be fully connected, so the repositories cloned with Depth are reported
+// as broken. If the storage supports it the packfiles are verified too.
+//
+// The objects of the alternates are only checked when they are reachable.
+func (r *Repository) Fsck() (*FsckReport, error) {
+	names, err := r.localObjectNames()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &FsckReport{}
+
+	// references of every valid object and the corrupt ones
+	refs := make(map[core.Hash][]core.Hash, len(names))
+	corrupt := make(map[core.Hash]bool, 0)
+	for _, h := range names {
+		objRefs, err := r.fsckObject(h)
+		if err != nil {
+			report.Corrupt = append(report.Corrupt, &FsckError{Hash: h, Err: err})
+			corrupt[h] = true
+			continue
+		}
+
+		refs[h] = objRefs
+	}
+
+	if err := r.fsckPacks(report); err != nil {
+		return nil, err
+	}
+
+	roots, err := r.reachableRoots()
+	if err != nil {
+		return nil, err
+	}
+
+	parents := r.fsckConnectivity(report, roots, refs, corrupt)
+	broken := brokenObjects(parents, report.Missing, corrupt)
+	if report.BrokenReferences, err = r.brokenReferences(broken); err != nil {
+		return nil, err
+	}
+
+	report.Dangling = danglingObjects(names, roots, refs, corrupt)
+	return report, nil
+}
+
+// localObjectNames returns the hashes of the objects of the storage, without
+// the objects of the alternates if the storage lists them one by one.
+func (r *Repository) localObjectNames() ([]core.Hash, error) {
+	s := r.s.ObjectStorage()
+	packed, isPacked := s.(core.PackedObjectStorage)
+	loose, isLoose := s.(core.LooseObjectStorage)
+
+	var hashes []core.Hash
+	if isPacked && isLoose {
+		packs, err := packed.ObjectPacks()
+		if err != nil {
+			return nil, err
+		}
+
+		local, err := localObjects(packed, loose, packs)
+		if err != nil {
+			return nil, err
+		}
+
+		for h := range local {
+			hashes = append(hashes, h)
+		}
+	} else {
+		iter, err := s.Iter(core.AnyObject)
+		if err != nil {
+			return nil, err
+		}
+
+		err = iter.ForEach(func(o core.Object) error {
+			hashes = append(hashes, o.Hash())
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Sort(core.HashSlice(hashes))
+	return hashes, nil
+}
+
+// fsckObject reads the object with the given hash, checks its content and
+// returns the hashes of the objects it references.
+func (r *Repository) fsckObject(h core.Hash) ([]core.Hash, error) {
+	o, err := r.s.ObjectStorage().Get(core.AnyObject, h)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkObjectHash(o, h); err != nil {
+		return nil, err
+	}
+
+	return r.objectReferences(o)
+}
+
+// checkObjectHash hashes the content of the object and compares it against
+// the given hash, the hash returned by the object is not trusted since it may
+// be the name used to look it up.
+func checkObjectHash(o core.Object, h core.Hash) (err error) {
+	reader, err := o.Reader()
+	if err != nil {
+		return err
+	}
+	defer checkClose(reader, &err)
+
+	hasher := core.NewHasher(o.Type(), o.Size())
+	n, err := io.Copy(hasher, reader)
+	if err != nil {
+		return err
+	}
+
+	if n != o.Size() {
+		return ErrObjectSizeMismatch
+	}
+
+	if hasher.Sum() != h {
+		return ErrObjectHashMismatch
+	}
+
+	return nil
+}
+
+// objectReferences decodes the object and returns the hashes of the objects
+// it references, the commits of the submodules are not included.
+func (r *Repository) objectReferences(o core.Object) ([]core.Hash, error) {
+	switch o.Type() {
+	case core.CommitObject:
+		c := &Commit{r: r}
+		if err := c.Decode(o); err != nil {
+			return nil, err
+		}
+
+		if c.tree.IsZero() {
+			return nil, ErrMalformedObject
+		}
+
+		return append([]core.Hash{c.tree}, c.parents...), nil
+	case core.TreeObject:
+		t := &Tree{r: r}
+		if err := t.Decode(o); err != nil {
+			return nil, err
+		}
+
+		var hashes []core.Hash
+		for _, e := range t.Entries {
+			if e.Mode != submoduleMode {
+				hashes = append(hashes, e.Hash)
+			}
+		}
+
+		return hashes, nil
+	case core.TagObject:
+		t := &Tag{r: r}
+		if err := t.Decode(o); err != nil {
+			return nil, err
+		}
+
+		if t.Target.IsZero() {
+			return nil, ErrMalformedObject
+		}
+
+		return []core.Hash{t.Target}, nil
+	case core.BlobObject:
+		return nil, nil
+	default:
+		return nil, ErrUnsupportedObject
+	}
+}
+
+// fsckPacks verifies the packfiles of the storage, if supported.
+func (r *Repository) fsckPacks(report *FsckReport) error {
+	s := r.s.ObjectStorage()
+	packed, isPacked := s.(core.PackedObjectStorage)
+	verifier, isVerifiable := s.(core.VerifiablePackedObjectStorage)
+	if !isPacked || !isVerifiable {
+		return nil
+	}
+
+	packs, err := packed.ObjectPacks()
+	if err != nil {
+		return err
+	}
+
+	for _, pack := range packs {
+		if err := verifier.VerifyObjectPack(pack); err != nil {
+			report.CorruptPacks = append(report.CorruptPacks, &FsckError{Hash: pack, Err: err})
+		}
+	}
+
+	return nil
+}
+
+// fsckConnectivity walks the objects reachable from the roots, the missing
+// objects are added to the report. The objects not found in refs, as the ones
+// of the alternates, are checked as they are reached. Returns the objects
+// referencing every reachable object.
+func (r *Repository) fsckConnectivity(
+	report *FsckReport, roots []core.Hash,
+	refs map[core.Hash][]core.Hash, corrupt map[core.Hash]bool,
+) map[core.Hash][]core.Hash {
+	parents := make(map[core.Hash][]core.Hash, len(refs))
+	seen := make(map[core.Hash]bool, len(refs))
+	pending := append([]core.Hash(nil), roots...)
+	for len(pending) > 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if seen[h] || corrupt[h] {
+			continue
+		}
+
+		seen[h] = true
+		objRefs, ok := refs[h]
+		if !ok {
+			var err error
+			objRefs, err = r.fsckObject(h)
+			switch err {
+			case nil:
+				refs[h] = objRefs
+			case core.ErrObjectNotFound:
+				report.Missing = append(report.Missing, h)
+				continue
+			default:
+				report.Corrupt = append(report.Corrupt, &FsckError{Hash: h, Err: err})
+				corrupt[h] = true
+				continue
+			}
+		}
+
+		for _, ref := range objRefs {
+			parents[ref] = append(parents[ref], h)
+			pending = append(pending, ref)
+		}
+	}
+
+	sort.Sort(core.HashSlice(report.Missing))
+	return parents
+}
+
+// brokenObjects returns the missing and corrupt objects and every object
+// whose history reaches one of them.
+func brokenObjects(
+	parents map[core.Hash][]core.Hash, missing []core.Hash, corrupt map[core.Hash]bool,
+) map[core.Hash]bool {
+	pending := append([]core.Hash(nil), missing...)
+	for h := range corrupt {
+		pending = append(pending, h)
+	}
+
+	broken := make(map[core.Hash]bool, 0)
+	for len(pending) > 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if broken[h] {
+			continue
+		}
+
+		broken[h] = true
+		pending = append(pending, parents[h]...)
+	}
+
+	return broken
+}
+
+// brokenReferences returns the names of the hash references pointing to a
+// broken object.
+func (r *Repository) brokenReferences(broken map[core.Hash]bool) ([]core.ReferenceName, error) {
+	iter, err := r.s.ReferenceStorage().Iter()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []core.ReferenceName
+	err = iter.ForEach(func(ref *core.Reference) error {
+		if ref.Type() == core.HashReference && broken[ref.Hash()] {
+			names = append(names, ref.Name())
+		}
+
+		return nil
+	})
+
+	return names, err
+}
+
+// danglingObjects returns the valid objects not referenced by any other object
+// nor by the roots, as git does the objects only referenced by unreachable
+// objects are not dangling.
+func danglingObjects(
+	names, roots []core.Hash, refs map[core.Hash][]core.Hash, corrupt map[core.Hash]bool,
+) []core.Hash {
+	referenced := make(map[core.Hash]bool, len(refs))
+	for _, h := range roots {
+		referenced[h] = true
+	}
+
+	for _, objRefs := range refs {
+		for _, h := range objRefs {
+			referenced[h] = true
+		}
+	}
+
+	var dangling []core.Hash
+	for _, h := range names {
+		if !referenced[h] && !corrupt[h] {
+			dangling = append(dangling, h)
+		}
+	}
+
+	return dangling
+}
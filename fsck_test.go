@@ -0,0 +1,141 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/src-d/go-git.v4/core"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+
+	. "gopkg.in/check.v1"
+)
+
+type FsckSuite struct {
+	BaseSuite
+}
+
+var _ = Suite(&FsckSuite{})
+
+func (s *FsckSuite) TestFsck(c *C) {
+	r, _ := s.newClonedRepository(c)
+
+	report, err := r.Fsck()
+	c.Assert(err, IsNil)
+	c.Assert(report.IsValid(), Equals, true)
+	c.Assert(report.Missing, HasLen, 0)
+	c.Assert(report.Corrupt, HasLen, 0)
+	c.Assert(report.Dangling, HasLen, 0)
+	c.Assert(report.BrokenReferences, HasLen, 0)
+	c.Assert(report.CorruptPacks, HasLen, 0)
+}
+
+func (s *FsckSuite) TestFsckMemory(c *C) {
+	r := NewMemoryRepository()
+	err := r.Clone(&CloneOptions{URL: RepositoryFixture})
+	c.Assert(err, IsNil)
+
+	report, err := r.Fsck()
+	c.Assert(err, IsNil)
+	c.Assert(report.IsValid(), Equals, true)
+	c.Assert(report.Dangling, HasLen, 0)
+}
+
+func (s *FsckSuite) TestFsckDangling(c *C) {
+	r, _ := s.newClonedRepository(c)
+	h := s.setObject(c, r, core.BlobObject, "dangling")
+
+	report, err := r.Fsck()
+	c.Assert(err, IsNil)
+	c.Assert(report.IsValid(), Equals, true)
+	c.Assert(report.Dangling, DeepEquals, []core.Hash{h})
+}
+
+func (s *FsckSuite) TestFsckMissing(c *C) {
+	r, _ := s.newClonedRepository(c)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+
+	tree := core.ComputeHash(core.TreeObject, []byte("missing"))
+	commit := s.setObject(c, r, core.CommitObject, fmt.Sprintf(
+		"tree %s\nparent %s\n\nbroken commit\n", tree, head.Hash(),
+	))
+
+	name := core.ReferenceName("refs/heads/broken")
+	err = r.s.ReferenceStorage().Set(core.NewHashReference(name, commit))
+	c.Assert(err, IsNil)
+
+	report, err := r.Fsck()
+	c.Assert(err, IsNil)
+	c.Assert(report.IsValid(), Equals, false)
+	c.Assert(report.Missing, DeepEquals, []core.Hash{tree})
+	c.Assert(report.BrokenReferences, DeepEquals, []core.ReferenceName{name})
+	c.Assert(report.Corrupt, HasLen, 0)
+	c.Assert(report.Dangling, HasLen, 0)
+}
+
+func (s *FsckSuite) TestFsckCorruptObject(c *C) {
+	r, dir := s.newClonedRepository(c)
+
+	// the content of the loose object doesn't match its name
+	h := s.setObject(c, r, core.BlobObject, "foo")
+	name := core.ComputeHash(core.BlobObject, []byte("bar"))
+	err := os.MkdirAll(s.objectPath(dir, name, ""), 0755)
+	c.Assert(err, IsNil)
+	err = os.Rename(s.objectPath(dir, h, h.String()[2:]), s.objectPath(dir, name, name.String()[2:]))
+	c.Assert(err, IsNil)
+
+	report, err := r.Fsck()
+	c.Assert(err, IsNil)
+	c.Assert(report.IsValid(), Equals, false)
+	c.Assert(report.Corrupt, HasLen, 1)
+	c.Assert(report.Corrupt[0].Hash, Equals, name)
+	c.Assert(report.Corrupt[0].Err, Equals, ErrObjectHashMismatch)
+	c.Assert(report.Dangling, HasLen, 0)
+}
+
+func (s *FsckSuite) TestFsckMalformedCommit(c *C) {
+	r := NewMemoryRepository()
+	h := s.setObject(c, r, core.CommitObject, "\nno tree\n")
+
+	report, err := r.Fsck()
+	c.Assert(err, IsNil)
+	c.Assert(report.Corrupt, HasLen, 1)
+	c.Assert(report.Corrupt[0].Hash, Equals, h)
+	c.Assert(report.Corrupt[0].Err, Equals, ErrMalformedObject)
+}
+
+func (s *FsckSuite) TestFsckCorruptPack(c *C) {
+	r, dir := s.newClonedRepository(c)
+
+	packs, err := r.s.ObjectStorage().(core.PackedObjectStorage).ObjectPacks()
+	c.Assert(err, IsNil)
+	c.Assert(packs, HasLen, 1)
+
+	// the last byte of the checksum at the end of the packfile
+	path := filepath.Join(dir, "objects", "pack", fmt.Sprintf("pack-%s.pack", packs[0]))
+	fi, err := os.Stat(path)
+	c.Assert(err, IsNil)
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	c.Assert(err, IsNil)
+	_, err = f.WriteAt([]byte{^packs[0][19]}, fi.Size()-1)
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	r, err = NewFilesystemRepository(dir)
+	c.Assert(err, IsNil)
+
+	report, err := r.Fsck()
+	c.Assert(err, IsNil)
+	c.Assert(report.IsValid(), Equals, false)
+	c.Assert(report.CorruptPacks, HasLen, 1)
+	c.Assert(report.CorruptPacks[0].Hash, Equals, packs[0])
+	c.Assert(report.CorruptPacks[0].Err, Equals, filesystem.ErrPackfileChecksumMismatch)
+	c.Assert(report.Corrupt, HasLen, 0)
+}
+
+func (s *FsckSuite) objectPath(dir string, h core.Hash, file string) string {
+	return filepath.Join(dir, "objects", h.String()[:2], file)
+}
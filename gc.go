@@ -0,0 +1,348 @@
+package git
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/core"
+	"gopkg.in/src-d/go-git.v4/formats/packfile"
+	"gopkg.in/src-d/go-git.v4/utils/fs"
+)
+
+// ErrRepackNotSupported is returned by Repack and GC when the object storage
+// can't write packfiles or delete objects.
+var ErrRepackNotSupported = errors.New("repack not supported by the storage")
+
+// Repack packs all the objects reachable from the references, the reflogs and
+// the index in one packfile, the loose objects and packfiles made redundant
+// are deleted. The unreachable objects are kept as loose objects.
+func (r *Repository) Repack() error {
+	return r.repack(time.Time{})
+}
+
+// GC repacks the objects as Repack does and prunes the unreachable objects not
+// modified inside the grace period given by the options.
+func (r *Repository) GC(o *GCOptions) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	return r.repack(time.Now().Add(-o.PruneExpire))
+}
+
+// repack packs the reachable objects, the unreachable objects modified before
+// expire are deleted, if expire is zero all of them are kept.
+func (r *Repository) repack(expire time.Time) error {
+	s := r.s.ObjectStorage()
+	packed, isPacked := s.(core.PackedObjectStorage)
+	loose, isLoose := s.(core.LooseObjectStorage)
+	writer, isWriter := s.(core.ObjectStorageWrite)
+	if !isPacked || !isLoose || !isWriter {
+		return ErrRepackNotSupported
+	}
+
+	reachable, err := r.reachableObjects()
+	if err != nil {
+		return err
+	}
+
+	packs, err := packed.ObjectPacks()
+	if err != nil {
+		return err
+	}
+
+	local, err := localObjects(packed, loose, packs)
+	if err != nil {
+		return err
+	}
+
+	if err := r.unpackUnreachable(packed, loose, packs, reachable, expire); err != nil {
+		return err
+	}
+
+	// the objects of the alternates are not copied
+	var hashes []core.Hash
+	for h := range reachable {
+		if local[h] {
+			hashes = append(hashes, h)
+		}
+	}
+
+	var pack core.Hash
+	if len(hashes) != 0 {
+		if pack, err = r.writePack(writer, hashes); err != nil {
+			return err
+		}
+	}
+
+	for _, h := range packs {
+		if h == pack {
+			continue
+		}
+
+		if err := packed.DeleteObjectPack(h); err != nil {
+			return err
+		}
+	}
+
+	return pruneLooseObjects(loose, reachable, expire)
+}
+
+// localObjects returns the objects stored in the packfiles and as loose
+// objects.
+func localObjects(
+	packed core.PackedObjectStorage, loose core.LooseObjectStorage, packs []core.Hash,
+) (map[core.Hash]bool, error) {
+	local := make(map[core.Hash]bool, 0)
+	for _, pack := range packs {
+		hashes, err := packed.ObjectPackHashes(pack)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, h := range hashes {
+			local[h] = true
+		}
+	}
+
+	hashes, err := loose.LooseObjects()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, h := range hashes {
+		local[h] = true
+	}
+
+	return local, nil
+}
+
+// unpackUnreachable writes as loose objects the unreachable objects of the
+// packfiles modified after expire, so they are kept when the packfiles are
+// deleted, as git repack -A does. The loose objects get the modification time
+// of their packfile, so they expire when the packfile would have, if the
+// storage supports it.
+func (r *Repository) unpackUnreachable(
+	packed core.PackedObjectStorage, loose core.LooseObjectStorage,
+	packs []core.Hash, reachable map[core.Hash]bool, expire time.Time,
+) error {
+	s := r.s.ObjectStorage()
+	seen := make(map[core.Hash]bool, 0)
+	for _, pack := range packs {
+		t, err := packed.ObjectPackTime(pack)
+		if err != nil {
+			return err
+		}
+
+		if !expire.IsZero() && t.Before(expire) {
+			continue
+		}
+
+		hashes, err := packed.ObjectPackHashes(pack)
+		if err != nil {
+			return err
+		}
+
+		for _, h := range hashes {
+			if reachable[h] || seen[h] {
+				continue
+			}
+
+			seen[h] = true
+			o, err := s.Get(core.AnyObject, h)
+			if err != nil {
+				return err
+			}
+
+			if _, err := s.Set(o); err != nil {
+				return err
+			}
+
+			// without support the object keeps the current time
+			err = loose.SetLooseObjectTime(h, t)
+			if err != nil && err != fs.ErrNotSupported {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// writePack writes a packfile with the given objects, returns its hash.
+func (r *Repository) writePack(s core.ObjectStorageWrite, hashes []core.Hash) (core.Hash, error) {
+	sort.Sort(core.HashSlice(hashes))
+
+	w, err := s.Writer()
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	e := packfile.NewEncoder(w, r.s.ObjectStorage(), false)
+	pack, err := e.Encode(hashes)
+	if err != nil {
+		w.Close()
+		return core.ZeroHash, err
+	}
+
+	return pack, w.Close()
+}
+
+// pruneLooseObjects deletes the loose objects already packed and the
+// unreachable ones modified before expire.
+func pruneLooseObjects(
+	s core.LooseObjectStorage, reachable map[core.Hash]bool, expire time.Time,
+) error {
+	hashes, err := s.LooseObjects()
+	if err != nil {
+		return err
+	}
+
+	for _, h := range hashes {
+		if !reachable[h] {
+			if expire.IsZero() {
+				continue
+			}
+
+			t, err := s.LooseObjectTime(h)
+			if err != nil {
+				return err
+			}
+
+			if !t.Before(expire) {
+				continue
+			}
+		}
+
+		if err := s.DeleteLooseObject(h); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reachableObjects returns the objects reachable from the references, the
+// reflogs and the index. The missing objects are ignored, they may belong to
+// a shallow history.
+func (r *Repository) reachableObjects() (map[core.Hash]bool, error) {
+	pending, err := r.reachableRoots()
+	if err != nil {
+		return nil, err
+	}
+
+	s := r.s.ObjectStorage()
+	seen := make(map[core.Hash]bool, 0)
+	for len(pending) > 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if seen[h] {
+			continue
+		}
+
+		seen[h] = true
+		o, err := s.Get(core.AnyObject, h)
+		if err == core.ErrObjectNotFound {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch o.Type() {
+		case core.CommitObject:
+			c := &Commit{r: r}
+			if err := c.Decode(o); err != nil {
+				return nil, err
+			}
+
+			pending = append(pending, c.tree)
+			pending = append(pending, c.parents...)
+		case core.TreeObject:
+			t := &Tree{r: r}
+			if err := t.Decode(o); err != nil {
+				return nil, err
+			}
+
+			for _, e := range t.Entries {
+				switch {
+				case e.Mode == submoduleMode:
+					// the commits of the submodules belong to other
+					// repositories
+				case e.Mode.IsDir():
+					pending = append(pending, e.Hash)
+				default:
+					// the blobs have no references, no need to read them
+					seen[e.Hash] = true
+				}
+			}
+		case core.TagObject:
+			t := &Tag{r: r}
+			if err := t.Decode(o); err != nil {
+				return nil, err
+			}
+
+			pending = append(pending, t.Target)
+		}
+	}
+
+	return seen, nil
+}
+
+// reachableRoots returns the objects pointed by the references, the reflogs
+// and the index.
+func (r *Repository) reachableRoots() ([]core.Hash, error) {
+	refs, err := r.s.ReferenceStorage().Iter()
+	if err != nil {
+		return nil, err
+	}
+
+	var roots []core.Hash
+	var names []core.ReferenceName
+	err = refs.ForEach(func(ref *core.Reference) error {
+		names = append(names, ref.Name())
+		if ref.Type() == core.HashReference {
+			roots = append(roots, ref.Hash())
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := r.s.ReferenceStorage().(core.ReflogStorage); ok {
+		for _, name := range names {
+			entries, err := s.Reflog(name)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, e := range entries {
+				for _, h := range []core.Hash{e.Old, e.New} {
+					if !h.IsZero() {
+						roots = append(roots, h)
+					}
+				}
+			}
+		}
+	}
+
+	if s, ok := r.s.(IndexStorage); ok {
+		idx, err := s.Index()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range idx.Entries {
+			if e.Mode != submoduleMode {
+				roots = append(roots, e.Hash)
+			}
+		}
+	}
+
+	return roots, nil
+}
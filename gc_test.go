@@ -0,0 +1,202 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/core"
+	"gopkg.in/src-d/go-git.v4/formats/packfile"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+	"gopkg.in/src-d/go-git.v4/utils/fs"
+	osfs "gopkg.in/src-d/go-git.v4/utils/fs/os"
+
+	. "gopkg.in/check.v1"
+)
+
+type GCSuite struct {
+	BaseSuite
+}
+
+var _ = Suite(&GCSuite{})
+
+func (s *GCSuite) TestRepack(c *C) {
+	r, _ := s.newClonedRepository(c)
+	os := r.s.ObjectStorage()
+
+	// a packed object also stored as loose object
+	packed, err := os.Get(core.BlobObject, core.NewHash("32858aad3c383ed1ff0a0f9bdf231d54a00c9e88"))
+	c.Assert(err, IsNil)
+	_, err = os.Set(packed)
+	c.Assert(err, IsNil)
+
+	unreachable := s.setObject(c, r, core.BlobObject, "unreachable")
+	commits := s.countCommits(c, r)
+
+	err = r.Repack()
+	c.Assert(err, IsNil)
+
+	packs, err := os.(core.PackedObjectStorage).ObjectPacks()
+	c.Assert(err, IsNil)
+	c.Assert(packs, HasLen, 1)
+
+	hashes, err := os.(core.PackedObjectStorage).ObjectPackHashes(packs[0])
+	c.Assert(err, IsNil)
+	c.Assert(hashes, HasLen, 31)
+
+	loose, err := os.(core.LooseObjectStorage).LooseObjects()
+	c.Assert(err, IsNil)
+	c.Assert(loose, DeepEquals, []core.Hash{unreachable})
+
+	c.Assert(s.countCommits(c, r), Equals, commits)
+}
+
+func (s *GCSuite) TestRepackTwice(c *C) {
+	r, _ := s.newClonedRepository(c)
+
+	c.Assert(r.Repack(), IsNil)
+	first, err := r.s.ObjectStorage().(core.PackedObjectStorage).ObjectPacks()
+	c.Assert(err, IsNil)
+
+	c.Assert(r.Repack(), IsNil)
+	second, err := r.s.ObjectStorage().(core.PackedObjectStorage).ObjectPacks()
+	c.Assert(err, IsNil)
+
+	c.Assert(second, DeepEquals, first)
+}
+
+func (s *GCSuite) TestGCPrunesLooseObjects(c *C) {
+	r, dir := s.newClonedRepository(c)
+
+	old := s.setObject(c, r, core.BlobObject, "old unreachable")
+	recent := s.setObject(c, r, core.BlobObject, "recent unreachable")
+
+	t := time.Now().Add(-30 * 24 * time.Hour)
+	hash := old.String()
+	err := os.Chtimes(filepath.Join(dir, "objects", hash[:2], hash[2:]), t, t)
+	c.Assert(err, IsNil)
+
+	err = r.GC(&GCOptions{})
+	c.Assert(err, IsNil)
+
+	_, err = r.s.ObjectStorage().Get(core.AnyObject, old)
+	c.Assert(err, Equals, core.ErrObjectNotFound)
+
+	_, err = r.s.ObjectStorage().Get(core.AnyObject, recent)
+	c.Assert(err, IsNil)
+
+	_, err = os.Stat(filepath.Join(dir, "objects", hash[:2]))
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *GCSuite) TestGCUnreachablePackedObjects(c *C) {
+	r, dir := s.newClonedRepository(c)
+
+	// recent packfile, its unreachable objects are kept as loose objects
+	h := s.writePack(c, r, "packed unreachable")
+	c.Assert(r.GC(&GCOptions{}), IsNil)
+
+	_, err := r.s.ObjectStorage().Get(core.AnyObject, h)
+	c.Assert(err, IsNil)
+
+	loose, err := r.s.ObjectStorage().(core.LooseObjectStorage).LooseObjects()
+	c.Assert(err, IsNil)
+	c.Assert(loose, DeepEquals, []core.Hash{h})
+	c.Assert(r.s.ObjectStorage().(core.LooseObjectStorage).DeleteLooseObject(h), IsNil)
+
+	// old packfile, its unreachable objects are dropped
+	h = s.writePack(c, r, "old packed unreachable")
+	packs, err := r.s.ObjectStorage().(core.PackedObjectStorage).ObjectPacks()
+	c.Assert(err, IsNil)
+
+	t := time.Now().Add(-30 * 24 * time.Hour)
+	for _, pack := range packs {
+		name := fmt.Sprintf("pack-%s.pack", pack)
+		err := os.Chtimes(filepath.Join(dir, "objects", "pack", name), t, t)
+		c.Assert(err, IsNil)
+	}
+
+	c.Assert(r.GC(&GCOptions{}), IsNil)
+
+	_, err = r.s.ObjectStorage().Get(core.AnyObject, h)
+	c.Assert(err, Equals, core.ErrObjectNotFound)
+
+	packs, err = r.s.ObjectStorage().(core.PackedObjectStorage).ObjectPacks()
+	c.Assert(err, IsNil)
+	c.Assert(packs, HasLen, 1)
+}
+
+func (s *GCSuite) TestRepackKeepsPackTime(c *C) {
+	r, dir := s.newClonedRepository(c)
+
+	h := s.writePack(c, r, "packed unreachable")
+	packs, err := r.s.ObjectStorage().(core.PackedObjectStorage).ObjectPacks()
+	c.Assert(err, IsNil)
+
+	t := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, pack := range packs {
+		name := fmt.Sprintf("pack-%s.pack", pack)
+		err := os.Chtimes(filepath.Join(dir, "objects", "pack", name), t, t)
+		c.Assert(err, IsNil)
+	}
+
+	c.Assert(r.Repack(), IsNil)
+
+	mtime, err := r.s.ObjectStorage().(core.LooseObjectStorage).LooseObjectTime(h)
+	c.Assert(err, IsNil)
+	c.Assert(mtime.Equal(t), Equals, true)
+}
+
+func (s *GCSuite) TestRepackWithoutChtimes(c *C) {
+	_, dir := s.newClonedRepository(c)
+
+	// a filesystem wrapper not forwarding Chtimes
+	sto, err := filesystem.NewStorage(struct{ fs.Filesystem }{osfs.NewOS(dir)})
+	c.Assert(err, IsNil)
+	r, err := NewRepository(sto)
+	c.Assert(err, IsNil)
+
+	h := s.writePack(c, r, "packed unreachable")
+	c.Assert(r.Repack(), IsNil)
+
+	_, err = r.s.ObjectStorage().(core.LooseObjectStorage).LooseObjectTime(h)
+	c.Assert(err, IsNil)
+}
+
+func (s *GCSuite) TestRepackNotSupported(c *C) {
+	r := NewMemoryRepository()
+	c.Assert(r.Repack(), Equals, ErrRepackNotSupported)
+	c.Assert(r.GC(&GCOptions{}), Equals, ErrRepackNotSupported)
+}
+
+// writePack writes a packfile with a single blob with the given content.
+func (s *GCSuite) writePack(c *C, r *Repository, content string) core.Hash {
+	m := NewMemoryRepository()
+	h := s.setObject(c, m, core.BlobObject, content)
+
+	w, err := r.s.ObjectStorage().(core.ObjectStorageWrite).Writer()
+	c.Assert(err, IsNil)
+
+	e := packfile.NewEncoder(w, m.s.(*memory.Storage).ObjectStorage(), false)
+	_, err = e.Encode([]core.Hash{h})
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	return h
+}
+
+func (s *GCSuite) countCommits(c *C, r *Repository) int {
+	iter, err := r.Commits()
+	c.Assert(err, IsNil)
+
+	var count int
+	err = iter.ForEach(func(*Commit) error {
+		count++
+		return nil
+	})
+
+	c.Assert(err, IsNil)
+	return count
+}
@@ -96,7 +96,9 @@ func (b *Blob) Encode(o core.Object) error {
 	return err
 }
 
-// Reader returns a reader allow the access to the content of the blob
+// Reader returns a reader allow the access to the content of the blob. The
+// content is read as it is consumed, when the storage supports it the blob is
+// never loaded in memory.
 func (b *Blob) Reader() (core.ObjectReader, error) {
 	return b.obj.Reader()
 }
@@ -2,6 +2,8 @@ package git
 
 import (
 	"errors"
+	"strings"
+	"time"
 
 	"gopkg.in/src-d/go-git.v4/clients/common"
 	"gopkg.in/src-d/go-git.v4/config"
@@ -11,13 +13,85 @@ import (
 const (
 	// DefaultRemoteName name of the default Remote, just like git command
 	DefaultRemoteName = "origin"
+	// DefaultPruneExpire is the grace period of the unreachable objects, as
+	// the default gc.pruneExpire of git
+	DefaultPruneExpire = 14 * 24 * time.Hour
+	// DefaultInitialBranch name of the branch HEAD points to in a new
+	// repository, just like git command
+	DefaultInitialBranch = "master"
 )
 
 var (
 	ErrMissingURL     = errors.New("URL field is required")
 	ErrInvalidRefSpec = errors.New("invalid refspec")
+	// ErrInvalidBranchName is returned when a branch name is not a valid
+	// reference name.
+	ErrInvalidBranchName = errors.New("invalid branch name")
 )
 
+// InitOptions describe how a repository should be initialized
+type InitOptions struct {
+	// Bare creates a repository without working directory, the git
+	// directory is the root of the filesystem instead of .git
+	Bare bool
+	// InitialBranch is the name of the branch HEAD points to, by default
+	// `master`. The branch is created by the first commit.
+	InitialBranch string
+}
+
+// Validate validate the fields and set the default values
+func (o *InitOptions) Validate() error {
+	if o.InitialBranch == "" {
+		o.InitialBranch = DefaultInitialBranch
+	}
+
+	if !isValidBranchName(o.InitialBranch) {
+		return ErrInvalidBranchName
+	}
+
+	return nil
+}
+
+// isValidBranchName checks the rules of git check-ref-format for the name of
+// a branch.
+func isValidBranchName(name string) bool {
+	if name == "@" || strings.HasPrefix(name, "-") ||
+		strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") ||
+		strings.HasSuffix(name, ".") || strings.Contains(name, "..") ||
+		strings.Contains(name, "//") || strings.Contains(name, "@{") {
+		return false
+	}
+
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || strings.HasSuffix(part, ".lock") {
+			return false
+		}
+	}
+
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(" ~^:?*[\\", r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// OpenOptions describe how a filesystem repository should be opened
+type OpenOptions struct {
+	// DetectDotGit looks for the repository in the parent directories of the
+	// path when the path doesn't belong to a repository, as git does
+	DetectDotGit bool
+	// GitDir is the path of the git directory, like GIT_DIR, if set the
+	// repository is not looked up. The relative paths are relative to the
+	// path given to OpenFilesystemRepository.
+	GitDir string
+	// WorkTree is the path of the working directory, like GIT_WORK_TREE. By
+	// default the directory containing the .git directory or file, or the
+	// path given to OpenFilesystemRepository if GitDir is set.
+	WorkTree string
+}
+
 // CloneOptions describe how a clone should be perform
 type CloneOptions struct {
 	// The (possibly remote) repository URL to clone from
@@ -32,6 +106,9 @@ type CloneOptions struct {
 	SingleBranch bool
 	// Limit fetching to the specified number of commits
 	Depth int
+	// Reference is the path of a local repository used as alternate, the
+	// objects available on it are not fetched, like git clone --reference
+	Reference string
 }
 
 // Validate validate the fields and set the default values
@@ -53,9 +130,11 @@ func (o *CloneOptions) Validate() error {
 
 // PullOptions describe how a pull should be perform
 type PullOptions struct {
-	// Name of the remote to be pulled
+	// Name of the remote to be pulled, if it and ReferenceName are empty the
+	// upstream of the current branch is pulled, see Repository.Upstream
 	RemoteName string
-	// Remote branch to clone
+	// Remote branch to pull, HEAD by default if the current branch has no
+	// upstream
 	ReferenceName core.ReferenceName
 	// Fetch only ReferenceName if true
 	SingleBranch bool
@@ -94,3 +173,19 @@ func (o *FetchOptions) Validate() error {
 
 	return nil
 }
+
+// GCOptions describe how a garbage collection should be perform
+type GCOptions struct {
+	// PruneExpire is the grace period of the unreachable objects, the ones
+	// modified inside the period are kept, by default DefaultPruneExpire
+	PruneExpire time.Duration
+}
+
+// Validate validate the fields and set the default values
+func (o *GCOptions) Validate() error {
+	if o.PruneExpire == 0 {
+		o.PruneExpire = DefaultPruneExpire
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/core"
+)
+
+var ErrReflogNotSupported = errors.New("reflog not supported by the storage")
+
+// ReflogEntry is a change of a reference recorded in its reflog
+type ReflogEntry struct {
+	// Old is the hash of the reference before the change, ZeroHash when the
+	// reference was created
+	Old core.Hash
+	// New is the hash of the reference after the change
+	New core.Hash
+	// Committer is who made the change and when
+	Committer Signature
+	// Message describes the change, eg. "clone: from <url>"
+	Message string
+}
+
+func (e *ReflogEntry) decode(raw *core.ReflogEntry) {
+	e.Old = raw.Old
+	e.New = raw.New
+	e.Message = raw.Message
+	e.Committer.Decode(raw.Committer)
+}
+
+func (e *ReflogEntry) String() string {
+	return fmt.Sprintf("%s %s %s", e.New, e.Committer.When.Format(DateFormat), e.Message)
+}
+
+// Reflog returns the reflog of the given reference from the newest to the
+// oldest entry, so the entry n is the one named <ref>@{n} by git
+func (r *Repository) Reflog(name core.ReferenceName) ([]*ReflogEntry, error) {
+	s, ok := r.s.ReferenceStorage().(core.ReflogStorage)
+	if !ok {
+		return nil, ErrReflogNotSupported
+	}
+
+	raw, err := s.Reflog(name)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*ReflogEntry, len(raw))
+	for i, e := range raw {
+		entry := &ReflogEntry{}
+		entry.decode(e)
+		entries[len(raw)-1-i] = entry
+	}
+
+	return entries, nil
+}
+
+// ExpireReflog removes from the reflog of the given reference the entries
+// older than the given time
+func (r *Repository) ExpireReflog(name core.ReferenceName, before time.Time) error {
+	s, ok := r.s.ReferenceStorage().(core.ReflogStorage)
+	if !ok {
+		return ErrReflogNotSupported
+	}
+
+	raw, err := s.Reflog(name)
+	if err != nil {
+		return err
+	}
+
+	var keep []*core.ReflogEntry
+	for _, e := range raw {
+		entry := &ReflogEntry{}
+		entry.decode(e)
+		if entry.Committer.When.Before(before) {
+			continue
+		}
+
+		keep = append(keep, e)
+	}
+
+	if len(keep) == len(raw) {
+		return nil
+	}
+
+	return s.SetReflog(name, keep)
+}
@@ -0,0 +1,158 @@
+package git
+
+import (
+	"os"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type ReflogSuite struct {
+	BaseSuite
+}
+
+var _ = Suite(&ReflogSuite{})
+
+func (s *ReflogSuite) TestCloneReflog(c *C) {
+	r, err := NewFilesystemRepository(c.MkDir())
+	c.Assert(err, IsNil)
+
+	err = r.Clone(&CloneOptions{URL: RepositoryFixture})
+	c.Assert(err, IsNil)
+
+	for _, name := range []core.ReferenceName{
+		core.HEAD,
+		"refs/heads/master",
+		"refs/remotes/origin/master",
+	} {
+		entries, err := r.Reflog(name)
+		c.Assert(err, IsNil)
+		c.Assert(entries, HasLen, 1, Commentf("reflog of %s", name))
+		c.Assert(entries[0].Old, Equals, core.ZeroHash)
+		c.Assert(entries[0].New.String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+		c.Assert(entries[0].Message, Equals, "clone: from "+RepositoryFixture)
+		c.Assert(entries[0].Committer.Name, Not(Equals), "")
+	}
+
+	entries, err := r.Reflog("refs/remotes/origin/branch")
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 1)
+	c.Assert(entries[0].New.String(), Equals, "e8d3ffab552895c19b9fcf7aa264d277cde33881")
+
+	entries, err = r.Reflog("refs/tags/v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 0)
+}
+
+func (s *ReflogSuite) TestReflogNewestFirst(c *C) {
+	r, err := NewFilesystemRepository(c.MkDir())
+	c.Assert(err, IsNil)
+
+	rs := r.s.ReferenceStorage()
+	first := core.NewReferenceFromStrings("refs/heads/master", "e8d3ffab552895c19b9fcf7aa264d277cde33881")
+	c.Assert(updateReferences(rs, []*core.Reference{first}, "first"), IsNil)
+
+	second := core.NewReferenceFromStrings("refs/heads/master", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	c.Assert(updateReferences(rs, []*core.Reference{second}, "second"), IsNil)
+
+	c.Assert(updateReferences(rs, []*core.Reference{second}, "no-op"), IsNil)
+
+	entries, err := r.Reflog("refs/heads/master")
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 2)
+	c.Assert(entries[0].Message, Equals, "second")
+	c.Assert(entries[0].Old, Equals, first.Hash())
+	c.Assert(entries[0].New, Equals, second.Hash())
+	c.Assert(entries[1].Message, Equals, "first")
+}
+
+func (s *ReflogSuite) TestReflogCommitterFromConfig(c *C) {
+	for _, env := range []string{"GIT_COMMITTER_NAME", "GIT_COMMITTER_EMAIL"} {
+		defer os.Setenv(env, os.Getenv(env))
+		os.Unsetenv(env)
+	}
+
+	r, err := NewFilesystemRepository(c.MkDir())
+	c.Assert(err, IsNil)
+
+	cfg, err := r.s.ConfigStorage().Config()
+	c.Assert(err, IsNil)
+	cfg.User.Name = "John Doe"
+	cfg.User.Email = "john@example.com"
+	c.Assert(r.s.ConfigStorage().SetConfig(cfg), IsNil)
+
+	ref := core.NewReferenceFromStrings("refs/heads/master", "e8d3ffab552895c19b9fcf7aa264d277cde33881")
+	c.Assert(updateReferences(r.s.ReferenceStorage(), []*core.Reference{ref}, "foo"), IsNil)
+
+	entries, err := r.Reflog("refs/heads/master")
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 1)
+	c.Assert(entries[0].Committer.Name, Equals, "John Doe")
+	c.Assert(entries[0].Committer.Email, Equals, "john@example.com")
+}
+
+func (s *ReflogSuite) TestReflogReferenceStorageSet(c *C) {
+	r, err := NewFilesystemRepository(c.MkDir())
+	c.Assert(err, IsNil)
+
+	rs := r.s.ReferenceStorage()
+	c.Assert(rs.Set(core.NewSymbolicReference(core.HEAD, "refs/heads/master")), IsNil)
+
+	ref := core.NewReferenceFromStrings("refs/heads/master", "e8d3ffab552895c19b9fcf7aa264d277cde33881")
+	c.Assert(rs.Set(ref), IsNil)
+
+	next := core.NewReferenceFromStrings("refs/heads/master", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	c.Assert(rs.CheckAndSetReference(next, ref), IsNil)
+
+	for _, name := range []core.ReferenceName{core.HEAD, "refs/heads/master"} {
+		entries, err := r.Reflog(name)
+		c.Assert(err, IsNil)
+		c.Assert(entries, HasLen, 2, Commentf("reflog of %s", name))
+		c.Assert(entries[0].Old, Equals, ref.Hash())
+		c.Assert(entries[0].New, Equals, next.Hash())
+		c.Assert(entries[1].Old, Equals, core.ZeroHash)
+		c.Assert(entries[1].New, Equals, ref.Hash())
+	}
+
+	c.Assert(rs.Set(core.NewReferenceFromStrings("refs/tags/v1.0.0", ref.Hash().String())), IsNil)
+	entries, err := r.Reflog("refs/tags/v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 0)
+}
+
+func (s *ReflogSuite) TestExpireReflog(c *C) {
+	r, err := NewFilesystemRepository(c.MkDir())
+	c.Assert(err, IsNil)
+
+	rs := r.s.ReferenceStorage().(core.ReflogStorage)
+	name := core.ReferenceName("refs/heads/master")
+	c.Assert(rs.AppendReflog(name, &core.ReflogEntry{
+		New:       core.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881"),
+		Committer: []byte("foo <foo@example.com> 1257894000 +0100"),
+		Message:   "old",
+	}), IsNil)
+
+	c.Assert(rs.AppendReflog(name, &core.ReflogEntry{
+		Old:       core.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881"),
+		New:       core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		Committer: []byte("foo <foo@example.com> 1478000000 +0100"),
+		Message:   "new",
+	}), IsNil)
+
+	err = r.ExpireReflog(name, time.Unix(1400000000, 0))
+	c.Assert(err, IsNil)
+
+	entries, err := r.Reflog(name)
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 1)
+	c.Assert(entries[0].Message, Equals, "new")
+	c.Assert(entries[0].Committer.When.Unix(), Equals, int64(1478000000))
+}
+
+func (s *ReflogSuite) TestReflogNotSupported(c *C) {
+	r := NewMemoryRepository()
+	_, err := r.Reflog(core.HEAD)
+	c.Assert(err, Equals, ErrReflogNotSupported)
+}
@@ -19,6 +19,9 @@ var NoErrAlreadyUpToDate = errors.New("already up-to-date")
 type Remote struct {
 	c *config.RemoteConfig
 	s Storage
+	// urls is the config with the url rewriting rules, nil if the URLs of
+	// the remote are used as they are.
+	urls *config.Config
 
 	// cache fields, there during the connection is open
 	upSrv  common.GitUploadPackService
@@ -43,8 +46,50 @@ func (r *Remote) Connect() error {
 	return r.retrieveUpInfo()
 }
 
+// Endpoint returns the endpoint to fetch from, the URL of the remote rewritten
+// with the url.<base>.insteadOf rules of the config of the repository.
+func (r *Remote) Endpoint() (common.Endpoint, error) {
+	return common.NewEndpoint(r.fetchURL())
+}
+
+// PushEndpoints returns the endpoints to push to, the push URLs of the remote
+// or its URL, rewritten with the url.<base>.insteadOf and pushInsteadOf rules
+// of the config of the repository.
+func (r *Remote) PushEndpoints() ([]common.Endpoint, error) {
+	urls := r.pushURLs()
+	endpoints := make([]common.Endpoint, len(urls))
+	for i, url := range urls {
+		var err error
+		if endpoints[i], err = common.NewEndpoint(url); err != nil {
+			return nil, err
+		}
+	}
+
+	return endpoints, nil
+}
+
+func (r *Remote) fetchURL() string {
+	if r.urls == nil {
+		return r.c.URL
+	}
+
+	return r.urls.FetchURL(r.c)
+}
+
+func (r *Remote) pushURLs() []string {
+	if r.urls == nil {
+		if len(r.c.PushURLs) != 0 {
+			return r.c.PushURLs
+		}
+
+		return append([]string{r.c.URL}, r.c.URLs...)
+	}
+
+	return r.urls.PushURLs(r.c)
+}
+
 func (r *Remote) connectUploadPackService() error {
-	endpoint, err := common.NewEndpoint(r.c.URL)
+	endpoint, err := r.Endpoint()
 	if err != nil {
 		return err
 	}
@@ -78,6 +123,12 @@ func (r *Remote) Capabilities() *packp.Capabilities {
 
 // Fetch returns a reader using the request
 func (r *Remote) Fetch(o *FetchOptions) (err error) {
+	return r.fetch(o, "fetch: from "+r.c.URL)
+}
+
+// fetch fetches the wanted references, the changes of the local references
+// are recorded in the reflog with the given message.
+func (r *Remote) fetch(o *FetchOptions, reflogMsg string) (err error) {
 	if err := o.Validate(); err != nil {
 		return err
 	}
@@ -86,45 +137,68 @@ func (r *Remote) Fetch(o *FetchOptions) (err error) {
 		o.RefSpecs = r.c.Fetch
 	}
 
-	refs, err := r.getWantedReferences(o.RefSpecs)
+	refs, err := r.getWantedReferences(o.RefSpecs, r.c.TagOpt)
 	if err != nil {
 		return err
 	}
 
-	if len(refs) == 0 {
-		return NoErrAlreadyUpToDate
+	missing, err := r.getMissingReferences(refs)
+	if err != nil {
+		return err
+	}
+
+	if len(missing) != 0 {
+		if err := r.fetchObjects(o, missing); err != nil {
+			return err
+		}
 	}
 
-	req, err := r.buildRequest(r.s.ReferenceStorage(), o, refs)
+	updated, err := r.updateLocalReferenceStorage(o.RefSpecs, refs, reflogMsg)
 	if err != nil {
 		return err
 	}
 
-	reader, err := r.upSrv.Fetch(req)
+	if len(missing) == 0 && !updated {
+		return NoErrAlreadyUpToDate
+	}
+
+	return nil
+}
+
+// fetchObjects requests to the remote the objects of the given references.
+func (r *Remote) fetchObjects(o *FetchOptions, refs []*core.Reference) (err error) {
+	req, err := r.buildRequest(r.s, o, refs)
 	if err != nil {
 		return err
 	}
 
-	defer checkClose(reader, &err)
-	if err := r.updateObjectStorage(reader); err != nil {
+	reader, err := r.upSrv.Fetch(req)
+	if err != nil {
 		return err
 	}
 
-	return r.updateLocalReferenceStorage(o.RefSpecs, refs)
+	defer checkClose(reader, &err)
+	return r.updateObjectStorage(reader)
 }
 
-func (r *Remote) getWantedReferences(spec []config.RefSpec) ([]*core.Reference, error) {
+// getWantedReferences returns the remote references matching the given
+// refspecs, and the tags as set by tagOpt: all of them with AllTags, none with
+// NoTags and, by default, all of them if every refspec is a wildcard.
+func (r *Remote) getWantedReferences(spec []config.RefSpec, tagOpt config.TagOpt) ([]*core.Reference, error) {
 	var refs []*core.Reference
 	iter, err := r.Refs()
 	if err != nil {
 		return refs, err
 	}
 
-	wantTags := true
-	for _, s := range spec {
-		if !s.IsWildcard() {
-			wantTags = false
-			break
+	wantTags := tagOpt == config.AllTags
+	if tagOpt == config.TagOptDefault {
+		wantTags = true
+		for _, s := range spec {
+			if !s.IsWildcard() {
+				wantTags = false
+				break
+			}
 		}
 	}
 
@@ -139,18 +213,33 @@ func (r *Remote) getWantedReferences(spec []config.RefSpec) ([]*core.Reference,
 			}
 		}
 
-		_, err := r.s.ObjectStorage().Get(core.CommitObject, ref.Hash())
+		refs = append(refs, ref)
+		return nil
+	})
+}
+
+// getMissingReferences returns the references whose objects are not in the
+// object storage, the objects can be in the storage, but not referenced, if
+// they were fetched before or if they are in an alternate.
+func (r *Remote) getMissingReferences(refs []*core.Reference) ([]*core.Reference, error) {
+	var missing []*core.Reference
+	for _, ref := range refs {
+		_, err := r.s.ObjectStorage().Get(core.AnyObject, ref.Hash())
 		if err == core.ErrObjectNotFound {
-			refs = append(refs, ref)
-			return nil
+			missing = append(missing, ref)
+			continue
 		}
 
-		return err
-	})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return missing, nil
 }
 
 func (r *Remote) buildRequest(
-	s core.ReferenceStorage, o *FetchOptions, refs []*core.Reference,
+	s Storage, o *FetchOptions, refs []*core.Reference,
 ) (*common.GitUploadPackRequest, error) {
 	req := &common.GitUploadPackRequest{}
 	req.Depth = o.Depth
@@ -159,7 +248,7 @@ func (r *Remote) buildRequest(
 		req.Want(ref.Hash())
 	}
 
-	i, err := s.Iter()
+	i, err := s.ReferenceStorage().Iter()
 	if err != nil {
 		return nil, err
 	}
@@ -173,7 +262,29 @@ func (r *Remote) buildRequest(
 		return nil
 	})
 
-	return req, err
+	if err != nil {
+		return nil, err
+	}
+
+	// the objects of the alternates are already available, as git does its
+	// references are announced as haves
+	as, ok := s.ObjectStorage().(core.AlternatesObjectStorage)
+	if !ok {
+		return req, nil
+	}
+
+	alternates, err := as.AlternateReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ref := range alternates {
+		if ref.Type() == core.HashReference {
+			req.Have(ref.Hash())
+		}
+	}
+
+	return req, nil
 }
 
 func (r *Remote) updateObjectStorage(reader io.Reader) error {
@@ -199,7 +310,12 @@ func (r *Remote) updateObjectStorage(reader io.Reader) error {
 	return err
 }
 
-func (r *Remote) updateLocalReferenceStorage(specs []config.RefSpec, refs []*core.Reference) error {
+// updateLocalReferenceStorage updates the local references with the fetched
+// ones, it returns true if any reference was changed.
+func (r *Remote) updateLocalReferenceStorage(
+	specs []config.RefSpec, refs []*core.Reference, reflogMsg string,
+) (bool, error) {
+	var updates []*core.Reference
 	for _, spec := range specs {
 		for _, ref := range refs {
 			if !spec.Match(ref.Name()) {
@@ -211,24 +327,54 @@ func (r *Remote) updateLocalReferenceStorage(specs []config.RefSpec, refs []*cor
 			}
 
 			name := spec.Dst(ref.Name())
-			n := core.NewHashReference(name, ref.Hash())
-			if err := r.s.ReferenceStorage().Set(n); err != nil {
-				return err
-			}
+			updates = append(updates, core.NewHashReference(name, ref.Hash()))
+		}
+	}
+
+	if r.c.TagOpt != config.NoTags {
+		tags, err := r.buildFetchedTags()
+		if err != nil {
+			return false, err
 		}
+
+		updates = append(updates, tags...)
+	}
+
+	changed, err := hasChangedReferences(r.s.ReferenceStorage(), updates)
+	if err != nil || !changed {
+		return false, err
 	}
 
-	return r.buildFetchedTags()
+	return true, updateReferences(r.s.ReferenceStorage(), updates, reflogMsg)
 }
 
-func (r *Remote) buildFetchedTags() error {
+// hasChangedReferences returns true if any of the given references is
+// different from the stored one.
+func hasChangedReferences(s core.ReferenceStorage, refs []*core.Reference) (bool, error) {
+	current, err := referencesByName(s)
+	if err != nil {
+		return false, err
+	}
+
+	for _, ref := range refs {
+		c, ok := current[ref.Name()]
+		if !ok || !c.Equals(ref) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (r *Remote) buildFetchedTags() ([]*core.Reference, error) {
 	iter, err := r.Refs()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	var tags []*core.Reference
 	os := r.s.ObjectStorage()
-	return iter.ForEach(func(ref *core.Reference) error {
+	err = iter.ForEach(func(ref *core.Reference) error {
 		if !ref.IsTag() {
 			return nil
 		}
@@ -242,8 +388,90 @@ func (r *Remote) buildFetchedTags() error {
 			return err
 		}
 
-		return r.s.ReferenceStorage().Set(ref)
+		tags = append(tags, ref)
+		return nil
+	})
+
+	return tags, err
+}
+
+// updateReferences stores the given references. If the storage supports
+// reference transactions all of them are stored atomically, and the current
+// values are checked so concurrent updates are not silently overwritten. The
+// storages keeping a reflog record the changes with the given message.
+func updateReferences(s core.ReferenceStorage, refs []*core.Reference, reflogMsg string) error {
+	current, err := referencesByName(s)
+	if err != nil {
+		return err
+	}
+
+	// when a reference is given more than once, the last value wins as it
+	// would do calling Set sequentially.
+	last := make(map[core.ReferenceName]int)
+	for i, ref := range refs {
+		last[ref.Name()] = i
+	}
+
+	var unique []*core.Reference
+	for i, ref := range refs {
+		if last[ref.Name()] == i {
+			unique = append(unique, ref)
+		}
+	}
+
+	return setReferences(s, unique, current, reflogMsg)
+}
+
+func setReferences(
+	s core.ReferenceStorage,
+	refs []*core.Reference,
+	current map[core.ReferenceName]*core.Reference,
+	reflogMsg string,
+) error {
+	txs, ok := s.(core.ReferenceStorageTx)
+	if !ok {
+		for _, ref := range refs {
+			if err := s.Set(ref); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	tx := txs.Begin()
+	if rtx, ok := tx.(core.ReflogTxReferenceStorage); ok {
+		rtx.SetReflogMessage(reflogMsg)
+	}
+
+	for _, ref := range refs {
+		old, ok := current[ref.Name()]
+		if !ok {
+			old = core.NewHashReference(ref.Name(), core.ZeroHash)
+		}
+
+		if err := tx.CheckAndSetReference(ref, old); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func referencesByName(s core.ReferenceStorage) (map[core.ReferenceName]*core.Reference, error) {
+	iter, err := s.Iter()
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make(map[core.ReferenceName]*core.Reference)
+	err = iter.ForEach(func(ref *core.Reference) error {
+		refs[ref.Name()] = ref
+		return nil
 	})
+
+	return refs, err
 }
 
 // Head returns the Reference of the HEAD
@@ -272,8 +500,10 @@ func (r *Remote) Disconnect() error {
 }
 
 func (r *Remote) String() string {
-	fetch := r.c.URL
-	push := r.c.URL
+	s := fmt.Sprintf("%s\t%s (fetch)", r.c.Name, r.fetchURL())
+	for _, push := range r.pushURLs() {
+		s += fmt.Sprintf("\n%s\t%s (push)", r.c.Name, push)
+	}
 
-	return fmt.Sprintf("%s\t%s (fetch)\n%[1]s\t%s (push)", r.c.Name, fetch, push)
+	return s
 }
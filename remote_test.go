@@ -126,6 +126,78 @@ func (s *RemoteSuite) TestFetchObjectStorageWriter(c *C) {
 	c.Assert(count, Equals, 31)
 }
 
+func (s *RemoteSuite) TestFetchNoTags(c *C) {
+	sto := memory.NewStorage()
+	r := newRemote(sto, &config.RemoteConfig{
+		Name:   "foo",
+		URL:    RepositoryFixture,
+		TagOpt: config.NoTags,
+	})
+	r.upSrv = &MockGitUploadPackService{}
+
+	c.Assert(r.Connect(), IsNil)
+
+	err := r.Fetch(&FetchOptions{
+		RefSpecs: []config.RefSpec{FixRefSpec},
+	})
+	c.Assert(err, IsNil)
+
+	_, err = sto.ReferenceStorage().Get("refs/remotes/origin/master")
+	c.Assert(err, IsNil)
+
+	_, err = sto.ReferenceStorage().Get("refs/tags/v1.0.0")
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+}
+
+func (s *RemoteSuite) TestFetchAllTags(c *C) {
+	sto := memory.NewStorage()
+	r := newRemote(sto, &config.RemoteConfig{
+		Name:   "foo",
+		URL:    RepositoryFixture,
+		TagOpt: config.AllTags,
+	})
+	r.upSrv = &MockGitUploadPackService{}
+
+	c.Assert(r.Connect(), IsNil)
+
+	err := r.Fetch(&FetchOptions{
+		RefSpecs: []config.RefSpec{"+refs/heads/branch:refs/remotes/origin/branch"},
+	})
+	c.Assert(err, IsNil)
+
+	ref, err := sto.ReferenceStorage().Get("refs/tags/v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+}
+
+func (s *RemoteSuite) TestFetchMirror(c *C) {
+	rc := &config.RemoteConfig{
+		Name:  "foo",
+		URL:   RepositoryFixture,
+		Fetch: []config.RefSpec{"+refs/*:refs/*"},
+	}
+	c.Assert(rc.Validate(), IsNil)
+
+	sto := memory.NewStorage()
+	r := newRemote(sto, rc)
+	r.upSrv = &MockGitUploadPackService{}
+
+	c.Assert(r.Connect(), IsNil)
+	c.Assert(r.Fetch(&FetchOptions{}), IsNil)
+
+	expectedRefs := []*core.Reference{
+		core.NewReferenceFromStrings("refs/heads/master", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		core.NewReferenceFromStrings("refs/heads/branch", "e8d3ffab552895c19b9fcf7aa264d277cde33881"),
+		core.NewReferenceFromStrings("refs/tags/v1.0.0", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	}
+
+	for _, exp := range expectedRefs {
+		r, err := sto.ReferenceStorage().Get(exp.Name())
+		c.Assert(err, IsNil)
+		c.Assert(exp.String(), Equals, r.String())
+	}
+}
+
 func (s *RemoteSuite) TestFetchNoErrAlreadyUpToDate(c *C) {
 	sto := memory.NewStorage()
 	r := newRemote(sto, &config.RemoteConfig{Name: "foo", URL: RepositoryFixture})
@@ -187,3 +259,64 @@ func (s *RemoteSuite) TestString(c *C) {
 		"foo\thttps://github.com/git-fixtures/basic.git (push)",
 	)
 }
+
+func (s *RemoteSuite) TestEndpointInsteadOf(c *C) {
+	urls := config.NewConfig()
+	urls.URLs["https://mirror.example.com/"] = &config.URLConfig{
+		Name:      "https://mirror.example.com/",
+		InsteadOf: []string{"https://github.com/"},
+	}
+	urls.URLs["ssh://git@github.com/"] = &config.URLConfig{
+		Name:          "ssh://git@github.com/",
+		PushInsteadOf: []string{"https://github.com/"},
+	}
+
+	r := newRemote(nil, &config.RemoteConfig{Name: "foo", URL: RepositoryFixture})
+	r.urls = urls
+
+	e, err := r.Endpoint()
+	c.Assert(err, IsNil)
+	c.Assert(e.String(), Equals, "https://mirror.example.com/git-fixtures/basic.git")
+
+	push, err := r.PushEndpoints()
+	c.Assert(err, IsNil)
+	c.Assert(push, HasLen, 1)
+	c.Assert(push[0].String(), Equals, "ssh://git@github.com/git-fixtures/basic.git")
+
+	c.Assert(r.String(), Equals, ""+
+		"foo\thttps://mirror.example.com/git-fixtures/basic.git (fetch)\n"+
+		"foo\tssh://git@github.com/git-fixtures/basic.git (push)",
+	)
+}
+
+func (s *RemoteSuite) TestPushEndpointsURLs(c *C) {
+	r := newRemote(nil, &config.RemoteConfig{
+		Name: "foo",
+		URL:  "https://github.com/git-fixtures/basic.git",
+		URLs: []string{"git@github.com:git-fixtures/basic.git"},
+	})
+
+	endpoints, err := r.PushEndpoints()
+	c.Assert(err, IsNil)
+	c.Assert(endpoints, HasLen, 2)
+	c.Assert(endpoints[0].String(), Equals, "https://github.com/git-fixtures/basic.git")
+	c.Assert(endpoints[1].Host, Equals, "github.com")
+
+	e, err := r.Endpoint()
+	c.Assert(err, IsNil)
+	c.Assert(e.String(), Equals, "https://github.com/git-fixtures/basic.git")
+}
+
+func (s *RemoteSuite) TestStringPushURLs(c *C) {
+	r := newRemote(nil, &config.RemoteConfig{
+		Name:     "foo",
+		URL:      RepositoryFixture,
+		PushURLs: []string{"ssh://foo/bar", "ssh://foo/qux"},
+	})
+
+	c.Assert(r.String(), Equals, ""+
+		"foo\thttps://github.com/git-fixtures/basic.git (fetch)\n"+
+		"foo\tssh://foo/bar (push)\n"+
+		"foo\tssh://foo/qux (push)",
+	)
+}
@@ -3,11 +3,16 @@ package git
 import (
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/core"
 	"gopkg.in/src-d/go-git.v4/storage/filesystem"
 	"gopkg.in/src-d/go-git.v4/storage/memory"
+	"gopkg.in/src-d/go-git.v4/utils/cache"
+	"gopkg.in/src-d/go-git.v4/utils/fs"
 	osfs "gopkg.in/src-d/go-git.v4/utils/fs/os"
 )
 
@@ -15,12 +20,28 @@ var (
 	ErrObjectNotFound     = errors.New("object not found")
 	ErrInvalidReference   = errors.New("invalid reference, should be a tag or a branch")
 	ErrRepositoryNonEmpty = errors.New("repository non empty")
+	// ErrRepositoryAlreadyExists is returned by Init when the filesystem
+	// already contains a git directory.
+	ErrRepositoryAlreadyExists = errors.New("repository already exists")
+	// ErrAlternatesNotSupported is returned by Clone when an alternate is
+	// requested and the storage doesn't support them.
+	ErrAlternatesNotSupported = errors.New("alternates not supported by the storage")
+	// ErrAlternateNotFound is returned by Clone when the repository to be
+	// used as alternate doesn't exist.
+	ErrAlternateNotFound = errors.New("alternate repository not found")
 )
 
 // Repository giturl string, auth common.AuthMethod repository struct
 type Repository struct {
-	r map[string]*Remote
-	s Storage
+	r  map[string]*Remote
+	s  Storage
+	wt string
+	// gitDir is the absolute path of the git directory of the repositories
+	// opened from the filesystem, empty otherwise.
+	gitDir string
+	// urls is the merged config with the url rewriting rules, read once by
+	// urlsConfig.
+	urls *config.Config
 }
 
 // NewMemoryRepository creates a new repository, backed by a memory.Storage
@@ -33,11 +54,70 @@ func NewMemoryRepository() *Repository {
 // based on a fs.OS, if you want to use a custom one you need to use the function
 // NewRepository and build you filesystem.Storage
 func NewFilesystemRepository(path string) (*Repository, error) {
-	s, err := filesystem.NewStorage(osfs.NewOS(path))
+	s, err := newOSStorage(osfs.NewOS(path))
 	if err != nil {
 		return nil, err
 	}
 
+	r, err := NewRepository(s)
+	if err != nil {
+		return nil, err
+	}
+
+	r.gitDir, err = filepath.Abs(path)
+	return r, err
+}
+
+// newOSStorage returns a storage over a git directory of the os filesystem,
+// its alternates can be anywhere in the os filesystem.
+func newOSStorage(dir fs.Filesystem) (*filesystem.Storage, error) {
+	return filesystem.NewStorageWithOptions(dir, filesystem.Options{
+		ObjectCache:          cache.NewObjectLRUDefault(),
+		AlternatesFilesystem: osfs.NewOS(string(filepath.Separator)),
+	})
+}
+
+// Init creates a new repository in the given filesystem, with HEAD pointing to
+// the master branch. The git directory is created in .git, or in the root of
+// the filesystem if bare is true, see InitWithOptions.
+func Init(fs fs.Filesystem, bare bool) (*Repository, error) {
+	return InitWithOptions(fs, &InitOptions{Bare: bare})
+}
+
+// InitWithOptions creates a new repository in the given filesystem, as git
+// init does: the object and reference directories, the config and HEAD are
+// written, ErrRepositoryAlreadyExists is returned if the git directory has
+// already a HEAD.
+func InitWithOptions(fs fs.Filesystem, o *InitOptions) (*Repository, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	if !o.Bare {
+		fs = fs.Dir(dotGitPath)
+	}
+
+	if _, err := fs.Stat(core.HEAD.String()); err == nil {
+		return nil, ErrRepositoryAlreadyExists
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	s, err := filesystem.NewStorage(fs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Init(o.Bare); err != nil {
+		return nil, err
+	}
+
+	branch := core.ReferenceName("refs/heads/" + o.InitialBranch)
+	head := core.NewSymbolicReference(core.HEAD, branch)
+	if err := s.ReferenceStorage().Set(head); err != nil {
+		return nil, err
+	}
+
 	return NewRepository(s)
 }
 
@@ -49,6 +129,53 @@ func NewRepository(s Storage) (*Repository, error) {
 	}, nil
 }
 
+// WorkTree returns the absolute path of the working directory of a repository
+// opened with OpenFilesystemRepository, it's empty for the bare repositories
+// and the repositories created in any other way.
+func (r *Repository) WorkTree() string {
+	return r.wt
+}
+
+// LayeredConfig returns the config of the repository merged with the system
+// and global configs, as git reads it. The config files of the repositories
+// opened from the filesystem are read directly, so their includes are resolved,
+// for the rest of the repositories the config of the storage is used.
+func (r *Repository) LayeredConfig() (*config.LayeredConfig, error) {
+	l, err := config.LoadGlobalConfig(r.gitDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.gitDir != "" {
+		common, err := commonDir(r.gitDir)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := l.AddFile(config.LocalScope, filepath.Join(common, "config")); err != nil {
+			return nil, err
+		}
+
+		return l, nil
+	}
+
+	cfg, err := r.s.ConfigStorage().Config()
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := cfg.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.AddConfig(config.LocalScope, "", b); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
 // Remote return a remote if exists
 func (r *Repository) Remote(name string) (*Remote, error) {
 	c, err := r.s.ConfigStorage().Remote(name)
@@ -56,7 +183,14 @@ func (r *Repository) Remote(name string) (*Remote, error) {
 		return nil, err
 	}
 
-	return newRemote(r.s, c), nil
+	urls, err := r.urlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	remote := newRemote(r.s, c)
+	remote.urls = urls
+	return remote, nil
 }
 
 // Remotes return all the remotes
@@ -66,9 +200,15 @@ func (r *Repository) Remotes() ([]*Remote, error) {
 		return nil, err
 	}
 
+	urls, err := r.urlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
 	remotes := make([]*Remote, len(config))
 	for i, c := range config {
 		remotes[i] = newRemote(r.s, c)
+		remotes[i].urls = urls
 	}
 
 	return remotes, nil
@@ -80,14 +220,37 @@ func (r *Repository) CreateRemote(c *config.RemoteConfig) (*Remote, error) {
 		return nil, err
 	}
 
-	remote := newRemote(r.s, c)
+	urls, err := r.urlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
 	if err := r.s.ConfigStorage().SetRemote(c); err != nil {
 		return nil, err
 	}
 
+	remote := newRemote(r.s, c)
+	remote.urls = urls
 	return remote, nil
 }
 
+// urlsConfig returns the merged config of the repository, with the url
+// rewriting rules of all the config files. The config files are read the
+// first time only.
+func (r *Repository) urlsConfig() (*config.Config, error) {
+	if r.urls != nil {
+		return r.urls, nil
+	}
+
+	l, err := r.LayeredConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	r.urls = l.Config
+	return r.urls, nil
+}
+
 // DeleteRemote delete a remote from the repository and delete the config
 func (r *Repository) DeleteRemote(name string) error {
 	return r.s.ConfigStorage().DeleteRemote(name)
@@ -128,7 +291,12 @@ func (r *Repository) Clone(o *CloneOptions) error {
 		return err
 	}
 
-	if err = remote.Fetch(&FetchOptions{Depth: o.Depth}); err != nil {
+	if err := r.setupAlternates(o); err != nil {
+		return err
+	}
+
+	reflogMsg := "clone: from " + o.URL
+	if err = remote.fetch(&FetchOptions{Depth: o.Depth}, reflogMsg); err != nil {
 		return err
 	}
 
@@ -137,7 +305,61 @@ func (r *Repository) Clone(o *CloneOptions) error {
 		return err
 	}
 
-	return r.createReferences(head)
+	if err := r.createReferences(head, reflogMsg); err != nil {
+		return err
+	}
+
+	if !head.IsBranch() {
+		return nil
+	}
+
+	branch := strings.TrimPrefix(head.Name().String(), branchPrefix)
+	return r.SetUpstream(branch, c.Name, head.Name())
+}
+
+// setupAlternates adds as alternate the repository given by the Reference
+// option.
+func (r *Repository) setupAlternates(o *CloneOptions) error {
+	if o.Reference == "" {
+		return nil
+	}
+
+	s, ok := r.s.ObjectStorage().(core.AlternatesObjectStorage)
+	if !ok {
+		return ErrAlternatesNotSupported
+	}
+
+	objects, err := findObjectsDir(o.Reference)
+	if err != nil {
+		return err
+	}
+
+	return s.AddAlternate(objects)
+}
+
+// findObjectsDir returns the absolute path of the objects directory of the
+// repository at the given path, that can be bare or not.
+func findObjectsDir(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	for _, dir := range []string{
+		filepath.Join(path, ".git", "objects"),
+		filepath.Join(path, "objects"),
+	} {
+		fi, err := os.Stat(dir)
+		if err == nil && fi.IsDir() {
+			return dir, nil
+		}
+
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	return "", ErrAlternateNotFound
 }
 
 const refspecSingleBranch = "+refs/heads/%s:refs/remotes/%s/%[1]s"
@@ -161,22 +383,19 @@ func (r *Repository) updateRemoteConfig(
 	return nil
 }
 
-func (r *Repository) createReferences(ref *core.Reference) error {
+func (r *Repository) createReferences(ref *core.Reference, reflogMsg string) error {
 	if !ref.IsBranch() {
 		// detached HEAD mode
 		head := core.NewHashReference(core.HEAD, ref.Hash())
-		return r.s.ReferenceStorage().Set(head)
-	}
-
-	if err := r.s.ReferenceStorage().Set(ref); err != nil {
-		return err
+		return updateReferences(r.s.ReferenceStorage(), []*core.Reference{head}, reflogMsg)
 	}
 
 	head := core.NewSymbolicReference(core.HEAD, ref.Name())
-	return r.s.ReferenceStorage().Set(head)
+	return updateReferences(r.s.ReferenceStorage(), []*core.Reference{ref, head}, reflogMsg)
 }
 
-// IsEmpty returns true if the repository is empty
+// IsEmpty returns true if the repository is empty, a repository with only
+// symbolic references, as the HEAD of a new repository, is empty.
 func (r *Repository) IsEmpty() (bool, error) {
 	iter, err := r.Refs()
 	if err != nil {
@@ -184,14 +403,30 @@ func (r *Repository) IsEmpty() (bool, error) {
 	}
 
 	var count int
-	return count == 0, iter.ForEach(func(r *core.Reference) error {
-		count++
+	err = iter.ForEach(func(r *core.Reference) error {
+		if r.Type() == core.HashReference {
+			count++
+		}
+
 		return nil
 	})
+
+	return count == 0, err
 }
 
-// Pull incorporates changes from a remote repository into the current branch
+// Pull incorporates changes from a remote repository into the current branch,
+// without RemoteName and ReferenceName the upstream of the current branch is
+// pulled, if it has one. The current branch is only fast-forwarded to its
+// upstream, ErrNonFastForwardUpdate is returned if it has commits not in it.
 func (r *Repository) Pull(o *PullOptions) error {
+	var local core.ReferenceName
+	if o.RemoteName == "" && o.ReferenceName == "" {
+		var err error
+		if local, err = r.setPullUpstream(o); err != nil {
+			return err
+		}
+	}
+
 	if err := o.Validate(); err != nil {
 		return err
 	}
@@ -218,15 +453,21 @@ func (r *Repository) Pull(o *PullOptions) error {
 
 	defer remote.Disconnect()
 
-	err = remote.Fetch(&FetchOptions{
+	reflogMsg := "pull: from " + remote.c.URL
+	err = remote.fetch(&FetchOptions{
 		Depth: o.Depth,
-	})
+	}, reflogMsg)
+
+	if local != "" && (err == nil || err == NoErrAlreadyUpToDate) {
+		// the upstream may be ahead of the branch even if nothing was fetched
+		return r.fastForward(local, head.Hash(), reflogMsg)
+	}
 
 	if err != nil {
 		return err
 	}
 
-	return r.createReferences(head)
+	return r.createReferences(head, reflogMsg)
 }
 
 // Commit return the commit with the given hash
@@ -1,9 +1,17 @@
 package git
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
 	"gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/core"
+	"gopkg.in/src-d/go-git.v4/fixtures"
 	"gopkg.in/src-d/go-git.v4/storage/memory"
+	memfs "gopkg.in/src-d/go-git.v4/utils/fs/memory"
+	osfs "gopkg.in/src-d/go-git.v4/utils/fs/os"
 
 	. "gopkg.in/check.v1"
 )
@@ -19,6 +27,210 @@ func (s *RepositorySuite) TestNewRepository(c *C) {
 	c.Assert(r, NotNil)
 }
 
+func (s *RepositorySuite) TestLayeredConfig(c *C) {
+	dir, err := ioutil.TempDir("", "go-git-layered-config")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	global := filepath.Join(dir, "gitconfig")
+	err = ioutil.WriteFile(global, []byte("[user]\n\tname = John Doe\n"), 0644)
+	c.Assert(err, IsNil)
+
+	defer os.Setenv("GIT_CONFIG_GLOBAL", os.Getenv("GIT_CONFIG_GLOBAL"))
+	defer os.Setenv("GIT_CONFIG_NOSYSTEM", os.Getenv("GIT_CONFIG_NOSYSTEM"))
+	os.Setenv("GIT_CONFIG_GLOBAL", global)
+	os.Setenv("GIT_CONFIG_NOSYSTEM", "true")
+
+	r := NewMemoryRepository()
+	_, err = r.CreateRemote(&config.RemoteConfig{Name: "foo", URL: "http://foo/bar"})
+	c.Assert(err, IsNil)
+
+	l, err := r.LayeredConfig()
+	c.Assert(err, IsNil)
+	c.Assert(l.Config.User.Name, Equals, "John Doe")
+	c.Assert(l.Config.Remotes["foo"].URL, Equals, "http://foo/bar")
+	c.Assert(l.Origin("user", "", "name").Path, Equals, global)
+	c.Assert(l.Origin("remote", "foo", "url").Scope, Equals, config.LocalScope)
+
+	_, err = Init(osfs.NewOS(dir), false)
+	c.Assert(err, IsNil)
+
+	r, err = OpenFilesystemRepository(dir, &OpenOptions{})
+	c.Assert(err, IsNil)
+
+	l, err = r.LayeredConfig()
+	c.Assert(err, IsNil)
+	c.Assert(l.Config.User.Name, Equals, "John Doe")
+	c.Assert(l.Origin("core", "", "bare").Path, Equals, filepath.Join(dir, ".git", "config"))
+}
+
+func (s *RepositorySuite) TestRemoteInsteadOf(c *C) {
+	dir, err := ioutil.TempDir("", "go-git-insteadof")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	global := filepath.Join(dir, "gitconfig")
+	err = ioutil.WriteFile(global, []byte(
+		"[url \"https://mirror.example.com/\"]\n\tinsteadOf = https://github.com/\n",
+	), 0644)
+	c.Assert(err, IsNil)
+
+	defer os.Setenv("GIT_CONFIG_GLOBAL", os.Getenv("GIT_CONFIG_GLOBAL"))
+	defer os.Setenv("GIT_CONFIG_NOSYSTEM", os.Getenv("GIT_CONFIG_NOSYSTEM"))
+	os.Setenv("GIT_CONFIG_GLOBAL", global)
+	os.Setenv("GIT_CONFIG_NOSYSTEM", "true")
+
+	r := NewMemoryRepository()
+	_, err = r.CreateRemote(&config.RemoteConfig{
+		Name: "origin",
+		URL:  "https://github.com/src-d/go-git",
+	})
+	c.Assert(err, IsNil)
+
+	remote, err := r.Remote("origin")
+	c.Assert(err, IsNil)
+	c.Assert(remote.Config().URL, Equals, "https://github.com/src-d/go-git")
+
+	e, err := remote.Endpoint()
+	c.Assert(err, IsNil)
+	c.Assert(e.String(), Equals, "https://mirror.example.com/src-d/go-git")
+}
+
+func (s *RepositorySuite) TestCreateRemoteInvalidGlobalConfig(c *C) {
+	dir, err := ioutil.TempDir("", "go-git-insteadof")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	global := filepath.Join(dir, "gitconfig")
+	c.Assert(ioutil.WriteFile(global, []byte("[url \"foo"), 0644), IsNil)
+
+	defer os.Setenv("GIT_CONFIG_GLOBAL", os.Getenv("GIT_CONFIG_GLOBAL"))
+	defer os.Setenv("GIT_CONFIG_NOSYSTEM", os.Getenv("GIT_CONFIG_NOSYSTEM"))
+	os.Setenv("GIT_CONFIG_GLOBAL", global)
+	os.Setenv("GIT_CONFIG_NOSYSTEM", "true")
+
+	r := NewMemoryRepository()
+	_, err = r.CreateRemote(&config.RemoteConfig{Name: "foo", URL: "http://foo/bar"})
+	c.Assert(err, NotNil)
+
+	_, err = r.s.ConfigStorage().Remote("foo")
+	c.Assert(err, Equals, config.ErrRemoteConfigNotFound)
+}
+
+func (s *RepositorySuite) TestRemoteReadsConfigOnce(c *C) {
+	dir, err := ioutil.TempDir("", "go-git-insteadof")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	global := filepath.Join(dir, "gitconfig")
+	err = ioutil.WriteFile(global, []byte(
+		"[url \"https://mirror.example.com/\"]\n\tinsteadOf = https://github.com/\n",
+	), 0644)
+	c.Assert(err, IsNil)
+
+	defer os.Setenv("GIT_CONFIG_GLOBAL", os.Getenv("GIT_CONFIG_GLOBAL"))
+	defer os.Setenv("GIT_CONFIG_NOSYSTEM", os.Getenv("GIT_CONFIG_NOSYSTEM"))
+	os.Setenv("GIT_CONFIG_GLOBAL", global)
+	os.Setenv("GIT_CONFIG_NOSYSTEM", "true")
+
+	r := NewMemoryRepository()
+	_, err = r.CreateRemote(&config.RemoteConfig{
+		Name: "origin",
+		URL:  "https://github.com/src-d/go-git",
+	})
+	c.Assert(err, IsNil)
+
+	c.Assert(os.Remove(global), IsNil)
+
+	remotes, err := r.Remotes()
+	c.Assert(err, IsNil)
+	c.Assert(remotes, HasLen, 1)
+
+	e, err := remotes[0].Endpoint()
+	c.Assert(err, IsNil)
+	c.Assert(e.String(), Equals, "https://mirror.example.com/src-d/go-git")
+}
+
+func (s *RepositorySuite) TestInit(c *C) {
+	dir := c.MkDir()
+	r, err := Init(osfs.NewOS(dir), false)
+	c.Assert(err, IsNil)
+	c.Assert(r, NotNil)
+
+	for _, path := range []string{"objects/info", "objects/pack", "refs/heads", "refs/tags"} {
+		fi, err := os.Stat(filepath.Join(dir, ".git", path))
+		c.Assert(err, IsNil)
+		c.Assert(fi.IsDir(), Equals, true)
+	}
+
+	head, err := ioutil.ReadFile(filepath.Join(dir, ".git", "HEAD"))
+	c.Assert(err, IsNil)
+	c.Assert(string(head), Equals, "ref: refs/heads/master\n")
+
+	cfg, err := ioutil.ReadFile(filepath.Join(dir, ".git", "config"))
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(string(cfg), "repositoryformatversion = 0"), Equals, true)
+	c.Assert(strings.Contains(string(cfg), "bare = false"), Equals, true)
+
+	empty, err := r.IsEmpty()
+	c.Assert(err, IsNil)
+	c.Assert(empty, Equals, true)
+
+	_, err = r.Head()
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+}
+
+func (s *RepositorySuite) TestInitBare(c *C) {
+	fs := memfs.New()
+	_, err := Init(fs, true)
+	c.Assert(err, IsNil)
+
+	head, err := fs.Stat("HEAD")
+	c.Assert(err, IsNil)
+	c.Assert(head.IsDir(), Equals, false)
+
+	_, err = fs.Stat(".git")
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *RepositorySuite) TestInitWithOptionsInitialBranch(c *C) {
+	fs := memfs.New()
+	r, err := InitWithOptions(fs, &InitOptions{InitialBranch: "main"})
+	c.Assert(err, IsNil)
+
+	head, err := r.Ref(core.HEAD, false)
+	c.Assert(err, IsNil)
+	c.Assert(head.Target(), Equals, core.ReferenceName("refs/heads/main"))
+}
+
+func (s *RepositorySuite) TestInitWithOptionsInvalidBranch(c *C) {
+	for _, name := range []string{"-foo", "foo..bar", "foo.lock", "foo bar", "foo/", ".foo"} {
+		_, err := InitWithOptions(memfs.New(), &InitOptions{InitialBranch: name})
+		c.Assert(err, Equals, ErrInvalidBranchName, Commentf("%s", name))
+	}
+}
+
+func (s *RepositorySuite) TestInitAlreadyExists(c *C) {
+	fs := memfs.New()
+	_, err := Init(fs, false)
+	c.Assert(err, IsNil)
+
+	_, err = Init(fs, false)
+	c.Assert(err, Equals, ErrRepositoryAlreadyExists)
+}
+
+func (s *RepositorySuite) TestInitAndClone(c *C) {
+	r, err := Init(memfs.New(), true)
+	c.Assert(err, IsNil)
+
+	err = r.Clone(&CloneOptions{URL: RepositoryFixture})
+	c.Assert(err, IsNil)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+}
+
 func (s *RepositorySuite) TestCreateRemoteAndRemote(c *C) {
 	r := NewMemoryRepository()
 	remote, err := r.CreateRemote(&config.RemoteConfig{
@@ -101,6 +313,54 @@ func (s *RepositorySuite) TestClone(c *C) {
 	c.Assert(branch.Hash().String(), Equals, "e8d3ffab552895c19b9fcf7aa264d277cde33881")
 }
 
+func (s *RepositorySuite) TestCloneWithReference(c *C) {
+	dir := c.MkDir()
+	r, err := NewFilesystemRepository(dir)
+	c.Assert(err, IsNil)
+
+	reference := fixtures.Basic().ByTag(".git").One().DotGit().Base()
+	err = r.Clone(&CloneOptions{
+		URL:       RepositoryFixture,
+		Reference: reference,
+	})
+
+	c.Assert(err, IsNil)
+
+	// all the objects are in the reference, so nothing was fetched
+	_, err = os.Stat(filepath.Join(dir, "objects", "pack"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+	commit, err := r.Commit(head.Hash())
+	c.Assert(err, IsNil)
+	c.Assert(commit.Hash, Equals, head.Hash())
+}
+
+func (s *RepositorySuite) TestCloneWithReferenceNotFound(c *C) {
+	r, err := NewFilesystemRepository(c.MkDir())
+	c.Assert(err, IsNil)
+
+	err = r.Clone(&CloneOptions{
+		URL:       RepositoryFixture,
+		Reference: c.MkDir(),
+	})
+
+	c.Assert(err, Equals, ErrAlternateNotFound)
+}
+
+func (s *RepositorySuite) TestCloneWithReferenceNotSupported(c *C) {
+	r := NewMemoryRepository()
+	err := r.Clone(&CloneOptions{
+		URL:       RepositoryFixture,
+		Reference: c.MkDir(),
+	})
+
+	c.Assert(err, Equals, ErrAlternatesNotSupported)
+}
+
 func (s *RepositorySuite) TestCloneNonEmpty(c *C) {
 	r := NewMemoryRepository()
 
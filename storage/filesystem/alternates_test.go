@@ -0,0 +1,144 @@
+package filesystem
+
+import (
+	"path/filepath"
+
+	"gopkg.in/src-d/go-git.v4/core"
+	"gopkg.in/src-d/go-git.v4/fixtures"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem/internal/dotgit"
+	"gopkg.in/src-d/go-git.v4/utils/fs/os"
+
+	. "gopkg.in/check.v1"
+)
+
+type AlternatesSuite struct {
+	fixtures.Suite
+}
+
+var _ = Suite(&AlternatesSuite{})
+
+func (s *AlternatesSuite) options() Options {
+	return Options{AlternatesFilesystem: os.NewOS("/")}
+}
+
+func (s *AlternatesSuite) TestGet(c *C) {
+	shared := fixtures.Basic().ByTag(".git").One().DotGit()
+
+	dir := dotgit.New(os.NewOS(c.MkDir()))
+	c.Assert(dir.AddAlternate(filepath.Join(shared.Base(), "objects")), IsNil)
+
+	o, err := newObjectStorage(dir, s.options())
+	c.Assert(err, IsNil)
+	defer o.Close()
+
+	expected := core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	obj, err := o.Get(core.CommitObject, expected)
+	c.Assert(err, IsNil)
+	c.Assert(obj.Hash(), Equals, expected)
+
+	_, err = o.Get(core.TreeObject, expected)
+	c.Assert(err, Equals, core.ErrObjectNotFound)
+}
+
+func (s *AlternatesSuite) TestAddAlternateKeepsOpened(c *C) {
+	shared := fixtures.Basic().ByTag(".git").One().DotGit()
+	other := fixtures.Basic().ByTag(".git").One().DotGit()
+
+	dir := dotgit.New(os.NewOS(c.MkDir()))
+	c.Assert(dir.AddAlternate(filepath.Join(shared.Base(), "objects")), IsNil)
+
+	o, err := newObjectStorage(dir, s.options())
+	c.Assert(err, IsNil)
+	defer o.Close()
+
+	// the alternates in use by a reader are still usable after adding one
+	alternates := o.alternateStorages()
+	c.Assert(alternates, HasLen, 1)
+	c.Assert(o.AddAlternate(filepath.Join(other.Base(), "objects")), IsNil)
+	c.Assert(o.alternateStorages(), HasLen, 2)
+	c.Assert(o.alternateStorages()[0], Equals, alternates[0])
+
+	expected := core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	obj, err := alternates[0].Get(core.CommitObject, expected)
+	c.Assert(err, IsNil)
+	c.Assert(obj.Hash(), Equals, expected)
+}
+
+func (s *AlternatesSuite) TestGetNested(c *C) {
+	shared := fixtures.Basic().ByTag(".git").One().DotGit()
+
+	middle := c.MkDir()
+	c.Assert(dotgit.New(os.NewOS(middle)).AddAlternate(
+		filepath.Join(shared.Base(), "objects"),
+	), IsNil)
+
+	dir := dotgit.New(os.NewOS(c.MkDir()))
+	c.Assert(dir.AddAlternate(filepath.Join(middle, "objects")), IsNil)
+
+	// a cycle doesn't open the same alternate twice
+	c.Assert(dotgit.New(os.NewOS(middle)).AddAlternate(
+		filepath.Join(middle, "objects"),
+	), IsNil)
+
+	o, err := newObjectStorage(dir, s.options())
+	c.Assert(err, IsNil)
+	defer o.Close()
+
+	c.Assert(o.alternates, HasLen, 2)
+
+	expected := core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	obj, err := o.Get(core.AnyObject, expected)
+	c.Assert(err, IsNil)
+	c.Assert(obj.Hash(), Equals, expected)
+}
+
+func (s *AlternatesSuite) TestIter(c *C) {
+	shared := fixtures.Basic().ByTag(".git").One().DotGit()
+
+	dir := dotgit.New(os.NewOS(c.MkDir()))
+	c.Assert(dir.AddAlternate(filepath.Join(shared.Base(), "objects")), IsNil)
+
+	o, err := newObjectStorage(dir, s.options())
+	c.Assert(err, IsNil)
+	defer o.Close()
+
+	// an object stored in both, the repository and the alternate
+	commit, err := o.Get(core.AnyObject, core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(err, IsNil)
+	_, err = o.Set(commit)
+	c.Assert(err, IsNil)
+
+	iter, err := o.Iter(core.AnyObject)
+	c.Assert(err, IsNil)
+
+	seen := make(map[core.Hash]int, 0)
+	err = iter.ForEach(func(obj core.Object) error {
+		seen[obj.Hash()]++
+		return nil
+	})
+
+	c.Assert(err, IsNil)
+	c.Assert(seen, HasLen, 31)
+	for h, count := range seen {
+		c.Assert(count, Equals, 1, Commentf("object %s", h))
+	}
+}
+
+func (s *AlternatesSuite) TestAlternateReferences(c *C) {
+	shared := fixtures.Basic().ByTag(".git").One().DotGit()
+
+	dir := dotgit.New(os.NewOS(c.MkDir()))
+	o, err := newObjectStorage(dir, s.options())
+	c.Assert(err, IsNil)
+	defer o.Close()
+
+	refs, err := o.AlternateReferences()
+	c.Assert(err, IsNil)
+	c.Assert(refs, HasLen, 0)
+
+	c.Assert(o.AddAlternate(filepath.Join(shared.Base(), "objects")), IsNil)
+
+	refs, err = o.AlternateReferences()
+	c.Assert(err, IsNil)
+	c.Assert(len(refs) > 0, Equals, true)
+}
@@ -1,47 +1,90 @@
 package filesystem
 
 import (
+	"io/ioutil"
 	"os"
+	"sort"
+	"sync"
 
 	"gopkg.in/src-d/go-git.v4/config"
-	gitconfig "gopkg.in/src-d/go-git.v4/formats/config"
 	"gopkg.in/src-d/go-git.v4/storage/filesystem/internal/dotgit"
 )
 
 const (
-	remoteSection = "remote"
-	fetchKey      = "fetch"
-	urlKey        = "url"
+	coreSection                = "core"
+	repositoryFormatVersionKey = "repositoryformatversion"
+	fileModeKey                = "filemode"
+	bareKey                    = "bare"
+	logAllRefUpdatesKey        = "logallrefupdates"
 )
 
+// ConfigStorage is the implementation of config.ConfigStorage over the config
+// file of a git directory, it's safe for concurrent use.
 type ConfigStorage struct {
 	dir *dotgit.DotGit
+	// m serializes the changes, every change reads and writes back the whole
+	// file
+	m sync.RWMutex
+}
+
+// Config reads the config file, an empty config is returned if the git
+// directory has no config file.
+func (c *ConfigStorage) Config() (*config.Config, error) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	return c.read()
+}
+
+// SetConfig writes the config file, the sections and keys of the config
+// not supported by config.Config are kept as they are in its Raw config.
+func (c *ConfigStorage) SetConfig(cfg *config.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.write(cfg)
 }
 
 func (c *ConfigStorage) Remote(name string) (*config.RemoteConfig, error) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
 	cfg, err := c.read()
 	if err != nil {
 		return nil, err
 	}
 
-	s := cfg.Section(remoteSection)
-	if !s.HasSubsection(name) {
+	r, ok := cfg.Remotes[name]
+	if !ok {
 		return nil, config.ErrRemoteConfigNotFound
 	}
 
-	return parseRemote(s.Subsection(name)), nil
+	return r, nil
 }
 
+// Remotes returns the remotes of the config, sorted by name.
 func (c *ConfigStorage) Remotes() ([]*config.RemoteConfig, error) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
 	cfg, err := c.read()
 	if err != nil {
 		return nil, err
 	}
 
-	remotes := []*config.RemoteConfig{}
-	sect := cfg.Section(remoteSection)
-	for _, s := range sect.Subsections {
-		remotes = append(remotes, parseRemote(s))
+	names := make([]string, 0, len(cfg.Remotes))
+	for name := range cfg.Remotes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	remotes := make([]*config.RemoteConfig, len(names))
+	for i, name := range names {
+		remotes[i] = cfg.Remotes[name]
 	}
 
 	return remotes, nil
@@ -52,37 +95,55 @@ func (c *ConfigStorage) SetRemote(r *config.RemoteConfig) error {
 		return err
 	}
 
+	c.m.Lock()
+	defer c.m.Unlock()
+
 	cfg, err := c.read()
 	if err != nil {
 		return err
 	}
 
-	s := cfg.Section(remoteSection).Subsection(r.Name)
-	s.Name = r.Name
-	if r.URL != "" {
-		s.SetOption(urlKey, r.URL)
-	}
-	s.RemoveOption(fetchKey)
-	for _, rs := range r.Fetch {
-		s.AddOption(fetchKey, rs.String())
+	cfg.Remotes[r.Name] = r
+	return c.write(cfg)
+}
+
+func (c *ConfigStorage) DeleteRemote(name string) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	cfg, err := c.read()
+	if err != nil {
+		return err
 	}
 
+	delete(cfg.Remotes, name)
 	return c.write(cfg)
 }
 
-func (c *ConfigStorage) DeleteRemote(name string) error {
+// init writes the core section of a new repository, as git init does.
+func (c *ConfigStorage) init(bare bool) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
 	cfg, err := c.read()
 	if err != nil {
 		return err
 	}
 
-	cfg = cfg.RemoveSubsection(remoteSection, name)
+	s := cfg.Raw.Section(coreSection)
+	s.SetOption(repositoryFormatVersionKey, "0")
+	s.SetOption(fileModeKey, "true")
+	s.SetOption(bareKey, "false")
+	if !bare {
+		s.SetOption(logAllRefUpdatesKey, "true")
+	}
 
+	cfg.Core.IsBare = bare
 	return c.write(cfg)
 }
 
-func (c *ConfigStorage) read() (*gitconfig.Config, error) {
-	cfg := gitconfig.New()
+func (c *ConfigStorage) read() (*config.Config, error) {
+	cfg := config.NewConfig()
 
 	f, err := c.dir.Config()
 	if err != nil {
@@ -95,42 +156,33 @@ func (c *ConfigStorage) read() (*gitconfig.Config, error) {
 
 	defer f.Close()
 
-	d := gitconfig.NewDecoder(f)
-	if err := d.Decode(cfg); err != nil {
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Unmarshal(b); err != nil {
 		return nil, err
 	}
 
 	return cfg, nil
 }
 
-func (c *ConfigStorage) write(cfg *gitconfig.Config) error {
-	f, err := c.dir.ConfigWriter()
+func (c *ConfigStorage) write(cfg *config.Config) error {
+	b, err := cfg.Marshal()
 	if err != nil {
 		return err
 	}
 
-	e := gitconfig.NewEncoder(f)
-	err = e.Encode(cfg)
+	f, err := c.dir.ConfigWriter()
 	if err != nil {
-		f.Close()
 		return err
 	}
 
-	return f.Close()
-}
-
-func parseRemote(s *gitconfig.Subsection) *config.RemoteConfig {
-	fetch := []config.RefSpec{}
-	for _, f := range s.Options.GetAll(fetchKey) {
-		rs := config.RefSpec(f)
-		if rs.IsValid() {
-			fetch = append(fetch, rs)
-		}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
 	}
 
-	return &config.RemoteConfig{
-		Name:  s.Name,
-		URL:   s.Option(urlKey),
-		Fetch: fetch,
-	}
+	return f.Close()
 }
@@ -3,6 +3,7 @@ package filesystem
 import (
 	"io/ioutil"
 	stdos "os"
+	"path/filepath"
 
 	"gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/fixtures"
@@ -30,7 +31,7 @@ func (s *ConfigSuite) SetUpTest(c *C) {
 }
 
 func (s *ConfigSuite) TestSetRemote(c *C) {
-	cfg := &ConfigStorage{s.dir}
+	cfg := &ConfigStorage{dir: s.dir}
 	err := cfg.SetRemote(&config.RemoteConfig{Name: "foo", URL: "foo"})
 	c.Assert(err, IsNil)
 
@@ -41,7 +42,7 @@ func (s *ConfigSuite) TestSetRemote(c *C) {
 
 func (s *ConfigSuite) TestRemotes(c *C) {
 	dir := dotgit.New(fixtures.Basic().ByTag(".git").One().DotGit())
-	cfg := &ConfigStorage{dir}
+	cfg := &ConfigStorage{dir: dir}
 
 	remotes, err := cfg.Remotes()
 	c.Assert(err, IsNil)
@@ -52,6 +53,66 @@ func (s *ConfigSuite) TestRemotes(c *C) {
 	c.Assert(remotes[0].Fetch[0].String(), Equals, "+refs/heads/*:refs/remotes/origin/*")
 }
 
+func (s *ConfigSuite) TestSetRemoteKeepsUnknown(c *C) {
+	err := ioutil.WriteFile(filepath.Join(s.path, "config"), []byte(
+		"[core]\n\tbare = false\n[alias]\n\tco = checkout\n",
+	), 0644)
+	c.Assert(err, IsNil)
+
+	cfg := &ConfigStorage{dir: s.dir}
+	err = cfg.SetRemote(&config.RemoteConfig{Name: "foo", URL: "foo"})
+	c.Assert(err, IsNil)
+
+	content, err := ioutil.ReadFile(filepath.Join(s.path, "config"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, `[core]
+	bare = false
+[alias]
+	co = checkout
+[remote "foo"]
+	url = foo
+	fetch = +refs/heads/*:refs/remotes/foo/*
+`)
+}
+
+func (s *ConfigSuite) TestSetRemoteKeepsLayout(c *C) {
+	input := `# edited by hand
+[core]
+	bare = false ; not bare
+
+[remote "origin"]
+	url = https://github.com/src-d/go-git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+[alias]
+	lg = "log --graph ; --oneline"
+`
+	err := ioutil.WriteFile(filepath.Join(s.path, "config"), []byte(input), 0644)
+	c.Assert(err, IsNil)
+
+	cfg := &ConfigStorage{dir: s.dir}
+	err = cfg.SetRemote(&config.RemoteConfig{
+		Name:   "origin",
+		URL:    "https://github.com/src-d/go-git",
+		Fetch:  []config.RefSpec{"+refs/heads/*:refs/remotes/origin/*"},
+		TagOpt: config.NoTags,
+	})
+	c.Assert(err, IsNil)
+
+	content, err := ioutil.ReadFile(filepath.Join(s.path, "config"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, `# edited by hand
+[core]
+	bare = false ; not bare
+
+[remote "origin"]
+	url = https://github.com/src-d/go-git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	tagopt = --no-tags
+[alias]
+	lg = "log --graph ; --oneline"
+`)
+}
+
 func (s *ConfigSuite) TearDownTest(c *C) {
 	defer stdos.RemoveAll(s.path)
 }
@@ -0,0 +1,151 @@
+package dotgit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/utils/fs"
+)
+
+var (
+	// ErrAlternateOutside is returned by Alternates when an alternate object
+	// directory is outside of the filesystem of the repository and no
+	// alternates root was set.
+	ErrAlternateOutside = errors.New("alternate object directory outside of the filesystem")
+)
+
+// SetAlternatesRoot sets the filesystem where the absolute paths of the
+// alternates, and the relative ones escaping from the filesystem of the
+// repository, are resolved. The base of the repository filesystem must be a
+// path of root, e.g. the root directory of the os filesystem.
+func (d *DotGit) SetAlternatesRoot(root fs.Filesystem) {
+	d.root = root
+}
+
+// Alternates returns a DotGit for each of the object directories listed in
+// the objects/info/alternates file, relative paths are resolved from the
+// objects directory. The alternates are opened from the filesystem of the
+// repository, or from the alternates root if they are outside of it.
+func (d *DotGit) Alternates() ([]*DotGit, error) {
+	paths, err := d.alternatesPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	var alternates []*DotGit
+	for _, path := range paths {
+		alt, err := d.openAlternate(path)
+		if err != nil {
+			return nil, err
+		}
+
+		alternates = append(alternates, alt)
+	}
+
+	return alternates, nil
+}
+
+// openAlternate returns the DotGit of the given object directory, the
+// directories named objects are opened from their parent, so the references
+// of their repository are available too.
+func (d *DotGit) openAlternate(path string) (*DotGit, error) {
+	afs, path, err := d.resolveAlternate(path)
+	if err != nil {
+		return nil, err
+	}
+
+	alt := &DotGit{fs: afs.Dir(path), objects: ".", root: d.root}
+	if filepath.Base(path) == objectsPath {
+		alt.fs = afs.Dir(filepath.Dir(path))
+		alt.objects = objectsPath
+	}
+
+	return alt, nil
+}
+
+// resolveAlternate returns the filesystem containing the given alternate and
+// its path in that filesystem.
+func (d *DotGit) resolveAlternate(path string) (fs.Filesystem, string, error) {
+	base, err := filepath.Abs(d.fs.Base())
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(d.objects, path)
+		if !isOutside(path) {
+			return d.fs, path, nil
+		}
+
+		path = filepath.Join(base, path)
+	} else if rel, err := filepath.Rel(base, path); err == nil && !isOutside(rel) {
+		return d.fs, rel, nil
+	}
+
+	if d.root == nil {
+		return nil, "", ErrAlternateOutside
+	}
+
+	return d.root, path, nil
+}
+
+func isOutside(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// AddAlternate appends the given object directory to the alternates file.
+func (d *DotGit) AddAlternate(path string) error {
+	f, err := d.fs.OpenFile(
+		d.fs.Join(d.objects, infoPath, alternatesPath),
+		os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintln(f, path); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// ObjectsPath returns the absolute path of the object directory.
+func (d *DotGit) ObjectsPath() (string, error) {
+	return filepath.Abs(d.fs.Join(d.fs.Base(), d.objects))
+}
+
+func (d *DotGit) alternatesPaths() (paths []string, err error) {
+	f, err := d.fs.Open(d.fs.Join(d.objects, infoPath, alternatesPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	defer func() {
+		if errClose := f.Close(); err == nil {
+			err = errClose
+		}
+	}()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		paths = append(paths, filepath.Clean(line))
+	}
+
+	return paths, s.Err()
+}
@@ -0,0 +1,110 @@
+package dotgit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/src-d/go-git.v4/core"
+	"gopkg.in/src-d/go-git.v4/utils/fs/chroot"
+	"gopkg.in/src-d/go-git.v4/utils/fs/memory"
+	osfs "gopkg.in/src-d/go-git.v4/utils/fs/os"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *SuiteDotGit) TestAlternates(c *C) {
+	tmp, err := ioutil.TempDir("", "dot-git")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(tmp)
+
+	fs := osfs.NewOS(filepath.Join(tmp, "repo", ".git"))
+	dir := New(fs)
+	dir.SetAlternatesRoot(osfs.NewOS(string(filepath.Separator)))
+
+	alternates, err := dir.Alternates()
+	c.Assert(err, IsNil)
+	c.Assert(alternates, HasLen, 0)
+
+	f, err := fs.Create("objects/info/alternates")
+	c.Assert(err, IsNil)
+	_, err = f.Write([]byte("# shared objects\n" +
+		filepath.Join(tmp, "absolute", "objects") + "\n\n" +
+		"../../../relative/objects\n" +
+		filepath.Join(tmp, "store") + "\n",
+	))
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	alternates, err = dir.Alternates()
+	c.Assert(err, IsNil)
+	c.Assert(alternates, HasLen, 3)
+
+	for i, expected := range []string{
+		filepath.Join(tmp, "absolute", "objects"),
+		filepath.Join(tmp, "relative", "objects"),
+		filepath.Join(tmp, "store"),
+	} {
+		path, err := alternates[i].ObjectsPath()
+		c.Assert(err, IsNil)
+		c.Assert(path, Equals, expected)
+	}
+}
+
+func (s *SuiteDotGit) TestAlternatesObjectDir(c *C) {
+	fs := memory.New()
+	dir := New(fs)
+	c.Assert(dir.AddAlternate("/store"), IsNil)
+
+	alternates, err := dir.Alternates()
+	c.Assert(err, IsNil)
+	c.Assert(alternates, HasLen, 1)
+
+	w, err := alternates[0].NewObject()
+	c.Assert(err, IsNil)
+	c.Assert(w.WriteHeader(core.BlobObject, 3), IsNil)
+	_, err = w.Write([]byte("foo"))
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	hash := w.Hash().String()
+	_, err = fs.Stat(fs.Join("store", hash[0:2], hash[2:40]))
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteDotGit) TestAlternatesOutside(c *C) {
+	tmp, err := ioutil.TempDir("", "dot-git")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(tmp)
+
+	dir := New(chroot.New(osfs.NewOS(tmp), "repo"))
+	c.Assert(dir.AddAlternate("../../../other/objects"), IsNil)
+
+	_, err = dir.Alternates()
+	c.Assert(err, Equals, ErrAlternateOutside)
+
+	dir = New(osfs.NewOS(filepath.Join(tmp, "repo")))
+	c.Assert(dir.AddAlternate(filepath.Join(tmp, "other", "objects")), IsNil)
+
+	_, err = dir.Alternates()
+	c.Assert(err, Equals, ErrAlternateOutside)
+}
+
+func (s *SuiteDotGit) TestAddAlternate(c *C) {
+	tmp, err := ioutil.TempDir("", "dot-git")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(tmp)
+
+	fs := osfs.NewOS(tmp)
+	dir := New(fs)
+
+	c.Assert(dir.AddAlternate("/foo/objects"), IsNil)
+	c.Assert(dir.AddAlternate("/bar/objects"), IsNil)
+
+	f, err := fs.Open("objects/info/alternates")
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadAll(f)
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+	c.Assert(string(content), Equals, "/foo/objects\n/bar/objects\n")
+}
@@ -5,9 +5,12 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
+	"time"
 
 	"gopkg.in/src-d/go-git.v4/core"
 	"gopkg.in/src-d/go-git.v4/utils/fs"
@@ -17,10 +20,23 @@ const (
 	suffix         = ".git"
 	packedRefsPath = "packed-refs"
 	configPath     = "config"
+	indexPath      = "index"
+	lockExt        = ".lock"
+
+	// packedRefsHeader is the first line of the packed-refs files written by
+	// DotGit, we don't peel the tags so only the sorted trait is announced.
+	packedRefsHeader = "# pack-refs with: sorted"
 
 	objectsPath = "objects"
 	packPath    = "pack"
+	infoPath    = "info"
 	refsPath    = "refs"
+	headsPath   = "heads"
+	tagsPath    = "tags"
+
+	// alternatesPath is the file, in objects/info, listing the object
+	// directories of other repositories where objects are looked up
+	alternatesPath = "alternates"
 
 	packExt = ".pack"
 	idxExt  = ".idx"
@@ -35,12 +51,24 @@ var (
 	ErrPackfileNotFound = errors.New("packfile not found")
 	// ErrConfigNotFound is returned by Config when the config is not found
 	ErrConfigNotFound = errors.New("config file not found")
+	// ErrIndexNotFound is returned by Index when the index file is not found
+	ErrIndexNotFound = errors.New("index file not found")
 	// ErrPackedRefsDuplicatedRef is returned when a duplicated reference is
 	// found in the packed-ref file. This is usually the case for corrupted git
 	// repositories.
 	ErrPackedRefsDuplicatedRef = errors.New("duplicated ref found in packed-ref file")
 	// ErrPackedRefsBadFormat is returned when the packed-ref file corrupt.
 	ErrPackedRefsBadFormat = errors.New("malformed packed-ref")
+	// ErrPackedRefsLocked is returned when the packed-refs file can't be
+	// rewritten because its lock file already exists, this usually means
+	// that another process is updating it.
+	ErrPackedRefsLocked = errors.New("packed-refs file is locked")
+	// ErrRefLocked is returned when a reference can't be updated because its
+	// lock file already exists.
+	ErrRefLocked = errors.New("reference is locked")
+	// ErrRefUpdateDuplicated is returned by UpdateRefs when the same
+	// reference is updated more than once.
+	ErrRefUpdateDuplicated = errors.New("duplicated reference update")
 	// ErrSymRefTargetNotFound is returned when a symbolic reference is
 	// targeting a non-existing object. This usually means the repository
 	// is corrupt.
@@ -51,13 +79,36 @@ var (
 // type is not zero-value-safe, use the New function to initialize it.
 type DotGit struct {
 	fs fs.Filesystem
+	// objects is the path of the object directory in fs
+	objects string
+	// root is the filesystem where the alternates outside of fs are opened
+	root fs.Filesystem
 }
 
 // New returns a DotGit value ready to be used. The path argument must
 // be the absolute path of a git repository directory (e.g.
 // "/foo/bar/.git").
 func New(fs fs.Filesystem) *DotGit {
-	return &DotGit{fs: fs}
+	return &DotGit{fs: fs, objects: objectsPath}
+}
+
+// Initialize creates the directories of a new git directory, the object and
+// reference directories are required by git to recognize the repository.
+func (d *DotGit) Initialize() error {
+	dirs := []string{
+		d.fs.Join(d.objects, infoPath),
+		d.fs.Join(d.objects, packPath),
+		d.fs.Join(refsPath, headsPath),
+		d.fs.Join(refsPath, tagsPath),
+	}
+
+	for _, dir := range dirs {
+		if err := d.fs.MkdirAll(dir, os.ModeDir|0755); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func (d *DotGit) ConfigWriter() (fs.File, error) {
@@ -72,12 +123,12 @@ func (d *DotGit) Config() (fs.File, error) {
 // NewObjectPack return a writer for a new packfile, it saves the packfile to
 // disk and also generates and save the index for the given packfile.
 func (d *DotGit) NewObjectPack() (*PackWriter, error) {
-	return newPackWrite(d.fs)
+	return newPackWrite(d.fs, d.objects)
 }
 
 // ObjectPacks returns the list of availables packfiles
 func (d *DotGit) ObjectPacks() ([]core.Hash, error) {
-	packDir := d.fs.Join(objectsPath, packPath)
+	packDir := d.fs.Join(d.objects, packPath)
 	files, err := d.fs.ReadDir(packDir)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -104,7 +155,7 @@ func (d *DotGit) ObjectPacks() ([]core.Hash, error) {
 
 // ObjectPack returns a fs.File of the given packfile
 func (d *DotGit) ObjectPack(hash core.Hash) (fs.File, error) {
-	file := d.fs.Join(objectsPath, packPath, fmt.Sprintf("pack-%s.pack", hash.String()))
+	file := d.fs.Join(d.objects, packPath, fmt.Sprintf("pack-%s.pack", hash.String()))
 
 	pack, err := d.fs.Open(file)
 	if err != nil {
@@ -120,7 +171,7 @@ func (d *DotGit) ObjectPack(hash core.Hash) (fs.File, error) {
 
 // ObjectPackIdx returns a fs.File of the index file for a given packfile
 func (d *DotGit) ObjectPackIdx(hash core.Hash) (fs.File, error) {
-	file := d.fs.Join(objectsPath, packPath, fmt.Sprintf("pack-%s.idx", hash.String()))
+	file := d.fs.Join(d.objects, packPath, fmt.Sprintf("pack-%s.idx", hash.String()))
 	idx, err := d.fs.Open(file)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -133,15 +184,71 @@ func (d *DotGit) ObjectPackIdx(hash core.Hash) (fs.File, error) {
 	return idx, nil
 }
 
+// ObjectPackTime returns the last modification time of the given packfile.
+func (d *DotGit) ObjectPackTime(hash core.Hash) (time.Time, error) {
+	file := d.fs.Join(d.objects, packPath, fmt.Sprintf("pack-%s.pack", hash.String()))
+	fi, err := d.fs.Stat(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return time.Time{}, ErrPackfileNotFound
+		}
+
+		return time.Time{}, err
+	}
+
+	return fi.ModTime(), nil
+}
+
+// ObjectPacksTime returns the last modification time of the packfiles
+// directory, it changes every time a packfile is added or removed.
+func (d *DotGit) ObjectPacksTime() (time.Time, error) {
+	fi, err := d.fs.Stat(d.fs.Join(d.objects, packPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return time.Time{}, nil
+		}
+
+		return time.Time{}, err
+	}
+
+	return fi.ModTime(), nil
+}
+
+// DeleteObjectPack removes the given packfile and its index file, the index is
+// removed first so the packfile is never found without it.
+func (d *DotGit) DeleteObjectPack(hash core.Hash) error {
+	base := d.fs.Join(d.objects, packPath, fmt.Sprintf("pack-%s", hash.String()))
+	for _, file := range []string{base + idxExt, base + packExt} {
+		if err := d.fs.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // NewObject return a writer for a new object file.
 func (d *DotGit) NewObject() (*ObjectWriter, error) {
-	return newObjectWriter(d.fs)
+	return newObjectWriter(d.fs, d.objects)
+}
+
+// NewStagedObject returns a writer for a new object file that is kept in a
+// temporary file after Close, the object is moved to its final location
+// calling Commit or discarded calling Rollback.
+func (d *DotGit) NewStagedObject() (*ObjectWriter, error) {
+	w, err := newObjectWriter(d.fs, d.objects)
+	if err != nil {
+		return nil, err
+	}
+
+	w.staged = true
+	return w, nil
 }
 
 // Objects returns a slice with the hashes of objects found under the
 // .git/objects/ directory.
 func (d *DotGit) Objects() ([]core.Hash, error) {
-	files, err := d.fs.ReadDir(objectsPath)
+	files, err := d.fs.ReadDir(d.objects)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, nil
@@ -154,7 +261,7 @@ func (d *DotGit) Objects() ([]core.Hash, error) {
 	for _, f := range files {
 		if f.IsDir() && len(f.Name()) == 2 && isHex(f.Name()) {
 			base := f.Name()
-			d, err := d.fs.ReadDir(d.fs.Join(objectsPath, base))
+			d, err := d.fs.ReadDir(d.fs.Join(d.objects, base))
 			if err != nil {
 				return nil, err
 			}
@@ -171,29 +278,76 @@ func (d *DotGit) Objects() ([]core.Hash, error) {
 // Object return a fs.File poiting the object file, if exists
 func (d *DotGit) Object(h core.Hash) (fs.File, error) {
 	hash := h.String()
-	file := d.fs.Join(objectsPath, hash[0:2], hash[2:40])
+	file := d.fs.Join(d.objects, hash[0:2], hash[2:40])
 
 	return d.fs.Open(file)
 }
 
-func (d *DotGit) SetRef(r *core.Reference) error {
-	var content string
-	switch r.Type() {
-	case core.SymbolicReference:
-		content = fmt.Sprintf("ref: %s\n", r.Target())
-	case core.HashReference:
-		content = fmt.Sprintln(r.Hash().String())
+// ObjectTime returns the last modification time of the given object file.
+func (d *DotGit) ObjectTime(h core.Hash) (time.Time, error) {
+	hash := h.String()
+	fi, err := d.fs.Stat(d.fs.Join(d.objects, hash[0:2], hash[2:40]))
+	if err != nil {
+		return time.Time{}, err
 	}
 
-	f, err := d.fs.Create(r.Name().String())
-	if err != nil {
-		return err
+	return fi.ModTime(), nil
+}
+
+// SetObjectTime changes the last modification time of the given object file,
+// it fails with fs.ErrNotSupported if the filesystem can't change it.
+func (d *DotGit) SetObjectTime(h core.Hash, t time.Time) error {
+	cfs, ok := d.fs.(fs.ChtimesFilesystem)
+	if !ok {
+		return fs.ErrNotSupported
 	}
 
-	if _, err := f.Write([]byte(content)); err != nil {
+	hash := h.String()
+	return cfs.Chtimes(d.fs.Join(d.objects, hash[0:2], hash[2:40]), t, t)
+}
+
+// RemoveObject removes the given object file, and its directory if it's left
+// empty, removing an object that doesn't exist is not an error.
+func (d *DotGit) RemoveObject(h core.Hash) error {
+	hash := h.String()
+	dir := d.fs.Join(d.objects, hash[0:2])
+	err := d.fs.Remove(d.fs.Join(dir, hash[2:40]))
+	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
-	return f.Close()
+
+	files, err := d.fs.ReadDir(dir)
+	if err != nil || len(files) != 0 {
+		return nil
+	}
+
+	return d.fs.Remove(dir)
+}
+
+// Index returns a fs.File of the index file, ErrIndexNotFound is returned if
+// the repository has no index.
+func (d *DotGit) Index() (fs.File, error) {
+	f, err := d.fs.Open(indexPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrIndexNotFound
+		}
+
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// SetRef stores the given reference, see UpdateRefs.
+func (d *DotGit) SetRef(r *core.Reference) error {
+	return d.UpdateRefs([]*RefUpdate{{Name: r.Name(), New: r}})
+}
+
+// CheckAndSetRef stores the given reference if the current value of the
+// reference is equal to old, see UpdateRefs.
+func (d *DotGit) CheckAndSetRef(r, old *core.Reference) error {
+	return d.UpdateRefs([]*RefUpdate{{Name: r.Name(), New: r, Old: old}})
 }
 
 // Refs scans the git directory collecting references, which it returns.
@@ -236,6 +390,479 @@ func (d *DotGit) Ref(name core.ReferenceName) (*core.Reference, error) {
 	return nil, core.ErrReferenceNotFound
 }
 
+// RemoveRef removes the given reference, see UpdateRefs.
+func (d *DotGit) RemoveRef(name core.ReferenceName) error {
+	return d.UpdateRefs([]*RefUpdate{{Name: name}})
+}
+
+// RefUpdate is a change to a reference applied by UpdateRefs, a nil New
+// removes the reference. When Old is not nil the change is only applied if the
+// current value of the reference is equal to it, or if the reference doesn't
+// exist when Old is absent (see core.Reference.IsAbsent).
+type RefUpdate struct {
+	Name     core.ReferenceName
+	New, Old *core.Reference
+	// Reflog, if not nil, is the entry appended to the reflog of the
+	// reference, its hashes are set by UpdateRefs. It's ignored on removals.
+	Reflog *core.ReflogEntry
+}
+
+// UpdateRefs applies all the given updates or none of them. It follows the
+// same locking protocol as git: a "<ref>.lock" file is created exclusively for
+// every reference, then the current values are checked against the expected
+// ones and the new values are written to the lock files. Only when all of
+// them succeed, the reflogs are appended and the lock files are renamed over
+// the references. Removed references are deleted from the packed-refs file
+// and the loose files, and their reflogs are deleted too.
+//
+// If a reference is already locked ErrRefLocked is returned, if the value of
+// a reference is not the expected one core.ErrReferenceHasChanged is returned.
+func (d *DotGit) UpdateRefs(updates []*RefUpdate) (err error) {
+	updates = append([]*RefUpdate(nil), updates...)
+	sort.Sort(refUpdatesByName(updates))
+
+	var locks []*refLock
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		for _, l := range locks {
+			if errRollback := l.rollback(d.fs); err == nil {
+				err = errRollback
+			}
+		}
+	}()
+
+	var packed []*packedRef
+	var packedRead, hasRemovals bool
+	for i, u := range updates {
+		if i > 0 && updates[i-1].Name == u.Name {
+			return ErrRefUpdateDuplicated
+		}
+
+		l, err := d.lockRef(u)
+		if err != nil {
+			return err
+		}
+
+		locks = append(locks, l)
+		if u.Old != nil || u.Reflog != nil {
+			if !packedRead {
+				if packed, err = d.readPackedRefs(); err != nil {
+					return err
+				}
+
+				packedRead = true
+			}
+		}
+
+		if u.Old != nil {
+			if err := d.checkRef(u.Name, u.Old, packed); err != nil {
+				return err
+			}
+		}
+
+		if u.New == nil {
+			hasRemovals = true
+			continue
+		}
+
+		if err := writeRef(l.f, u.New); err != nil {
+			return err
+		}
+	}
+
+	if err := d.logRefUpdates(updates, packed); err != nil {
+		return err
+	}
+
+	if hasRemovals {
+		if err := d.removePackedRefs(updates); err != nil {
+			return err
+		}
+	}
+
+	for _, l := range locks {
+		if err := l.commit(d.fs); err != nil {
+			return err
+		}
+
+		if l.update.New != nil {
+			continue
+		}
+
+		if err := d.removeReflog(l.update.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *DotGit) checkRef(
+	name core.ReferenceName, old *core.Reference, packed []*packedRef,
+) error {
+	current, err := d.currentRef(name, packed)
+	if err != nil {
+		return err
+	}
+
+	if old.IsAbsent() {
+		if current != nil {
+			return core.ErrReferenceHasChanged
+		}
+
+		return nil
+	}
+
+	if current == nil || !current.Equals(old) {
+		return core.ErrReferenceHasChanged
+	}
+
+	return nil
+}
+
+// currentRef returns the stored value of a reference, from its loose file or
+// the given packed references, nil is returned if it doesn't exist.
+func (d *DotGit) currentRef(
+	name core.ReferenceName, packed []*packedRef,
+) (*core.Reference, error) {
+	ref, err := d.readReferenceFile(".", name.String())
+	if err == nil {
+		return ref, nil
+	}
+
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	for _, p := range packed {
+		if p.ref.Name() == name {
+			return p.ref, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (d *DotGit) removePackedRefs(updates []*RefUpdate) error {
+	return d.rewritePackedRefs(func(refs []*packedRef) ([]*packedRef, bool) {
+		removed := make(map[core.ReferenceName]bool)
+		for _, u := range updates {
+			if u.New == nil {
+				removed[u.Name] = true
+			}
+		}
+
+		var result []*packedRef
+		for _, r := range refs {
+			if !removed[r.ref.Name()] {
+				result = append(result, r)
+			}
+		}
+
+		return result, len(result) != len(refs)
+	})
+}
+
+func (d *DotGit) lockRef(u *RefUpdate) (*refLock, error) {
+	f, err := d.fs.OpenFile(
+		u.Name.String()+lockExt, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666,
+	)
+
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, ErrRefLocked
+		}
+
+		return nil, err
+	}
+
+	return &refLock{update: u, f: f}, nil
+}
+
+func writeRef(w io.Writer, r *core.Reference) error {
+	var content string
+	switch r.Type() {
+	case core.SymbolicReference:
+		content = fmt.Sprintf("ref: %s\n", r.Target())
+	case core.HashReference:
+		content = fmt.Sprintln(r.Hash().String())
+	}
+
+	_, err := w.Write([]byte(content))
+	return err
+}
+
+// refLock is the lock file of a reference being updated.
+type refLock struct {
+	update *RefUpdate
+	f      fs.File
+	done   bool
+}
+
+// commit renames the lock file over the reference, or deletes both files
+// if the reference is being removed.
+func (l *refLock) commit(fs fs.Filesystem) error {
+	l.done = true
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+
+	name := l.update.Name.String()
+	if l.update.New != nil {
+		return fs.Rename(l.f.Filename(), name)
+	}
+
+	if err := fs.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return fs.Remove(l.f.Filename())
+}
+
+func (l *refLock) rollback(fs fs.Filesystem) error {
+	if l.done {
+		return nil
+	}
+
+	l.done = true
+	l.f.Close()
+	return fs.Remove(l.f.Filename())
+}
+
+type refUpdatesByName []*RefUpdate
+
+func (p refUpdatesByName) Len() int           { return len(p) }
+func (p refUpdatesByName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p refUpdatesByName) Less(i, j int) bool { return p[i].Name < p[j].Name }
+
+// PackRefs moves all the loose hash references under refs/ to the packed-refs
+// file, once the new packed-refs file is in place the loose files are
+// removed. Symbolic references are always kept as loose files.
+func (d *DotGit) PackRefs() error {
+	var loose []*core.Reference
+	if err := d.addRefsFromRefDir(&loose); err != nil {
+		return err
+	}
+
+	var packed []*core.Reference
+	err := d.rewritePackedRefs(func(refs []*packedRef) ([]*packedRef, bool) {
+		byName := make(map[core.ReferenceName]*packedRef, len(refs))
+		for _, r := range refs {
+			byName[r.ref.Name()] = r
+		}
+
+		for _, r := range loose {
+			if r.Type() != core.HashReference {
+				continue
+			}
+
+			prev, ok := byName[r.Name()]
+			if ok && prev.ref.Hash() == r.Hash() {
+				packed = append(packed, r)
+				continue
+			}
+
+			if ok {
+				prev.ref, prev.peeled = r, core.ZeroHash
+			} else {
+				refs = append(refs, &packedRef{ref: r})
+			}
+
+			packed = append(packed, r)
+		}
+
+		return refs, len(packed) != 0
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, r := range packed {
+		if err := d.removePackedLooseRef(r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removePackedLooseRef removes the loose file of a reference already written
+// to packed-refs, the file is kept if it was updated in the meantime.
+func (d *DotGit) removePackedLooseRef(r *core.Reference) error {
+	current, err := d.readReferenceFile(".", r.Name().String())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if current.Type() != core.HashReference || current.Hash() != r.Hash() {
+		return nil
+	}
+
+	err = d.fs.Remove(r.Name().String())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// packedRef is an entry of the packed-refs file, peeled is the object pointed
+// by an annotated tag when the entry is followed by a '^' line.
+type packedRef struct {
+	ref    *core.Reference
+	peeled core.Hash
+}
+
+type packedRefsByName []*packedRef
+
+func (p packedRefsByName) Len() int           { return len(p) }
+func (p packedRefsByName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p packedRefsByName) Less(i, j int) bool { return p[i].ref.Name() < p[j].ref.Name() }
+
+// rewritePackedRefs holds the packed-refs lock file while the entries are
+// read and passed to fn, if fn reports a change the returned entries are
+// written to the lock file and renamed over packed-refs, so readers never see
+// a partially written file.
+func (d *DotGit) rewritePackedRefs(
+	fn func([]*packedRef) ([]*packedRef, bool),
+) (err error) {
+	lock, err := d.lockPackedRefs()
+	if err != nil {
+		return err
+	}
+
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+
+		lock.Close()
+		if errRemove := d.fs.Remove(lock.Filename()); err == nil {
+			err = errRemove
+		}
+	}()
+
+	refs, err := d.readPackedRefs()
+	if err != nil {
+		return err
+	}
+
+	refs, changed := fn(refs)
+	if !changed {
+		return nil
+	}
+
+	if err := writePackedRefs(lock, refs); err != nil {
+		return err
+	}
+
+	if err := lock.Close(); err != nil {
+		return err
+	}
+
+	if err := d.fs.Rename(lock.Filename(), packedRefsPath); err != nil {
+		return err
+	}
+
+	committed = true
+	return nil
+}
+
+func (d *DotGit) lockPackedRefs() (fs.File, error) {
+	f, err := d.fs.OpenFile(
+		packedRefsPath+lockExt, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666,
+	)
+
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, ErrPackedRefsLocked
+		}
+
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (d *DotGit) readPackedRefs() (refs []*packedRef, err error) {
+	f, err := d.fs.Open(packedRefsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	defer func() {
+		if errClose := f.Close(); err == nil {
+			err = errClose
+		}
+	}()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		if len(line) == 0 {
+			continue
+		}
+
+		if line[0] == '^' {
+			if len(refs) == 0 {
+				return nil, ErrPackedRefsBadFormat
+			}
+
+			refs[len(refs)-1].peeled = core.NewHash(line[1:])
+			continue
+		}
+
+		ref, err := d.processLine(line)
+		if err != nil {
+			return nil, err
+		}
+
+		if ref != nil {
+			refs = append(refs, &packedRef{ref: ref})
+		}
+	}
+
+	return refs, s.Err()
+}
+
+// writePackedRefs writes the given entries sorted by name, as the header
+// announces, whatever the order of the file they were read from.
+func writePackedRefs(w io.Writer, refs []*packedRef) error {
+	sort.Sort(packedRefsByName(refs))
+	if _, err := fmt.Fprintln(w, packedRefsHeader); err != nil {
+		return err
+	}
+
+	for _, r := range refs {
+		if _, err := fmt.Fprintf(w, "%s %s\n", r.ref.Hash(), r.ref.Name()); err != nil {
+			return err
+		}
+
+		if r.peeled.IsZero() {
+			continue
+		}
+
+		if _, err := fmt.Fprintf(w, "^%s\n", r.peeled); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (d *DotGit) addRefsFromPackedRefs(refs *[]*core.Reference) (err error) {
 	f, err := d.fs.Open(packedRefsPath)
 	if err != nil {
@@ -298,6 +925,10 @@ func (d *DotGit) walkReferencesTree(refs *[]*core.Reference, relPath string) err
 	}
 
 	for _, f := range files {
+		if strings.HasSuffix(f.Name(), lockExt) {
+			continue
+		}
+
 		newRelPath := d.fs.Join(relPath, f.Name())
 		if f.IsDir() {
 			if err = d.walkReferencesTree(refs, newRelPath); err != nil {
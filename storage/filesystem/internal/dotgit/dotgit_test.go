@@ -82,6 +82,144 @@ func (s *SuiteDotGit) TestSetRefs(c *C) {
 
 }
 
+func (s *SuiteDotGit) TestCheckAndSetRef(c *C) {
+	tmp, err := ioutil.TempDir("", "dot-git")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(tmp)
+
+	fs := osfs.NewOS(tmp)
+	dir := New(fs)
+
+	old := core.NewReferenceFromStrings(
+		"refs/heads/foo",
+		"e8d3ffab552895c19b9fcf7aa264d277cde33881",
+	)
+	c.Assert(dir.SetRef(old), IsNil)
+
+	new := core.NewReferenceFromStrings(
+		"refs/heads/foo",
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+	)
+	c.Assert(dir.CheckAndSetRef(new, old), IsNil)
+	c.Assert(dir.CheckAndSetRef(new, old), Equals, core.ErrReferenceHasChanged)
+
+	ref, err := dir.Ref("refs/heads/foo")
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+	_, err = fs.Stat("refs/heads/foo.lock")
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *SuiteDotGit) TestCheckAndSetRefFromPackedRefs(c *C) {
+	fs := fixtures.Basic().ByTag(".git").One().DotGit()
+	dir := New(fs)
+
+	old := core.NewReferenceFromStrings(
+		"refs/remotes/origin/branch",
+		"e8d3ffab552895c19b9fcf7aa264d277cde33881",
+	)
+
+	new := core.NewReferenceFromStrings(
+		"refs/remotes/origin/branch",
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+	)
+
+	c.Assert(dir.CheckAndSetRef(new, old), IsNil)
+
+	ref, err := dir.Ref("refs/remotes/origin/branch")
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+}
+
+func (s *SuiteDotGit) TestSetRefLocked(c *C) {
+	tmp, err := ioutil.TempDir("", "dot-git")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(tmp)
+
+	fs := osfs.NewOS(tmp)
+	dir := New(fs)
+
+	f, err := fs.Create("refs/heads/foo.lock")
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	err = dir.SetRef(core.NewReferenceFromStrings(
+		"refs/heads/foo",
+		"e8d3ffab552895c19b9fcf7aa264d277cde33881",
+	))
+	c.Assert(err, Equals, ErrRefLocked)
+
+	refs, err := dir.Refs()
+	c.Assert(err, IsNil)
+	c.Assert(refs, HasLen, 0)
+}
+
+func (s *SuiteDotGit) TestUpdateRefsAllOrNothing(c *C) {
+	tmp, err := ioutil.TempDir("", "dot-git")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(tmp)
+
+	fs := osfs.NewOS(tmp)
+	dir := New(fs)
+
+	foo := core.NewReferenceFromStrings(
+		"refs/heads/foo",
+		"e8d3ffab552895c19b9fcf7aa264d277cde33881",
+	)
+	c.Assert(dir.SetRef(foo), IsNil)
+
+	bar := core.NewReferenceFromStrings(
+		"refs/heads/bar",
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+	)
+
+	err = dir.UpdateRefs([]*RefUpdate{
+		{Name: bar.Name(), New: bar},
+		{Name: foo.Name(), Old: bar},
+	})
+	c.Assert(err, Equals, core.ErrReferenceHasChanged)
+
+	refs, err := dir.Refs()
+	c.Assert(err, IsNil)
+	c.Assert(refs, HasLen, 1)
+	c.Assert(refs[0].Equals(foo), Equals, true)
+
+	files, err := fs.ReadDir("refs/heads")
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 1)
+
+	err = dir.UpdateRefs([]*RefUpdate{
+		{Name: bar.Name(), New: bar},
+		{Name: foo.Name(), Old: foo},
+	})
+	c.Assert(err, IsNil)
+
+	refs, err = dir.Refs()
+	c.Assert(err, IsNil)
+	c.Assert(refs, HasLen, 1)
+	c.Assert(refs[0].Equals(bar), Equals, true)
+}
+
+func (s *SuiteDotGit) TestUpdateRefsDuplicated(c *C) {
+	tmp, err := ioutil.TempDir("", "dot-git")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(tmp)
+
+	dir := New(osfs.NewOS(tmp))
+
+	foo := core.NewReferenceFromStrings(
+		"refs/heads/foo",
+		"e8d3ffab552895c19b9fcf7aa264d277cde33881",
+	)
+
+	err = dir.UpdateRefs([]*RefUpdate{
+		{Name: foo.Name(), New: foo},
+		{Name: foo.Name()},
+	})
+	c.Assert(err, Equals, ErrRefUpdateDuplicated)
+}
+
 func (s *SuiteDotGit) TestRefsFromPackedRefs(c *C) {
 	fs := fixtures.Basic().ByTag(".git").One().DotGit()
 	dir := New(fs)
@@ -94,6 +232,180 @@ func (s *SuiteDotGit) TestRefsFromPackedRefs(c *C) {
 	c.Assert(ref.Hash().String(), Equals, "e8d3ffab552895c19b9fcf7aa264d277cde33881")
 
 }
+func (s *SuiteDotGit) TestRemoveRefFromReferenceFile(c *C) {
+	fs := fixtures.Basic().ByTag(".git").One().DotGit()
+	dir := New(fs)
+
+	name := core.ReferenceName("refs/remotes/origin/HEAD")
+	err := dir.RemoveRef(name)
+	c.Assert(err, IsNil)
+
+	refs, err := dir.Refs()
+	c.Assert(err, IsNil)
+
+	ref := findReference(refs, string(name))
+	c.Assert(ref, IsNil)
+}
+
+func (s *SuiteDotGit) TestRemoveRefFromPackedRefs(c *C) {
+	fs := fixtures.Basic().ByTag(".git").One().DotGit()
+	dir := New(fs)
+
+	name := core.ReferenceName("refs/remotes/origin/branch")
+	err := dir.RemoveRef(name)
+	c.Assert(err, IsNil)
+
+	refs, err := dir.Refs()
+	c.Assert(err, IsNil)
+	c.Assert(findReference(refs, string(name)), IsNil)
+	c.Assert(findReference(refs, "refs/remotes/origin/master"), NotNil)
+
+	_, err = fs.Stat(packedRefsPath + lockExt)
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *SuiteDotGit) TestRemoveRefFromUnsortedPackedRefs(c *C) {
+	fs := osfs.NewOS(c.MkDir())
+	dir := New(fs)
+
+	f, err := fs.Create(packedRefsPath)
+	c.Assert(err, IsNil)
+	_, err = f.Write([]byte("" +
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/tags/v1.0.0\n" +
+		"e8d3ffab552895c19b9fcf7aa264d277cde33881 refs/heads/branch\n" +
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/master\n",
+	))
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	c.Assert(dir.RemoveRef("refs/heads/branch"), IsNil)
+
+	f, err = fs.Open(packedRefsPath)
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadAll(f)
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+	c.Assert(string(content), Equals, ""+
+		"# pack-refs with: sorted\n"+
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/master\n"+
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/tags/v1.0.0\n",
+	)
+}
+
+func (s *SuiteDotGit) TestRemoveRefNotFound(c *C) {
+	fs := fixtures.Basic().ByTag(".git").One().DotGit()
+	dir := New(fs)
+
+	err := dir.RemoveRef(core.ReferenceName("refs/heads/not-found"))
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteDotGit) TestRemoveRefLocked(c *C) {
+	fs := fixtures.Basic().ByTag(".git").One().DotGit()
+	dir := New(fs)
+
+	f, err := fs.Create(packedRefsPath + lockExt)
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	err = dir.RemoveRef(core.ReferenceName("refs/remotes/origin/branch"))
+	c.Assert(err, Equals, ErrPackedRefsLocked)
+}
+
+func (s *SuiteDotGit) TestPackRefs(c *C) {
+	tmp, err := ioutil.TempDir("", "dot-git")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(tmp)
+
+	fs := osfs.NewOS(tmp)
+	dir := New(fs)
+
+	err = dir.SetRef(core.NewReferenceFromStrings(
+		"refs/heads/foo",
+		"e8d3ffab552895c19b9fcf7aa264d277cde33881",
+	))
+	c.Assert(err, IsNil)
+
+	err = dir.SetRef(core.NewReferenceFromStrings(
+		"refs/tags/v1.0.0",
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+	))
+	c.Assert(err, IsNil)
+
+	err = dir.SetRef(core.NewReferenceFromStrings(
+		"refs/heads/symbolic",
+		"ref: refs/heads/foo",
+	))
+	c.Assert(err, IsNil)
+
+	err = dir.PackRefs()
+	c.Assert(err, IsNil)
+
+	f, err := fs.Open(packedRefsPath)
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadAll(f)
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+	c.Assert(string(content), Equals, ""+
+		"# pack-refs with: sorted\n"+
+		"e8d3ffab552895c19b9fcf7aa264d277cde33881 refs/heads/foo\n"+
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/tags/v1.0.0\n",
+	)
+
+	_, err = fs.Stat("refs/heads/foo")
+	c.Assert(os.IsNotExist(err), Equals, true)
+	_, err = fs.Stat("refs/heads/symbolic")
+	c.Assert(err, IsNil)
+
+	refs, err := dir.Refs()
+	c.Assert(err, IsNil)
+	c.Assert(refs, HasLen, 3)
+
+	ref, err := dir.Ref("refs/tags/v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+}
+
+func (s *SuiteDotGit) TestPackRefsKeepsPeeled(c *C) {
+	tmp, err := ioutil.TempDir("", "dot-git")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(tmp)
+
+	fs := osfs.NewOS(tmp)
+	dir := New(fs)
+
+	f, err := fs.Create(packedRefsPath)
+	c.Assert(err, IsNil)
+	_, err = f.Write([]byte("" +
+		"# pack-refs with: peeled fully-peeled \n" +
+		"b8e471f58bcbca63b07bda20e428190409c2db47 refs/tags/v1.0.0\n" +
+		"^6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n",
+	))
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	err = dir.SetRef(core.NewReferenceFromStrings(
+		"refs/heads/master",
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+	))
+	c.Assert(err, IsNil)
+
+	err = dir.PackRefs()
+	c.Assert(err, IsNil)
+
+	f, err = fs.Open(packedRefsPath)
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadAll(f)
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+	c.Assert(string(content), Equals, ""+
+		"# pack-refs with: sorted\n"+
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/master\n"+
+		"b8e471f58bcbca63b07bda20e428190409c2db47 refs/tags/v1.0.0\n"+
+		"^6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n",
+	)
+}
+
 func (s *SuiteDotGit) TestRefsFromReferenceFile(c *C) {
 	fs := fixtures.Basic().ByTag(".git").One().DotGit()
 	dir := New(fs)
@@ -184,6 +496,81 @@ func (s *SuiteDotGit) TestObjectPackNotFound(c *C) {
 	c.Assert(idx, IsNil)
 }
 
+func (s *SuiteDotGit) TestObjectPackTime(c *C) {
+	f := fixtures.Basic().ByTag(".git").One()
+	dir := New(f.DotGit())
+
+	t, err := dir.ObjectPackTime(f.PackfileHash)
+	c.Assert(err, IsNil)
+	c.Assert(t.IsZero(), Equals, false)
+
+	_, err = dir.ObjectPackTime(core.ZeroHash)
+	c.Assert(err, Equals, ErrPackfileNotFound)
+}
+
+func (s *SuiteDotGit) TestObjectPacksTime(c *C) {
+	f := fixtures.Basic().ByTag(".git").One()
+	dir := New(f.DotGit())
+
+	t, err := dir.ObjectPacksTime()
+	c.Assert(err, IsNil)
+	c.Assert(t.IsZero(), Equals, false)
+
+	dir = New(osfs.NewOS(c.MkDir()))
+	t, err = dir.ObjectPacksTime()
+	c.Assert(err, IsNil)
+	c.Assert(t.IsZero(), Equals, true)
+}
+
+func (s *SuiteDotGit) TestDeleteObjectPack(c *C) {
+	f := fixtures.Basic().ByTag(".git").One()
+	dir := New(f.DotGit())
+
+	err := dir.DeleteObjectPack(f.PackfileHash)
+	c.Assert(err, IsNil)
+
+	_, err = dir.ObjectPack(f.PackfileHash)
+	c.Assert(err, Equals, ErrPackfileNotFound)
+	_, err = dir.ObjectPackIdx(f.PackfileHash)
+	c.Assert(err, Equals, ErrPackfileNotFound)
+
+	packs, err := dir.ObjectPacks()
+	c.Assert(err, IsNil)
+	c.Assert(packs, HasLen, 0)
+}
+
+func (s *SuiteDotGit) TestRemoveObject(c *C) {
+	fs := osfs.NewOS(c.MkDir())
+	dir := New(fs)
+
+	w, err := dir.NewObject()
+	c.Assert(err, IsNil)
+	c.Assert(w.WriteHeader(core.BlobObject, 14), IsNil)
+	_, err = w.Write([]byte("this is a test"))
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	h := core.NewHash("a8a940627d132695a9769df883f85992f0ff4a43")
+	t, err := dir.ObjectTime(h)
+	c.Assert(err, IsNil)
+	c.Assert(t.IsZero(), Equals, false)
+
+	c.Assert(dir.RemoveObject(h), IsNil)
+
+	_, err = fs.Stat("objects/a8")
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	c.Assert(dir.RemoveObject(h), IsNil)
+}
+
+func (s *SuiteDotGit) TestIndexNotFound(c *C) {
+	dir := New(osfs.NewOS(c.MkDir()))
+
+	idx, err := dir.Index()
+	c.Assert(err, Equals, ErrIndexNotFound)
+	c.Assert(idx, IsNil)
+}
+
 func (s *SuiteDotGit) TestNewObject(c *C) {
 	tmp, err := ioutil.TempDir("", "dot-git")
 	c.Assert(err, IsNil)
@@ -243,3 +630,19 @@ func (s *SuiteDotGit) TestObjectNotFound(c *C) {
 	c.Assert(err, NotNil)
 	c.Assert(file, IsNil)
 }
+
+func (s *SuiteDotGit) TestInitialize(c *C) {
+	fs := osfs.NewOS(c.MkDir())
+	dir := New(fs)
+
+	err := dir.Initialize()
+	c.Assert(err, IsNil)
+
+	for _, path := range []string{"objects/info", "objects/pack", "refs/heads", "refs/tags"} {
+		fi, err := fs.Stat(path)
+		c.Assert(err, IsNil)
+		c.Assert(fi.IsDir(), Equals, true)
+	}
+
+	c.Assert(dir.Initialize(), IsNil)
+}
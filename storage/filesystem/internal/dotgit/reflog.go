@@ -0,0 +1,258 @@
+package dotgit
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/core"
+)
+
+const (
+	logsPath = "logs"
+
+	maxResolveRecursion = 1024
+)
+
+var (
+	// ErrReflogBadFormat is returned when a reflog file is corrupt.
+	ErrReflogBadFormat = errors.New("malformed reflog")
+	// ErrReflogLocked is returned when a reflog can't be rewritten because its
+	// lock file already exists.
+	ErrReflogLocked = errors.New("reflog is locked")
+)
+
+// Reflog returns the entries of the reflog of the given reference, read from
+// logs/<ref>, from the oldest to the newest.
+func (d *DotGit) Reflog(name core.ReferenceName) (entries []*core.ReflogEntry, err error) {
+	f, err := d.fs.Open(d.reflogPath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	defer func() {
+		if errClose := f.Close(); err == nil {
+			err = errClose
+		}
+	}()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+
+		e, err := decodeReflogEntry(s.Bytes())
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, s.Err()
+}
+
+// AppendReflog adds the given entry at the end of the reflog of a reference,
+// the file and its directories are created if needed.
+func (d *DotGit) AppendReflog(name core.ReferenceName, e *core.ReflogEntry) error {
+	f, err := d.fs.OpenFile(
+		d.reflogPath(name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(encodeReflogEntry(e)); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// SetReflog replaces the reflog of a reference with the given entries, the
+// new content is written to a lock file that is renamed over the reflog.
+func (d *DotGit) SetReflog(name core.ReferenceName, entries []*core.ReflogEntry) error {
+	path := d.reflogPath(name)
+	f, err := d.fs.OpenFile(
+		path+lockExt, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666,
+	)
+
+	if err != nil {
+		if os.IsExist(err) {
+			return ErrReflogLocked
+		}
+
+		return err
+	}
+
+	for _, e := range entries {
+		if _, err := f.Write(encodeReflogEntry(e)); err != nil {
+			f.Close()
+			d.fs.Remove(f.Filename())
+			return err
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		d.fs.Remove(f.Filename())
+		return err
+	}
+
+	return d.fs.Rename(f.Filename(), path)
+}
+
+// logRefUpdates appends the reflog entries of the updates, called by
+// UpdateRefs while the references are locked and before they are changed. The
+// entries get the hashes pointed by the references before and after the
+// updates, and they are skipped if both are equal. When the branch pointed by
+// HEAD is updated the entry is appended to the reflog of HEAD too.
+func (d *DotGit) logRefUpdates(updates []*RefUpdate, packed []*packedRef) error {
+	updated := make(map[core.ReferenceName]*core.Reference, len(updates))
+	for _, u := range updates {
+		updated[u.Name] = u.New
+	}
+
+	var head *core.Reference
+	var headRead bool
+	for _, u := range updates {
+		if u.Reflog == nil || u.New == nil {
+			continue
+		}
+
+		old, err := d.resolveRefHash(u.Name, nil, packed)
+		if err != nil {
+			return err
+		}
+
+		new, err := d.resolveRefHash(u.Name, updated, packed)
+		if err != nil {
+			return err
+		}
+
+		if old == new {
+			continue
+		}
+
+		e := *u.Reflog
+		e.Old, e.New = old, new
+		if err := d.AppendReflog(u.Name, &e); err != nil {
+			return err
+		}
+
+		if _, ok := updated[core.HEAD]; ok {
+			// HEAD is logged by itself, no need to follow it
+			continue
+		}
+
+		if !headRead {
+			if head, err = d.currentRef(core.HEAD, packed); err != nil {
+				return err
+			}
+
+			headRead = true
+		}
+
+		if head == nil || head.Type() != core.SymbolicReference ||
+			head.Target() != u.Name {
+			continue
+		}
+
+		if err := d.AppendReflog(core.HEAD, &e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveRefHash returns the hash pointed by a reference following the
+// symbolic references, the values in updated are used instead of the stored
+// ones. ZeroHash is returned if it can't be resolved.
+func (d *DotGit) resolveRefHash(
+	name core.ReferenceName,
+	updated map[core.ReferenceName]*core.Reference,
+	packed []*packedRef,
+) (core.Hash, error) {
+	for i := 0; i < maxResolveRecursion; i++ {
+		ref, ok := updated[name]
+		if !ok {
+			var err error
+			if ref, err = d.currentRef(name, packed); err != nil {
+				return core.ZeroHash, err
+			}
+		}
+
+		if ref == nil {
+			return core.ZeroHash, nil
+		}
+
+		if ref.Type() == core.HashReference {
+			return ref.Hash(), nil
+		}
+
+		name = ref.Target()
+	}
+
+	return core.ZeroHash, nil
+}
+
+// removeReflog deletes the reflog of a reference, if any.
+func (d *DotGit) removeReflog(name core.ReferenceName) error {
+	err := d.fs.Remove(d.reflogPath(name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (d *DotGit) reflogPath(name core.ReferenceName) string {
+	return d.fs.Join(logsPath, name.String())
+}
+
+// encodeReflogEntry returns the line of a reflog entry:
+// "<old> <new> <committer>\t<message>\n", the message is kept in a single line.
+func encodeReflogEntry(e *core.ReflogEntry) []byte {
+	msg := strings.Replace(strings.TrimSpace(e.Message), "\n", " ", -1)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s %s", e.Old, e.New, e.Committer)
+	if msg != "" {
+		fmt.Fprintf(&b, "\t%s", msg)
+	}
+
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+func decodeReflogEntry(line []byte) (*core.ReflogEntry, error) {
+	// two hashes of 40 hex chars, each one followed by a space
+	const hashesLength = 82
+	if len(line) < hashesLength || line[40] != ' ' || line[81] != ' ' {
+		return nil, ErrReflogBadFormat
+	}
+
+	e := &core.ReflogEntry{
+		Old: core.NewHash(string(line[:40])),
+		New: core.NewHash(string(line[41:81])),
+	}
+
+	rest := line[hashesLength:]
+	if tab := bytes.IndexByte(rest, '\t'); tab != -1 {
+		e.Message = string(rest[tab+1:])
+		rest = rest[:tab]
+	}
+
+	e.Committer = append([]byte(nil), rest...)
+	return e, nil
+}
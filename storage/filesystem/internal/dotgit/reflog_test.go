@@ -0,0 +1,216 @@
+package dotgit
+
+import (
+	"io/ioutil"
+	"os"
+
+	"gopkg.in/src-d/go-git.v4/core"
+	osfs "gopkg.in/src-d/go-git.v4/utils/fs/os"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *SuiteDotGit) TestAppendReflog(c *C) {
+	tmp, err := ioutil.TempDir("", "dot-git")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(tmp)
+
+	fs := osfs.NewOS(tmp)
+	dir := New(fs)
+
+	name := core.ReferenceName("refs/heads/master")
+	first := &core.ReflogEntry{
+		New:       core.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881"),
+		Committer: []byte("foo <foo@example.com> 1257894000 +0100"),
+		Message:   "clone: from https://github.com/git-fixtures/basic.git",
+	}
+
+	second := &core.ReflogEntry{
+		Old:       core.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881"),
+		New:       core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		Committer: []byte("foo <foo@example.com> 1257894100 +0100"),
+		Message:   "pull: fast-forward\n",
+	}
+
+	c.Assert(dir.AppendReflog(name, first), IsNil)
+	c.Assert(dir.AppendReflog(name, second), IsNil)
+
+	f, err := fs.Open("logs/refs/heads/master")
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadAll(f)
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+	c.Assert(string(content), Equals, ""+
+		"0000000000000000000000000000000000000000 e8d3ffab552895c19b9fcf7aa264d277cde33881 foo <foo@example.com> 1257894000 +0100\tclone: from https://github.com/git-fixtures/basic.git\n"+
+		"e8d3ffab552895c19b9fcf7aa264d277cde33881 6ecf0ef2c2dffb796033e5a02219af86ec6584e5 foo <foo@example.com> 1257894100 +0100\tpull: fast-forward\n",
+	)
+
+	entries, err := dir.Reflog(name)
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 2)
+	c.Assert(entries[0], DeepEquals, first)
+	c.Assert(entries[1].Old, Equals, second.Old)
+	c.Assert(entries[1].New, Equals, second.New)
+	c.Assert(string(entries[1].Committer), Equals, string(second.Committer))
+	c.Assert(entries[1].Message, Equals, "pull: fast-forward")
+}
+
+func (s *SuiteDotGit) TestReflogNotFound(c *C) {
+	tmp, err := ioutil.TempDir("", "dot-git")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(tmp)
+
+	dir := New(osfs.NewOS(tmp))
+	entries, err := dir.Reflog("refs/heads/master")
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 0)
+}
+
+func (s *SuiteDotGit) TestReflogBadFormat(c *C) {
+	tmp, err := ioutil.TempDir("", "dot-git")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(tmp)
+
+	fs := osfs.NewOS(tmp)
+	dir := New(fs)
+
+	f, err := fs.Create("logs/HEAD")
+	c.Assert(err, IsNil)
+	_, err = f.Write([]byte("foo bar\n"))
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	_, err = dir.Reflog(core.HEAD)
+	c.Assert(err, Equals, ErrReflogBadFormat)
+}
+
+func (s *SuiteDotGit) TestSetReflog(c *C) {
+	tmp, err := ioutil.TempDir("", "dot-git")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(tmp)
+
+	fs := osfs.NewOS(tmp)
+	dir := New(fs)
+
+	e := &core.ReflogEntry{
+		New:       core.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881"),
+		Committer: []byte("foo <foo@example.com> 1257894000 +0100"),
+		Message:   "commit: foo",
+	}
+
+	c.Assert(dir.AppendReflog(core.HEAD, e), IsNil)
+	c.Assert(dir.AppendReflog(core.HEAD, e), IsNil)
+	c.Assert(dir.SetReflog(core.HEAD, []*core.ReflogEntry{e}), IsNil)
+
+	entries, err := dir.Reflog(core.HEAD)
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 1)
+
+	_, err = fs.Stat("logs/HEAD.lock")
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *SuiteDotGit) TestRemoveRefRemovesReflog(c *C) {
+	tmp, err := ioutil.TempDir("", "dot-git")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(tmp)
+
+	fs := osfs.NewOS(tmp)
+	dir := New(fs)
+
+	ref := core.NewReferenceFromStrings(
+		"refs/heads/foo",
+		"e8d3ffab552895c19b9fcf7aa264d277cde33881",
+	)
+	c.Assert(dir.SetRef(ref), IsNil)
+	c.Assert(dir.AppendReflog(ref.Name(), &core.ReflogEntry{
+		New:       ref.Hash(),
+		Committer: []byte("foo <foo@example.com> 1257894000 +0100"),
+	}), IsNil)
+
+	c.Assert(dir.RemoveRef(ref.Name()), IsNil)
+
+	_, err = fs.Stat("logs/refs/heads/foo")
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *SuiteDotGit) TestUpdateRefsReflog(c *C) {
+	tmp, err := ioutil.TempDir("", "dot-git")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(tmp)
+
+	dir := New(osfs.NewOS(tmp))
+
+	old := core.NewReferenceFromStrings(
+		"refs/heads/master",
+		"e8d3ffab552895c19b9fcf7aa264d277cde33881",
+	)
+	c.Assert(dir.SetRef(old), IsNil)
+	c.Assert(dir.PackRefs(), IsNil)
+	c.Assert(dir.SetRef(core.NewSymbolicReference(core.HEAD, old.Name())), IsNil)
+
+	new := core.NewReferenceFromStrings(
+		"refs/heads/master",
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+	)
+	e := &core.ReflogEntry{
+		Committer: []byte("foo <foo@example.com> 1257894000 +0100"),
+		Message:   "commit: foo",
+	}
+
+	c.Assert(dir.UpdateRefs([]*RefUpdate{
+		{Name: new.Name(), New: new, Reflog: e},
+	}), IsNil)
+
+	c.Assert(dir.UpdateRefs([]*RefUpdate{
+		{Name: new.Name(), New: new, Reflog: e},
+	}), IsNil)
+
+	for _, n := range []core.ReferenceName{new.Name(), core.HEAD} {
+		entries, err := dir.Reflog(n)
+		c.Assert(err, IsNil)
+		c.Assert(entries, HasLen, 1)
+		c.Assert(entries[0].Old, Equals, old.Hash())
+		c.Assert(entries[0].New, Equals, new.Hash())
+		c.Assert(entries[0].Message, Equals, e.Message)
+	}
+}
+
+func (s *SuiteDotGit) TestUpdateRefsReflogError(c *C) {
+	tmp, err := ioutil.TempDir("", "dot-git")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(tmp)
+
+	fs := osfs.NewOS(tmp)
+	dir := New(fs)
+
+	old := core.NewReferenceFromStrings(
+		"refs/heads/foo",
+		"e8d3ffab552895c19b9fcf7aa264d277cde33881",
+	)
+	c.Assert(dir.SetRef(old), IsNil)
+
+	// a directory in place of the reflog, so it can't be appended
+	f, err := fs.Create("logs/refs/heads/foo/bar")
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	err = dir.UpdateRefs([]*RefUpdate{{
+		Name: old.Name(),
+		New: core.NewReferenceFromStrings(
+			"refs/heads/foo",
+			"6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+		),
+		Reflog: &core.ReflogEntry{
+			Committer: []byte("foo <foo@example.com> 1257894000 +0100"),
+		},
+	}})
+	c.Assert(err, NotNil)
+
+	ref, err := dir.Ref(old.Name())
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash(), Equals, old.Hash())
+
+	_, err = fs.Stat("refs/heads/foo.lock")
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
@@ -16,6 +16,7 @@ type PackWriter struct {
 	Notify func(h core.Hash, i idxfile.Idxfile)
 
 	fs       fs.Filesystem
+	objects  string
 	fr, fw   fs.File
 	synced   *syncedReader
 	checksum core.Hash
@@ -23,8 +24,8 @@ type PackWriter struct {
 	result   chan error
 }
 
-func newPackWrite(fs fs.Filesystem) (*PackWriter, error) {
-	fw, err := fs.TempFile(fs.Join(objectsPath, packPath), "tmp_pack_")
+func newPackWrite(fs fs.Filesystem, objects string) (*PackWriter, error) {
+	fw, err := fs.TempFile(fs.Join(objects, packPath), "tmp_pack_")
 	if err != nil {
 		return nil, err
 	}
@@ -35,11 +36,12 @@ func newPackWrite(fs fs.Filesystem) (*PackWriter, error) {
 	}
 
 	writer := &PackWriter{
-		fs:     fs,
-		fw:     fw,
-		fr:     fr,
-		synced: newSyncedReader(fw, fr),
-		result: make(chan error),
+		fs:      fs,
+		objects: objects,
+		fw:      fw,
+		fr:      fr,
+		synced:  newSyncedReader(fw, fr),
+		result:  make(chan error),
 	}
 
 	go writer.buildIndex()
@@ -103,7 +105,7 @@ func (w *PackWriter) Close() error {
 }
 
 func (w *PackWriter) save() error {
-	base := w.fs.Join(objectsPath, packPath, fmt.Sprintf("pack-%s", w.checksum))
+	base := w.fs.Join(w.objects, packPath, fmt.Sprintf("pack-%s", w.checksum))
 	idx, err := w.fs.Create(fmt.Sprintf("%s.idx", base))
 	if err != nil {
 		return err
@@ -205,7 +207,7 @@ func (s *syncedReader) Seek(offset int64, whence int) (int64, error) {
 	}
 
 	p, err := s.r.Seek(offset, whence)
-	s.read = uint64(p)
+	atomic.StoreUint64(&s.read, uint64(p))
 
 	return p, err
 }
@@ -218,20 +220,25 @@ func (s *syncedReader) Close() error {
 
 type ObjectWriter struct {
 	objfile.Writer
-	fs fs.Filesystem
-	f  fs.File
+	fs      fs.Filesystem
+	objects string
+	f       fs.File
+
+	// staged writers are not moved to the final location on Close
+	staged bool
 }
 
-func newObjectWriter(fs fs.Filesystem) (*ObjectWriter, error) {
-	f, err := fs.TempFile(fs.Join(objectsPath, packPath), "tmp_obj_")
+func newObjectWriter(fs fs.Filesystem, objects string) (*ObjectWriter, error) {
+	f, err := fs.TempFile(fs.Join(objects, packPath), "tmp_obj_")
 	if err != nil {
 		return nil, err
 	}
 
 	return &ObjectWriter{
-		Writer: (*objfile.NewWriter(f)),
-		fs:     fs,
-		f:      f,
+		Writer:  (*objfile.NewWriter(f)),
+		fs:      fs,
+		objects: objects,
+		f:       f,
 	}, nil
 }
 
@@ -244,12 +251,33 @@ func (w *ObjectWriter) Close() error {
 		return err
 	}
 
+	if w.staged {
+		return nil
+	}
+
+	return w.save()
+}
+
+// Open opens the temporary file of a staged object for reading, the file
+// contains the compressed object as it will be stored.
+func (w *ObjectWriter) Open() (fs.File, error) {
+	return w.fs.Open(w.f.Filename())
+}
+
+// Commit moves a staged object, already closed, to its final location.
+func (w *ObjectWriter) Commit() error {
 	return w.save()
 }
 
+// Rollback discards a staged object, already closed, removing its temporary
+// file.
+func (w *ObjectWriter) Rollback() error {
+	return w.fs.Remove(w.f.Filename())
+}
+
 func (w *ObjectWriter) save() error {
 	hash := w.Hash().String()
-	file := w.fs.Join(objectsPath, hash[0:2], hash[2:40])
+	file := w.fs.Join(w.objects, hash[0:2], hash[2:40])
 
 	return w.fs.Rename(w.f.Filename(), file)
 }
@@ -0,0 +1,58 @@
+// +build linux
+
+package filesystem
+
+import (
+	"io"
+	"syscall"
+
+	"gopkg.in/src-d/go-git.v4/utils/fs"
+)
+
+// mmapFile maps the content of the file in memory, it's only possible when
+// the file is backed by the os filesystem.
+func mmapFile(f fs.File, size int64) (*mmapReader, bool) {
+	fd, ok := f.(interface {
+		Fd() uintptr
+	})
+
+	if !ok || size <= 0 || int64(int(size)) != size {
+		return nil, false
+	}
+
+	data, err := syscall.Mmap(
+		int(fd.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED,
+	)
+
+	if err != nil {
+		return nil, false
+	}
+
+	return &mmapReader{data: data}, true
+}
+
+// mmapReader is an io.ReaderAt over a memory mapped file
+type mmapReader struct {
+	data []byte
+}
+
+func (r *mmapReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, syscall.EINVAL
+	}
+
+	if off >= int64(len(r.data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, r.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+func (r *mmapReader) Close() error {
+	return syscall.Munmap(r.data)
+}
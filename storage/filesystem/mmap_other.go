@@ -0,0 +1,19 @@
+// +build !linux
+
+package filesystem
+
+import (
+	"io"
+
+	"gopkg.in/src-d/go-git.v4/utils/fs"
+)
+
+type mmapReader struct {
+	io.ReaderAt
+	io.Closer
+}
+
+// mmapFile is only supported on linux
+func mmapFile(f fs.File, size int64) (*mmapReader, bool) {
+	return nil, false
+}
@@ -1,8 +1,16 @@
 package filesystem
 
 import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"hash/crc32"
 	"io"
 	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"gopkg.in/src-d/go-git.v4/core"
 	"gopkg.in/src-d/go-git.v4/formats/idxfile"
@@ -10,6 +18,7 @@ import (
 	"gopkg.in/src-d/go-git.v4/formats/packfile"
 	"gopkg.in/src-d/go-git.v4/storage/filesystem/internal/dotgit"
 	"gopkg.in/src-d/go-git.v4/storage/memory"
+	"gopkg.in/src-d/go-git.v4/utils/cache"
 	"gopkg.in/src-d/go-git.v4/utils/fs"
 )
 
@@ -18,46 +27,374 @@ import (
 //
 // Zero values of this type are not safe to use, see the New function below.
 //
-// Currently only reads are supported, no writting.
+// The loose objects are always read from disk, the packfiles are scanned when
+// the storage is opened and again when an object is not found and the
+// packfiles directory changed, so the packfiles added by other processes, as
+// a git fetch, are found. Refresh rescans the packfiles explicitly.
 //
-// Also values from this type are not yet able to track changes on disk, this is,
-// Gitdir values will get outdated as soon as repositories change on disk.
+// An ObjectStorage is safe for concurrent use by multiple goroutines, except
+// its transactions.
 type ObjectStorage struct {
-	dir   *dotgit.DotGit
-	index map[core.Hash]index
+	dir *dotgit.DotGit
+	// m protects index, packsTime, scanTime and alternates
+	m     sync.RWMutex
+	index map[core.Hash]*packIndex
+	// packsTime is the modification time of the packfiles directory when it
+	// was scanned, and scanTime the time of the scan
+	packsTime time.Time
+	scanTime  time.Time
+	// cache holds the objects read from the packfiles, including the bases
+	// of the deltas, shared across all the packfiles
+	cache cache.Object
+	packs *packPool
+	// objects bigger than largeObjectThreshold are streamed from disk, if
+	// negative all the objects are loaded in memory
+	largeObjectThreshold int64
+
+	options Options
+	// alternates are the object storages of the repositories listed in
+	// objects/info/alternates, including the nested ones
+	alternates []*ObjectStorage
 }
 
-func newObjectStorage(dir *dotgit.DotGit) (*ObjectStorage, error) {
+var (
+	// ErrPackfileChecksumMismatch is returned by VerifyObjectPack when the
+	// checksum of a packfile doesn't match its content or its name
+	ErrPackfileChecksumMismatch = errors.New("packfile checksum mismatch")
+	// ErrPackfileCRC32Mismatch is returned by VerifyObjectPack when the CRC32
+	// of an entry of a packfile doesn't match the one of its idx file
+	ErrPackfileCRC32Mismatch = errors.New("packfile entry CRC32 mismatch")
+)
+
+// maxAlternatesDepth is the maximum level of nested alternates followed, as
+// git does
+const maxAlternatesDepth = 5
+
+// packsTimeGranularity is the coarsest granularity of the modification times
+// of the filesystems, the packfiles directory is rescanned until it's older
+// than this at scan time, since a change made within it may keep its time.
+const packsTimeGranularity = 2 * time.Second
+
+func newObjectStorage(dir *dotgit.DotGit, o Options) (*ObjectStorage, error) {
+	if o.AlternatesFilesystem != nil {
+		dir.SetAlternatesRoot(o.AlternatesFilesystem)
+	}
+
+	s, err := openObjectStorage(dir, o)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.loadAlternates(); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// openObjectStorage returns an ObjectStorage without alternates.
+func openObjectStorage(dir *dotgit.DotGit, o Options) (*ObjectStorage, error) {
 	s := &ObjectStorage{
 		dir:   dir,
-		index: make(map[core.Hash]index, 0),
+		index: make(map[core.Hash]*packIndex, 0),
+		cache: o.ObjectCache,
+		packs: newPackPool(dir, o.MaxOpenPacks, o.MmapPacks),
+
+		largeObjectThreshold: o.LargeObjectThreshold,
+		options:              o,
 	}
+
+	if s.largeObjectThreshold == 0 {
+		s.largeObjectThreshold = DefaultLargeObjectThreshold
+	}
+
 	return s, s.loadIdxFiles()
 }
 
-func (s *ObjectStorage) loadIdxFiles() error {
-	packs, err := s.dir.ObjectPacks()
+// loadAlternates opens the object storages of the alternates not opened yet,
+// the nested alternates are followed up to maxAlternatesDepth levels and every
+// object directory is opened once. The opened storages are kept, since they
+// may be in use by the readers, s.m must be held for writing.
+func (s *ObjectStorage) loadAlternates() error {
+	path, err := s.dir.ObjectsPath()
 	if err != nil {
 		return err
 	}
 
-	for _, h := range packs {
-		if err := s.loadIdxFile(h); err != nil {
+	seen := map[string]bool{path: true}
+	for _, as := range s.alternates {
+		path, err := as.dir.ObjectsPath()
+		if err != nil {
 			return err
 		}
+
+		seen[path] = true
 	}
 
+	var opened []*ObjectStorage
+	level := []*dotgit.DotGit{s.dir}
+	for depth := 0; depth < maxAlternatesDepth && len(level) != 0; depth++ {
+		var next []*dotgit.DotGit
+		for _, dir := range level {
+			alternates, err := dir.Alternates()
+			if err != nil {
+				closeStorages(opened)
+				return err
+			}
+
+			for _, alt := range alternates {
+				path, err := alt.ObjectsPath()
+				if err != nil {
+					closeStorages(opened)
+					return err
+				}
+
+				if seen[path] {
+					continue
+				}
+
+				seen[path] = true
+				as, err := openObjectStorage(alt, s.options)
+				if err != nil {
+					closeStorages(opened)
+					return err
+				}
+
+				opened = append(opened, as)
+				next = append(next, alt)
+			}
+		}
+
+		level = next
+	}
+
+	// a new slice is set, the readers may be iterating the current one
+	alternates := make([]*ObjectStorage, 0, len(s.alternates)+len(opened))
+	s.alternates = append(append(alternates, s.alternates...), opened...)
 	return nil
 }
 
-func (s *ObjectStorage) loadIdxFile(h core.Hash) error {
-	idx, err := s.dir.ObjectPackIdx(h)
+func closeStorages(storages []*ObjectStorage) {
+	for _, s := range storages {
+		s.Close()
+	}
+}
+
+// AddAlternate adds the given object directory to objects/info/alternates,
+// the objects of the alternate are available from this storage from now on.
+func (s *ObjectStorage) AddAlternate(path string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if err := s.dir.AddAlternate(path); err != nil {
+		return err
+	}
+
+	return s.loadAlternates()
+}
+
+// AlternateReferences returns the references of the repositories of the
+// alternates.
+func (s *ObjectStorage) AlternateReferences() ([]*core.Reference, error) {
+	var refs []*core.Reference
+	for _, as := range s.alternateStorages() {
+		r, err := as.dir.Refs()
+		if err != nil {
+			return nil, err
+		}
+
+		refs = append(refs, r...)
+	}
+
+	return refs, nil
+}
+
+// alternateStorages returns the object storages of the alternates.
+func (s *ObjectStorage) alternateStorages() []*ObjectStorage {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	return s.alternates
+}
+
+func (s *ObjectStorage) loadIdxFiles() error {
+	_, err := s.refresh()
+	return err
+}
+
+// Refresh rescans the packfiles directory of the storage and its alternates,
+// the idx files of the new packfiles are loaded and the deleted packfiles are
+// released.
+func (s *ObjectStorage) Refresh() error {
+	if err := s.loadIdxFiles(); err != nil {
+		return err
+	}
+
+	for _, as := range s.alternateStorages() {
+		if err := as.Refresh(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// refresh rescans the packfiles directory, returns true if new packfiles were
+// found. The directory is listed and the new idx files are read without
+// holding s.m, so the readers aren't blocked meanwhile.
+func (s *ObjectStorage) refresh() (bool, error) {
+	// the times are taken before listing the directory, so the changes made
+	// meanwhile are found on the next scan
+	now := time.Now()
+	t, err := s.dir.ObjectPacksTime()
+	if err != nil {
+		return false, err
+	}
+
+	// the packfiles added by Writer after the listing are not released
+	known := s.indexedPacks()
+	packs, err := s.dir.ObjectPacks()
+	if err != nil {
+		return false, err
+	}
+
+	found := make(map[core.Hash]bool, len(packs))
+	loaded := make(map[core.Hash]*packIndex, 0)
+	for _, h := range packs {
+		found[h] = true
+		if known[h] != nil {
+			continue
+		}
+
+		idx, err := s.openIdxFile(h)
+		if err == dotgit.ErrPackfileNotFound {
+			// the idx file is written after the packfile
+			continue
+		}
+
+		if err != nil {
+			releaseIndexes(loaded)
+			return false, err
+		}
+
+		loaded[h] = idx
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	var added bool
+	for h, idx := range loaded {
+		if _, ok := s.index[h]; ok {
+			idx.release()
+			continue
+		}
+
+		s.index[h] = idx
+		added = true
+	}
+
+	for h, idx := range known {
+		if found[h] || s.index[h] != idx {
+			continue
+		}
+
+		if err := s.releasePack(h); err != nil {
+			return added, err
+		}
+	}
+
+	if now.After(s.scanTime) {
+		s.packsTime, s.scanTime = t, now
+	}
+
+	return added, nil
+}
+
+// packsChanged returns true if the packfiles directory may have changed since
+// the last scan: its modification time is not the scanned one, or it was
+// scanned within packsTimeGranularity of it.
+func (s *ObjectStorage) packsChanged() (bool, error) {
+	t, err := s.dir.ObjectPacksTime()
 	if err != nil {
+		return false, err
+	}
+
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	return !t.Equal(s.packsTime) || s.scanTime.Sub(s.packsTime) < packsTimeGranularity, nil
+}
+
+// indexedPacks returns the indexes of the loaded packfiles.
+func (s *ObjectStorage) indexedPacks() map[core.Hash]*packIndex {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	packs := make(map[core.Hash]*packIndex, len(s.index))
+	for h, idx := range s.index {
+		packs[h] = idx
+	}
+
+	return packs
+}
+
+func releaseIndexes(indexes map[core.Hash]*packIndex) {
+	for _, idx := range indexes {
+		idx.release()
+	}
+}
+
+// releasePack closes the given packfile, its objects are no longer looked up
+// and its idx file is closed once released by the readers using it. s.m must
+// be held for writing.
+func (s *ObjectStorage) releasePack(pack core.Hash) error {
+	if err := s.packs.Remove(pack); err != nil {
 		return err
 	}
 
-	s.index[h] = make(index)
-	return s.index[h].Decode(idx)
+	idx, ok := s.index[pack]
+	if !ok {
+		return nil
+	}
+
+	delete(s.index, pack)
+	return idx.release()
+}
+
+// acquireIndex returns the index of the given packfile, it must be released
+// once it's no longer used.
+func (s *ObjectStorage) acquireIndex(pack core.Hash) (*packIndex, bool) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	idx, ok := s.index[pack]
+	if ok {
+		idx.acquire()
+	}
+
+	return idx, ok
+}
+
+// openIdxFile reads the idx file of the given packfile.
+func (s *ObjectStorage) openIdxFile(h core.Hash) (*packIndex, error) {
+	f, err := s.dir.ObjectPackIdx(h)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := idxfile.NewIndex(readerAt(f))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if s.options.ReverseIndex {
+		idx.EnableReverseIndex()
+	}
+
+	return newPackIndex(idx, f), nil
 }
 
 func (s *ObjectStorage) NewObject() core.Object {
@@ -72,10 +409,30 @@ func (s *ObjectStorage) Writer() (io.WriteCloser, error) {
 	}
 
 	w.Notify = func(h core.Hash, idx idxfile.Idxfile) {
-		s.index[h] = make(index)
-		for _, e := range idx.Entries {
-			s.index[h][e.Hash] = int64(e.Offset)
+		// the idx file is already on disk, but since Notify can't fail the
+		// index is built from the idx in memory
+		buf := bytes.NewBuffer(nil)
+		if _, err := idxfile.NewEncoder(buf).Encode(&idx); err != nil {
+			return
+		}
+
+		i, err := idxfile.NewIndex(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			return
 		}
+
+		if s.options.ReverseIndex {
+			i.EnableReverseIndex()
+		}
+
+		s.m.Lock()
+		defer s.m.Unlock()
+
+		if old, ok := s.index[h]; ok {
+			old.release()
+		}
+
+		s.index[h] = newPackIndex(i, nil)
 	}
 
 	return w, nil
@@ -87,29 +444,49 @@ func (s *ObjectStorage) Set(o core.Object) (core.Hash, error) {
 		return core.ZeroHash, core.ErrInvalidType
 	}
 
-	ow, err := s.dir.NewObject()
+	ow, err := stageObject(s.dir, o)
 	if err != nil {
 		return core.ZeroHash, err
 	}
 
-	defer ow.Close()
+	return o.Hash(), ow.Commit()
+}
+
+// stageObject writes the object to a temporary file, the returned writer is
+// already closed and it should be committed or rolled back.
+func stageObject(dir *dotgit.DotGit, o core.Object) (*dotgit.ObjectWriter, error) {
+	ow, err := dir.NewStagedObject()
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeObject(ow, o)
+	if errClose := ow.Close(); err == nil {
+		err = errClose
+	}
 
+	if err != nil {
+		ow.Rollback()
+		return nil, err
+	}
+
+	return ow, nil
+}
+
+func writeObject(ow *dotgit.ObjectWriter, o core.Object) error {
 	or, err := o.Reader()
 	if err != nil {
-		return core.ZeroHash, err
+		return err
 	}
 
 	defer or.Close()
 
 	if err := ow.WriteHeader(o.Type(), o.Size()); err != nil {
-		return core.ZeroHash, err
-	}
-
-	if _, err := io.Copy(ow, or); err != nil {
-		return core.ZeroHash, err
+		return err
 	}
 
-	return o.Hash(), nil
+	_, err = io.Copy(ow, or)
+	return err
 }
 
 // Get returns the object with the given hash, by searching for it in
@@ -120,6 +497,14 @@ func (s *ObjectStorage) Get(t core.ObjectType, h core.Hash) (core.Object, error)
 		obj, err = s.getFromPackfile(h)
 	}
 
+	if err == core.ErrObjectNotFound {
+		obj, err = s.getFromAlternates(h)
+	}
+
+	if err == core.ErrObjectNotFound {
+		obj, err = s.getFromNewPackfiles(h)
+	}
+
 	if err != nil {
 		return nil, err
 	}
@@ -131,6 +516,56 @@ func (s *ObjectStorage) Get(t core.ObjectType, h core.Hash) (core.Object, error)
 	return obj, nil
 }
 
+// getFromNewPackfiles rescans the packfiles directory if it changed since the
+// last scan, and looks up the object again if new packfiles were found.
+func (s *ObjectStorage) getFromNewPackfiles(h core.Hash) (core.Object, error) {
+	changed, err := s.packsChanged()
+	if err != nil {
+		return nil, err
+	}
+
+	if !changed {
+		return nil, core.ErrObjectNotFound
+	}
+
+	added, err := s.refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	if !added {
+		return nil, core.ErrObjectNotFound
+	}
+
+	return s.getFromPackfile(h)
+}
+
+func (s *ObjectStorage) getFromAlternates(h core.Hash) (core.Object, error) {
+	for _, as := range s.alternateStorages() {
+		obj, err := as.Get(core.AnyObject, h)
+		if err == core.ErrObjectNotFound {
+			continue
+		}
+
+		return obj, err
+	}
+
+	return nil, core.ErrObjectNotFound
+}
+
+// contains returns true if the object is stored in this storage, without
+// looking into the alternates.
+func (s *ObjectStorage) contains(h core.Hash) bool {
+	f, err := s.dir.Object(h)
+	if err == nil {
+		f.Close()
+		return true
+	}
+
+	_, _, _, err = s.findObjectInPackfile(h)
+	return err == nil
+}
+
 func (s *ObjectStorage) getFromUnpacked(h core.Hash) (obj core.Object, err error) {
 	f, err := s.dir.Object(h)
 	if err != nil {
@@ -143,7 +578,6 @@ func (s *ObjectStorage) getFromUnpacked(h core.Hash) (obj core.Object, err error
 
 	defer f.Close()
 
-	obj = s.NewObject()
 	r, err := objfile.NewReader(f)
 	if err != nil {
 		return nil, err
@@ -156,6 +590,37 @@ func (s *ObjectStorage) getFromUnpacked(h core.Hash) (obj core.Object, err error
 		return nil, err
 	}
 
+	if s.isLargeObject(size) {
+		return newLooseObject(s.dir, h, t, size), nil
+	}
+
+	return readObjectContent(s.NewObject(), t, size, r)
+}
+
+// isLargeObject returns true if an object of the given size should be
+// streamed from disk instead of being loaded in memory.
+func (s *ObjectStorage) isLargeObject(size int64) bool {
+	return s.largeObjectThreshold > 0 && size >= s.largeObjectThreshold
+}
+
+// readObjectFile decodes the compressed object read from f into obj.
+func readObjectFile(obj core.Object, f io.Reader) (core.Object, error) {
+	r, err := objfile.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+
+	t, size, err := r.Header()
+	if err != nil {
+		return nil, err
+	}
+
+	return readObjectContent(obj, t, size, r)
+}
+
+func readObjectContent(obj core.Object, t core.ObjectType, size int64, r io.Reader) (core.Object, error) {
 	obj.SetType(t)
 	obj.SetSize(size)
 	w, err := obj.Writer()
@@ -170,36 +635,309 @@ func (s *ObjectStorage) getFromUnpacked(h core.Hash) (obj core.Object, err error
 // Get returns the object with the given hash, by searching for it in
 // the packfile.
 func (s *ObjectStorage) getFromPackfile(h core.Hash) (core.Object, error) {
-	pack, offset := s.findObjectInPackfile(h)
-	if offset == -1 {
-		return nil, core.ErrObjectNotFound
+	if s.packs.Closed() {
+		return nil, ErrStorageClosed
 	}
 
-	f, err := s.dir.ObjectPack(pack)
+	pack, idx, offset, err := s.findObjectInPackfile(h)
 	if err != nil {
 		return nil, err
 	}
 
-	defer f.Close()
+	defer idx.release()
+
+	if s.cache != nil {
+		if obj, ok := s.cache.Get(h); ok {
+			return obj, nil
+		}
+	}
+
+	f, err := s.packs.Get(pack)
+	if err != nil {
+		return nil, err
+	}
 
-	p := packfile.NewScanner(f)
+	defer s.packs.Put(f)
+
+	if s.largeObjectThreshold > 0 {
+		obj, err := s.getLargeObjectFromPackfile(f, pack, offset, h)
+		if obj != nil || err != nil {
+			return obj, err
+		}
+	}
+
+	p := packfile.NewScanner(f.Reader())
 	d, err := packfile.NewDecoder(p, memory.NewStorage().ObjectStorage())
 	if err != nil {
 		return nil, err
 	}
 
-	d.SetOffsets(s.index[pack])
+	d.SetIndex(idx)
+	if s.cache != nil {
+		d.SetCache(s.cache)
+	}
+
 	return d.ReadObjectAt(offset)
 }
 
-func (s *ObjectStorage) findObjectInPackfile(h core.Hash) (core.Hash, int64) {
+// getLargeObjectFromPackfile returns a streamed object if the object at the
+// given offset is bigger than the large object threshold and is not a delta,
+// the deltas are always loaded in memory since they require its base.
+func (s *ObjectStorage) getLargeObjectFromPackfile(
+	f *openPack, pack core.Hash, offset int64, h core.Hash,
+) (core.Object, error) {
+	p := packfile.NewScanner(f.Reader())
+	if _, err := p.Seek(offset); err != nil {
+		return nil, err
+	}
+
+	header, err := p.NextObjectHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	switch header.Type {
+	case core.OFSDeltaObject, core.REFDeltaObject:
+		return nil, nil
+	}
+
+	if !s.isLargeObject(header.Length) {
+		return nil, nil
+	}
+
+	return newPackedObject(s.packs, pack, offset, h, header.Type, header.Length), nil
+}
+
+// findObjectInPackfile returns the packfile containing the given object, its
+// index and the offset of the object. The index must be released once it's no
+// longer used.
+func (s *ObjectStorage) findObjectInPackfile(h core.Hash) (core.Hash, *packIndex, int64, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
 	for packfile, index := range s.index {
-		if offset, ok := index[h]; ok {
-			return packfile, offset
+		offset, err := index.FindOffset(h)
+		if err == core.ErrObjectNotFound {
+			continue
+		}
+
+		if err != nil {
+			return core.ZeroHash, nil, -1, err
+		}
+
+		index.acquire()
+		return packfile, index, offset, nil
+	}
+
+	return core.ZeroHash, nil, -1, core.ErrObjectNotFound
+}
+
+// Close closes the packfiles and idx files kept open by the storage and its
+// alternates.
+func (s *ObjectStorage) Close() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	err := s.packs.Close()
+	for _, as := range s.alternates {
+		if errClose := as.Close(); err == nil {
+			err = errClose
+		}
+	}
+
+	for _, idx := range s.index {
+		if errClose := idx.release(); err == nil {
+			err = errClose
+		}
+	}
+
+	return err
+}
+
+// ObjectPacks returns the hashes of the packfiles of the storage, the
+// packfiles of the alternates are not included.
+func (s *ObjectStorage) ObjectPacks() ([]core.Hash, error) {
+	if _, err := s.refresh(); err != nil {
+		return nil, err
+	}
+
+	return s.dir.ObjectPacks()
+}
+
+// ObjectPackHashes returns the hashes of the objects of the given packfile.
+func (s *ObjectStorage) ObjectPackHashes(pack core.Hash) ([]core.Hash, error) {
+	idx, ok := s.acquireIndex(pack)
+	if !ok {
+		return nil, dotgit.ErrPackfileNotFound
+	}
+
+	defer idx.release()
+	return idx.Hashes()
+}
+
+// ObjectPackTime returns the last modification time of the given packfile.
+func (s *ObjectStorage) ObjectPackTime(pack core.Hash) (time.Time, error) {
+	return s.dir.ObjectPackTime(pack)
+}
+
+// DeleteObjectPack closes and deletes the given packfile and its idx file.
+func (s *ObjectStorage) DeleteObjectPack(pack core.Hash) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if err := s.releasePack(pack); err != nil {
+		return err
+	}
+
+	return s.dir.DeleteObjectPack(pack)
+}
+
+// VerifyObjectPack checks that the checksum at the end of the given packfile
+// matches its content and its name, and that the CRC32 of every entry matches
+// the one stored in its idx file.
+func (s *ObjectStorage) VerifyObjectPack(pack core.Hash) error {
+	idx, ok := s.acquireIndex(pack)
+	if !ok {
+		return dotgit.ErrPackfileNotFound
+	}
+
+	defer idx.release()
+	p, err := s.packs.Get(pack)
+	if err != nil {
+		return err
+	}
+
+	defer s.packs.Put(p)
+
+	if err := verifyPackChecksum(p); err != nil {
+		return err
+	}
+
+	return verifyPackCRC32s(p, idx.Index)
+}
+
+// packHeaderSize and packFooterSize are the sizes of the signature, version
+// and object count at the beginning of a packfile and of its checksum at the
+// end.
+const (
+	packHeaderSize = 12
+	packFooterSize = 20
+)
+
+func verifyPackChecksum(p *openPack) error {
+	if p.size < packHeaderSize+packFooterSize {
+		return ErrPackfileChecksumMismatch
+	}
+
+	r := p.Reader()
+	h := sha1.New()
+	if _, err := io.CopyN(h, r, p.size-packFooterSize); err != nil {
+		return err
+	}
+
+	var checksum core.Hash
+	if _, err := io.ReadFull(r, checksum[:]); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(h.Sum(nil), checksum[:]) || checksum != p.hash {
+		return ErrPackfileChecksumMismatch
+	}
+
+	return nil
+}
+
+// verifyPackCRC32s computes the CRC32 of every entry of the packfile, every
+// entry ends where the next one starts, the last one at the checksum.
+func verifyPackCRC32s(p *openPack, idx *idxfile.Index) error {
+	hashes, err := idx.Hashes()
+	if err != nil {
+		return err
+	}
+
+	entries := make(packEntries, len(hashes))
+	for i, h := range hashes {
+		offset, err := idx.FindOffset(h)
+		if err != nil {
+			return err
+		}
+
+		entries[i] = packEntry{hash: h, offset: offset}
+	}
+
+	sort.Sort(entries)
+
+	for i, e := range entries {
+		end := p.size - packFooterSize
+		if i+1 < len(entries) {
+			end = entries[i+1].offset
+		}
+
+		if e.offset < packHeaderSize || end <= e.offset {
+			return ErrPackfileCRC32Mismatch
+		}
+
+		crc := crc32.NewIEEE()
+		if _, err := io.Copy(crc, io.NewSectionReader(p.r, e.offset, end-e.offset)); err != nil {
+			return err
+		}
+
+		expected, err := idx.FindCRC32(e.hash)
+		if err != nil {
+			return err
+		}
+
+		if crc.Sum32() != expected {
+			return ErrPackfileCRC32Mismatch
 		}
 	}
 
-	return core.ZeroHash, -1
+	return nil
+}
+
+type packEntry struct {
+	hash   core.Hash
+	offset int64
+}
+
+// packEntries sorts the entries of a packfile by offset.
+type packEntries []packEntry
+
+func (e packEntries) Len() int           { return len(e) }
+func (e packEntries) Less(i, j int) bool { return e[i].offset < e[j].offset }
+func (e packEntries) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+
+// LooseObjects returns the hashes of the loose objects of the storage, the
+// loose objects of the alternates are not included.
+func (s *ObjectStorage) LooseObjects() ([]core.Hash, error) {
+	return s.dir.Objects()
+}
+
+// LooseObjectTime returns the last modification time of the given loose
+// object.
+func (s *ObjectStorage) LooseObjectTime(h core.Hash) (time.Time, error) {
+	t, err := s.dir.ObjectTime(h)
+	if os.IsNotExist(err) {
+		return t, core.ErrObjectNotFound
+	}
+
+	return t, err
+}
+
+// SetLooseObjectTime changes the last modification time of the given loose
+// object.
+func (s *ObjectStorage) SetLooseObjectTime(h core.Hash, t time.Time) error {
+	err := s.dir.SetObjectTime(h, t)
+	if os.IsNotExist(err) {
+		return core.ErrObjectNotFound
+	}
+
+	return err
+}
+
+// DeleteLooseObject deletes the given loose object.
+func (s *ObjectStorage) DeleteLooseObject(h core.Hash) error {
+	return s.dir.RemoveObject(h)
 }
 
 // Iter returns an iterator for all the objects in the packfile with the
@@ -223,9 +961,58 @@ func (s *ObjectStorage) Iter(t core.ObjectType) (core.ObjectIter, error) {
 	}
 
 	iters = append(iters, packi...)
+
+	alternates := s.alternateStorages()
+	for i, as := range alternates {
+		iter, err := as.Iter(t)
+		if err != nil {
+			return nil, err
+		}
+
+		// the objects are returned only from the first storage containing
+		// them
+		previous := append([]*ObjectStorage{s}, alternates[:i]...)
+		iters = append(iters, &alternateIter{
+			ObjectIter: iter,
+			skip: func(h core.Hash) bool {
+				for _, ps := range previous {
+					if ps.contains(h) {
+						return true
+					}
+				}
+
+				return false
+			},
+		})
+	}
+
 	return core.NewMultiObjectIter(iters), nil
 }
 
+// alternateIter is an iterator of the objects of an alternate, skipping the
+// objects already returned by the previous iterators.
+type alternateIter struct {
+	core.ObjectIter
+	skip func(core.Hash) bool
+}
+
+func (iter *alternateIter) Next() (core.Object, error) {
+	for {
+		obj, err := iter.ObjectIter.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		if !iter.skip(obj.Hash()) {
+			return obj, nil
+		}
+	}
+}
+
+func (iter *alternateIter) ForEach(cb func(core.Object) error) error {
+	return core.ForEachIterator(iter, cb)
+}
+
 func (s *ObjectStorage) buildPackfileIters(
 	t core.ObjectType, seen map[core.Hash]bool) ([]core.ObjectIter, error) {
 	packs, err := s.dir.ObjectPacks()
@@ -251,37 +1038,127 @@ func (s *ObjectStorage) buildPackfileIters(
 	return iters, nil
 }
 
-// Begin opens a new transaction. However, this implementation is not
-// transactional, so Commit and Rollback have no effect.
-func (o *ObjectStorage) Begin() core.TxObjectStorage {
-	return o
+// Begin opens a new transaction. The objects set in the transaction are
+// written to temporary files, on Commit they are moved to the objects
+// directory and on Rollback they are deleted.
+func (s *ObjectStorage) Begin() core.TxObjectStorage {
+	return &TxObjectStorage{
+		Storage: s,
+		Objects: make(map[core.Hash]*dotgit.ObjectWriter, 0),
+	}
 }
 
-func (tx *ObjectStorage) Commit() error {
-	return nil
+// TxObjectStorage is an in-progress transaction of an ObjectStorage, the
+// objects aren't visible from the storage until Commit is called.
+//
+// Since the objects are named by its content, every object is moved
+// atomically to its final location, if the process is interrupted during a
+// Commit only complete objects are left behind.
+type TxObjectStorage struct {
+	Storage *ObjectStorage
+	Objects map[core.Hash]*dotgit.ObjectWriter
 }
 
-func (tx *ObjectStorage) Rollback() error {
-	return nil
+// Set writes the object to a temporary file.
+func (tx *TxObjectStorage) Set(o core.Object) (core.Hash, error) {
+	if o.Type() == core.OFSDeltaObject || o.Type() == core.REFDeltaObject {
+		return core.ZeroHash, core.ErrInvalidType
+	}
+
+	h := o.Hash()
+	if _, ok := tx.Objects[h]; ok {
+		return h, nil
+	}
+
+	ow, err := stageObject(tx.Storage.dir, o)
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	tx.Objects[h] = ow
+	return h, nil
 }
 
-type index map[core.Hash]int64
+// Get returns an object set in the transaction, if it's not found it is
+// looked up in the storage.
+func (tx *TxObjectStorage) Get(t core.ObjectType, h core.Hash) (core.Object, error) {
+	ow, ok := tx.Objects[h]
+	if !ok {
+		return tx.Storage.Get(t, h)
+	}
+
+	f, err := ow.Open()
+	if err != nil {
+		return nil, err
+	}
 
-func (i index) Decode(r io.Reader) error {
-	idx := &idxfile.Idxfile{}
+	defer f.Close()
 
-	d := idxfile.NewDecoder(r)
-	if err := d.Decode(idx); err != nil {
-		return err
+	obj, err := readObjectFile(tx.Storage.NewObject(), f)
+	if err != nil {
+		return nil, err
+	}
+
+	if core.AnyObject != t && obj.Type() != t {
+		return nil, core.ErrObjectNotFound
 	}
 
-	for _, e := range idx.Entries {
-		i[e.Hash] = int64(e.Offset)
+	return obj, nil
+}
+
+// Commit moves all the objects of the transaction to the objects directory.
+func (tx *TxObjectStorage) Commit() error {
+	for h, ow := range tx.Objects {
+		if err := ow.Commit(); err != nil {
+			return err
+		}
+
+		delete(tx.Objects, h)
 	}
 
 	return nil
 }
 
+// Rollback deletes the temporary files of the objects of the transaction.
+func (tx *TxObjectStorage) Rollback() error {
+	var err error
+	for h, ow := range tx.Objects {
+		if errRollback := ow.Rollback(); err == nil {
+			err = errRollback
+		}
+
+		delete(tx.Objects, h)
+	}
+
+	return err
+}
+
+// packIndex is the idx file of a packfile, kept open to look up the objects
+// on disk
+type packIndex struct {
+	*idxfile.Index
+	c io.Closer
+	// refs counts the storage and the readers holding the index, the idx
+	// file is closed when it drops to zero
+	refs int32
+}
+
+func newPackIndex(idx *idxfile.Index, c io.Closer) *packIndex {
+	return &packIndex{Index: idx, c: c, refs: 1}
+}
+
+func (i *packIndex) acquire() {
+	atomic.AddInt32(&i.refs, 1)
+}
+
+func (i *packIndex) release() error {
+	if atomic.AddInt32(&i.refs, -1) != 0 || i.c == nil {
+		return nil
+	}
+
+	return i.c.Close()
+}
+
 type packfileIter struct {
 	f fs.File
 	d *packfile.Decoder
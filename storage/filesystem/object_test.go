@@ -1,9 +1,20 @@
 package filesystem
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
 	"gopkg.in/src-d/go-git.v4/core"
 	"gopkg.in/src-d/go-git.v4/fixtures"
+	"gopkg.in/src-d/go-git.v4/formats/packfile"
 	"gopkg.in/src-d/go-git.v4/storage/filesystem/internal/dotgit"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+	"gopkg.in/src-d/go-git.v4/utils/cache"
+	memfs "gopkg.in/src-d/go-git.v4/utils/fs/memory"
+	"gopkg.in/src-d/go-git.v4/utils/fs/overlay"
+	"gopkg.in/src-d/go-git.v4/utils/fs/readonly"
 
 	. "gopkg.in/check.v1"
 )
@@ -16,7 +27,7 @@ var _ = Suite(&FsSuite{})
 
 func (s *FsSuite) TestGetFromObjectFile(c *C) {
 	fs := fixtures.ByTag(".git").ByTag("unpacked").One().DotGit()
-	o, err := newObjectStorage(dotgit.New(fs))
+	o, err := newObjectStorage(dotgit.New(fs), Options{ObjectCache: cache.NewObjectLRUDefault()})
 	c.Assert(err, IsNil)
 
 	expected := core.NewHash("f3dfe29d268303fc6e1bbce268605fc99573406e")
@@ -28,7 +39,62 @@ func (s *FsSuite) TestGetFromObjectFile(c *C) {
 func (s *FsSuite) TestGetFromPackfile(c *C) {
 	fixtures.Basic().ByTag(".git").Test(c, func(f *fixtures.Fixture) {
 		fs := f.DotGit()
-		o, err := newObjectStorage(dotgit.New(fs))
+		o, err := newObjectStorage(dotgit.New(fs), Options{ObjectCache: cache.NewObjectLRUDefault()})
+		c.Assert(err, IsNil)
+
+		expected := core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+		obj, err := o.Get(core.AnyObject, expected)
+		c.Assert(err, IsNil)
+		c.Assert(obj.Hash(), Equals, expected)
+	})
+}
+
+func (s *FsSuite) TestGetFromPackfileCached(c *C) {
+	fixtures.Basic().ByTag(".git").Test(c, func(f *fixtures.Fixture) {
+		fs := f.DotGit()
+		lru := cache.NewObjectLRUDefault()
+		o, err := newObjectStorage(dotgit.New(fs), Options{ObjectCache: lru})
+		c.Assert(err, IsNil)
+
+		expected := core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+		obj, err := o.Get(core.AnyObject, expected)
+		c.Assert(err, IsNil)
+
+		cached, ok := lru.Get(expected)
+		c.Assert(ok, Equals, true)
+		c.Assert(cached, Equals, obj)
+
+		again, err := o.Get(core.AnyObject, expected)
+		c.Assert(err, IsNil)
+		c.Assert(again, Equals, obj)
+	})
+}
+
+func (s *FsSuite) TestGetFromPackfileReverseIndex(c *C) {
+	fixtures.Basic().ByTag(".git").Test(c, func(f *fixtures.Fixture) {
+		fs := f.DotGit()
+		lru := cache.NewObjectLRUDefault()
+		o, err := newObjectStorage(dotgit.New(fs), Options{ObjectCache: lru, ReverseIndex: true})
+		c.Assert(err, IsNil)
+
+		iter, err := o.Iter(core.AnyObject)
+		c.Assert(err, IsNil)
+
+		err = iter.ForEach(func(expected core.Object) error {
+			obj, err := o.Get(core.AnyObject, expected.Hash())
+			c.Assert(err, IsNil)
+			c.Assert(obj.Hash(), Equals, expected.Hash())
+			c.Assert(obj.Type(), Equals, expected.Type())
+			return nil
+		})
+		c.Assert(err, IsNil)
+	})
+}
+
+func (s *FsSuite) TestGetFromPackfileWithoutCache(c *C) {
+	fixtures.Basic().ByTag(".git").Test(c, func(f *fixtures.Fixture) {
+		fs := f.DotGit()
+		o, err := newObjectStorage(dotgit.New(fs), Options{})
 		c.Assert(err, IsNil)
 
 		expected := core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
@@ -40,7 +106,7 @@ func (s *FsSuite) TestGetFromPackfile(c *C) {
 
 func (s *FsSuite) TestGetFromPackfileMultiplePackfiles(c *C) {
 	fs := fixtures.ByTag(".git").ByTag("multi-packfile").One().DotGit()
-	o, err := newObjectStorage(dotgit.New(fs))
+	o, err := newObjectStorage(dotgit.New(fs), Options{ObjectCache: cache.NewObjectLRUDefault()})
 	c.Assert(err, IsNil)
 
 	expected := core.NewHash("8d45a34641d73851e01d3754320b33bb5be3c4d3")
@@ -57,7 +123,7 @@ func (s *FsSuite) TestGetFromPackfileMultiplePackfiles(c *C) {
 func (s *FsSuite) TestIter(c *C) {
 	fixtures.ByTag(".git").ByTag("packfile").Test(c, func(f *fixtures.Fixture) {
 		fs := f.DotGit()
-		o, err := newObjectStorage(dotgit.New(fs))
+		o, err := newObjectStorage(dotgit.New(fs), Options{ObjectCache: cache.NewObjectLRUDefault()})
 		c.Assert(err, IsNil)
 
 		iter, err := o.Iter(core.AnyObject)
@@ -77,7 +143,7 @@ func (s *FsSuite) TestIter(c *C) {
 func (s *FsSuite) TestIterWithType(c *C) {
 	fixtures.ByTag(".git").Test(c, func(f *fixtures.Fixture) {
 		fs := f.DotGit()
-		o, err := newObjectStorage(dotgit.New(fs))
+		o, err := newObjectStorage(dotgit.New(fs), Options{ObjectCache: cache.NewObjectLRUDefault()})
 		c.Assert(err, IsNil)
 
 		iter, err := o.Iter(core.CommitObject)
@@ -91,3 +157,243 @@ func (s *FsSuite) TestIterWithType(c *C) {
 		c.Assert(err, IsNil)
 	})
 }
+
+func (s *FsSuite) TestVerifyObjectPack(c *C) {
+	fixtures.Basic().ByTag(".git").Test(c, func(f *fixtures.Fixture) {
+		o, err := newObjectStorage(dotgit.New(f.DotGit()), Options{})
+		c.Assert(err, IsNil)
+		defer o.Close()
+
+		packs, err := o.ObjectPacks()
+		c.Assert(err, IsNil)
+
+		for _, pack := range packs {
+			c.Assert(o.VerifyObjectPack(pack), IsNil)
+		}
+	})
+}
+
+func (s *FsSuite) TestVerifyObjectPackNotFound(c *C) {
+	fs := fixtures.Basic().ByTag(".git").One().DotGit()
+	o, err := newObjectStorage(dotgit.New(fs), Options{})
+	c.Assert(err, IsNil)
+	defer o.Close()
+
+	err = o.VerifyObjectPack(core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(err, Equals, dotgit.ErrPackfileNotFound)
+}
+
+func (s *FsSuite) TestVerifyObjectPackChecksumMismatch(c *C) {
+	f := fixtures.Basic().ByTag(".git").ByTag("packfile").One()
+	fs := f.DotGit()
+	name := fmt.Sprintf("objects/pack/pack-%s.pack", f.PackfileHash)
+	flipByte(c, fs.Join(fs.Base(), name), 42)
+
+	o, err := newObjectStorage(dotgit.New(fs), Options{})
+	c.Assert(err, IsNil)
+	defer o.Close()
+
+	c.Assert(o.VerifyObjectPack(f.PackfileHash), Equals, ErrPackfileChecksumMismatch)
+}
+
+func (s *FsSuite) TestVerifyObjectPackCRC32Mismatch(c *C) {
+	f := fixtures.Basic().ByTag(".git").ByTag("packfile").One()
+	fs := f.DotGit()
+
+	// first entry of the CRC32 table, after the header, the fanout table and
+	// the hashes of the objects
+	name := fmt.Sprintf("objects/pack/pack-%s.idx", f.PackfileHash)
+	flipByte(c, fs.Join(fs.Base(), name), 8+256*4+int64(f.ObjectsCount)*20)
+
+	o, err := newObjectStorage(dotgit.New(fs), Options{})
+	c.Assert(err, IsNil)
+	defer o.Close()
+
+	c.Assert(o.VerifyObjectPack(f.PackfileHash), Equals, ErrPackfileCRC32Mismatch)
+}
+
+func flipByte(c *C, path string, offset int64) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	b := make([]byte, 1)
+	_, err = f.ReadAt(b, offset)
+	c.Assert(err, IsNil)
+
+	b[0] ^= 0xff
+	_, err = f.WriteAt(b, offset)
+	c.Assert(err, IsNil)
+}
+
+func (s *FsSuite) TestGetFromNewPackfile(c *C) {
+	fs := fixtures.Basic().ByTag(".git").One().DotGit()
+	o, err := newObjectStorage(dotgit.New(fs), Options{})
+	c.Assert(err, IsNil)
+	defer o.Close()
+
+	// the packfile is written by other storage, as if it was other process
+	other, err := newObjectStorage(dotgit.New(fs), Options{})
+	c.Assert(err, IsNil)
+	defer other.Close()
+
+	h, pack := writeBlobPack(c, other, "new packfile")
+
+	obj, err := o.Get(core.AnyObject, h)
+	c.Assert(err, IsNil)
+	c.Assert(obj.Hash(), Equals, h)
+
+	hashes, err := o.ObjectPackHashes(pack)
+	c.Assert(err, IsNil)
+	c.Assert(hashes, DeepEquals, []core.Hash{h})
+}
+
+func (s *FsSuite) TestGetFromNewPackfileSameTime(c *C) {
+	fs := fixtures.Basic().ByTag(".git").One().DotGit()
+	packs := filepath.Join(fs.Base(), "objects", "pack")
+	t := time.Now().Truncate(time.Second)
+	c.Assert(os.Chtimes(packs, t, t), IsNil)
+
+	o, err := newObjectStorage(dotgit.New(fs), Options{})
+	c.Assert(err, IsNil)
+	defer o.Close()
+
+	other, err := newObjectStorage(dotgit.New(fs), Options{})
+	c.Assert(err, IsNil)
+	defer other.Close()
+
+	// a packfile added within the time granularity of the filesystem
+	h, _ := writeBlobPack(c, other, "new packfile")
+	c.Assert(os.Chtimes(packs, t, t), IsNil)
+
+	obj, err := o.Get(core.AnyObject, h)
+	c.Assert(err, IsNil)
+	c.Assert(obj.Hash(), Equals, h)
+}
+
+func (s *FsSuite) TestGetNotRescanningUnchangedPackfiles(c *C) {
+	fs := fixtures.Basic().ByTag(".git").One().DotGit()
+	packs := filepath.Join(fs.Base(), "objects", "pack")
+	t := time.Now().Add(-time.Hour)
+	c.Assert(os.Chtimes(packs, t, t), IsNil)
+
+	o, err := newObjectStorage(dotgit.New(fs), Options{})
+	c.Assert(err, IsNil)
+	defer o.Close()
+
+	other, err := newObjectStorage(dotgit.New(fs), Options{})
+	c.Assert(err, IsNil)
+	defer other.Close()
+
+	h, _ := writeBlobPack(c, other, "new packfile")
+	c.Assert(os.Chtimes(packs, t, t), IsNil)
+
+	_, err = o.Get(core.AnyObject, h)
+	c.Assert(err, Equals, core.ErrObjectNotFound)
+
+	c.Assert(o.Refresh(), IsNil)
+	obj, err := o.Get(core.AnyObject, h)
+	c.Assert(err, IsNil)
+	c.Assert(obj.Hash(), Equals, h)
+}
+
+func (s *FsSuite) TestDeleteObjectPackInUse(c *C) {
+	fs := fixtures.Basic().ByTag(".git").One().DotGit()
+	o, err := newObjectStorage(dotgit.New(fs), Options{})
+	c.Assert(err, IsNil)
+	defer o.Close()
+
+	h, pack := writeBlobPack(c, o, "in use")
+	c.Assert(o.Refresh(), IsNil)
+
+	idx, ok := o.acquireIndex(pack)
+	c.Assert(ok, Equals, true)
+	c.Assert(o.DeleteObjectPack(pack), IsNil)
+
+	hashes, err := idx.Hashes()
+	c.Assert(err, IsNil)
+	c.Assert(hashes, DeepEquals, []core.Hash{h})
+	c.Assert(idx.release(), IsNil)
+}
+
+func (s *FsSuite) TestRefresh(c *C) {
+	fs := fixtures.Basic().ByTag(".git").One().DotGit()
+	o, err := newObjectStorage(dotgit.New(fs), Options{})
+	c.Assert(err, IsNil)
+	defer o.Close()
+
+	other, err := newObjectStorage(dotgit.New(fs), Options{})
+	c.Assert(err, IsNil)
+	defer other.Close()
+
+	h, pack := writeBlobPack(c, other, "new packfile")
+
+	c.Assert(o.Refresh(), IsNil)
+	_, err = o.ObjectPackHashes(pack)
+	c.Assert(err, IsNil)
+
+	c.Assert(other.DeleteObjectPack(pack), IsNil)
+	c.Assert(o.Refresh(), IsNil)
+
+	_, err = o.ObjectPackHashes(pack)
+	c.Assert(err, Equals, dotgit.ErrPackfileNotFound)
+
+	_, err = o.Get(core.AnyObject, h)
+	c.Assert(err, Equals, core.ErrObjectNotFound)
+}
+
+// writeBlobPack writes a packfile with a single blob with the given content,
+// returns the hashes of the blob and the packfile.
+func writeBlobPack(c *C, o *ObjectStorage, content string) (core.Hash, core.Hash) {
+	m := memory.NewStorage()
+	obj := m.ObjectStorage().NewObject()
+	obj.SetType(core.BlobObject)
+	obj.SetSize(int64(len(content)))
+	ow, err := obj.Writer()
+	c.Assert(err, IsNil)
+	_, err = ow.Write([]byte(content))
+	c.Assert(err, IsNil)
+	c.Assert(ow.Close(), IsNil)
+
+	h, err := m.ObjectStorage().Set(obj)
+	c.Assert(err, IsNil)
+
+	w, err := o.Writer()
+	c.Assert(err, IsNil)
+
+	pack, err := packfile.NewEncoder(w, m.ObjectStorage(), false).Encode([]core.Hash{h})
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	return h, pack
+}
+
+func (s *FsSuite) TestReadOnly(c *C) {
+	fs := readonly.New(fixtures.Basic().ByTag(".git").One().DotGit())
+	o, err := newObjectStorage(dotgit.New(fs), Options{ObjectCache: cache.NewObjectLRUDefault()})
+	c.Assert(err, IsNil)
+
+	expected := core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	obj, err := o.Get(core.AnyObject, expected)
+	c.Assert(err, IsNil)
+	c.Assert(obj.Hash(), Equals, expected)
+
+	_, err = o.Writer()
+	c.Assert(err, NotNil)
+}
+
+func (s *FsSuite) TestOverlay(c *C) {
+	lower := fixtures.Basic().ByTag(".git").One().DotGit()
+	o, err := newObjectStorage(
+		dotgit.New(overlay.New(readonly.New(lower), memfs.New())),
+		Options{ObjectCache: cache.NewObjectLRUDefault()},
+	)
+	c.Assert(err, IsNil)
+
+	h, pack := writeBlobPack(c, o, "overlay")
+	_, err = o.Get(core.AnyObject, h)
+	c.Assert(err, IsNil)
+
+	_, err = lower.Stat(lower.Join("objects", "pack", fmt.Sprintf("pack-%s.pack", pack)))
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
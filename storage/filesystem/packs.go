@@ -0,0 +1,223 @@
+package filesystem
+
+import (
+	"container/list"
+	"errors"
+	"io"
+	"sync"
+
+	"gopkg.in/src-d/go-git.v4/core"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem/internal/dotgit"
+	"gopkg.in/src-d/go-git.v4/utils/fs"
+)
+
+// DefaultMaxOpenPacks is the maximum number of packfiles kept open by a
+// storage when no limit is given
+const DefaultMaxOpenPacks = 64
+
+// ErrStorageClosed is returned when a packfile is read from a closed storage
+var ErrStorageClosed = errors.New("storage closed")
+
+// packPool keeps open a bounded number of packfiles, the least recently used
+// packfile is closed when the limit is reached. The packfiles are read using
+// io.ReaderAt, so the same handle can be used by concurrent lookups.
+type packPool struct {
+	dir  *dotgit.DotGit
+	max  int
+	mmap bool
+
+	m      sync.Mutex
+	ll     *list.List
+	packs  map[core.Hash]*list.Element
+	closed bool
+}
+
+func newPackPool(dir *dotgit.DotGit, max int, mmap bool) *packPool {
+	if max <= 0 {
+		max = DefaultMaxOpenPacks
+	}
+
+	return &packPool{
+		dir:   dir,
+		max:   max,
+		mmap:  mmap,
+		ll:    list.New(),
+		packs: make(map[core.Hash]*list.Element, 0),
+	}
+}
+
+// Get returns the open packfile with the given hash, opening it if needed.
+// The packfile can't be closed until it is released with Put.
+func (p *packPool) Get(h core.Hash) (*openPack, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if p.closed {
+		return nil, ErrStorageClosed
+	}
+
+	if e, ok := p.packs[h]; ok {
+		p.ll.MoveToFront(e)
+		pack := e.Value.(*openPack)
+		pack.refs++
+		return pack, nil
+	}
+
+	pack, err := p.open(h)
+	if err != nil {
+		return nil, err
+	}
+
+	pack.refs++
+	p.packs[h] = p.ll.PushFront(pack)
+
+	for p.ll.Len() > p.max {
+		if err := p.evict(p.ll.Back()); err != nil {
+			return nil, err
+		}
+	}
+
+	return pack, nil
+}
+
+func (p *packPool) open(h core.Hash) (*openPack, error) {
+	f, err := p.dir.ObjectPack(h)
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if p.mmap {
+		if r, ok := mmapFile(f, size); ok {
+			// the mapping stays valid after closing the file
+			if err := f.Close(); err != nil {
+				r.Close()
+				return nil, err
+			}
+
+			return &openPack{hash: h, r: r, c: r, size: size}, nil
+		}
+	}
+
+	return &openPack{hash: h, r: readerAt(f), c: f, size: size}, nil
+}
+
+// Put releases a packfile returned by Get.
+func (p *packPool) Put(pack *openPack) error {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	pack.refs--
+	if pack.evicted && pack.refs == 0 {
+		return pack.c.Close()
+	}
+
+	return nil
+}
+
+// Close closes all the packfiles, the packfiles in use are closed as soon as
+// they are released.
+func (p *packPool) Close() error {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.closed = true
+
+	var err error
+	for p.ll.Len() > 0 {
+		if errEvict := p.evict(p.ll.Back()); err == nil {
+			err = errEvict
+		}
+	}
+
+	return err
+}
+
+// Remove closes the given packfile if it's open, as soon as it is released,
+// it's used when the packfile is deleted.
+func (p *packPool) Remove(h core.Hash) error {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	e, ok := p.packs[h]
+	if !ok {
+		return nil
+	}
+
+	return p.evict(e)
+}
+
+// Closed returns true if the pool was closed.
+func (p *packPool) Closed() bool {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	return p.closed
+}
+
+func (p *packPool) evict(e *list.Element) error {
+	pack := e.Value.(*openPack)
+	p.ll.Remove(e)
+	delete(p.packs, pack.hash)
+
+	pack.evicted = true
+	if pack.refs == 0 {
+		return pack.c.Close()
+	}
+
+	return nil
+}
+
+// openPack is a packfile kept open by a packPool
+type openPack struct {
+	hash core.Hash
+	r    io.ReaderAt
+	c    io.Closer
+	size int64
+
+	refs    int
+	evicted bool
+}
+
+// Reader returns a new io.ReadSeeker of the packfile, independent from any
+// other reader of the same packfile.
+func (p *openPack) Reader() io.ReadSeeker {
+	return io.NewSectionReader(p.r, 0, p.size)
+}
+
+// readerAt returns the file as an io.ReaderAt, if the file doesn't implement
+// it the reads are serialized using Seek and Read.
+func readerAt(f fs.File) io.ReaderAt {
+	if r, ok := f.(io.ReaderAt); ok {
+		return r
+	}
+
+	return &seekReaderAt{f: f}
+}
+
+// seekReaderAt implements io.ReaderAt over a fs.File that doesn't support it.
+type seekReaderAt struct {
+	m sync.Mutex
+	f fs.File
+}
+
+func (r *seekReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if _, err := r.f.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	n, err := io.ReadFull(r.f, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+
+	return n, err
+}
@@ -0,0 +1,94 @@
+package filesystem
+
+import (
+	"sync"
+
+	"gopkg.in/src-d/go-git.v4/core"
+	"gopkg.in/src-d/go-git.v4/fixtures"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem/internal/dotgit"
+
+	. "gopkg.in/check.v1"
+)
+
+type PackPoolSuite struct {
+	fixtures.Suite
+}
+
+var _ = Suite(&PackPoolSuite{})
+
+func (s *PackPoolSuite) TestGetFromPackfileMaxOpenPacks(c *C) {
+	fs := fixtures.Basic().ByTag(".git").One().DotGit()
+	o, err := newObjectStorage(dotgit.New(fs), Options{MaxOpenPacks: 1})
+	c.Assert(err, IsNil)
+	defer o.Close()
+
+	foo, _ := writeBlobPack(c, o, "foo")
+	bar, _ := writeBlobPack(c, o, "bar")
+
+	master := core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	for _, expected := range []core.Hash{master, foo, bar, master, foo} {
+		obj, err := o.Get(core.AnyObject, expected)
+		c.Assert(err, IsNil)
+		c.Assert(obj.Hash(), Equals, expected)
+		c.Assert(o.packs.ll.Len(), Equals, 1)
+	}
+}
+
+func (s *PackPoolSuite) TestGetFromPackfileMmap(c *C) {
+	fixtures.Basic().ByTag(".git").Test(c, func(f *fixtures.Fixture) {
+		o, err := newObjectStorage(dotgit.New(f.DotGit()), Options{MmapPacks: true})
+		c.Assert(err, IsNil)
+		defer o.Close()
+
+		expected := core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+		obj, err := o.Get(core.AnyObject, expected)
+		c.Assert(err, IsNil)
+		c.Assert(obj.Hash(), Equals, expected)
+	})
+}
+
+func (s *PackPoolSuite) TestGetFromPackfileConcurrent(c *C) {
+	fixtures.Basic().ByTag(".git").Test(c, func(f *fixtures.Fixture) {
+		o, err := newObjectStorage(dotgit.New(f.DotGit()), Options{})
+		c.Assert(err, IsNil)
+		defer o.Close()
+
+		expected := core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 10)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := o.getFromPackfile(expected)
+				errs <- err
+			}()
+		}
+
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			c.Assert(err, IsNil)
+		}
+
+		c.Assert(o.packs.ll.Len(), Equals, 1)
+	})
+}
+
+func (s *PackPoolSuite) TestClose(c *C) {
+	fixtures.Basic().ByTag(".git").Test(c, func(f *fixtures.Fixture) {
+		o, err := newObjectStorage(dotgit.New(f.DotGit()), Options{})
+		c.Assert(err, IsNil)
+
+		expected := core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+		_, err = o.getFromPackfile(expected)
+		c.Assert(err, IsNil)
+
+		c.Assert(o.Close(), IsNil)
+		c.Assert(o.packs.ll.Len(), Equals, 0)
+
+		_, err = o.getFromPackfile(expected)
+		c.Assert(err, Equals, ErrStorageClosed)
+	})
+}
@@ -1,22 +1,68 @@
 package filesystem
 
 import (
+	"sync"
+
 	"gopkg.in/src-d/go-git.v4/core"
 	"gopkg.in/src-d/go-git.v4/storage/filesystem/internal/dotgit"
 )
 
+// ReferenceStorage is the implementation of core.ReferenceStorage over a git
+// directory, it's safe for concurrent use. The references are replaced
+// atomically using lock files, so the readers never see a partial update, and
+// the writers of the same storage are serialized so they don't find the locks
+// of each other. Every change is recorded in the reflog, as git does.
 type ReferenceStorage struct {
 	dir *dotgit.DotGit
+	// c is the config of the repository, used to get the committer of the
+	// reflog entries
+	c      *ConfigStorage
+	global globalConfig
+	// m serializes the writers, the reflogs are read holding it too since
+	// they are appended in place
+	m sync.RWMutex
 }
 
 func (r *ReferenceStorage) Set(ref *core.Reference) error {
-	return r.dir.SetRef(ref)
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.updateRefs([]*dotgit.RefUpdate{{Name: ref.Name(), New: ref}}, "")
+}
+
+func (r *ReferenceStorage) CheckAndSetReference(new, old *core.Reference) error {
+	if new == nil {
+		return nil
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.updateRefs([]*dotgit.RefUpdate{
+		{Name: new.Name(), New: new, Old: old},
+	}, "")
 }
 
 func (r *ReferenceStorage) Get(n core.ReferenceName) (*core.Reference, error) {
 	return r.dir.Ref(n)
 }
 
+func (r *ReferenceStorage) Remove(n core.ReferenceName) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.dir.RemoveRef(n)
+}
+
+// PackRefs moves all the loose hash references into the packed-refs file,
+// removing the loose files afterwards.
+func (r *ReferenceStorage) PackRefs() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.dir.PackRefs()
+}
+
 func (r *ReferenceStorage) Iter() (core.ReferenceIter, error) {
 	refs, err := r.dir.Refs()
 	if err != nil {
@@ -25,3 +71,77 @@ func (r *ReferenceStorage) Iter() (core.ReferenceIter, error) {
 
 	return core.NewReferenceSliceIter(refs), nil
 }
+
+// Reflog returns the entries of the reflog of the given reference.
+func (r *ReferenceStorage) Reflog(n core.ReferenceName) ([]*core.ReflogEntry, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	return r.dir.Reflog(n)
+}
+
+// AppendReflog adds an entry at the end of the reflog of a reference.
+func (r *ReferenceStorage) AppendReflog(n core.ReferenceName, e *core.ReflogEntry) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.dir.AppendReflog(n, e)
+}
+
+// SetReflog replaces all the entries of the reflog of a reference.
+func (r *ReferenceStorage) SetReflog(n core.ReferenceName, entries []*core.ReflogEntry) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.dir.SetReflog(n, entries)
+}
+
+// Begin starts a reference transaction, on Commit all the references are
+// locked and updated using the same lock files as git.
+func (r *ReferenceStorage) Begin() core.TxReferenceStorage {
+	return &TxReferenceStorage{r: r}
+}
+
+type TxReferenceStorage struct {
+	r       *ReferenceStorage
+	updates []*dotgit.RefUpdate
+	msg     string
+}
+
+// SetReflogMessage sets the message of the reflog entries recording the
+// changes of the transaction.
+func (tx *TxReferenceStorage) SetReflogMessage(msg string) {
+	tx.msg = msg
+}
+
+func (tx *TxReferenceStorage) CheckAndSetReference(new, old *core.Reference) error {
+	if new == nil {
+		return nil
+	}
+
+	tx.updates = append(tx.updates, &dotgit.RefUpdate{
+		Name: new.Name(), New: new, Old: old,
+	})
+
+	return nil
+}
+
+func (tx *TxReferenceStorage) CheckAndRemoveReference(n core.ReferenceName, old *core.Reference) error {
+	tx.updates = append(tx.updates, &dotgit.RefUpdate{Name: n, Old: old})
+	return nil
+}
+
+func (tx *TxReferenceStorage) Commit() error {
+	updates := tx.updates
+	tx.updates = nil
+
+	tx.r.m.Lock()
+	defer tx.r.m.Unlock()
+
+	return tx.r.updateRefs(updates, tx.msg)
+}
+
+func (tx *TxReferenceStorage) Rollback() error {
+	tx.updates = nil
+	return nil
+}
@@ -0,0 +1,135 @@
+package filesystem
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/core"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem/internal/dotgit"
+)
+
+// reflogCommitter returns the identity used in the reflog entries, as git
+// does it's taken from the GIT_COMMITTER_NAME and GIT_COMMITTER_EMAIL
+// environment variables, then from user.name and user.email of the config of
+// the repository or the global config, falling back to the current user and
+// host names.
+func (r *ReferenceStorage) reflogCommitter() ([]byte, error) {
+	user, err := r.configUser()
+	if err != nil {
+		return nil, err
+	}
+
+	name := os.Getenv("GIT_COMMITTER_NAME")
+	if name == "" {
+		name = user.Name
+	}
+
+	if name == "" {
+		name = os.Getenv("USER")
+	}
+
+	if name == "" {
+		name = "unknown"
+	}
+
+	email := os.Getenv("GIT_COMMITTER_EMAIL")
+	if email == "" {
+		email = user.Email
+	}
+
+	if email == "" {
+		host, _ := os.Hostname()
+		email = fmt.Sprintf("%s@%s", name, host)
+	}
+
+	now := time.Now()
+	return []byte(fmt.Sprintf(
+		"%s <%s> %d %s", name, email, now.Unix(), now.Format("-0700"),
+	)), nil
+}
+
+// configUser returns the user of the config of the repository, the values
+// not set there are taken from the global config.
+func (r *ReferenceStorage) configUser() (config.UserConfig, error) {
+	var user config.UserConfig
+	if r.c != nil {
+		cfg, err := r.c.Config()
+		if err != nil {
+			return user, err
+		}
+
+		user = cfg.User
+	}
+
+	if user.Name != "" && user.Email != "" {
+		return user, nil
+	}
+
+	global, err := r.global.load()
+	if err != nil {
+		return user, err
+	}
+
+	if user.Name == "" {
+		user.Name = global.User.Name
+	}
+
+	if user.Email == "" {
+		user.Email = global.User.Email
+	}
+
+	return user, nil
+}
+
+// globalConfig is the global config, read once.
+type globalConfig struct {
+	once sync.Once
+	cfg  *config.Config
+	err  error
+}
+
+func (g *globalConfig) load() (*config.Config, error) {
+	g.once.Do(func() {
+		var l *config.LayeredConfig
+		if l, g.err = config.LoadGlobalConfig(""); g.err == nil {
+			g.cfg = l.Config
+		}
+	})
+
+	return g.cfg, g.err
+}
+
+// updateRefs applies the updates, recording the changes of the logged
+// references in the reflog with the given message. Following the default git
+// behaviour only the branches, remote branches, notes and HEAD are logged. The
+// committer is resolved before writing, so nothing is changed if it fails.
+func (r *ReferenceStorage) updateRefs(updates []*dotgit.RefUpdate, msg string) error {
+	var committer []byte
+	for _, u := range updates {
+		if u.New == nil || !isLoggedReference(u.Name) {
+			continue
+		}
+
+		if committer == nil {
+			var err error
+			if committer, err = r.reflogCommitter(); err != nil {
+				return err
+			}
+		}
+
+		u.Reflog = &core.ReflogEntry{Committer: committer, Message: msg}
+	}
+
+	return r.dir.UpdateRefs(updates)
+}
+
+func isLoggedReference(n core.ReferenceName) bool {
+	return n == core.HEAD ||
+		strings.HasPrefix(n.String(), "refs/heads/") ||
+		strings.HasPrefix(n.String(), "refs/remotes/") ||
+		strings.HasPrefix(n.String(), "refs/notes/")
+}
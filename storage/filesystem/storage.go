@@ -4,10 +4,14 @@ package filesystem
 import (
 	"gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/core"
+	"gopkg.in/src-d/go-git.v4/formats/index"
 	"gopkg.in/src-d/go-git.v4/storage/filesystem/internal/dotgit"
+	"gopkg.in/src-d/go-git.v4/utils/cache"
 	"gopkg.in/src-d/go-git.v4/utils/fs"
 )
 
+// Storage is a storage backed by a git directory, its object, reference and
+// config storages are safe for concurrent use by multiple goroutines.
 type Storage struct {
 	dir *dotgit.DotGit
 	fs  fs.Filesystem
@@ -17,14 +21,59 @@ type Storage struct {
 	c *ConfigStorage
 }
 
+// Options holds configuration for the filesystem storage
+type Options struct {
+	// ObjectCache is the cache of the objects read from the packfiles, it
+	// can be shared between storages. If nil no objects are cached.
+	ObjectCache cache.Object
+	// MaxOpenPacks is the maximum number of packfiles kept open, if zero
+	// DefaultMaxOpenPacks is used.
+	MaxOpenPacks int
+	// MmapPacks maps the packfiles in memory instead of reading them with
+	// read calls, only supported on linux with the os filesystem.
+	MmapPacks bool
+	// LargeObjectThreshold is the size from which the objects are streamed
+	// from disk instead of loaded in memory, the objects stored as deltas in
+	// the packfiles are always loaded in memory. If zero
+	// DefaultLargeObjectThreshold is used, if negative no object is streamed.
+	LargeObjectThreshold int64
+	// ReverseIndex keeps in memory the offsets of the objects of every
+	// packfile, 12 bytes per object, so the bases of the deltas referenced by
+	// offset are found in the ObjectCache instead of read again from the
+	// packfile. It's built the first time a delta base of the packfile is read.
+	ReverseIndex bool
+	// AlternatesFilesystem is the filesystem where the alternate object
+	// directories outside of the storage filesystem are opened, the absolute
+	// paths of the alternates are paths of this filesystem. If nil the
+	// alternates outside of the storage filesystem are rejected.
+	AlternatesFilesystem fs.Filesystem
+}
+
+// NewStorage returns a new Storage backed by the given filesystem, using an
+// object cache of cache.DefaultMaxSize
 func NewStorage(fs fs.Filesystem) (*Storage, error) {
+	return NewStorageWithOptions(fs, Options{
+		ObjectCache: cache.NewObjectLRUDefault(),
+	})
+}
+
+// NewStorageWithOptions returns a new Storage backed by the given
+// filesystem, configured with the given options
+func NewStorageWithOptions(fs fs.Filesystem, o Options) (*Storage, error) {
 	dir := dotgit.New(fs)
-	o, err := newObjectStorage(dir)
+	os, err := newObjectStorage(dir, o)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Storage{dir: dir, fs: fs, o: o}, nil
+	c := &ConfigStorage{dir: dir}
+	return &Storage{
+		dir: dir,
+		fs:  fs,
+		o:   os,
+		r:   &ReferenceStorage{dir: dir, c: c},
+		c:   c,
+	}, nil
 }
 
 func (s *Storage) ObjectStorage() core.ObjectStorage {
@@ -32,19 +81,46 @@ func (s *Storage) ObjectStorage() core.ObjectStorage {
 }
 
 func (s *Storage) ReferenceStorage() core.ReferenceStorage {
-	if s.r != nil {
-		return s.r
-	}
-
-	s.r = &ReferenceStorage{dir: s.dir}
 	return s.r
 }
 
 func (s *Storage) ConfigStorage() config.ConfigStorage {
-	if s.c != nil {
-		return s.c
+	return s.c
+}
+
+// Init initializes a new git directory, creating the object and reference
+// directories and the core section of the config, bare sets core.bare.
+func (s *Storage) Init(bare bool) error {
+	if err := s.dir.Initialize(); err != nil {
+		return err
 	}
 
-	s.c = &ConfigStorage{dir: s.dir}
-	return s.c
+	return s.c.init(bare)
+}
+
+// Index returns the index of the repository, an empty index is returned if
+// the repository has no index file.
+func (s *Storage) Index() (*index.Index, error) {
+	idx := &index.Index{}
+	f, err := s.dir.Index()
+	if err != nil {
+		if err == dotgit.ErrIndexNotFound {
+			return idx, nil
+		}
+
+		return nil, err
+	}
+
+	defer f.Close()
+
+	if err := index.NewDecoder(f).Decode(idx); err != nil {
+		return nil, err
+	}
+
+	return idx, nil
+}
+
+// Close releases the resources held by the storage, as the open packfiles.
+func (s *Storage) Close() error {
+	return s.o.Close()
 }
@@ -3,7 +3,10 @@ package filesystem
 import (
 	"testing"
 
+	"gopkg.in/src-d/go-git.v4/core"
 	"gopkg.in/src-d/go-git.v4/storage/test"
+	"gopkg.in/src-d/go-git.v4/utils/fs"
+	"gopkg.in/src-d/go-git.v4/utils/fs/memory"
 	"gopkg.in/src-d/go-git.v4/utils/fs/os"
 
 	. "gopkg.in/check.v1"
@@ -13,13 +16,15 @@ func Test(t *testing.T) { TestingT(t) }
 
 type StorageSuite struct {
 	test.BaseStorageSuite
+	fs fs.Filesystem
 }
 
 var _ = Suite(&StorageSuite{})
 
 func (s *StorageSuite) SetUpTest(c *C) {
 	path := c.MkDir()
-	storage, err := NewStorage(os.NewOS(path))
+	s.fs = os.NewOS(path)
+	storage, err := NewStorage(s.fs)
 	c.Assert(err, IsNil)
 	s.BaseStorageSuite = test.NewBaseStorageSuite(
 		storage.ObjectStorage(),
@@ -28,10 +33,40 @@ func (s *StorageSuite) SetUpTest(c *C) {
 	)
 }
 
-func (s *StorageSuite) TestTxObjectStorageSetAndCommit(c *C) {
-	c.Skip("tx not supported")
+func (s *StorageSuite) TestTxObjectStorageRollbackRemovesFiles(c *C) {
+	tx := s.ObjectStorage.Begin()
+
+	obj := &core.MemoryObject{}
+	obj.SetType(core.BlobObject)
+	obj.SetSize(3)
+	obj.Write([]byte("foo"))
+
+	h, err := tx.Set(obj)
+	c.Assert(err, IsNil)
+
+	_, err = s.ObjectStorage.Get(core.AnyObject, h)
+	c.Assert(err, Equals, core.ErrObjectNotFound)
+
+	c.Assert(tx.Rollback(), IsNil)
+
+	files, err := s.fs.ReadDir("objects/pack")
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 0)
+}
+
+type MemoryFilesystemSuite struct {
+	StorageSuite
 }
 
-func (s *StorageSuite) TestTxObjectStorageSetAndRollback(c *C) {
-	c.Skip("tx not supported")
+var _ = Suite(&MemoryFilesystemSuite{})
+
+func (s *MemoryFilesystemSuite) SetUpTest(c *C) {
+	s.fs = memory.New()
+	storage, err := NewStorage(s.fs)
+	c.Assert(err, IsNil)
+	s.BaseStorageSuite = test.NewBaseStorageSuite(
+		storage.ObjectStorage(),
+		storage.ReferenceStorage(),
+		storage.ConfigStorage(),
+	)
 }
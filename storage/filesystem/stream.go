@@ -0,0 +1,124 @@
+package filesystem
+
+import (
+	"errors"
+	"io"
+
+	"gopkg.in/src-d/go-git.v4/core"
+	"gopkg.in/src-d/go-git.v4/formats/objfile"
+	"gopkg.in/src-d/go-git.v4/formats/packfile"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem/internal/dotgit"
+)
+
+// DefaultLargeObjectThreshold is the size from which the objects are read
+// from disk as they are consumed, instead of being loaded in memory, when no
+// threshold is given
+const DefaultLargeObjectThreshold = 1024 * 1024
+
+// ErrStreamedObjectReadOnly is returned when the Writer of an object streamed
+// from disk is requested
+var ErrStreamedObjectReadOnly = errors.New("streamed objects are read-only")
+
+// streamedObject is a core.Object whose content is read from disk each time
+// Reader is called, the content is never kept in memory.
+type streamedObject struct {
+	h    core.Hash
+	t    core.ObjectType
+	size int64
+
+	open func() (core.ObjectReader, error)
+}
+
+func (o *streamedObject) Hash() core.Hash                    { return o.h }
+func (o *streamedObject) Type() core.ObjectType              { return o.t }
+func (o *streamedObject) SetType(t core.ObjectType)          { o.t = t }
+func (o *streamedObject) Size() int64                        { return o.size }
+func (o *streamedObject) SetSize(s int64)                    { o.size = s }
+func (o *streamedObject) Reader() (core.ObjectReader, error) { return o.open() }
+
+// Writer always fails, since the content is read from disk.
+func (o *streamedObject) Writer() (core.ObjectWriter, error) {
+	return nil, ErrStreamedObjectReadOnly
+}
+
+// newLooseObject returns a streamed object of a loose object file.
+func newLooseObject(dir *dotgit.DotGit, h core.Hash, t core.ObjectType, size int64) core.Object {
+	return &streamedObject{h: h, t: t, size: size, open: func() (core.ObjectReader, error) {
+		f, err := dir.Object(h)
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := objfile.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		if _, _, err := r.Header(); err != nil {
+			r.Close()
+			f.Close()
+			return nil, err
+		}
+
+		return &streamReader{Reader: r, close: func() error {
+			err := r.Close()
+			if errClose := f.Close(); err == nil {
+				err = errClose
+			}
+
+			return err
+		}}, nil
+	}}
+}
+
+// newPackedObject returns a streamed object of a non-delta object stored in
+// a packfile at the given offset.
+func newPackedObject(
+	packs *packPool, pack core.Hash, offset int64,
+	h core.Hash, t core.ObjectType, size int64,
+) core.Object {
+	return &streamedObject{h: h, t: t, size: size, open: func() (core.ObjectReader, error) {
+		f, err := packs.Get(pack)
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := readPackedObject(f, offset)
+		if err != nil {
+			packs.Put(f)
+			return nil, err
+		}
+
+		return &streamReader{Reader: r, close: func() error {
+			err := r.Close()
+			if errPut := packs.Put(f); err == nil {
+				err = errPut
+			}
+
+			return err
+		}}, nil
+	}}
+}
+
+func readPackedObject(f *openPack, offset int64) (io.ReadCloser, error) {
+	p := packfile.NewScanner(f.Reader())
+	if _, err := p.Seek(offset); err != nil {
+		return nil, err
+	}
+
+	if _, err := p.NextObjectHeader(); err != nil {
+		return nil, err
+	}
+
+	return p.NextObjectReader()
+}
+
+type streamReader struct {
+	io.Reader
+	close func() error
+}
+
+func (r *streamReader) Close() error {
+	return r.close()
+}
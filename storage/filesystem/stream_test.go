@@ -0,0 +1,126 @@
+package filesystem
+
+import (
+	"io/ioutil"
+
+	"gopkg.in/src-d/go-git.v4/core"
+	"gopkg.in/src-d/go-git.v4/fixtures"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem/internal/dotgit"
+	"gopkg.in/src-d/go-git.v4/utils/fs/os"
+
+	. "gopkg.in/check.v1"
+)
+
+type StreamSuite struct {
+	fixtures.Suite
+}
+
+var _ = Suite(&StreamSuite{})
+
+func (s *StreamSuite) TestGetFromPackfileStreamed(c *C) {
+	fixtures.Basic().ByTag(".git").Test(c, func(f *fixtures.Fixture) {
+		dir := dotgit.New(f.DotGit())
+		expected := s.readAll(c, dir, Options{LargeObjectThreshold: -1})
+
+		streamed, err := newObjectStorage(dir, Options{LargeObjectThreshold: 1})
+		c.Assert(err, IsNil)
+		defer streamed.Close()
+
+		for h, content := range expected {
+			obj, err := streamed.Get(core.AnyObject, h)
+			c.Assert(err, IsNil)
+			c.Assert(obj.Hash(), Equals, h)
+			c.Assert(obj.Size(), Equals, int64(len(content)))
+			c.Assert(s.content(c, obj), Equals, content)
+		}
+	})
+}
+
+func (s *StreamSuite) TestGetFromPackfileStreamedIsReadOnly(c *C) {
+	fixtures.Basic().ByTag(".git").Test(c, func(f *fixtures.Fixture) {
+		o, err := newObjectStorage(dotgit.New(f.DotGit()), Options{LargeObjectThreshold: 1})
+		c.Assert(err, IsNil)
+		defer o.Close()
+
+		// blob stored without delta
+		h := core.NewHash("32858aad3c383ed1ff0a0f9bdf231d54a00c9e88")
+		obj, err := o.Get(core.BlobObject, h)
+		c.Assert(err, IsNil)
+
+		_, ok := obj.(*streamedObject)
+		c.Assert(ok, Equals, true)
+
+		_, err = obj.Writer()
+		c.Assert(err, Equals, ErrStreamedObjectReadOnly)
+	})
+}
+
+func (s *StreamSuite) TestGetFromUnpackedStreamed(c *C) {
+	dir := dotgit.New(os.NewOS(c.MkDir()))
+	o, err := newObjectStorage(dir, Options{LargeObjectThreshold: 4})
+	c.Assert(err, IsNil)
+
+	small := s.newBlob(c, "foo")
+	large := s.newBlob(c, "foo bar")
+	for _, obj := range []core.Object{small, large} {
+		_, err := o.Set(obj)
+		c.Assert(err, IsNil)
+	}
+
+	obj, err := o.Get(core.AnyObject, small.Hash())
+	c.Assert(err, IsNil)
+	_, ok := obj.(*core.MemoryObject)
+	c.Assert(ok, Equals, true)
+	c.Assert(s.content(c, obj), Equals, "foo")
+
+	obj, err = o.Get(core.BlobObject, large.Hash())
+	c.Assert(err, IsNil)
+	_, ok = obj.(*streamedObject)
+	c.Assert(ok, Equals, true)
+	c.Assert(obj.Size(), Equals, int64(7))
+	c.Assert(s.content(c, obj), Equals, "foo bar")
+	c.Assert(s.content(c, obj), Equals, "foo bar")
+}
+
+func (s *StreamSuite) readAll(c *C, dir *dotgit.DotGit, o Options) map[core.Hash]string {
+	storage, err := newObjectStorage(dir, o)
+	c.Assert(err, IsNil)
+	defer storage.Close()
+
+	iter, err := storage.Iter(core.AnyObject)
+	c.Assert(err, IsNil)
+
+	content := make(map[core.Hash]string, 0)
+	err = iter.ForEach(func(obj core.Object) error {
+		content[obj.Hash()] = s.content(c, obj)
+		return nil
+	})
+
+	c.Assert(err, IsNil)
+	return content
+}
+
+func (s *StreamSuite) content(c *C, obj core.Object) string {
+	r, err := obj.Reader()
+	c.Assert(err, IsNil)
+
+	content, err := ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+	c.Assert(r.Close(), IsNil)
+
+	return string(content)
+}
+
+func (s *StreamSuite) newBlob(c *C, content string) core.Object {
+	obj := &core.MemoryObject{}
+	obj.SetType(core.BlobObject)
+	obj.SetSize(int64(len(content)))
+
+	w, err := obj.Writer()
+	c.Assert(err, IsNil)
+	_, err = w.Write([]byte(content))
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	return obj
+}
@@ -2,110 +2,191 @@
 package memory
 
 import (
+	"bytes"
 	"fmt"
+	"sort"
+	"sync"
 
 	"gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/core"
+	format "gopkg.in/src-d/go-git.v4/formats/config"
 )
 
 var ErrUnsupportedObjectType = fmt.Errorf("unsupported object type")
 
-// Storage in memory storage system
+// Storage in memory storage system, its object, reference and config storages
+// are safe for concurrent use by multiple goroutines.
 type Storage struct {
 	c *ConfigStorage
 	o *ObjectStorage
-	r *ReferenceStorage
+	r *lockedReferenceStorage
 }
 
 // NewStorage returns a new Storage
 func NewStorage() *Storage {
-	return &Storage{}
+	return &Storage{
+		c: &ConfigStorage{config: config.NewConfig()},
+		o: &ObjectStorage{
+			Objects: make(map[core.Hash]core.Object, 0),
+			Commits: make(map[core.Hash]core.Object, 0),
+			Trees:   make(map[core.Hash]core.Object, 0),
+			Blobs:   make(map[core.Hash]core.Object, 0),
+			Tags:    make(map[core.Hash]core.Object, 0),
+		},
+		r: &lockedReferenceStorage{refs: make(ReferenceStorage, 0)},
+	}
 }
 
-// ConfigStorage return the ConfigStorage, if not exists create a new one
+// ConfigStorage returns the ConfigStorage
 func (s *Storage) ConfigStorage() config.ConfigStorage {
-	if s.c != nil {
-		return s.c
-	}
-
-	s.c = &ConfigStorage{
-		RemotesConfig: make(map[string]*config.RemoteConfig),
-	}
-
 	return s.c
 }
 
-// ObjectStorage returns the ObjectStorage, if not exists creates a new one
+// ObjectStorage returns the ObjectStorage
 func (s *Storage) ObjectStorage() core.ObjectStorage {
-	if s.o != nil {
-		return s.o
+	return s.o
+}
+
+// ReferenceStorage returns the ReferenceStorage, safe for concurrent use
+func (s *Storage) ReferenceStorage() core.ReferenceStorage {
+	return s.r
+}
+
+// ConfigStorage is the implementation of config.ConfigStorage for memory, it's
+// safe for concurrent use.
+type ConfigStorage struct {
+	// config is kept marshaled, its Raw config is up to date so it can be read
+	// without being modified
+	config *config.Config
+
+	m sync.RWMutex
+}
+
+// Config returns a copy of the stored config.
+func (c *ConfigStorage) Config() (*config.Config, error) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	return decodeConfig(c.config.Raw)
+}
+
+// SetConfig validates and stores a copy of the given config.
+func (c *ConfigStorage) SetConfig(cfg *config.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
 	}
 
-	s.o = &ObjectStorage{
-		Objects: make(map[core.Hash]core.Object, 0),
-		Commits: make(map[core.Hash]core.Object, 0),
-		Trees:   make(map[core.Hash]core.Object, 0),
-		Blobs:   make(map[core.Hash]core.Object, 0),
-		Tags:    make(map[core.Hash]core.Object, 0),
+	cfg, err := copyConfig(cfg)
+	if err != nil {
+		return err
 	}
 
-	return s.o
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.config = cfg
+	return nil
 }
 
-// ReferenceStorage returns the ReferenceStorage if not exists creates a new one
-func (s *Storage) ReferenceStorage() core.ReferenceStorage {
-	if s.r != nil {
-		return s.r
+// copyConfig returns a deep copy of cfg, as it would be read back from a
+// config file, the Raw config of cfg is updated with its fields.
+func copyConfig(cfg *config.Config) (*config.Config, error) {
+	if _, err := cfg.Marshal(); err != nil {
+		return nil, err
 	}
 
-	r := make(ReferenceStorage, 0)
-	s.r = &r
-
-	return s.r
+	return decodeConfig(cfg.Raw)
 }
 
-type ConfigStorage struct {
-	RemotesConfig map[string]*config.RemoteConfig
+// decodeConfig returns a new config read from raw, which is not modified.
+func decodeConfig(raw *format.Config) (*config.Config, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := format.NewEncoder(buf).Encode(raw); err != nil {
+		return nil, err
+	}
+
+	result := config.NewConfig()
+	if err := result.Unmarshal(buf.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return result, nil
 }
 
 func (c *ConfigStorage) Remote(name string) (*config.RemoteConfig, error) {
-	r, ok := c.RemotesConfig[name]
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	r, ok := c.config.Remotes[name]
 	if ok {
-		return r, nil
+		return copyRemote(r), nil
 	}
 
 	return nil, config.ErrRemoteConfigNotFound
 }
 
+// copyRemote returns a deep copy of r.
+func copyRemote(r *config.RemoteConfig) *config.RemoteConfig {
+	result := *r
+	result.URLs = append([]string(nil), r.URLs...)
+	result.Fetch = append([]config.RefSpec(nil), r.Fetch...)
+	result.PushURLs = append([]string(nil), r.PushURLs...)
+	result.Push = append([]config.RefSpec(nil), r.Push...)
+	return &result
+}
+
+// Remotes returns the remotes of the config, sorted by name.
 func (c *ConfigStorage) Remotes() ([]*config.RemoteConfig, error) {
-	var o []*config.RemoteConfig
-	for _, r := range c.RemotesConfig {
-		o = append(o, r)
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	names := make([]string, 0, len(c.config.Remotes))
+	for name := range c.config.Remotes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	o := make([]*config.RemoteConfig, len(names))
+	for i, name := range names {
+		o[i] = copyRemote(c.config.Remotes[name])
 	}
 
 	return o, nil
 }
+
 func (c *ConfigStorage) SetRemote(r *config.RemoteConfig) error {
 	if err := r.Validate(); err != nil {
 		return err
 	}
 
-	c.RemotesConfig[r.Name] = r
-	return nil
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.config.Remotes[r.Name] = copyRemote(r)
+	_, err := c.config.Marshal()
+	return err
 }
 
 func (c *ConfigStorage) DeleteRemote(name string) error {
-	delete(c.RemotesConfig, name)
-	return nil
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	delete(c.config.Remotes, name)
+	_, err := c.config.Marshal()
+	return err
 }
 
-// ObjectStorage is the implementation of core.ObjectStorage for memory.Object
+// ObjectStorage is the implementation of core.ObjectStorage for memory.Object,
+// it's safe for concurrent use as long as the maps are not accessed directly.
+// The objects are shared by all the callers of Get, they must not be modified.
 type ObjectStorage struct {
 	Objects map[core.Hash]core.Object
 	Commits map[core.Hash]core.Object
 	Trees   map[core.Hash]core.Object
 	Blobs   map[core.Hash]core.Object
 	Tags    map[core.Hash]core.Object
+
+	m sync.RWMutex
 }
 
 // NewObject creates a new MemoryObject
@@ -116,6 +197,10 @@ func (o *ObjectStorage) NewObject() core.Object {
 // Set stores an object, the object should be properly filled before set it.
 func (o *ObjectStorage) Set(obj core.Object) (core.Hash, error) {
 	h := obj.Hash()
+
+	o.m.Lock()
+	defer o.m.Unlock()
+
 	o.Objects[h] = obj
 
 	switch obj.Type() {
@@ -136,6 +221,9 @@ func (o *ObjectStorage) Set(obj core.Object) (core.Hash, error) {
 
 // Get returns a object with the given hash
 func (o *ObjectStorage) Get(t core.ObjectType, h core.Hash) (core.Object, error) {
+	o.m.RLock()
+	defer o.m.RUnlock()
+
 	obj, ok := o.Objects[h]
 	if !ok || (core.AnyObject != t && obj.Type() != t) {
 		return nil, core.ErrObjectNotFound
@@ -146,6 +234,9 @@ func (o *ObjectStorage) Get(t core.ObjectType, h core.Hash) (core.Object, error)
 
 // Iter returns a core.ObjectIter for the given core.ObjectTybe
 func (o *ObjectStorage) Iter(t core.ObjectType) (core.ObjectIter, error) {
+	o.m.RLock()
+	defer o.m.RUnlock()
+
 	var series []core.Object
 	switch t {
 	case core.AnyObject:
@@ -171,6 +262,8 @@ func flattenObjectMap(m map[core.Hash]core.Object) []core.Object {
 	return objects
 }
 
+// Begin starts a transaction, the transactions are not safe for concurrent
+// use.
 func (o *ObjectStorage) Begin() core.TxObjectStorage {
 	return &TxObjectStorage{
 		Storage: o,
@@ -215,6 +308,9 @@ func (tx *TxObjectStorage) Rollback() error {
 	return nil
 }
 
+// ReferenceStorage is a map of references implementing core.ReferenceStorage,
+// it's not safe for concurrent use, the ReferenceStorage of a Storage is
+// wrapped with a lock.
 type ReferenceStorage map[core.ReferenceName]*core.Reference
 
 // Set stores a reference.
@@ -236,6 +332,46 @@ func (r ReferenceStorage) Get(n core.ReferenceName) (*core.Reference, error) {
 	return ref, nil
 }
 
+// CheckAndSetReference stores a reference, if old is not nil the stored
+// reference should be equal to it, or not exist if old is absent.
+func (r ReferenceStorage) CheckAndSetReference(new, old *core.Reference) error {
+	if new == nil {
+		return nil
+	}
+
+	if err := r.checkReference(new.Name(), old); err != nil {
+		return err
+	}
+
+	r[new.Name()] = new
+	return nil
+}
+
+func (r ReferenceStorage) checkReference(n core.ReferenceName, old *core.Reference) error {
+	if old == nil {
+		return nil
+	}
+
+	ref, ok := r[n]
+	if old.IsAbsent() {
+		ok = !ok
+	} else if ok {
+		ok = ref.Equals(old)
+	}
+
+	if !ok {
+		return core.ErrReferenceHasChanged
+	}
+
+	return nil
+}
+
+// Remove deletes the reference with the given name
+func (r ReferenceStorage) Remove(n core.ReferenceName) error {
+	delete(r, n)
+	return nil
+}
+
 // Iter returns a core.ReferenceIter
 func (r ReferenceStorage) Iter() (core.ReferenceIter, error) {
 	var refs []*core.Reference
@@ -245,3 +381,126 @@ func (r ReferenceStorage) Iter() (core.ReferenceIter, error) {
 
 	return core.NewReferenceSliceIter(refs), nil
 }
+
+// Begin starts a reference transaction.
+func (r ReferenceStorage) Begin() core.TxReferenceStorage {
+	return &TxReferenceStorage{Storage: r}
+}
+
+// TxReferenceStorage is the implementation of core.TxReferenceStorage for a
+// ReferenceStorage.
+type TxReferenceStorage struct {
+	Storage ReferenceStorage
+	Updates []*ReferenceUpdate
+}
+
+// ReferenceUpdate is a queued change of a TxReferenceStorage, a nil New
+// removes the reference.
+type ReferenceUpdate struct {
+	Name     core.ReferenceName
+	New, Old *core.Reference
+}
+
+func (tx *TxReferenceStorage) CheckAndSetReference(new, old *core.Reference) error {
+	if new == nil {
+		return nil
+	}
+
+	tx.Updates = append(tx.Updates, &ReferenceUpdate{
+		Name: new.Name(), New: new, Old: old,
+	})
+
+	return nil
+}
+
+func (tx *TxReferenceStorage) CheckAndRemoveReference(n core.ReferenceName, old *core.Reference) error {
+	tx.Updates = append(tx.Updates, &ReferenceUpdate{Name: n, Old: old})
+	return nil
+}
+
+func (tx *TxReferenceStorage) Commit() error {
+	for _, u := range tx.Updates {
+		if err := tx.Storage.checkReference(u.Name, u.Old); err != nil {
+			return err
+		}
+	}
+
+	for _, u := range tx.Updates {
+		if u.New == nil {
+			delete(tx.Storage, u.Name)
+			continue
+		}
+
+		tx.Storage[u.Name] = u.New
+	}
+
+	tx.Updates = nil
+	return nil
+}
+
+func (tx *TxReferenceStorage) Rollback() error {
+	tx.Updates = nil
+	return nil
+}
+
+// lockedReferenceStorage is a ReferenceStorage safe for concurrent use.
+type lockedReferenceStorage struct {
+	m    sync.RWMutex
+	refs ReferenceStorage
+}
+
+func (r *lockedReferenceStorage) Set(ref *core.Reference) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.refs.Set(ref)
+}
+
+func (r *lockedReferenceStorage) Get(n core.ReferenceName) (*core.Reference, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	return r.refs.Get(n)
+}
+
+func (r *lockedReferenceStorage) CheckAndSetReference(new, old *core.Reference) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.refs.CheckAndSetReference(new, old)
+}
+
+func (r *lockedReferenceStorage) Remove(n core.ReferenceName) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.refs.Remove(n)
+}
+
+func (r *lockedReferenceStorage) Iter() (core.ReferenceIter, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	return r.refs.Iter()
+}
+
+// Begin starts a reference transaction, the updates are applied holding the
+// lock of the storage.
+func (r *lockedReferenceStorage) Begin() core.TxReferenceStorage {
+	return &lockedTxReferenceStorage{
+		TxReferenceStorage: &TxReferenceStorage{Storage: r.refs},
+		m:                  &r.m,
+	}
+}
+
+type lockedTxReferenceStorage struct {
+	*TxReferenceStorage
+	m *sync.RWMutex
+}
+
+func (tx *lockedTxReferenceStorage) Commit() error {
+	tx.m.Lock()
+	defer tx.m.Unlock()
+
+	return tx.TxReferenceStorage.Commit()
+}
@@ -7,9 +7,11 @@ import (
 	"io"
 	"io/ioutil"
 	"sort"
+	"sync"
 
 	"gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/core"
+	"gopkg.in/src-d/go-git.v4/formats/packfile"
 
 	. "gopkg.in/check.v1"
 )
@@ -227,6 +229,170 @@ func (s *BaseStorageSuite) TestReferenceStorageGetNotFound(c *C) {
 	c.Assert(r, IsNil)
 }
 
+func (s *BaseStorageSuite) TestReferenceStorageRemove(c *C) {
+	err := s.ReferenceStorage.Set(
+		core.NewReferenceFromStrings("refs/heads/foo", "bc9968d75e48de59f0870ffb71f5e160bbbdcf52"),
+	)
+	c.Assert(err, IsNil)
+
+	err = s.ReferenceStorage.Remove(core.ReferenceName("refs/heads/foo"))
+	c.Assert(err, IsNil)
+
+	r, err := s.ReferenceStorage.Get(core.ReferenceName("refs/heads/foo"))
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+	c.Assert(r, IsNil)
+
+	err = s.ReferenceStorage.Remove(core.ReferenceName("refs/heads/foo"))
+	c.Assert(err, IsNil)
+}
+
+func (s *BaseStorageSuite) TestReferenceStorageCheckAndSetReference(c *C) {
+	old := core.NewReferenceFromStrings("refs/heads/foo", "bc9968d75e48de59f0870ffb71f5e160bbbdcf52")
+	err := s.ReferenceStorage.Set(old)
+	c.Assert(err, IsNil)
+
+	new := core.NewReferenceFromStrings("refs/heads/foo", "482e0eada5de4039e6f216b45b3c9b683b83bfa0")
+	err = s.ReferenceStorage.CheckAndSetReference(new, old)
+	c.Assert(err, IsNil)
+
+	e, err := s.ReferenceStorage.Get(core.ReferenceName("refs/heads/foo"))
+	c.Assert(err, IsNil)
+	c.Assert(e.Hash().String(), Equals, "482e0eada5de4039e6f216b45b3c9b683b83bfa0")
+
+	err = s.ReferenceStorage.CheckAndSetReference(old, old)
+	c.Assert(err, Equals, core.ErrReferenceHasChanged)
+
+	e, err = s.ReferenceStorage.Get(core.ReferenceName("refs/heads/foo"))
+	c.Assert(err, IsNil)
+	c.Assert(e.Hash().String(), Equals, "482e0eada5de4039e6f216b45b3c9b683b83bfa0")
+
+	err = s.ReferenceStorage.CheckAndSetReference(old, nil)
+	c.Assert(err, IsNil)
+}
+
+func (s *BaseStorageSuite) TestReferenceStorageCheckAndSetReferenceNotFound(c *C) {
+	old := core.NewReferenceFromStrings("refs/heads/foo", "bc9968d75e48de59f0870ffb71f5e160bbbdcf52")
+	err := s.ReferenceStorage.CheckAndSetReference(old, old)
+	c.Assert(err, Equals, core.ErrReferenceHasChanged)
+
+	_, err = s.ReferenceStorage.Get(core.ReferenceName("refs/heads/foo"))
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+}
+
+func (s *BaseStorageSuite) TestReferenceStorageCheckAndSetReferenceAbsent(c *C) {
+	foo := core.NewReferenceFromStrings("refs/heads/foo", "bc9968d75e48de59f0870ffb71f5e160bbbdcf52")
+	absent := core.NewHashReference(foo.Name(), core.ZeroHash)
+	c.Assert(absent.IsAbsent(), Equals, true)
+
+	err := s.ReferenceStorage.CheckAndSetReference(foo, absent)
+	c.Assert(err, IsNil)
+
+	e, err := s.ReferenceStorage.Get(foo.Name())
+	c.Assert(err, IsNil)
+	c.Assert(e.Hash(), Equals, foo.Hash())
+
+	bar := core.NewReferenceFromStrings("refs/heads/foo", "482e0eada5de4039e6f216b45b3c9b683b83bfa0")
+	err = s.ReferenceStorage.CheckAndSetReference(bar, absent)
+	c.Assert(err, Equals, core.ErrReferenceHasChanged)
+
+	e, err = s.ReferenceStorage.Get(foo.Name())
+	c.Assert(err, IsNil)
+	c.Assert(e.Hash(), Equals, foo.Hash())
+}
+
+func (s *BaseStorageSuite) TestTxReferenceStorageCheckAbsent(c *C) {
+	txs, ok := s.ReferenceStorage.(core.ReferenceStorageTx)
+	if !ok {
+		c.Skip("reference transactions not supported")
+	}
+
+	foo := core.NewReferenceFromStrings("refs/heads/foo", "bc9968d75e48de59f0870ffb71f5e160bbbdcf52")
+	c.Assert(s.ReferenceStorage.Set(foo), IsNil)
+
+	tx := txs.Begin()
+	bar := core.NewReferenceFromStrings("refs/heads/bar", "482e0eada5de4039e6f216b45b3c9b683b83bfa0")
+	c.Assert(tx.CheckAndSetReference(bar, core.NewHashReference(bar.Name(), core.ZeroHash)), IsNil)
+	c.Assert(tx.CheckAndSetReference(foo, core.NewHashReference(foo.Name(), core.ZeroHash)), IsNil)
+	c.Assert(tx.Commit(), Equals, core.ErrReferenceHasChanged)
+
+	_, err := s.ReferenceStorage.Get(bar.Name())
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+
+	tx = txs.Begin()
+	c.Assert(tx.CheckAndSetReference(bar, core.NewHashReference(bar.Name(), core.ZeroHash)), IsNil)
+	c.Assert(tx.Commit(), IsNil)
+
+	_, err = s.ReferenceStorage.Get(bar.Name())
+	c.Assert(err, IsNil)
+}
+
+func (s *BaseStorageSuite) TestTxReferenceStorageCommit(c *C) {
+	txs, ok := s.ReferenceStorage.(core.ReferenceStorageTx)
+	if !ok {
+		c.Skip("reference transactions not supported")
+	}
+
+	foo := core.NewReferenceFromStrings("refs/heads/foo", "bc9968d75e48de59f0870ffb71f5e160bbbdcf52")
+	c.Assert(s.ReferenceStorage.Set(foo), IsNil)
+
+	tx := txs.Begin()
+	bar := core.NewReferenceFromStrings("refs/heads/bar", "482e0eada5de4039e6f216b45b3c9b683b83bfa0")
+	c.Assert(tx.CheckAndSetReference(bar, nil), IsNil)
+	c.Assert(tx.CheckAndRemoveReference(foo.Name(), foo), IsNil)
+
+	_, err := s.ReferenceStorage.Get(bar.Name())
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+
+	c.Assert(tx.Commit(), IsNil)
+
+	e, err := s.ReferenceStorage.Get(bar.Name())
+	c.Assert(err, IsNil)
+	c.Assert(e.Hash().String(), Equals, "482e0eada5de4039e6f216b45b3c9b683b83bfa0")
+
+	_, err = s.ReferenceStorage.Get(foo.Name())
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+}
+
+func (s *BaseStorageSuite) TestTxReferenceStorageCommitHasChanged(c *C) {
+	txs, ok := s.ReferenceStorage.(core.ReferenceStorageTx)
+	if !ok {
+		c.Skip("reference transactions not supported")
+	}
+
+	foo := core.NewReferenceFromStrings("refs/heads/foo", "bc9968d75e48de59f0870ffb71f5e160bbbdcf52")
+	c.Assert(s.ReferenceStorage.Set(foo), IsNil)
+
+	tx := txs.Begin()
+	bar := core.NewReferenceFromStrings("refs/heads/bar", "482e0eada5de4039e6f216b45b3c9b683b83bfa0")
+	c.Assert(tx.CheckAndSetReference(bar, nil), IsNil)
+	changed := core.NewReferenceFromStrings("refs/heads/foo", "482e0eada5de4039e6f216b45b3c9b683b83bfa0")
+	c.Assert(tx.CheckAndSetReference(changed, changed), IsNil)
+
+	c.Assert(tx.Commit(), Equals, core.ErrReferenceHasChanged)
+
+	_, err := s.ReferenceStorage.Get(bar.Name())
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+
+	e, err := s.ReferenceStorage.Get(foo.Name())
+	c.Assert(err, IsNil)
+	c.Assert(e.Hash().String(), Equals, "bc9968d75e48de59f0870ffb71f5e160bbbdcf52")
+}
+
+func (s *BaseStorageSuite) TestTxReferenceStorageRollback(c *C) {
+	txs, ok := s.ReferenceStorage.(core.ReferenceStorageTx)
+	if !ok {
+		c.Skip("reference transactions not supported")
+	}
+
+	tx := txs.Begin()
+	foo := core.NewReferenceFromStrings("refs/heads/foo", "bc9968d75e48de59f0870ffb71f5e160bbbdcf52")
+	c.Assert(tx.CheckAndSetReference(foo, nil), IsNil)
+	c.Assert(tx.Rollback(), IsNil)
+
+	_, err := s.ReferenceStorage.Get(foo.Name())
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+}
+
 func (s *BaseStorageSuite) TestReferenceStorageIter(c *C) {
 	err := s.ReferenceStorage.Set(
 		core.NewReferenceFromStrings("refs/foo", "bc9968d75e48de59f0870ffb71f5e160bbbdcf52"),
@@ -270,6 +436,25 @@ func (s *BaseStorageSuite) TestConfigStorageSetInvalid(c *C) {
 	c.Assert(err, NotNil)
 }
 
+func (s *BaseStorageSuite) TestConfigStorageRemoteIsCopied(c *C) {
+	r := &config.RemoteConfig{Name: "foo", URL: "http://foo/bar.git"}
+	c.Assert(s.ConfigStore.SetRemote(r), IsNil)
+
+	r.URL = "http://foo/baz.git"
+	r.Fetch[0] = "+refs/heads/master:refs/remotes/foo/master"
+
+	stored, err := s.ConfigStore.Remote("foo")
+	c.Assert(err, IsNil)
+	c.Assert(stored.URL, Equals, "http://foo/bar.git")
+	c.Assert(stored.Fetch, DeepEquals, []config.RefSpec{"+refs/heads/*:refs/remotes/foo/*"})
+
+	stored.Fetch[0] = "+refs/heads/master:refs/remotes/foo/master"
+	remotes, err := s.ConfigStore.Remotes()
+	c.Assert(err, IsNil)
+	c.Assert(remotes, HasLen, 1)
+	c.Assert(remotes[0].Fetch, DeepEquals, []config.RefSpec{"+refs/heads/*:refs/remotes/foo/*"})
+}
+
 func (s *BaseStorageSuite) TestConfigStorageRemotes(c *C) {
 	s.ConfigStore.SetRemote(&config.RemoteConfig{
 		Name: "foo", URL: "http://foo/bar.git",
@@ -291,6 +476,248 @@ func (s *BaseStorageSuite) TestConfigStorageRemotes(c *C) {
 	c.Assert(sorted[1], Equals, "foo")
 }
 
+func (s *BaseStorageSuite) TestConfigStorageSetConfig(c *C) {
+	cfg := config.NewConfig()
+	cfg.Core.IsBare = true
+	cfg.User.Name = "John Doe"
+	cfg.User.Email = "john@example.com"
+	cfg.Remotes["origin"] = &config.RemoteConfig{
+		Name:     "origin",
+		URL:      "http://foo/bar.git",
+		URLs:     []string{"http://foo/baz.git"},
+		PushURLs: []string{"http://foo/qux.git"},
+		Push:     []config.RefSpec{"refs/heads/master:refs/heads/master"},
+		TagOpt:   config.AllTags,
+		Mirror:   true,
+	}
+	cfg.Branches["master"] = &config.BranchConfig{
+		Name:   "master",
+		Remote: "origin",
+		Merge:  "refs/heads/master",
+	}
+	cfg.URLs["http://foo/"] = &config.URLConfig{
+		Name:      "http://foo/",
+		InsteadOf: []string{"foo:"},
+	}
+
+	err := s.ConfigStore.SetConfig(cfg)
+	c.Assert(err, IsNil)
+
+	cfg, err = s.ConfigStore.Config()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Core.IsBare, Equals, true)
+	c.Assert(cfg.User.Name, Equals, "John Doe")
+	c.Assert(cfg.User.Email, Equals, "john@example.com")
+
+	r, err := s.ConfigStore.Remote("origin")
+	c.Assert(err, IsNil)
+	c.Assert(r.URL, Equals, "http://foo/bar.git")
+	c.Assert(r.URLs, DeepEquals, []string{"http://foo/baz.git"})
+	c.Assert(r.PushURLs, DeepEquals, []string{"http://foo/qux.git"})
+	c.Assert(r.Push, DeepEquals, []config.RefSpec{"refs/heads/master:refs/heads/master"})
+	c.Assert(r.TagOpt, Equals, config.AllTags)
+	c.Assert(r.Mirror, Equals, true)
+	c.Assert(r.Fetch, DeepEquals, []config.RefSpec{"+refs/heads/*:refs/remotes/origin/*"})
+
+	c.Assert(cfg.Branches, HasLen, 1)
+	c.Assert(cfg.Branches["master"].Remote, Equals, "origin")
+	c.Assert(cfg.Branches["master"].Merge.String(), Equals, "refs/heads/master")
+	c.Assert(cfg.URLs, HasLen, 1)
+	c.Assert(cfg.URLs["http://foo/"].InsteadOf, DeepEquals, []string{"foo:"})
+}
+
+func (s *BaseStorageSuite) TestConfigStorageSetConfigInvalid(c *C) {
+	cfg := config.NewConfig()
+	cfg.Remotes["foo"] = &config.RemoteConfig{Name: "foo"}
+
+	err := s.ConfigStore.SetConfig(cfg)
+	c.Assert(err, Equals, config.ErrRemoteConfigEmptyURL)
+}
+
+// concurrency is the number of goroutines used by the concurrency tests, they
+// are meant to be run with the race detector.
+const concurrency = 16
+
+func (s *BaseStorageSuite) TestObjectStorageConcurrency(c *C) {
+	err := runConcurrently(concurrency, func(i int) error {
+		content := []byte(fmt.Sprintf("object %d", i))
+		o := s.ObjectStorage.NewObject()
+		o.SetType(core.BlobObject)
+		o.SetSize(int64(len(content)))
+
+		w, err := o.Writer()
+		if err != nil {
+			return err
+		}
+
+		if _, err := w.Write(content); err != nil {
+			return err
+		}
+
+		if err := w.Close(); err != nil {
+			return err
+		}
+
+		h, err := s.ObjectStorage.Set(o)
+		if err != nil {
+			return err
+		}
+
+		// the storages supporting packfiles get half of the objects packed
+		if ws, ok := s.ObjectStorage.(core.ObjectStorageWrite); ok && i%2 == 0 {
+			pw, err := ws.Writer()
+			if err != nil {
+				return err
+			}
+
+			e := packfile.NewEncoder(pw, s.ObjectStorage, false)
+			if _, err := e.Encode([]core.Hash{h}); err != nil {
+				pw.Close()
+				return err
+			}
+
+			if err := pw.Close(); err != nil {
+				return err
+			}
+		}
+
+		obj, err := s.ObjectStorage.Get(core.BlobObject, h)
+		if err != nil {
+			return err
+		}
+
+		if err := objectEquals(obj, o); err != nil {
+			return err
+		}
+
+		iter, err := s.ObjectStorage.Iter(core.AnyObject)
+		if err != nil {
+			return err
+		}
+
+		return iter.ForEach(func(core.Object) error { return nil })
+	})
+
+	c.Assert(err, IsNil)
+
+	iter, err := s.ObjectStorage.Iter(core.BlobObject)
+	c.Assert(err, IsNil)
+
+	seen := make(map[core.Hash]bool, 0)
+	err = iter.ForEach(func(o core.Object) error {
+		seen[o.Hash()] = true
+		return nil
+	})
+
+	c.Assert(err, IsNil)
+	c.Assert(seen, HasLen, concurrency)
+}
+
+func (s *BaseStorageSuite) TestReferenceStorageConcurrency(c *C) {
+	shared := core.ReferenceName("refs/heads/shared")
+	err := runConcurrently(concurrency, func(i int) error {
+		name := core.ReferenceName(fmt.Sprintf("refs/heads/branch-%d", i))
+		ref := core.NewHashReference(name, core.NewHash("bc9968d75e48de59f0870ffb71f5e160bbbdcf52"))
+		if err := s.ReferenceStorage.Set(ref); err != nil {
+			return err
+		}
+
+		next := core.NewHashReference(name, core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+		if err := s.ReferenceStorage.CheckAndSetReference(next, ref); err != nil {
+			return err
+		}
+
+		stored, err := s.ReferenceStorage.Get(name)
+		if err != nil {
+			return err
+		}
+
+		if stored.Hash() != next.Hash() {
+			return fmt.Errorf("unexpected hash of %s: %s", name, stored.Hash())
+		}
+
+		if err := s.ReferenceStorage.Set(core.NewHashReference(shared, next.Hash())); err != nil {
+			return err
+		}
+
+		iter, err := s.ReferenceStorage.Iter()
+		if err != nil {
+			return err
+		}
+
+		return iter.ForEach(func(*core.Reference) error { return nil })
+	})
+
+	c.Assert(err, IsNil)
+
+	iter, err := s.ReferenceStorage.Iter()
+	c.Assert(err, IsNil)
+
+	var count int
+	err = iter.ForEach(func(*core.Reference) error {
+		count++
+		return nil
+	})
+
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, concurrency+1)
+}
+
+func (s *BaseStorageSuite) TestConfigStorageConcurrency(c *C) {
+	err := runConcurrently(concurrency, func(i int) error {
+		name := fmt.Sprintf("remote-%d", i)
+		err := s.ConfigStore.SetRemote(&config.RemoteConfig{
+			Name: name,
+			URL:  fmt.Sprintf("http://foo/%d.git", i),
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if _, err = s.ConfigStore.Remotes(); err != nil {
+			return err
+		}
+
+		cfg, err := s.ConfigStore.Config()
+		if err != nil {
+			return err
+		}
+
+		if _, ok := cfg.Remotes[name]; !ok {
+			return fmt.Errorf("remote %q not found in the config", name)
+		}
+
+		return nil
+	})
+
+	c.Assert(err, IsNil)
+
+	remotes, err := s.ConfigStore.Remotes()
+	c.Assert(err, IsNil)
+	c.Assert(remotes, HasLen, concurrency)
+}
+
+// runConcurrently calls fn from n goroutines, returns the first error found.
+func runConcurrently(n int, fn func(i int) error) error {
+	errs := make(chan error, n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := fn(i); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
 func objectEquals(a core.Object, b core.Object) error {
 	ha := a.Hash()
 	hb := b.Hash()
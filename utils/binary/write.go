@@ -28,3 +28,18 @@ func WriteUint32(w io.Writer, value uint32) error {
 func WriteUint16(w io.Writer, value uint16) error {
 	return binary.Write(w, binary.BigEndian, value)
 }
+
+// WriteVariableWidthInt writes the variable width encoding of n into w, in
+// the same format read by ReadVariableWidthInt
+func WriteVariableWidthInt(w io.Writer, n int64) error {
+	buf := []byte{byte(n & int64(maskLength))}
+	n >>= lengthBits
+	for n != 0 {
+		n--
+		buf = append([]byte{maskContinue | byte(n&int64(maskLength))}, buf...)
+		n >>= lengthBits
+	}
+
+	_, err := w.Write(buf)
+	return err
+}
@@ -0,0 +1,27 @@
+// Package cache implements caches of git objects used by the storages
+package cache
+
+import "gopkg.in/src-d/go-git.v4/core"
+
+const (
+	Byte int64 = 1 << (iota * 10)
+	KiByte
+	MiByte
+	GiByte
+)
+
+// DefaultMaxSize is the maximum size of the object caches created by the
+// storages when no cache is given
+const DefaultMaxSize = 96 * MiByte
+
+// Object is an interface to an object cache. The size of an object is the
+// size of its content, as returned by core.Object.Size.
+type Object interface {
+	// Add puts the given object into the cache, evicting other objects if
+	// the maximum size of the cache is exceeded.
+	Add(o core.Object)
+	// Get returns the object with the given hash, if it's in the cache.
+	Get(h core.Hash) (core.Object, bool)
+	// Clear removes all the objects from the cache.
+	Clear()
+}
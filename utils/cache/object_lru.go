@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+
+	"gopkg.in/src-d/go-git.v4/core"
+)
+
+// ObjectLRU is an Object cache with a least recently used eviction policy,
+// bounded by the total size of the objects it holds. It's safe for
+// concurrent use.
+type ObjectLRU struct {
+	MaxSize int64
+
+	actualSize int64
+	ll         *list.List
+	cache      map[core.Hash]*list.Element
+	m          sync.Mutex
+}
+
+// NewObjectLRU returns a new ObjectLRU with the given maximum size in bytes
+func NewObjectLRU(maxSize int64) *ObjectLRU {
+	return &ObjectLRU{MaxSize: maxSize}
+}
+
+// NewObjectLRUDefault returns a new ObjectLRU with DefaultMaxSize
+func NewObjectLRUDefault() *ObjectLRU {
+	return NewObjectLRU(DefaultMaxSize)
+}
+
+// Add adds an object to the cache, marking it as the most recently used. An
+// object bigger than the maximum size of the cache is never added.
+func (c *ObjectLRU) Add(o core.Object) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.cache == nil {
+		c.ll = list.New()
+		c.cache = make(map[core.Hash]*list.Element)
+	}
+
+	size := o.Size()
+	if size > c.MaxSize {
+		return
+	}
+
+	h := o.Hash()
+	if e, ok := c.cache[h]; ok {
+		c.ll.MoveToFront(e)
+		return
+	}
+
+	c.cache[h] = c.ll.PushFront(o)
+	c.actualSize += size
+
+	for c.actualSize > c.MaxSize {
+		last := c.ll.Back()
+		lastObj := last.Value.(core.Object)
+
+		c.ll.Remove(last)
+		delete(c.cache, lastObj.Hash())
+		c.actualSize -= lastObj.Size()
+	}
+}
+
+// Get returns an object by its hash, marking it as the most recently used.
+func (c *ObjectLRU) Get(h core.Hash) (core.Object, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	e, ok := c.cache[h]
+	if !ok {
+		return nil, false
+	}
+
+	c.ll.MoveToFront(e)
+	return e.Value.(core.Object), true
+}
+
+// Clear removes all the objects from the cache.
+func (c *ObjectLRU) Clear() {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.ll = nil
+	c.cache = nil
+	c.actualSize = 0
+}
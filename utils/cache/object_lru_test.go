@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4/core"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type ObjectSuite struct {
+	c       *ObjectLRU
+	aObject core.Object
+	bObject core.Object
+	cObject core.Object
+	dObject core.Object
+}
+
+var _ = Suite(&ObjectSuite{})
+
+func (s *ObjectSuite) SetUpTest(c *C) {
+	s.aObject = newObject("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", 1*Byte)
+	s.bObject = newObject("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", 3*Byte)
+	s.cObject = newObject("cccccccccccccccccccccccccccccccccccccccc", 1*Byte)
+	s.dObject = newObject("dddddddddddddddddddddddddddddddddddddddd", 1*Byte)
+
+	s.c = NewObjectLRU(2 * Byte)
+}
+
+func (s *ObjectSuite) TestAddAndGet(c *C) {
+	s.c.Add(s.aObject)
+	s.c.Add(s.cObject)
+
+	obj, ok := s.c.Get(s.aObject.Hash())
+	c.Assert(ok, Equals, true)
+	c.Assert(obj, Equals, s.aObject)
+
+	obj, ok = s.c.Get(s.cObject.Hash())
+	c.Assert(ok, Equals, true)
+	c.Assert(obj, Equals, s.cObject)
+}
+
+func (s *ObjectSuite) TestEvictsLeastRecentlyUsed(c *C) {
+	s.c.Add(s.aObject)
+	s.c.Add(s.cObject)
+
+	// a is now the most recently used
+	_, ok := s.c.Get(s.aObject.Hash())
+	c.Assert(ok, Equals, true)
+
+	s.c.Add(s.dObject)
+
+	_, ok = s.c.Get(s.cObject.Hash())
+	c.Assert(ok, Equals, false)
+	_, ok = s.c.Get(s.aObject.Hash())
+	c.Assert(ok, Equals, true)
+	_, ok = s.c.Get(s.dObject.Hash())
+	c.Assert(ok, Equals, true)
+}
+
+func (s *ObjectSuite) TestAddBiggerThanMaxSize(c *C) {
+	s.c.Add(s.aObject)
+	s.c.Add(s.bObject)
+
+	_, ok := s.c.Get(s.bObject.Hash())
+	c.Assert(ok, Equals, false)
+	_, ok = s.c.Get(s.aObject.Hash())
+	c.Assert(ok, Equals, true)
+}
+
+func (s *ObjectSuite) TestAddTwice(c *C) {
+	s.c.Add(s.aObject)
+	s.c.Add(s.aObject)
+	c.Assert(s.c.actualSize, Equals, 1*Byte)
+}
+
+func (s *ObjectSuite) TestClear(c *C) {
+	s.c.Add(s.aObject)
+	s.c.Clear()
+
+	_, ok := s.c.Get(s.aObject.Hash())
+	c.Assert(ok, Equals, false)
+	c.Assert(s.c.actualSize, Equals, int64(0))
+}
+
+type dummyObject struct {
+	core.Object
+	hash core.Hash
+	size int64
+}
+
+func newObject(hash string, size int64) core.Object {
+	return &dummyObject{
+		hash: core.NewHash(hash),
+		size: size,
+	}
+}
+
+func (d *dummyObject) Hash() core.Hash { return d.hash }
+func (d *dummyObject) Size() int64     { return d.size }
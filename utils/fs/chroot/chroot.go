@@ -0,0 +1,230 @@
+// Package chroot is a fs.Filesystem wrapper confining every path beneath a
+// base directory
+package chroot
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/utils/fs"
+)
+
+// ErrCrossedBoundary is returned when a path escapes from the base directory.
+var ErrCrossedBoundary = errors.New("chroot boundary crossed")
+
+const parent = ".."
+
+// Chroot is a filesystem wrapper where every path is relative to a base
+// directory of the underlying filesystem. The absolute paths are relative to
+// the base too, and the paths escaping from it using ".." are rejected with
+// ErrCrossedBoundary.
+type Chroot struct {
+	fs   fs.Filesystem
+	base string
+}
+
+// New returns a filesystem confined to the given base directory of fs
+func New(fs fs.Filesystem, base string) *Chroot {
+	return &Chroot{fs: fs, base: base}
+}
+
+// Create creates a file and opens it with standard permissions
+// and modes O_RDWR, O_CREATE and O_TRUNC.
+func (c *Chroot) Create(filename string) (fs.File, error) {
+	return c.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// Open opens a file in read-only mode.
+func (c *Chroot) Open(filename string) (fs.File, error) {
+	return c.OpenFile(filename, os.O_RDONLY, 0)
+}
+
+// OpenFile opens a file of the base directory, as the underlying filesystem
+// does.
+func (c *Chroot) OpenFile(filename string, flag int, perm os.FileMode) (fs.File, error) {
+	fullpath, err := c.fullpath(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := c.fs.OpenFile(fullpath, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.newFile(f)
+}
+
+// Stat returns the FileInfo structure describing file.
+func (c *Chroot) Stat(filename string) (fs.FileInfo, error) {
+	fullpath, err := c.fullpath(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.fs.Stat(fullpath)
+}
+
+// ReadDir returns the filesystem info for all the archives under the specified
+// path.
+func (c *Chroot) ReadDir(path string) ([]fs.FileInfo, error) {
+	fullpath, err := c.fullpath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.fs.ReadDir(fullpath)
+}
+
+// TempFile creates a new temporary file in dir with a name beginning with
+// prefix.
+func (c *Chroot) TempFile(dir, prefix string) (fs.File, error) {
+	fullpath, err := c.fullpath(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := c.fs.TempFile(fullpath, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.newFile(f)
+}
+
+// Rename moves a file, both paths must be inside the base directory.
+func (c *Chroot) Rename(from, to string) error {
+	var err error
+	if from, err = c.fullpath(from); err != nil {
+		return err
+	}
+
+	if to, err = c.fullpath(to); err != nil {
+		return err
+	}
+
+	return c.fs.Rename(from, to)
+}
+
+// Chtimes changes the access and modification times of a file, it fails with
+// fs.ErrNotSupported if the underlying filesystem can't change them.
+func (c *Chroot) Chtimes(filename string, atime, mtime time.Time) error {
+	fullpath, err := c.fullpath(filename)
+	if err != nil {
+		return err
+	}
+
+	cfs, ok := c.fs.(fs.ChtimesFilesystem)
+	if !ok {
+		return fs.ErrNotSupported
+	}
+
+	return cfs.Chtimes(fullpath, atime, mtime)
+}
+
+// Remove deletes a file.
+func (c *Chroot) Remove(filename string) error {
+	fullpath, err := c.fullpath(filename)
+	if err != nil {
+		return err
+	}
+
+	return c.fs.Remove(fullpath)
+}
+
+// MkdirAll creates a directory and all its missing parents.
+func (c *Chroot) MkdirAll(filename string, perm os.FileMode) error {
+	fullpath, err := c.fullpath(filename)
+	if err != nil {
+		return err
+	}
+
+	return c.fs.MkdirAll(fullpath, perm)
+}
+
+// Join joins the specified elements using the filesystem separator.
+func (c *Chroot) Join(elem ...string) string {
+	return c.fs.Join(elem...)
+}
+
+// Dir returns a new Filesystem confined to the given path, if the path escapes
+// from the base directory every operation of the returned filesystem fails.
+func (c *Chroot) Dir(path string) fs.Filesystem {
+	fullpath, err := c.fullpath(path)
+	if err != nil {
+		return New(c, path)
+	}
+
+	return New(c.fs, fullpath)
+}
+
+// Base returns the base path of the filesystem
+func (c *Chroot) Base() string {
+	return c.fs.Join(c.fs.Base(), c.base)
+}
+
+// fullpath returns the path of the given file in the underlying filesystem.
+func (c *Chroot) fullpath(filename string) (string, error) {
+	rel, err := clean(filename)
+	if err != nil {
+		return "", err
+	}
+
+	return c.fs.Join(c.base, rel), nil
+}
+
+// newFile wraps a file of the underlying filesystem, so its name is relative
+// to the base directory.
+func (c *Chroot) newFile(f fs.File) (fs.File, error) {
+	filename, err := filepath.Rel(c.base, f.Filename())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	wrapped := &file{File: f, filename: filename}
+	if r, ok := f.(io.ReaderAt); ok {
+		return &readerAtFile{file: wrapped, r: r}, nil
+	}
+
+	return wrapped, nil
+}
+
+// clean returns the given path relative to the base directory, the paths
+// escaping from it return ErrCrossedBoundary.
+func clean(filename string) (string, error) {
+	sep := string(filepath.Separator)
+	filename = filepath.Clean(strings.TrimLeft(filepath.FromSlash(filename), sep))
+	if filename == parent || strings.HasPrefix(filename, parent+sep) {
+		return "", ErrCrossedBoundary
+	}
+
+	return filename, nil
+}
+
+// file is a file of the underlying filesystem named relatively to the base
+// directory.
+type file struct {
+	fs.File
+	filename string
+}
+
+func (f *file) Filename() string {
+	return f.filename
+}
+
+// readerAtFile is a file whose underlying file implements io.ReaderAt, the
+// files not implementing it are wrapped by file, so they don't implement it
+// either.
+type readerAtFile struct {
+	*file
+	r io.ReaderAt
+}
+
+func (f *readerAtFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.r.ReadAt(p, off)
+}
@@ -0,0 +1,114 @@
+package chroot
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4/utils/fs"
+	"gopkg.in/src-d/go-git.v4/utils/fs/memory"
+	"gopkg.in/src-d/go-git.v4/utils/fs/test"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type ChrootSuite struct {
+	test.FilesystemSuite
+	underlying *memory.Memory
+}
+
+var _ = Suite(&ChrootSuite{})
+
+func (s *ChrootSuite) SetUpTest(c *C) {
+	s.underlying = memory.New()
+	s.FilesystemSuite.Fs = New(s.underlying, "base")
+}
+
+func (s *ChrootSuite) TestCreateInBase(c *C) {
+	f, err := s.Fs.Create("/foo/../bar")
+	c.Assert(err, IsNil)
+	c.Assert(f.Filename(), Equals, "bar")
+	c.Assert(f.Close(), IsNil)
+
+	_, err = s.underlying.Stat("base/bar")
+	c.Assert(err, IsNil)
+}
+
+func (s *ChrootSuite) TestCrossedBoundary(c *C) {
+	f, err := s.underlying.Create("secret")
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	_, err = s.Fs.Open("../secret")
+	c.Assert(err, Equals, ErrCrossedBoundary)
+
+	_, err = s.Fs.Create("foo/../../secret")
+	c.Assert(err, Equals, ErrCrossedBoundary)
+
+	_, err = s.Fs.Stat("/../secret")
+	c.Assert(err, Equals, ErrCrossedBoundary)
+
+	_, err = s.Fs.ReadDir("..")
+	c.Assert(err, Equals, ErrCrossedBoundary)
+
+	_, err = s.Fs.TempFile("..", "foo")
+	c.Assert(err, Equals, ErrCrossedBoundary)
+
+	c.Assert(s.Fs.Rename("foo", "../foo"), Equals, ErrCrossedBoundary)
+	c.Assert(s.Fs.Remove("../secret"), Equals, ErrCrossedBoundary)
+
+	_, err = s.underlying.Stat("secret")
+	c.Assert(err, IsNil)
+}
+
+func (s *ChrootSuite) TestDirCrossedBoundary(c *C) {
+	_, err := s.Fs.Dir("..").Open("secret")
+	c.Assert(err, Equals, ErrCrossedBoundary)
+
+	_, err = s.Fs.Dir("foo").Open("../../secret")
+	c.Assert(err, Equals, ErrCrossedBoundary)
+}
+
+func (s *ChrootSuite) TestBaseUnderlying(c *C) {
+	c.Assert(s.Fs.Base(), Equals, "/base")
+	c.Assert(s.Fs.Dir("foo").Base(), Equals, "/base/foo")
+}
+
+func (s *ChrootSuite) TestReadAt(c *C) {
+	f, err := s.Fs.Create("foo")
+	c.Assert(err, IsNil)
+	_, err = f.Write([]byte("foo"))
+	c.Assert(err, IsNil)
+
+	r, ok := f.(io.ReaderAt)
+	c.Assert(ok, Equals, true)
+
+	b := make([]byte, 2)
+	n, err := r.ReadAt(b, 1)
+	c.Assert(err, IsNil)
+	c.Assert(string(b[:n]), Equals, "oo")
+	c.Assert(f.Close(), IsNil)
+
+	f, err = New(&noReaderAtFilesystem{s.underlying}, "base").Open("foo")
+	c.Assert(err, IsNil)
+	_, ok = f.(io.ReaderAt)
+	c.Assert(ok, Equals, false)
+	c.Assert(f.Close(), IsNil)
+}
+
+// noReaderAtFilesystem is a filesystem whose files don't implement
+// io.ReaderAt.
+type noReaderAtFilesystem struct {
+	fs.Filesystem
+}
+
+func (n *noReaderAtFilesystem) OpenFile(filename string, flag int, perm os.FileMode) (fs.File, error) {
+	f, err := n.Filesystem.OpenFile(filename, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	return struct{ fs.File }{f}, nil
+}
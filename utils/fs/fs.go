@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io"
 	"os"
+	"time"
 )
 
 var (
@@ -22,11 +23,18 @@ type Filesystem interface {
 	TempFile(dir, prefix string) (File, error)
 	Rename(from, to string) error
 	Remove(filename string) error
+	MkdirAll(filename string, perm os.FileMode) error
 	Join(elem ...string) string
 	Dir(path string) Filesystem
 	Base() string
 }
 
+// ChtimesFilesystem is an optional interface for Filesystem, it changes the
+// access and modification times of a file, as os.Chtimes does.
+type ChtimesFilesystem interface {
+	Chtimes(filename string, atime, mtime time.Time) error
+}
+
 type File interface {
 	Filename() string
 	IsClosed() bool
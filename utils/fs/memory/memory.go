@@ -0,0 +1,579 @@
+// Package memory is a fs.Filesystem implementation kept in memory
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/utils/fs"
+)
+
+const separator = "/"
+
+var (
+	errIsDir       = errors.New("is a directory")
+	errNotDir      = errors.New("not a directory")
+	errNotEmpty    = errors.New("directory not empty")
+	errNotReadable = errors.New("file not opened for reading")
+	errNotWritable = errors.New("file not opened for writing")
+)
+
+// Memory is a filesystem kept in memory, safe for concurrent use by multiple
+// goroutines. The parent directories are created as needed, as the os
+// filesystem does, and the files opened several times share their content.
+type Memory struct {
+	s    *storage
+	base string
+}
+
+// New returns a new empty Memory filesystem
+func New() *Memory {
+	return &Memory{s: newStorage(), base: separator}
+}
+
+// Create creates a file and opens it with standard permissions
+// and modes O_RDWR, O_CREATE and O_TRUNC.
+func (m *Memory) Create(filename string) (fs.File, error) {
+	return m.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// Open opens a file in read-only mode.
+func (m *Memory) Open(filename string) (fs.File, error) {
+	return m.OpenFile(filename, os.O_RDONLY, 0)
+}
+
+// OpenFile is equivalent to standard os.OpenFile.
+// If flag os.O_CREATE is set, all parent directories will be created.
+func (m *Memory) OpenFile(filename string, flag int, perm os.FileMode) (fs.File, error) {
+	filename = clean(filename)
+	f, err := m.s.OpenFile(m.fullpath(filename), flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	return newHandle(filename, f, flag), nil
+}
+
+// Stat returns the FileInfo structure describing file.
+func (m *Memory) Stat(filename string) (fs.FileInfo, error) {
+	return m.s.Stat(m.fullpath(filename))
+}
+
+// ReadDir returns the filesystem info for all the archives under the specified
+// path, sorted by name.
+func (m *Memory) ReadDir(path string) ([]fs.FileInfo, error) {
+	return m.s.ReadDir(m.fullpath(path))
+}
+
+// TempFile creates a new file in dir with a name beginning with prefix, opened
+// for reading and writing.
+func (m *Memory) TempFile(dir, prefix string) (fs.File, error) {
+	for {
+		name := m.Join(clean(dir), fmt.Sprintf("%s%d", prefix, m.s.NextTemp()))
+		f, err := m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+
+		return f, err
+	}
+}
+
+// Rename moves a file or a directory, the parent directories of the
+// destination are created if needed.
+func (m *Memory) Rename(from, to string) error {
+	return m.s.Rename(m.fullpath(from), m.fullpath(to))
+}
+
+// Chtimes changes the modification time of a file, the access time is not
+// recorded.
+func (m *Memory) Chtimes(filename string, atime, mtime time.Time) error {
+	return m.s.Chtimes(m.fullpath(filename), mtime)
+}
+
+// Remove deletes a file or an empty directory.
+func (m *Memory) Remove(filename string) error {
+	return m.s.Remove(m.fullpath(filename))
+}
+
+// MkdirAll creates a directory and all its missing parents.
+func (m *Memory) MkdirAll(filename string, perm os.FileMode) error {
+	return m.s.MkdirAll(m.fullpath(filename), perm)
+}
+
+// Join joins the specified elements using the filesystem separator.
+func (m *Memory) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+// Dir returns a new Filesystem sharing the files with m, using as base the
+// given path
+func (m *Memory) Dir(p string) fs.Filesystem {
+	return &Memory{s: m.s, base: m.fullpath(p)}
+}
+
+// Base returns the base path of the filesystem
+func (m *Memory) Base() string {
+	return m.base
+}
+
+func (m *Memory) fullpath(filename string) string {
+	return path.Join(m.base, clean(filename))
+}
+
+// clean returns the given path relative to the root of the filesystem.
+func clean(filename string) string {
+	return strings.TrimPrefix(path.Clean(separator+filename), separator)
+}
+
+// storage holds the files and directories by absolute path.
+type storage struct {
+	m     sync.RWMutex
+	files map[string]*file
+	temp  int64
+}
+
+func newStorage() *storage {
+	return &storage{
+		files: map[string]*file{
+			separator: newDir(separator, 0755),
+		},
+	}
+}
+
+func (s *storage) OpenFile(p string, flag int, perm os.FileMode) (*file, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	f, ok := s.files[p]
+	if !ok {
+		if flag&os.O_CREATE == 0 {
+			return nil, &os.PathError{Op: "open", Path: p, Err: os.ErrNotExist}
+		}
+
+		if err := s.createParents(p); err != nil {
+			return nil, err
+		}
+
+		f = newFile(path.Base(p), perm)
+		s.add(p, f)
+		return f, nil
+	}
+
+	if flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0 {
+		return nil, &os.PathError{Op: "open", Path: p, Err: os.ErrExist}
+	}
+
+	if f.mode.IsDir() {
+		if isWritable(flag) {
+			return nil, &os.PathError{Op: "open", Path: p, Err: errIsDir}
+		}
+
+		return f, nil
+	}
+
+	if flag&os.O_TRUNC != 0 && isWritable(flag) {
+		f.Truncate()
+	}
+
+	return f, nil
+}
+
+func (s *storage) Stat(p string) (fs.FileInfo, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	f, ok := s.files[p]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: p, Err: os.ErrNotExist}
+	}
+
+	return f.Stat(), nil
+}
+
+func (s *storage) Chtimes(p string, mtime time.Time) error {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	f, ok := s.files[p]
+	if !ok {
+		return &os.PathError{Op: "chtimes", Path: p, Err: os.ErrNotExist}
+	}
+
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	f.modTime = mtime
+	return nil
+}
+
+func (s *storage) ReadDir(p string) ([]fs.FileInfo, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	f, ok := s.files[p]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: p, Err: os.ErrNotExist}
+	}
+
+	if !f.mode.IsDir() {
+		return nil, &os.PathError{Op: "readdirent", Path: p, Err: errNotDir}
+	}
+
+	children := s.children(p)
+	sort.Strings(children)
+
+	infos := make([]fs.FileInfo, len(children))
+	for i, child := range children {
+		infos[i] = s.files[child].Stat()
+	}
+
+	return infos, nil
+}
+
+func (s *storage) Rename(from, to string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	f, ok := s.files[from]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: from, New: to, Err: os.ErrNotExist}
+	}
+
+	if from == to {
+		return nil
+	}
+
+	if target, ok := s.files[to]; ok && target.mode.IsDir() {
+		return &os.LinkError{Op: "rename", Old: from, New: to, Err: errIsDir}
+	}
+
+	if f.mode.IsDir() && strings.HasPrefix(to, from+separator) {
+		return &os.LinkError{Op: "rename", Old: from, New: to, Err: os.ErrInvalid}
+	}
+
+	if err := s.createParents(to); err != nil {
+		return err
+	}
+
+	if f.mode.IsDir() {
+		for _, child := range s.descendants(from) {
+			s.files[to+strings.TrimPrefix(child, from)] = s.files[child]
+			delete(s.files, child)
+		}
+	}
+
+	s.remove(from)
+	f.name = path.Base(to)
+	s.add(to, f)
+	return nil
+}
+
+func (s *storage) Remove(p string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	f, ok := s.files[p]
+	if !ok || p == separator {
+		return &os.PathError{Op: "remove", Path: p, Err: os.ErrNotExist}
+	}
+
+	if f.mode.IsDir() && len(s.children(p)) != 0 {
+		return &os.PathError{Op: "remove", Path: p, Err: errNotEmpty}
+	}
+
+	s.remove(p)
+	return nil
+}
+
+func (s *storage) MkdirAll(p string, perm os.FileMode) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if f, ok := s.files[p]; ok {
+		if !f.mode.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: p, Err: errNotDir}
+		}
+
+		return nil
+	}
+
+	if err := s.createParents(p); err != nil {
+		return err
+	}
+
+	s.add(p, newDir(path.Base(p), perm))
+	return nil
+}
+
+// NextTemp returns a number used to name a temporary file.
+func (s *storage) NextTemp() int64 {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.temp++
+	return s.temp
+}
+
+// createParents creates the missing parent directories of the given path.
+func (s *storage) createParents(p string) error {
+	dir := path.Dir(p)
+	if f, ok := s.files[dir]; ok {
+		if !f.mode.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: dir, Err: errNotDir}
+		}
+
+		return nil
+	}
+
+	if err := s.createParents(dir); err != nil {
+		return err
+	}
+
+	s.add(dir, newDir(path.Base(dir), 0755))
+	return nil
+}
+
+// add stores a file and updates the modification time of its parent.
+func (s *storage) add(p string, f *file) {
+	s.files[p] = f
+	s.files[path.Dir(p)].Touch()
+}
+
+// remove deletes a file and updates the modification time of its parent.
+func (s *storage) remove(p string) {
+	delete(s.files, p)
+	if parent, ok := s.files[path.Dir(p)]; ok {
+		parent.Touch()
+	}
+}
+
+// children returns the paths of the direct children of the directory p.
+func (s *storage) children(p string) []string {
+	var children []string
+	for child := range s.files {
+		if child != p && path.Dir(child) == p {
+			children = append(children, child)
+		}
+	}
+
+	return children
+}
+
+// descendants returns the paths of all the files under the directory p.
+func (s *storage) descendants(p string) []string {
+	var descendants []string
+	for child := range s.files {
+		if strings.HasPrefix(child, p+separator) {
+			descendants = append(descendants, child)
+		}
+	}
+
+	return descendants
+}
+
+// file is a file or a directory, its content is shared by all its handles.
+type file struct {
+	m       sync.RWMutex
+	name    string
+	mode    os.FileMode
+	modTime time.Time
+	content []byte
+}
+
+func newFile(name string, perm os.FileMode) *file {
+	return &file{name: name, mode: perm &^ os.ModeType, modTime: time.Now()}
+}
+
+func newDir(name string, perm os.FileMode) *file {
+	return &file{name: name, mode: os.ModeDir | perm.Perm(), modTime: time.Now()}
+}
+
+// Touch updates the modification time of the file.
+func (f *file) Touch() {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	f.modTime = time.Now()
+}
+
+// Truncate removes the content of the file.
+func (f *file) Truncate() {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	f.content = nil
+	f.modTime = time.Now()
+}
+
+func (f *file) Size() int64 {
+	f.m.RLock()
+	defer f.m.RUnlock()
+
+	return int64(len(f.content))
+}
+
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	f.m.RLock()
+	defer f.m.RUnlock()
+
+	if off >= int64(len(f.content)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, f.content[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+func (f *file) WriteAt(p []byte, off int64) int {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if end := off + int64(len(p)); end > int64(len(f.content)) {
+		content := make([]byte, end)
+		copy(content, f.content)
+		f.content = content
+	}
+
+	f.modTime = time.Now()
+	return copy(f.content[off:], p)
+}
+
+func (f *file) Stat() fs.FileInfo {
+	f.m.RLock()
+	defer f.m.RUnlock()
+
+	return &fileInfo{
+		name:    f.name,
+		size:    int64(len(f.content)),
+		mode:    f.mode,
+		modTime: f.modTime,
+	}
+}
+
+// handle is an open file, with its own position and mode.
+type handle struct {
+	fs.BaseFile
+
+	f        *file
+	position int64
+	flag     int
+}
+
+func newHandle(filename string, f *file, flag int) *handle {
+	return &handle{
+		BaseFile: fs.BaseFile{BaseFilename: filename},
+		f:        f,
+		flag:     flag,
+	}
+}
+
+func (h *handle) Read(p []byte) (int, error) {
+	n, err := h.ReadAt(p, h.position)
+	h.position += int64(n)
+
+	if err == io.EOF && n != 0 {
+		return n, nil
+	}
+
+	return n, err
+}
+
+func (h *handle) ReadAt(p []byte, off int64) (int, error) {
+	if h.IsClosed() {
+		return 0, fs.ErrClosed
+	}
+
+	if !isReadable(h.flag) {
+		return 0, errNotReadable
+	}
+
+	if h.f.mode.IsDir() {
+		return 0, errIsDir
+	}
+
+	return h.f.ReadAt(p, off)
+}
+
+func (h *handle) Write(p []byte) (int, error) {
+	if h.IsClosed() {
+		return 0, fs.ErrClosed
+	}
+
+	if !isWritable(h.flag) {
+		return 0, errNotWritable
+	}
+
+	if h.flag&os.O_APPEND != 0 {
+		h.position = h.f.Size()
+	}
+
+	n := h.f.WriteAt(p, h.position)
+	h.position += int64(n)
+	return n, nil
+}
+
+func (h *handle) Seek(offset int64, whence int) (int64, error) {
+	if h.IsClosed() {
+		return 0, fs.ErrClosed
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += h.position
+	case io.SeekEnd:
+		offset += h.f.Size()
+	default:
+		return h.position, os.ErrInvalid
+	}
+
+	if offset < 0 {
+		return h.position, os.ErrInvalid
+	}
+
+	h.position = offset
+	return h.position, nil
+}
+
+func (h *handle) Close() error {
+	if h.IsClosed() {
+		return fs.ErrClosed
+	}
+
+	h.Closed = true
+	return nil
+}
+
+func isReadable(flag int) bool {
+	return flag&(os.O_WRONLY|os.O_RDWR) != os.O_WRONLY
+}
+
+func isWritable(flag int) bool {
+	return flag&(os.O_WRONLY|os.O_RDWR) != os.O_RDONLY
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() interface{}   { return nil }
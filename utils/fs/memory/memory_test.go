@@ -0,0 +1,113 @@
+package memory_test
+
+import (
+	"io/ioutil"
+	stdos "os"
+	"testing"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git.v4/utils/fs/memory"
+	"gopkg.in/src-d/go-git.v4/utils/fs/test"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type MemorySuite struct {
+	test.FilesystemSuite
+}
+
+var _ = Suite(&MemorySuite{})
+
+func (s *MemorySuite) SetUpTest(c *C) {
+	s.FilesystemSuite.Fs = memory.New()
+}
+
+func (s *MemorySuite) TestOpenNotExists(c *C) {
+	_, err := s.Fs.Open("foo")
+	c.Assert(stdos.IsNotExist(err), Equals, true)
+
+	_, err = s.Fs.Stat("foo")
+	c.Assert(stdos.IsNotExist(err), Equals, true)
+
+	_, err = s.Fs.ReadDir("foo")
+	c.Assert(stdos.IsNotExist(err), Equals, true)
+}
+
+func (s *MemorySuite) TestOpenFileExcl(c *C) {
+	f, err := s.Fs.OpenFile("foo", stdos.O_RDWR|stdos.O_CREATE|stdos.O_EXCL, 0666)
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	_, err = s.Fs.OpenFile("foo", stdos.O_RDWR|stdos.O_CREATE|stdos.O_EXCL, 0666)
+	c.Assert(stdos.IsExist(err), Equals, true)
+}
+
+func (s *MemorySuite) TestReadOnlyWrite(c *C) {
+	f, err := s.Fs.Create("foo")
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	f, err = s.Fs.Open("foo")
+	c.Assert(err, IsNil)
+
+	_, err = f.Write([]byte("foo"))
+	c.Assert(err, NotNil)
+	c.Assert(f.Close(), IsNil)
+}
+
+func (s *MemorySuite) TestSharedContent(c *C) {
+	w, err := s.Fs.Create("foo")
+	c.Assert(err, IsNil)
+	_, err = w.Write([]byte("foo"))
+	c.Assert(err, IsNil)
+
+	// the content is visible before the writer is closed
+	r, err := s.Fs.Open("foo")
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "foo")
+
+	c.Assert(r.Close(), IsNil)
+	c.Assert(w.Close(), IsNil)
+}
+
+func (s *MemorySuite) TestRemoveNonEmptyDir(c *C) {
+	f, err := s.Fs.Create("foo/bar")
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	c.Assert(s.Fs.Remove("foo"), NotNil)
+	c.Assert(s.Fs.Remove("foo/bar"), IsNil)
+	c.Assert(s.Fs.Remove("foo"), IsNil)
+
+	fis, err := s.Fs.ReadDir("/")
+	c.Assert(err, IsNil)
+	c.Assert(fis, HasLen, 0)
+}
+
+func (s *MemorySuite) TestRenameDir(c *C) {
+	f, err := s.Fs.Create("foo/bar/qux")
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	c.Assert(s.Fs.Rename("foo", "baz/foo"), IsNil)
+
+	_, err = s.Fs.Stat("foo")
+	c.Assert(stdos.IsNotExist(err), Equals, true)
+
+	fi, err := s.Fs.Stat("baz/foo/bar/qux")
+	c.Assert(err, IsNil)
+	c.Assert(fi.Name(), Equals, "qux")
+}
+
+func (s *MemorySuite) TestDirShared(c *C) {
+	f, err := s.Fs.Dir("foo").Create("bar")
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	fi, err := s.Fs.Stat("foo/bar")
+	c.Assert(err, IsNil)
+	c.Assert(fi.IsDir(), Equals, false)
+	c.Assert(s.Fs.Dir("foo").Base(), Equals, "/foo")
+}
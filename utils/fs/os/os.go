@@ -5,6 +5,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/src-d/go-git.v4/utils/fs"
 )
@@ -32,7 +33,7 @@ func (fs *OS) Create(filename string) (fs.File, error) {
 func (fs *OS) OpenFile(filename string, flag int, perm os.FileMode) (fs.File, error) {
 	fullpath := path.Join(fs.base, filename)
 
-	if flag|os.O_CREATE != 0 {
+	if flag&os.O_CREATE != 0 {
 		if err := fs.createDir(fullpath); err != nil {
 			return nil, err
 		}
@@ -102,6 +103,12 @@ func (fs *OS) Stat(filename string) (fs.FileInfo, error) {
 	return os.Stat(fullpath)
 }
 
+// Chtimes changes the access and modification times of a file.
+func (fs *OS) Chtimes(filename string, atime, mtime time.Time) error {
+	fullpath := fs.Join(fs.base, filename)
+	return os.Chtimes(fullpath, atime, mtime)
+}
+
 func (fs *OS) Remove(filename string) error {
 	fullpath := fs.Join(fs.base, filename)
 	return os.Remove(fullpath)
@@ -131,6 +138,11 @@ func (fs *OS) TempFile(dir, prefix string) (fs.File, error) {
 	return newOSFile(filename, f), nil
 }
 
+// MkdirAll creates a directory and all its missing parents.
+func (fs *OS) MkdirAll(filename string, perm os.FileMode) error {
+	return os.MkdirAll(fs.Join(fs.base, filename), perm)
+}
+
 // Join joins the specified elements using the filesystem separator.
 func (fs *OS) Join(elem ...string) string {
 	return filepath.Join(elem...)
@@ -181,3 +193,8 @@ func (f *osFile) Close() error {
 func (f *osFile) ReadAt(p []byte, off int64) (n int, err error) {
 	return f.file.ReadAt(p, off)
 }
+
+// Fd returns the file descriptor of the underlying os file
+func (f *osFile) Fd() uintptr {
+	return f.file.Fd()
+}
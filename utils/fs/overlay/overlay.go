@@ -0,0 +1,377 @@
+// Package overlay is a copy-on-write fs.Filesystem combining a read-only
+// lower layer with a writable upper one
+package overlay
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/utils/fs"
+)
+
+var errNotEmpty = errors.New("directory not empty")
+
+// Overlay is a copy-on-write filesystem, the files are read from the upper
+// layer and then from the lower one, and every change is made in the upper
+// layer, so the lower layer is never modified. The files of the lower layer
+// are copied to the upper one when they are opened for writing, and the
+// removed ones are hidden.
+//
+// The removed files are only recorded in memory, by the Overlay and the
+// filesystems returned by Dir, so they are visible again in a new Overlay
+// over the same layers. Renaming the directories of the lower layer is not
+// supported.
+type Overlay struct {
+	lower fs.Filesystem
+	upper fs.Filesystem
+	s     *state
+	base  string
+}
+
+// state is shared by an Overlay and the filesystems returned by Dir.
+type state struct {
+	m       sync.RWMutex
+	removed map[string]bool
+}
+
+// New returns a new Overlay, lower is only read and every change is written
+// to upper.
+func New(lower, upper fs.Filesystem) *Overlay {
+	return &Overlay{
+		lower: lower,
+		upper: upper,
+		s:     &state{removed: make(map[string]bool, 0)},
+	}
+}
+
+// Create creates a file and opens it with standard permissions
+// and modes O_RDWR, O_CREATE and O_TRUNC.
+func (o *Overlay) Create(filename string) (fs.File, error) {
+	return o.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// Open opens a file in read-only mode.
+func (o *Overlay) Open(filename string) (fs.File, error) {
+	return o.OpenFile(filename, os.O_RDONLY, 0)
+}
+
+// OpenFile opens a file of the upper layer, or of the lower layer if it's
+// opened in read-only mode. If the file is opened for writing and it's only
+// found in the lower layer, it's copied to the upper layer first.
+func (o *Overlay) OpenFile(filename string, flag int, perm os.FileMode) (fs.File, error) {
+	if flag == os.O_RDONLY {
+		o.s.m.RLock()
+		defer o.s.m.RUnlock()
+
+		f, err := o.upper.OpenFile(filename, flag, perm)
+		if !os.IsNotExist(err) {
+			return f, err
+		}
+
+		if o.isRemoved(filename) {
+			return nil, notExist("open", filename)
+		}
+
+		return o.lower.OpenFile(filename, flag, perm)
+	}
+
+	o.s.m.Lock()
+	defer o.s.m.Unlock()
+
+	if err := o.copyUpForWrite(filename, flag); err != nil {
+		return nil, err
+	}
+
+	return o.upper.OpenFile(filename, flag, perm)
+}
+
+// copyUpForWrite copies a file from the lower layer to the upper one, if
+// needed to open it with the given flags.
+func (o *Overlay) copyUpForWrite(filename string, flag int) error {
+	if _, err := o.upper.Stat(filename); !os.IsNotExist(err) {
+		return err
+	}
+
+	fi, err := o.lowerStat(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0 {
+		return &os.PathError{Op: "open", Path: filename, Err: os.ErrExist}
+	}
+
+	if fi.IsDir() {
+		return &os.PathError{Op: "open", Path: filename, Err: fs.ErrNotSupported}
+	}
+
+	if flag&os.O_TRUNC != 0 {
+		return nil
+	}
+
+	return o.copyUp(filename, fi.Mode())
+}
+
+// copyUp copies a file from the lower layer to the upper one.
+func (o *Overlay) copyUp(filename string, mode os.FileMode) (err error) {
+	src, err := o.lower.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := o.upper.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if cerr := dst.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// Stat returns the FileInfo structure describing file.
+func (o *Overlay) Stat(filename string) (fs.FileInfo, error) {
+	o.s.m.RLock()
+	defer o.s.m.RUnlock()
+
+	fi, err := o.upper.Stat(filename)
+	if !os.IsNotExist(err) {
+		return fi, err
+	}
+
+	return o.lowerStat(filename)
+}
+
+// ReadDir returns the filesystem info for all the archives under the specified
+// path in both layers, sorted by name.
+func (o *Overlay) ReadDir(path string) ([]fs.FileInfo, error) {
+	o.s.m.RLock()
+	defer o.s.m.RUnlock()
+
+	return o.readDir(path)
+}
+
+func (o *Overlay) readDir(path string) ([]fs.FileInfo, error) {
+	upper, err := o.upper.ReadDir(path)
+	upperFound := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var lower []fs.FileInfo
+	if !o.isRemoved(path) {
+		lower, err = o.lower.ReadDir(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	if !upperFound && err != nil {
+		return nil, err
+	}
+
+	infos := make(map[string]fs.FileInfo, len(upper)+len(lower))
+	for _, fi := range lower {
+		if !o.isRemoved(o.upper.Join(path, fi.Name())) {
+			infos[fi.Name()] = fi
+		}
+	}
+
+	for _, fi := range upper {
+		infos[fi.Name()] = fi
+	}
+
+	names := make([]string, 0, len(infos))
+	for name := range infos {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	result := make([]fs.FileInfo, len(names))
+	for i, name := range names {
+		result[i] = infos[name]
+	}
+
+	return result, nil
+}
+
+// TempFile creates a new temporary file in the upper layer.
+func (o *Overlay) TempFile(dir, prefix string) (fs.File, error) {
+	return o.upper.TempFile(dir, prefix)
+}
+
+// Rename moves a file, the files of the lower layer are copied to the upper
+// layer first and then hidden.
+func (o *Overlay) Rename(from, to string) error {
+	o.s.m.Lock()
+	defer o.s.m.Unlock()
+
+	fi, err := o.lowerStat(from)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	case fi.IsDir():
+		return &os.LinkError{Op: "rename", Old: from, New: to, Err: fs.ErrNotSupported}
+	default:
+		if err := o.copyUpForWrite(from, os.O_RDWR); err != nil {
+			return err
+		}
+	}
+
+	if err := o.upper.Rename(from, to); err != nil {
+		return err
+	}
+
+	if fi != nil {
+		o.s.removed[o.key(from)] = true
+	}
+
+	return nil
+}
+
+// Chtimes changes the access and modification times of a file, the files of
+// the lower layer are copied to the upper layer first. It fails with
+// fs.ErrNotSupported if the upper layer can't change them.
+func (o *Overlay) Chtimes(filename string, atime, mtime time.Time) error {
+	upper, ok := o.upper.(fs.ChtimesFilesystem)
+	if !ok {
+		return fs.ErrNotSupported
+	}
+
+	o.s.m.Lock()
+	defer o.s.m.Unlock()
+
+	if err := o.copyUpForWrite(filename, os.O_RDWR); err != nil {
+		return err
+	}
+
+	return upper.Chtimes(filename, atime, mtime)
+}
+
+// Remove deletes a file or an empty directory from the upper layer and hides
+// it from the lower layer.
+func (o *Overlay) Remove(filename string) error {
+	o.s.m.Lock()
+	defer o.s.m.Unlock()
+
+	upper, err := o.upper.Stat(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	lower, err := o.lowerStat(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if upper == nil && lower == nil {
+		return notExist("remove", filename)
+	}
+
+	if (upper != nil && upper.IsDir()) || (lower != nil && lower.IsDir()) {
+		infos, err := o.readDir(filename)
+		if err != nil {
+			return err
+		}
+
+		if len(infos) != 0 {
+			return &os.PathError{Op: "remove", Path: filename, Err: errNotEmpty}
+		}
+	}
+
+	if upper != nil {
+		if err := o.upper.Remove(filename); err != nil {
+			return err
+		}
+	}
+
+	if lower != nil {
+		o.s.removed[o.key(filename)] = true
+	}
+
+	return nil
+}
+
+// MkdirAll creates a directory and all its missing parents in the upper layer.
+func (o *Overlay) MkdirAll(filename string, perm os.FileMode) error {
+	o.s.m.Lock()
+	defer o.s.m.Unlock()
+
+	fi, err := o.lowerStat(filename)
+	if err == nil && !fi.IsDir() {
+		return &os.PathError{Op: "mkdir", Path: filename, Err: os.ErrExist}
+	}
+
+	return o.upper.MkdirAll(filename, perm)
+}
+
+// Join joins the specified elements using the filesystem separator.
+func (o *Overlay) Join(elem ...string) string {
+	return o.upper.Join(elem...)
+}
+
+// Dir returns a new Overlay over the given path of both layers, sharing the
+// removed files with o.
+func (o *Overlay) Dir(p string) fs.Filesystem {
+	return &Overlay{
+		lower: o.lower.Dir(p),
+		upper: o.upper.Dir(p),
+		s:     o.s,
+		base:  o.key(p),
+	}
+}
+
+// Base returns the base path of the upper layer
+func (o *Overlay) Base() string {
+	return o.upper.Base()
+}
+
+// lowerStat returns the FileInfo of a file of the lower layer, unless it was
+// removed.
+func (o *Overlay) lowerStat(filename string) (fs.FileInfo, error) {
+	if o.isRemoved(filename) {
+		return nil, notExist("stat", filename)
+	}
+
+	return o.lower.Stat(filename)
+}
+
+// isRemoved returns true if the file or any of its parents were removed from
+// the lower layer.
+func (o *Overlay) isRemoved(filename string) bool {
+	for k := o.key(filename); k != "" && k != "."; k = path.Dir(k) {
+		if o.s.removed[k] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// key returns the path of a file relative to the root Overlay.
+func (o *Overlay) key(filename string) string {
+	filename = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(filename)), "/")
+	return path.Join(o.base, filename)
+}
+
+func notExist(op, filename string) error {
+	return &os.PathError{Op: op, Path: filename, Err: os.ErrNotExist}
+}
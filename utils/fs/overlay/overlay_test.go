@@ -0,0 +1,147 @@
+package overlay
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4/utils/fs"
+	"gopkg.in/src-d/go-git.v4/utils/fs/memory"
+	"gopkg.in/src-d/go-git.v4/utils/fs/readonly"
+	"gopkg.in/src-d/go-git.v4/utils/fs/test"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type OverlaySuite struct {
+	test.FilesystemSuite
+	lower *memory.Memory
+	upper *memory.Memory
+}
+
+var _ = Suite(&OverlaySuite{})
+
+func (s *OverlaySuite) SetUpTest(c *C) {
+	s.lower = memory.New()
+	s.upper = memory.New()
+	s.FilesystemSuite.Fs = New(readonly.New(s.lower), s.upper)
+}
+
+func (s *OverlaySuite) TestReadLower(c *C) {
+	s.write(c, s.lower, "foo/bar", "lower")
+
+	s.assertContent(c, s.Fs, "foo/bar", "lower")
+	s.assertContent(c, s.Fs.Dir("foo"), "bar", "lower")
+}
+
+func (s *OverlaySuite) TestReadUpper(c *C) {
+	s.write(c, s.lower, "foo", "lower")
+	s.write(c, s.upper, "foo", "upper")
+
+	s.assertContent(c, s.Fs, "foo", "upper")
+}
+
+func (s *OverlaySuite) TestWriteCopyUp(c *C) {
+	s.write(c, s.lower, "foo", "lower")
+
+	f, err := s.Fs.OpenFile("foo", os.O_WRONLY|os.O_APPEND, 0)
+	c.Assert(err, IsNil)
+	_, err = f.Write([]byte("+upper"))
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	s.assertContent(c, s.Fs, "foo", "lower+upper")
+	s.assertContent(c, s.upper, "foo", "lower+upper")
+	s.assertContent(c, s.lower, "foo", "lower")
+}
+
+func (s *OverlaySuite) TestCreateExcl(c *C) {
+	s.write(c, s.lower, "foo", "lower")
+
+	_, err := s.Fs.OpenFile("foo", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	c.Assert(os.IsExist(err), Equals, true)
+}
+
+func (s *OverlaySuite) TestRemoveLower(c *C) {
+	s.write(c, s.lower, "foo/bar", "lower")
+
+	c.Assert(s.Fs.Remove("foo"), NotNil)
+	c.Assert(s.Fs.Remove("foo/bar"), IsNil)
+	c.Assert(s.Fs.Remove("foo"), IsNil)
+
+	_, err := s.Fs.Stat("foo/bar")
+	c.Assert(os.IsNotExist(err), Equals, true)
+	_, err = s.Fs.Open("foo/bar")
+	c.Assert(os.IsNotExist(err), Equals, true)
+	_, err = s.Fs.ReadDir("foo")
+	c.Assert(os.IsNotExist(err), Equals, true)
+	c.Assert(os.IsNotExist(s.Fs.Remove("foo")), Equals, true)
+
+	s.assertContent(c, s.lower, "foo/bar", "lower")
+
+	s.write(c, s.Fs, "foo/qux", "upper")
+	fis, err := s.Fs.ReadDir("foo")
+	c.Assert(err, IsNil)
+	c.Assert(fis, HasLen, 1)
+	c.Assert(fis[0].Name(), Equals, "qux")
+}
+
+func (s *OverlaySuite) TestRemoveDir(c *C) {
+	s.write(c, s.lower, "foo/bar", "lower")
+
+	c.Assert(s.Fs.Dir("foo").Remove("bar"), IsNil)
+
+	_, err := s.Fs.Stat("foo/bar")
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *OverlaySuite) TestReadDirMerged(c *C) {
+	s.write(c, s.lower, "foo/a", "lower")
+	s.write(c, s.lower, "foo/b", "lower")
+	s.write(c, s.upper, "foo/b", "upper")
+	s.write(c, s.upper, "foo/c", "upper")
+
+	fis, err := s.Fs.ReadDir("foo")
+	c.Assert(err, IsNil)
+	c.Assert(fis, HasLen, 3)
+	c.Assert(fis[0].Name(), Equals, "a")
+	c.Assert(fis[1].Name(), Equals, "b")
+	c.Assert(fis[1].Size(), Equals, int64(5))
+	c.Assert(fis[2].Name(), Equals, "c")
+}
+
+func (s *OverlaySuite) TestRenameLower(c *C) {
+	s.write(c, s.lower, "foo", "lower")
+
+	c.Assert(s.Fs.Rename("foo", "bar"), IsNil)
+
+	_, err := s.Fs.Stat("foo")
+	c.Assert(os.IsNotExist(err), Equals, true)
+	s.assertContent(c, s.Fs, "bar", "lower")
+	s.assertContent(c, s.lower, "foo", "lower")
+}
+
+func (s *OverlaySuite) TestRenameLowerDir(c *C) {
+	s.write(c, s.lower, "foo/bar", "lower")
+
+	c.Assert(s.Fs.Rename("foo", "qux"), NotNil)
+}
+
+func (s *OverlaySuite) write(c *C, fs fs.Filesystem, filename, content string) {
+	f, err := fs.Create(filename)
+	c.Assert(err, IsNil)
+	_, err = f.Write([]byte(content))
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+}
+
+func (s *OverlaySuite) assertContent(c *C, fs fs.Filesystem, filename, content string) {
+	f, err := fs.Open(filename)
+	c.Assert(err, IsNil)
+	read, err := ioutil.ReadAll(f)
+	c.Assert(err, IsNil)
+	c.Assert(string(read), Equals, content)
+	c.Assert(f.Close(), IsNil)
+}
@@ -0,0 +1,92 @@
+// Package readonly is a fs.Filesystem wrapper rejecting every change
+package readonly
+
+import (
+	"os"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/utils/fs"
+)
+
+// ReadOnly is a filesystem wrapper where every call that would change the
+// underlying filesystem fails with fs.ErrReadOnly.
+type ReadOnly struct {
+	fs fs.Filesystem
+}
+
+// New returns a read-only view of the given filesystem
+func New(fs fs.Filesystem) *ReadOnly {
+	return &ReadOnly{fs: fs}
+}
+
+// Create always fails with fs.ErrReadOnly.
+func (r *ReadOnly) Create(filename string) (fs.File, error) {
+	return nil, fs.ErrReadOnly
+}
+
+// Open opens a file in read-only mode.
+func (r *ReadOnly) Open(filename string) (fs.File, error) {
+	return r.fs.Open(filename)
+}
+
+// OpenFile opens a file in read-only mode, any flag other than os.O_RDONLY
+// fails with fs.ErrReadOnly. The files are returned as opened by the underlying
+// filesystem, since they can't be written.
+func (r *ReadOnly) OpenFile(filename string, flag int, perm os.FileMode) (fs.File, error) {
+	if flag != os.O_RDONLY {
+		return nil, fs.ErrReadOnly
+	}
+
+	return r.fs.OpenFile(filename, flag, perm)
+}
+
+// Stat returns the FileInfo structure describing file.
+func (r *ReadOnly) Stat(filename string) (fs.FileInfo, error) {
+	return r.fs.Stat(filename)
+}
+
+// ReadDir returns the filesystem info for all the archives under the specified
+// path.
+func (r *ReadOnly) ReadDir(path string) ([]fs.FileInfo, error) {
+	return r.fs.ReadDir(path)
+}
+
+// TempFile always fails with fs.ErrReadOnly.
+func (r *ReadOnly) TempFile(dir, prefix string) (fs.File, error) {
+	return nil, fs.ErrReadOnly
+}
+
+// Rename always fails with fs.ErrReadOnly.
+func (r *ReadOnly) Rename(from, to string) error {
+	return fs.ErrReadOnly
+}
+
+// Chtimes always fails with fs.ErrReadOnly.
+func (r *ReadOnly) Chtimes(filename string, atime, mtime time.Time) error {
+	return fs.ErrReadOnly
+}
+
+// Remove always fails with fs.ErrReadOnly.
+func (r *ReadOnly) Remove(filename string) error {
+	return fs.ErrReadOnly
+}
+
+// MkdirAll always fails with fs.ErrReadOnly.
+func (r *ReadOnly) MkdirAll(filename string, perm os.FileMode) error {
+	return fs.ErrReadOnly
+}
+
+// Join joins the specified elements using the filesystem separator.
+func (r *ReadOnly) Join(elem ...string) string {
+	return r.fs.Join(elem...)
+}
+
+// Dir returns a read-only view of the given path
+func (r *ReadOnly) Dir(path string) fs.Filesystem {
+	return New(r.fs.Dir(path))
+}
+
+// Base returns the base path of the underlying filesystem
+func (r *ReadOnly) Base() string {
+	return r.fs.Base()
+}
@@ -0,0 +1,78 @@
+package readonly
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/utils/fs"
+	"gopkg.in/src-d/go-git.v4/utils/fs/memory"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type ReadOnlySuite struct {
+	fs *ReadOnly
+}
+
+var _ = Suite(&ReadOnlySuite{})
+
+func (s *ReadOnlySuite) SetUpTest(c *C) {
+	m := memory.New()
+	f, err := m.Create("foo/bar")
+	c.Assert(err, IsNil)
+	_, err = f.Write([]byte("bar"))
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	s.fs = New(m)
+}
+
+func (s *ReadOnlySuite) TestRead(c *C) {
+	f, err := s.fs.Open("foo/bar")
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadAll(f)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "bar")
+	c.Assert(f.Close(), IsNil)
+
+	fi, err := s.fs.Stat("foo/bar")
+	c.Assert(err, IsNil)
+	c.Assert(fi.Size(), Equals, int64(3))
+
+	fis, err := s.fs.ReadDir("foo")
+	c.Assert(err, IsNil)
+	c.Assert(fis, HasLen, 1)
+}
+
+func (s *ReadOnlySuite) TestWrite(c *C) {
+	_, err := s.fs.Create("qux")
+	c.Assert(err, Equals, fs.ErrReadOnly)
+
+	_, err = s.fs.OpenFile("foo/bar", os.O_RDWR, 0)
+	c.Assert(err, Equals, fs.ErrReadOnly)
+
+	_, err = s.fs.OpenFile("foo/bar", os.O_WRONLY|os.O_APPEND, 0)
+	c.Assert(err, Equals, fs.ErrReadOnly)
+
+	_, err = s.fs.TempFile("foo", "qux")
+	c.Assert(err, Equals, fs.ErrReadOnly)
+
+	c.Assert(s.fs.Rename("foo/bar", "qux"), Equals, fs.ErrReadOnly)
+	c.Assert(s.fs.Remove("foo/bar"), Equals, fs.ErrReadOnly)
+	c.Assert(s.fs.Chtimes("foo/bar", time.Now(), time.Now()), Equals, fs.ErrReadOnly)
+
+	_, err = s.fs.Stat("foo/bar")
+	c.Assert(err, IsNil)
+}
+
+func (s *ReadOnlySuite) TestDir(c *C) {
+	dir := s.fs.Dir("foo")
+
+	_, err := dir.Stat("bar")
+	c.Assert(err, IsNil)
+	c.Assert(dir.Remove("bar"), Equals, fs.ErrReadOnly)
+}
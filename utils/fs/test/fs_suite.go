@@ -6,6 +6,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	. "gopkg.in/check.v1"
 	. "gopkg.in/src-d/go-git.v4/utils/fs"
@@ -306,6 +307,47 @@ func (s *FilesystemSuite) TestRemoveTempFile(c *C) {
 	c.Assert(s.Fs.Remove(fn), IsNil)
 }
 
+func (s *FilesystemSuite) TestMkdirAll(c *C) {
+	err := s.Fs.MkdirAll("foo/bar", 0755)
+	c.Assert(err, IsNil)
+
+	fi, err := s.Fs.Stat("foo/bar")
+	c.Assert(err, IsNil)
+	c.Assert(fi.IsDir(), Equals, true)
+
+	fis, err := s.Fs.ReadDir("foo/bar")
+	c.Assert(err, IsNil)
+	c.Assert(fis, HasLen, 0)
+
+	c.Assert(s.Fs.MkdirAll("foo/bar", 0755), IsNil)
+}
+
+func (s *FilesystemSuite) TestMkdirAllOverFile(c *C) {
+	f, err := s.Fs.Create("foo")
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	c.Assert(s.Fs.MkdirAll("foo", 0755), NotNil)
+}
+
+func (s *FilesystemSuite) TestChtimes(c *C) {
+	fs, ok := s.Fs.(ChtimesFilesystem)
+	c.Assert(ok, Equals, true)
+
+	f, err := s.Fs.Create("foo")
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	t := time.Unix(1257894000, 0)
+	c.Assert(fs.Chtimes("foo", t, t), IsNil)
+
+	fi, err := s.Fs.Stat("foo")
+	c.Assert(err, IsNil)
+	c.Assert(fi.ModTime().Equal(t), Equals, true)
+
+	c.Assert(os.IsNotExist(fs.Chtimes("bar", t, t)), Equals, true)
+}
+
 func (s *FilesystemSuite) TestJoin(c *C) {
 	c.Assert(s.Fs.Join("foo", "bar"), Equals, "foo/bar")
 }